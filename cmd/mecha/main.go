@@ -1,18 +1,57 @@
 package main
 
 import (
+	"bytes"
 	"flag"
 	"fmt"
+	"mechanus-compiler/internal/asmgen"
+	"mechanus-compiler/internal/ast"
+	"mechanus-compiler/internal/bytecode"
+	"mechanus-compiler/internal/cgen"
 	"mechanus-compiler/internal/compiler_error"
+	"mechanus-compiler/internal/format"
+	"mechanus-compiler/internal/interpreter"
+	"mechanus-compiler/internal/ir"
+	"mechanus-compiler/internal/llvmgen"
 	logger2 "mechanus-compiler/internal/logger"
+	"mechanus-compiler/internal/lsp"
 	"mechanus-compiler/internal/parser"
+	"mechanus-compiler/internal/semantic"
+	"mechanus-compiler/internal/vm"
+	"mechanus-compiler/internal/wasmgen"
+	"mechanus-compiler/internal/wat"
 	"os"
 )
 
 var debug bool = false
+var emit string = ""
+var maxErrors int = parser.DefaultMaxErrors
+var diagnosticsFormat string = compiler_error.FormatText
 var logger = logger2.New(os.Stderr, logger2.LevelDebug)
 
 func main() {
+	// Subcommands are given before any flag, as in "mecha run file.mecha"
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "run":
+			os.Exit(run(os.Args[2:]))
+		case "exec":
+			os.Exit(execute(os.Args[2:]))
+		case "disasm":
+			os.Exit(disassemble(os.Args[2:]))
+		case "lsp":
+			os.Exit(serve(os.Args[2:]))
+		case "fmt":
+			os.Exit(formatSources(os.Args[2:]))
+		}
+	}
+
+	compile()
+}
+
+// compile :
+// Checks the source file given by -i and writes the code generated for the -emit target to the -o file.
+func compile() {
 	// Collect source and output files
 	sourceFile, outputFile, err := getFiles()
 	errSalt := "main"
@@ -31,16 +70,366 @@ func main() {
 		}
 	}()
 
-	// Initialize the parser
-	parser, err := parser.NewParser(sourceFile, outputFile, debug)
+	// Run the syntax and semantic analyses
+	construct, info, err := analyze(sourceFile, false)
+	if err != nil {
+		os.Exit(1)
+	}
+	if diagnosticsFormat == compiler_error.FormatSARIF {
+		// CI expects a SARIF log from every build, even a clean one
+		printDiagnostics(sourceFile.Name(), nil)
+	}
 
+	// Generate code for the requested target, if any
+	if emit == "" {
+		return
+	}
+	code, err := generate(construct, info)
 	if err != nil {
 		os.Exit(1)
 	}
+	if _, err = outputFile.WriteString(code); err != nil {
+		err = compiler_error.FileErrorf(errSalt, err)
+		logger.Error(err, nil)
+		os.Exit(1)
+	}
+}
+
+// run :
+// Implements "mecha run [-d] [-max-errors n] [-diagnostics-format f] file.mecha". Checks the source file and runs it
+// with the interpreter, returning the Gear integrated by the main Architect as the exit code.
+func run(args []string) int {
+	errSalt := "run"
+
+	flags := flag.NewFlagSet("run", flag.ExitOnError)
+	flags.BoolVar(&debug, "d", false, "Debug mode")
+	flags.IntVar(&maxErrors, "max-errors", parser.DefaultMaxErrors, "Stop after this many syntax errors, 0 for no limit")
+	flags.StringVar(&diagnosticsFormat, "diagnostics-format", compiler_error.FormatText, diagnosticsFormatUsage)
+	_ = flags.Parse(args)
+
+	if err := checkDiagnosticsFormat(errSalt); err != nil {
+		return 1
+	}
+
+	if flags.NArg() != 1 {
+		err := compiler_error.FileErrorf(errSalt, fmt.Errorf(compiler_error.NoSourceFile))
+		logger.Error(err, nil)
+		return 1
+	}
+
+	sourceFile, err := os.Open(flags.Arg(0))
+	if err != nil {
+		err = compiler_error.FileErrorf(errSalt, err)
+		logger.Error(err, nil)
+		return 1
+	}
+	defer func() {
+		if err := sourceFile.Close(); err != nil {
+			err = compiler_error.FileErrorf(errSalt, err)
+			logger.Error(err, nil)
+		}
+	}()
+
+	// Only the program speaks on a successful run
+	construct, info, err := analyze(sourceFile, true)
+	if err != nil {
+		return 1
+	}
+
+	interpreter := interpreter.NewInterpreter(info, os.Stdin, os.Stdout, debug)
+	exitCode, err := interpreter.Run(construct)
+	if err != nil {
+		printDiagnostics(sourceFile.Name(), err)
+		return 1
+	}
+	return int(exitCode)
+}
+
+// execute :
+// Implements "mecha exec [-d] [-diagnostics-format f] file.mechc". Loads a program written by "-emit bytecode" and
+// runs it with the VM, returning the Gear integrated by the main Architect as the exit code.
+func execute(args []string) int {
+	errSalt := "execute"
+
+	flags := flag.NewFlagSet("exec", flag.ExitOnError)
+	flags.BoolVar(&debug, "d", false, "Debug mode")
+	flags.StringVar(&diagnosticsFormat, "diagnostics-format", compiler_error.FormatText, diagnosticsFormatUsage)
+	_ = flags.Parse(args)
+
+	if err := checkDiagnosticsFormat(errSalt); err != nil {
+		return 1
+	}
+
+	program, err := loadBytecode(errSalt, flags)
+	if err != nil {
+		return 1
+	}
+
+	machine := vm.NewVM(program, os.Stdin, os.Stdout, debug)
+	exitCode, err := machine.Run()
+	if err != nil {
+		printDiagnostics(flags.Arg(0), err)
+		return 1
+	}
+	return int(exitCode)
+}
+
+// disassemble :
+// Implements "mecha disasm file.mechc". Prints a listing of a program written by "-emit bytecode".
+func disassemble(args []string) int {
+	flags := flag.NewFlagSet("disasm", flag.ExitOnError)
+	_ = flags.Parse(args)
+
+	program, err := loadBytecode("disassemble", flags)
+	if err != nil {
+		return 1
+	}
+
+	fmt.Print(bytecode.Disassemble(program))
+	return 0
+}
+
+// serve :
+// Implements "mecha lsp [-d]". Runs a Language Server Protocol server over stdin and stdout until the editor exits it.
+func serve(args []string) int {
+	flags := flag.NewFlagSet("lsp", flag.ExitOnError)
+	flags.BoolVar(&debug, "d", false, "Debug mode")
+	_ = flags.Parse(args)
+
+	server := lsp.NewServer(os.Stdin, os.Stdout, debug)
+	if err := server.Run(); err != nil {
+		return 1
+	}
+	return 0
+}
+
+// formatSources :
+// Implements "mecha fmt [-w] [-d] file.mecha...". Prints every source file in the canonical layout. With -w, files are
+// rewritten in place instead, and with -d, the changes are printed as a unified diff.
+func formatSources(args []string) int {
+	errSalt := "formatSources"
+
+	flags := flag.NewFlagSet("fmt", flag.ExitOnError)
+	write := flags.Bool("w", false, "Write the result to the source file instead of stdout")
+	diff := flags.Bool("d", false, "Print a diff of the changes instead of the formatted source")
+	_ = flags.Parse(args)
+
+	if flags.NArg() == 0 {
+		err := compiler_error.FileErrorf(errSalt, fmt.Errorf(compiler_error.NoSourceFile))
+		logger.Error(err, nil)
+		return 1
+	}
+
+	exitCode := 0
+	for _, path := range flags.Args() {
+		source, err := os.ReadFile(path)
+		if err != nil {
+			logger.Error(compiler_error.FileErrorf(errSalt, err), nil)
+			exitCode = 1
+			continue
+		}
+		formatted, err := formatSource(path)
+		if err != nil {
+			exitCode = 1
+			continue
+		}
+
+		if *diff {
+			fmt.Print(format.Diff(path, string(source), formatted))
+		}
+		if *write && formatted != string(source) {
+			info, err := os.Stat(path)
+			if err == nil {
+				err = os.WriteFile(path, []byte(formatted), info.Mode().Perm())
+			}
+			if err != nil {
+				logger.Error(compiler_error.FileErrorf(errSalt, err), nil)
+				exitCode = 1
+			}
+		}
+		if !*diff && !*write {
+			fmt.Print(formatted)
+		}
+	}
+	return exitCode
+}
+
+// formatSource :
+// Returns a source file in the canonical layout. Syntax errors are printed like in any other command.
+func formatSource(path string) (string, error) {
+	sourceFile, err := os.Open(path)
+	if err != nil {
+		err = compiler_error.FileErrorf("formatSource", err)
+		logger.Error(err, nil)
+		return "", err
+	}
+	defer sourceFile.Close()
+
+	formatter, err := format.NewFormatter(sourceFile, path, false)
+	if err != nil {
+		return "", err
+	}
+	formatted, err := formatter.Run()
+	if err != nil {
+		printDiagnostics(path, err)
+		return "", err
+	}
+	return formatted, nil
+}
+
+// loadBytecode :
+// Loads the .mechc file given as the only argument left in flags.
+func loadBytecode(errSalt string, flags *flag.FlagSet) (*bytecode.Program, error) {
+	if flags.NArg() != 1 {
+		err := compiler_error.FileErrorf(errSalt, fmt.Errorf(compiler_error.NoSourceFile))
+		logger.Error(err, nil)
+		return nil, err
+	}
+
+	file, err := os.Open(flags.Arg(0))
+	if err != nil {
+		err = compiler_error.FileErrorf(errSalt, err)
+		logger.Error(err, nil)
+		return nil, err
+	}
+	defer file.Close()
+
+	program, err := bytecode.Load(file)
+	if err != nil {
+		err = compiler_error.FileErrorf(errSalt, err)
+		logger.Error(err, nil)
+		return nil, err
+	}
+	return program, nil
+}
+
+// analyze :
+// Runs the syntax and semantic analyses over the source file. Errors are logged by the phase that found them, then
+// printed with the source they point at. When quiet, the phases that succeed only say so in debug mode.
+func analyze(sourceFile *os.File, quiet bool) (*ast.Construct, *semantic.Info, error) {
+	// Initialize the parser
+	parser, err := parser.NewParser(sourceFile, sourceFile.Name(), debug)
+	if err != nil {
+		return nil, nil, err
+	}
+	parser.SetMaxErrors(maxErrors)
+	parser.SetQuiet(quiet)
 
 	// Start the syntax analysis
-	if err = parser.Run(); err != nil {
-		os.Exit(1)
+	construct, err := parser.Run()
+	if err != nil {
+		printDiagnostics(sourceFile.Name(), err)
+		return nil, nil, err
+	}
+
+	// Start the semantic analysis
+	analyzer := semantic.NewAnalyzer(debug)
+	analyzer.SetQuiet(quiet)
+	info, err := analyzer.Run(construct)
+	if err != nil {
+		printDiagnostics(sourceFile.Name(), err)
+		return nil, nil, err
+	}
+
+	return construct, info, nil
+}
+
+// printDiagnostics :
+// Prints every Diagnostic found in err in the -diagnostics-format format. Text goes to stderr, quoting the lines of
+// the source file the diagnostics point at. JSON and SARIF go to stdout, so they can be piped into other tools: it is
+// free once the analysis fails, and a program that fails while running sends nothing after them.
+func printDiagnostics(path string, err error) {
+	diagnostics := compiler_error.Diagnostics(err)
+	for _, diagnostic := range diagnostics {
+		if diagnostic.File == "" {
+			diagnostic.File = path
+		}
+	}
+
+	if diagnosticsFormat != compiler_error.FormatText {
+		if err := compiler_error.WriteDiagnostics(os.Stdout, diagnosticsFormat, diagnostics); err != nil {
+			logger.Error(compiler_error.FileErrorf("printDiagnostics", err), nil)
+		}
+		return
+	}
+
+	source, readErr := os.ReadFile(path)
+	if readErr != nil {
+		logger.Error(compiler_error.FileErrorf("printDiagnostics", readErr), nil)
+	}
+	for _, diagnostic := range diagnostics {
+		fmt.Fprintln(os.Stderr, compiler_error.Render(diagnostic, string(source)))
+	}
+}
+
+// diagnosticsFormatUsage is the help of the -diagnostics-format flag.
+const diagnosticsFormatUsage = "Format of the errors found in the source file: text (stderr), json or sarif (stdout)"
+
+// checkDiagnosticsFormat :
+// Checks the value of the -diagnostics-format flag.
+func checkDiagnosticsFormat(errSalt string) error {
+	switch diagnosticsFormat {
+	case compiler_error.FormatText, compiler_error.FormatJSON, compiler_error.FormatSARIF:
+		return nil
+	default:
+		err := compiler_error.FileErrorf(errSalt,
+			fmt.Errorf("%s '%s'", compiler_error.UnknownDiagnosticsFormat, diagnosticsFormat))
+		logger.Error(err, nil)
+		return err
+	}
+}
+
+// generate :
+// Runs the backend selected by the -emit flag.
+func generate(construct *ast.Construct, info *semantic.Info) (string, error) {
+	switch emit {
+	case "c":
+		generator := cgen.NewGenerator(info, debug)
+		return generator.Run(construct)
+	case "asm":
+		generator := asmgen.NewGenerator(info, debug)
+		return generator.Run(construct)
+	case "llvm":
+		generator := llvmgen.NewGenerator(info, debug)
+		return generator.Run(construct)
+	case "wat":
+		generator := wasmgen.NewGenerator(info, debug)
+		return generator.Run(construct)
+	case "wasm":
+		generator := wasmgen.NewGenerator(info, debug)
+		text, err := generator.Run(construct)
+		if err != nil {
+			return "", err
+		}
+		module, err := wat.Assemble(text)
+		if err != nil {
+			err = compiler_error.CodegenErrorf("generate", err)
+			logger.Error(err, nil)
+			return "", err
+		}
+		return string(module), nil
+	case "ir":
+		builder := ir.NewBuilder(info, debug)
+		program, err := builder.Run(construct)
+		if err != nil {
+			return "", err
+		}
+		return program.String(), nil
+	case "bytecode":
+		compiler := bytecode.NewCompiler(info, debug)
+		program, err := compiler.Run(construct)
+		if err != nil {
+			return "", err
+		}
+		var encoded bytes.Buffer
+		if err := bytecode.Encode(program, &encoded); err != nil {
+			return "", err
+		}
+		return encoded.String(), nil
+	default:
+		err := compiler_error.CodegenErrorf("generate", fmt.Errorf("%s '%s'", compiler_error.UnknownEmit, emit))
+		logger.Error(err, nil)
+		return "", err
 	}
 }
 
@@ -77,10 +466,17 @@ func getFilePaths() ([]string, error) {
 	inputFile := flag.String("i", "", "Source file path")
 	outputFile := flag.String("o", "", "Output file path")
 	flag.BoolVar(&debug, "d", false, "Debug mode")
+	flag.StringVar(&emit, "emit", "", "Code generation target written to the output file: c, asm, llvm, wat, wasm, ir, bytecode")
+	flag.IntVar(&maxErrors, "max-errors", parser.DefaultMaxErrors, "Stop after this many syntax errors, 0 for no limit")
+	flag.StringVar(&diagnosticsFormat, "diagnostics-format", compiler_error.FormatText, diagnosticsFormatUsage)
 
 	// Parse command line arguments
 	flag.Parse()
 
+	if err := checkDiagnosticsFormat("getFilePaths"); err != nil {
+		return nil, err
+	}
+
 	// Check if required flags are provided
 	if *inputFile == "" {
 		err := compiler_error.FileErrorf("getFilePaths", fmt.Errorf(compiler_error.NoSourceFile))
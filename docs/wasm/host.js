@@ -0,0 +1,184 @@
+// Host for the WebAssembly modules written by "mecha -emit wasm".
+//
+// The module imports its Send and Receive functions from "mecha" and exports one function per Architect, along with
+// its memory as "_memory" and an allocator as "_alloc". This host feeds Receive from a string, collects everything
+// sent into another, and follows the rules of "mecha run":
+//   - Tensors are printed with six significant digits, like the "%g" of C.
+//   - Received lines lose their "\n" and "\r". Gears, States and Tensors may start with spaces or tabs.
+//   - Invalid input, division by zero and indexes outside of an Assembly stop the program with exit code 1.
+//   - The exit code is the Gear integrated by main, or 0 for any other type.
+//
+// Usage, in a browser or in Node:
+//   import { run } from "./host.js";
+//   const bytes = await (await fetch("program.wasm")).arrayBuffer();
+//   const { output, error, code } = await run(bytes, "5\n");
+
+const encoder = new TextEncoder();
+const decoder = new TextDecoder();
+
+const GEAR_MIN = -(2n ** 63n);
+const GEAR_MAX = 2n ** 63n - 1n;
+
+// MechaError is thrown to stop the program from inside a host function.
+class MechaError extends Error {}
+
+// run instantiates a module and calls its main Architect. It resolves to the text sent by the program, the message
+// of the error that stopped it, if any, and its exit code.
+export async function run(bytes, input = "") {
+  let output = "";
+  let memory = null;
+  let alloc = null;
+  const lines = input.split("\n");
+  let line = 0;
+
+  const send = (text) => {
+    output += text + "\n";
+  };
+  const receive = () => {
+    // Past the end of the input, every Receive gets an empty line
+    let text = line < lines.length ? lines[line++] : "";
+    if (text.endsWith("\r")) {
+      text = text.slice(0, -1);
+    }
+    return text;
+  };
+  const invalid = (type) => {
+    throw new MechaError(`invalid ${type} input`);
+  };
+  const readOmnidrone = (address) => {
+    const view = new DataView(memory.buffer);
+    const length = view.getUint32(address, true);
+    return decoder.decode(new Uint8Array(memory.buffer, address + 4, length));
+  };
+
+  const imports = {
+    mecha: {
+      send_gear: (value) => send(value.toString()),
+      send_state: (value) => send(value.toString()),
+      send_tensor: (value) => send(formatTensor(value)),
+      send_monodrone: (value) => send(String.fromCodePoint(value)),
+      send_omnidrone: (address) => send(readOmnidrone(address)),
+      send_switch: (value) => send(value ? "true" : "false"),
+      send_nil: () => send("Nil"),
+      receive_gear: () => parseGear(receive()) ?? invalid("Gear"),
+      receive_state: () => parseGear(receive()) ?? invalid("State"),
+      receive_tensor: () => parseTensor(receive()) ?? invalid("Tensor"),
+      receive_monodrone: () => parseMonodrone(receive()) ?? invalid("Monodrone"),
+      receive_omnidrone: () => {
+        const text = encoder.encode(receive());
+        const address = alloc(4 + text.length);
+        new DataView(memory.buffer).setUint32(address, text.length, true);
+        new Uint8Array(memory.buffer, address + 4, text.length).set(text);
+        return address;
+      },
+      fail: (address) => {
+        throw new MechaError(readOmnidrone(address));
+      },
+    },
+  };
+
+  const { instance } = await WebAssembly.instantiate(bytes, imports);
+  memory = instance.exports._memory;
+  alloc = instance.exports._alloc;
+
+  try {
+    const result = instance.exports.main();
+    // Only a Gear result is a BigInt; BigInt.asIntN keeps the low 32 bits like the exit code of a process
+    const code = typeof result === "bigint" ? Number(BigInt.asIntN(32, result)) : 0;
+    return { output, error: null, code };
+  } catch (error) {
+    if (error instanceof MechaError) {
+      return { output, error: error.message, code: 1 };
+    }
+    throw error;
+  }
+}
+
+// formatTensor prints a Tensor like "%g": six significant digits without trailing zeros, in exponent form when the
+// exponent is below -4 or at least 6. Ties are rounded to even on the exact value of the Tensor.
+export function formatTensor(value) {
+  if (Number.isNaN(value)) {
+    return "nan";
+  }
+  if (!Number.isFinite(value)) {
+    return value > 0 ? "inf" : "-inf";
+  }
+  if (value === 0) {
+    return Object.is(value, -0) ? "-0" : "0";
+  }
+
+  const sign = value < 0 ? "-" : "";
+  let [digits, exponent] = roundDigits(Math.abs(value));
+
+  let text;
+  if (exponent < -4 || exponent >= 6) {
+    const mantissa = digits.length > 1 ? digits[0] + "." + digits.slice(1) : digits;
+    const power = Math.abs(exponent).toString().padStart(2, "0");
+    text = `${mantissa}e${exponent < 0 ? "-" : "+"}${power}`;
+  } else if (exponent < 0) {
+    text = "0." + "0".repeat(-exponent - 1) + digits;
+  } else if (digits.length > exponent + 1) {
+    text = digits.slice(0, exponent + 1) + "." + digits.slice(exponent + 1);
+  } else {
+    text = digits + "0".repeat(exponent + 1 - digits.length);
+  }
+  return sign + text;
+}
+
+// roundDigits returns the six significant digits of a positive Tensor, without trailing zeros, and its decimal
+// exponent. toExponential rounds ties away from zero, so they are detected on the longer expansion and rounded to
+// even instead. A double close enough to look like a tie in 20 digits is an exact tie.
+function roundDigits(value) {
+  const [long, longExponent] = value.toExponential(20).split("e");
+  const exact = long.replace(".", "");
+  let [short, exponent] = value.toExponential(5).split("e");
+  let digits = short.replace(".", "");
+  exponent = Number(exponent);
+
+  if (/^50*$/.test(exact.slice(6)) && Number(exact[5]) % 2 === 0) {
+    digits = exact.slice(0, 6);
+    exponent = Number(longExponent);
+  }
+  return [digits.replace(/0+$/, "") || "0", exponent];
+}
+
+// parseGear reads a Gear or State: an optional sign followed by decimal digits, within 64 bits. It returns undefined
+// when the line is not valid.
+export function parseGear(line) {
+  const text = line.replace(/^[ \t]+/, "");
+  if (!/^[+-]?[0-9]+$/.test(text)) {
+    return undefined;
+  }
+  const value = BigInt(text);
+  if (value < GEAR_MIN || value > GEAR_MAX) {
+    return undefined;
+  }
+  return value;
+}
+
+// parseTensor reads a Tensor written in decimal, or as inf, infinity or nan in any case. Values too large for a
+// double are not valid. It returns undefined when the line is not valid.
+export function parseTensor(line) {
+  const text = line.replace(/^[ \t]+/, "");
+  const special = /^([+-]?)(inf|infinity|nan)$/i.exec(text);
+  if (special) {
+    if (special[2].toLowerCase() === "nan") {
+      return NaN;
+    }
+    return special[1] === "-" ? -Infinity : Infinity;
+  }
+  if (!/^[+-]?([0-9]+\.?[0-9]*|\.[0-9]+)([eE][+-]?[0-9]+)?$/.test(text)) {
+    return undefined;
+  }
+  const value = Number(text);
+  return Number.isFinite(value) ? value : undefined;
+}
+
+// parseMonodrone reads a line holding exactly one character. It returns undefined when the line is not valid.
+export function parseMonodrone(line) {
+  const characters = [...line];
+  if (characters.length !== 1 || characters[0] === "\uFFFD") {
+    return undefined;
+  }
+  return characters[0].codePointAt(0);
+}
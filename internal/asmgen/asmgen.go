@@ -0,0 +1,859 @@
+package asmgen
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"mechanus-compiler/internal/ast"
+	"mechanus-compiler/internal/compiler_error"
+	"mechanus-compiler/internal/logger"
+	"mechanus-compiler/internal/semantic"
+	"os"
+	"strings"
+)
+
+// Generator :
+// This is the structure responsible for turning a checked Construct into x86-64 assembly for the GNU assembler. The
+// output is a standalone Linux program: it defines _start, talks to the kernel through system calls and does not
+// need libc, so "as" and "ld" are enough to build it.
+//
+// Architects follow the System V calling convention. Gears, Monodrones, Omnidrones (as pointers to NUL-terminated
+// strings), States, Nil and Assemblies (as pointers to their header on the heap) are passed in the integer registers
+// and returned in rax; Tensors are passed in the SSE registers and returned in xmm0. Every variable and parameter
+// has a slot in the stack frame, and expressions are evaluated into rax or xmm0, pushing intermediate results on the
+// stack.
+type Generator struct {
+	logger *logger.Logger
+	info   *semantic.Info
+	output strings.Builder
+	// Literals, emitted in .rodata after the code in the order they were first used
+	strings map[string]int
+	tensors map[uint64]int
+	states  map[ast.Type]int
+	labels  int
+	// State of the Architect being generated
+	code   strings.Builder
+	slots  map[*semantic.Symbol]int
+	frame  int
+	depth  int
+	result ast.Type
+	exit   string
+}
+
+// slotSize is the size of every slot of a stack frame and of every value pushed on the stack.
+const slotSize = 8
+
+var (
+	// integerRegisters and sseRegisters hold the System V argument registers, in order.
+	integerRegisters = []string{"rdi", "rsi", "rdx", "rcx", "r8", "r9"}
+	sseRegisters     = []string{"xmm0", "xmm1", "xmm2", "xmm3", "xmm4", "xmm5", "xmm6", "xmm7"}
+)
+
+// NewGenerator :
+// Initializes a new Generator instance. info must be the result of a successful semantic analysis of the Construct
+// that will be generated.
+func NewGenerator(info *semantic.Info, debug bool) Generator {
+	// Initialize the logger. Log to Stderr. Set level based on the debug flag.
+	logLevel := logger.LevelInfo
+	if debug {
+		logLevel = logger.LevelDebug
+	}
+
+	return Generator{
+		logger: logger.New(os.Stderr, logLevel),
+		info:   info,
+	}
+}
+
+// Run :
+// Generates the assembly for the given Construct.
+//
+// Fails if the Construct has no main Architect, or if it detaches an Architect or uses Channels. The program only has
+// the stack it starts with and the system calls of its runtime, and none of them starts a thread.
+func (generator *Generator) Run(construct *ast.Construct) (string, error) {
+	generator.output.Reset()
+	generator.strings = make(map[string]int)
+	generator.tensors = make(map[uint64]int)
+	generator.states = make(map[ast.Type]int)
+	generator.labels = 0
+
+	entry := generator.info.Main
+	if entry == nil {
+		err := compiler_error.CodegenErrorf(compiler_error.CodegenError, errors.New(compiler_error.MissingMain))
+		generator.logger.Error(err, nil)
+		return "", err
+	}
+
+	if generator.info.Concurrent {
+		unsupported := fmt.Errorf(compiler_error.Unsupported, "assembly")
+		err := compiler_error.CodegenErrorf(compiler_error.CodegenError, unsupported)
+		generator.logger.Error(err, nil)
+		return "", err
+	}
+
+	generator.output.WriteString(fmt.Sprintf("# Generated from the %s Construct.\n", construct.Name))
+	generator.output.WriteString("    .intel_syntax noprefix\n")
+	generator.output.WriteString("    .text\n")
+	generator.output.WriteString("    .globl _start\n")
+	generator.output.WriteString("_start:\n")
+	generator.output.WriteString("    xor ebp, ebp\n")
+	generator.output.WriteString(fmt.Sprintf("    call %s\n", architectName(entry.Name)))
+	if semantic.ReturnType(entry) == ast.TypeGear {
+		generator.output.WriteString("    mov rbx, rax\n")
+	} else {
+		generator.output.WriteString("    xor ebx, ebx\n")
+	}
+	generator.output.WriteString("    call mecha_flush\n")
+	generator.output.WriteString("    mov rdi, rbx\n")
+	generator.output.WriteString("    mov eax, 60\n")
+	generator.output.WriteString("    syscall\n")
+
+	// The parser stores the Architects bottom-to-top, so they are emitted in reverse to follow the source file
+	for i := len(construct.Architects) - 1; i >= 0; i-- {
+		generator.architect(construct.Architects[i])
+	}
+
+	generator.output.WriteString(runtime)
+	generator.literals()
+
+	generator.logger.Info(compiler_error.CodegenSuccess, nil)
+	return generator.output.String(), nil
+}
+
+//**********************************************************************************************************************
+// Architects and commands
+//**********************************************************************************************************************
+
+// architect :
+// Generates the function of a single Architect. The body is generated first, so the prologue can reserve a frame
+// big enough for every slot it used.
+func (generator *Generator) architect(architect *ast.Architect) {
+	generator.logger.Debug("Generating Architect", map[string]any{"name": architect.Name})
+
+	generator.code.Reset()
+	generator.slots = make(map[*semantic.Symbol]int)
+	generator.frame = 0
+	generator.depth = 0
+	generator.result = semantic.ReturnType(architect)
+	generator.exit = generator.label()
+
+	// Move the parameters from their registers, or from the caller's frame, into their slots
+	integers, sses, stacked := 0, 0, 0
+	for _, parameter := range architect.Parameters {
+		slot := generator.slot(generator.info.Defs[parameter])
+		switch {
+		case parameter.Type == ast.TypeTensor && sses < len(sseRegisters):
+			generator.emit("movsd %s, %s", slot, sseRegisters[sses])
+			sses++
+		case parameter.Type != ast.TypeTensor && integers < len(integerRegisters):
+			generator.emit("mov %s, %s", slot, integerRegisters[integers])
+			integers++
+		default:
+			generator.emit("mov rax, [rbp + %d]", 2*slotSize+stacked*slotSize)
+			generator.emit("mov %s, rax", slot)
+			stacked++
+		}
+	}
+
+	generator.block(architect.Body)
+
+	// Reaching the end of the body integrates the zero value of the return type
+	switch {
+	case generator.result.IsAssembly():
+		generator.emit("xor edi, edi")
+		generator.call("mecha_assembly_make")
+	case generator.result == ast.TypeTensor:
+		generator.emit("xorpd xmm0, xmm0")
+	case generator.result == ast.TypeOmnidrone:
+		generator.emit("lea rax, [rip + .Lmecha_empty]")
+	default:
+		generator.emit("xor eax, eax")
+	}
+
+	frame := (generator.frame + 15) &^ 15
+	generator.output.WriteString("\n")
+	generator.output.WriteString(fmt.Sprintf("%s:\n", architectName(architect.Name)))
+	generator.output.WriteString("    push rbp\n")
+	generator.output.WriteString("    mov rbp, rsp\n")
+	if frame > 0 {
+		generator.output.WriteString(fmt.Sprintf("    sub rsp, %d\n", frame))
+	}
+	generator.output.WriteString(generator.code.String())
+	generator.output.WriteString(fmt.Sprintf("%s:\n", generator.exit))
+	generator.output.WriteString("    leave\n")
+	generator.output.WriteString("    ret\n")
+}
+
+// block :
+// Generates the commands of a block in execution order.
+func (generator *Generator) block(block *ast.Block) {
+	for _, command := range block.Commands {
+		generator.command(command)
+	}
+}
+
+// command :
+// Generates a single command.
+func (generator *Generator) command(command ast.Command) {
+	switch cmd := command.(type) {
+	case *ast.CmdIf:
+		end := generator.label()
+		branches := []*ast.CmdElif{{Condition: cmd.Condition, Body: cmd.Then}}
+		branches = append(branches, cmd.Elifs...)
+		for _, branch := range branches {
+			next := generator.label()
+			generator.condition(branch.Condition, next)
+			generator.block(branch.Body)
+			generator.emit("jmp %s", end)
+			generator.place(next)
+		}
+		if cmd.Else != nil {
+			generator.block(cmd.Else)
+		}
+		generator.place(end)
+	case *ast.CmdFor:
+		if cmd.Elements != nil {
+			generator.iteration(cmd)
+			break
+		}
+		start := generator.label()
+		end := generator.label()
+		generator.place(start)
+		generator.condition(cmd.Condition, end)
+		generator.block(cmd.Body)
+		generator.emit("jmp %s", start)
+		generator.place(end)
+	case *ast.CmdDeclaration:
+		generator.value(cmd.Value, cmd.Type)
+		generator.store(generator.slot(generator.info.Defs[cmd]), cmd.Type)
+	case *ast.CmdAssignment:
+		symbol := generator.info.Uses[cmd]
+		if cmd.Index == nil {
+			generator.value(cmd.Value, symbol.Type)
+			generator.store(generator.slot(symbol), symbol.Type)
+			break
+		}
+		// The value is computed before the address of the element, since computing it may append to the Assembly
+		// and move its elements
+		generator.element(cmd.Value, symbol.Type.Element())
+		generator.push("rax")
+		generator.expr(cmd.Index)
+		generator.emit("mov rsi, rax")
+		generator.emit("mov rdi, %s", generator.slot(symbol))
+		generator.call("mecha_assembly_at")
+		generator.pop("rcx")
+		generator.emit("mov [rax], rcx")
+	case *ast.CmdReceive:
+		symbol := generator.info.Uses[cmd]
+		generator.call("mecha_receive_" + runtimeSuffix(symbol.Type))
+		generator.store(generator.slot(symbol), symbol.Type)
+	case *ast.CmdSend:
+		t := generator.info.Types[cmd.Value]
+		generator.expr(cmd.Value)
+		// A State is written as the name of its member, read from the table of the names of its set
+		if _, ok := generator.info.States[t]; ok {
+			generator.emit("lea rcx, [rip + %s]", generator.stateLabel(t))
+			generator.emit("mov rax, [rcx + rax*8]")
+			t = ast.TypeOmnidrone
+		}
+		if t != ast.TypeTensor {
+			generator.emit("mov rdi, rax")
+		}
+		generator.call("mecha_send_" + runtimeSuffix(t))
+	case *ast.CmdAppend:
+		generator.element(cmd.Value, generator.info.Types[cmd.Assembly].Element())
+		generator.push("rax")
+		generator.expr(cmd.Assembly)
+		generator.emit("mov rdi, rax")
+		generator.pop("rsi")
+		generator.call("mecha_assembly_push")
+	case *ast.CmdIntegrate:
+		generator.value(cmd.Value, generator.result)
+		generator.emit("jmp %s", generator.exit)
+	case *ast.CmdCall:
+		generator.expr(cmd.Call)
+	}
+}
+
+// iteration :
+// Generates a for over the elements of an Assembly. The Assembly, its length and the index of the current element are
+// kept in scratch slots. The address of the elements is read again on every pass, as the body may append to the
+// Assembly and move them.
+func (generator *Generator) iteration(cmd *ast.CmdFor) {
+	elements := generator.scratchSlot()
+	length := generator.scratchSlot()
+	index := generator.scratchSlot()
+	start := generator.label()
+	end := generator.label()
+
+	generator.expr(cmd.Elements)
+	generator.emit("mov %s, rax", elements)
+	generator.emit("mov rax, [rax]")
+	generator.emit("mov %s, rax", length)
+	generator.emit("mov %s, 0", index)
+
+	generator.place(start)
+	generator.emit("mov rax, %s", index)
+	generator.emit("cmp rax, %s", length)
+	generator.emit("jge %s", end)
+	generator.emit("mov rcx, %s", elements)
+	generator.emit("mov rcx, [rcx + 16]")
+	switch element := generator.info.Types[cmd.Elements].Element(); {
+	case element == ast.TypeTensor:
+		generator.emit("movsd xmm0, [rcx + rax*8]")
+	case cmd.Type == ast.TypeTensor:
+		generator.emit("cvtsi2sd xmm0, [rcx + rax*8]")
+	default:
+		generator.emit("mov rax, [rcx + rax*8]")
+	}
+	generator.store(generator.slot(generator.info.Defs[cmd]), cmd.Type)
+	generator.block(cmd.Body)
+	generator.emit("inc %s", index)
+	generator.emit("jmp %s", start)
+	generator.place(end)
+}
+
+// condition :
+// Generates a <CONDITION> that jumps to the given label when it does not hold. The right side of '&&' and '||' is
+// skipped once the left side decides the result, and any other Switch is tested for zero.
+func (generator *Generator) condition(condition ast.Expr, otherwise string) {
+	if not, ok := condition.(*ast.UnaryExpr); ok {
+		holds := generator.label()
+		generator.condition(not.Operand, holds)
+		generator.emit("jmp %s", otherwise)
+		generator.place(holds)
+		return
+	}
+
+	comparison, ok := condition.(*ast.BinaryExpr)
+	if !ok {
+		generator.expr(condition)
+		generator.emit("test rax, rax")
+		generator.emit("jz %s", otherwise)
+		return
+	}
+	switch comparison.Operator {
+	case ast.OpAnd:
+		generator.condition(comparison.Left, otherwise)
+		generator.condition(comparison.Right, otherwise)
+	case ast.OpOr:
+		holds := generator.label()
+		next := generator.label()
+		generator.condition(comparison.Left, next)
+		generator.emit("jmp %s", holds)
+		generator.place(next)
+		generator.condition(comparison.Right, otherwise)
+		generator.place(holds)
+	default:
+		generator.comparison(comparison, otherwise)
+	}
+}
+
+// comparison :
+// Generates a comparison that jumps to the given label when it does not hold. Tensor comparisons use ucomisd, whose
+// flags make every comparison with NaN false except '!='.
+func (generator *Generator) comparison(comparison *ast.BinaryExpr, otherwise string) {
+	left := generator.info.Types[comparison.Left]
+	right := generator.info.Types[comparison.Right]
+
+	switch {
+	case left == ast.TypeTensor || right == ast.TypeTensor:
+		generator.operands(comparison, ast.TypeTensor)
+		switch comparison.Operator {
+		case ast.OpGreater:
+			generator.emit("ucomisd xmm0, xmm1")
+			generator.emit("jbe %s", otherwise)
+		case ast.OpGreaterEqual:
+			generator.emit("ucomisd xmm0, xmm1")
+			generator.emit("jb %s", otherwise)
+		case ast.OpLess:
+			generator.emit("ucomisd xmm1, xmm0")
+			generator.emit("jbe %s", otherwise)
+		case ast.OpLessEqual:
+			generator.emit("ucomisd xmm1, xmm0")
+			generator.emit("jb %s", otherwise)
+		case ast.OpEqual:
+			generator.emit("ucomisd xmm0, xmm1")
+			generator.emit("jne %s", otherwise)
+			generator.emit("jp %s", otherwise)
+		case ast.OpNotEqual:
+			holds := generator.label()
+			generator.emit("ucomisd xmm0, xmm1")
+			generator.emit("jp %s", holds)
+			generator.emit("je %s", otherwise)
+			generator.place(holds)
+		}
+	case left == ast.TypeOmnidrone:
+		generator.operands(comparison, ast.TypeOmnidrone)
+		generator.emit("mov rdi, rax")
+		generator.emit("mov rsi, rcx")
+		generator.call("mecha_omnidrone_equal")
+		generator.emit("test eax, eax")
+		if comparison.Operator == ast.OpEqual {
+			generator.emit("jz %s", otherwise)
+		} else {
+			generator.emit("jnz %s", otherwise)
+		}
+	default:
+		generator.operands(comparison, left)
+		generator.emit("cmp rax, rcx")
+		jumps := map[ast.Operator]string{
+			ast.OpGreater:      "jle",
+			ast.OpGreaterEqual: "jl",
+			ast.OpLess:         "jge",
+			ast.OpLessEqual:    "jg",
+			ast.OpEqual:        "jne",
+			ast.OpNotEqual:     "je",
+		}
+		generator.emit("%s %s", jumps[comparison.Operator], otherwise)
+	}
+}
+
+// switchValue :
+// Generates a comparison or a logical operation as a Switch, leaving 1 or 0 in rax. It is generated like a
+// condition, so the right side of '&&' and '||' is still skipped once the left side decides the result.
+func (generator *Generator) switchValue(expr ast.Expr) {
+	otherwise := generator.label()
+	end := generator.label()
+	generator.condition(expr, otherwise)
+	generator.emit("mov eax, 1")
+	generator.emit("jmp %s", end)
+	generator.place(otherwise)
+	generator.emit("xor eax, eax")
+	generator.place(end)
+}
+
+//**********************************************************************************************************************
+// Expressions
+//**********************************************************************************************************************
+
+// value :
+// Generates an expression whose result is stored as the given type, widening a Gear into a Tensor when needed.
+func (generator *Generator) value(expr ast.Expr, to ast.Type) {
+	generator.expr(expr)
+	if generator.info.Types[expr] == ast.TypeGear && to == ast.TypeTensor {
+		generator.emit("cvtsi2sd xmm0, rax")
+	}
+}
+
+// expr :
+// Generates an expression, leaving its value in xmm0 if it is a Tensor and in rax otherwise, where a Switch is 1 or 0.
+// Operands and arguments are evaluated from left to right.
+func (generator *Generator) expr(expr ast.Expr) {
+	switch e := expr.(type) {
+	case *ast.GearLiteral:
+		if e.Value == 0 {
+			generator.emit("xor eax, eax")
+		} else {
+			generator.emit("mov rax, %d", e.Value)
+		}
+	case *ast.TensorLiteral:
+		generator.emit("movsd xmm0, [rip + %s]", generator.tensorLabel(e.Value))
+	case *ast.MonodroneLiteral:
+		generator.emit("mov eax, %d", e.Value)
+	case *ast.OmnidroneLiteral:
+		generator.emit("lea rax, [rip + %s]", generator.stringLabel(e.Value))
+	case *ast.SwitchLiteral:
+		if e.Value {
+			generator.emit("mov eax, 1")
+		} else {
+			generator.emit("xor eax, eax")
+		}
+	case *ast.NilLiteral:
+		generator.emit("xor eax, eax")
+	case *ast.Identifier:
+		symbol := generator.info.Uses[e]
+		if symbol.Kind == semantic.SymbolMember {
+			generator.emit("mov rax, %d", symbol.Value)
+		} else if symbol.Type == ast.TypeTensor {
+			generator.emit("movsd xmm0, %s", generator.slot(symbol))
+		} else {
+			generator.emit("mov rax, %s", generator.slot(symbol))
+		}
+	case *ast.UnaryExpr:
+		if e.Operator == ast.OpNot {
+			generator.switchValue(e)
+			return
+		}
+		generator.expr(e.Operand)
+		if generator.info.Types[e] == ast.TypeTensor {
+			generator.emit("movq rax, xmm0")
+			generator.emit("btc rax, 63")
+			generator.emit("movq xmm0, rax")
+		} else {
+			generator.emit("neg rax")
+		}
+	case *ast.BinaryExpr:
+		if e.Operator.IsComparison() || e.Operator.IsLogical() {
+			generator.switchValue(e)
+			return
+		}
+		generator.arithmetic(e)
+	case *ast.CallExpr:
+		generator.callArchitect(e)
+	case *ast.AssemblyLiteral:
+		generator.assembly(e)
+	case *ast.IndexExpr:
+		generator.expr(e.Index)
+		generator.push("rax")
+		generator.expr(e.Assembly)
+		generator.emit("mov rdi, rax")
+		generator.pop("rsi")
+		generator.call("mecha_assembly_at")
+		if generator.info.Types[e] == ast.TypeTensor {
+			generator.emit("movsd xmm0, [rax]")
+		} else {
+			generator.emit("mov rax, [rax]")
+		}
+	case *ast.LengthExpr:
+		generator.expr(e.Assembly)
+		generator.emit("mov rax, [rax]")
+	}
+}
+
+// element :
+// Generates a value that goes into an Assembly of the given element type, leaving it in rax. A Tensor is moved there
+// from xmm0, since every element takes 8 bytes.
+func (generator *Generator) element(expr ast.Expr, t ast.Type) {
+	generator.value(expr, t)
+	if t == ast.TypeTensor {
+		generator.emit("movq rax, xmm0")
+	}
+}
+
+// assembly :
+// Generates an Assembly literal. The elements are pushed from left to right and popped into the new Assembly from
+// the last one.
+func (generator *Generator) assembly(e *ast.AssemblyLiteral) {
+	for _, element := range e.Elements {
+		generator.element(element, e.Type.Element())
+		generator.push("rax")
+	}
+	generator.emit("mov edi, %d", len(e.Elements))
+	generator.call("mecha_assembly_make")
+	if len(e.Elements) == 0 {
+		return
+	}
+	generator.emit("mov rcx, [rax + 16]")
+	for i := len(e.Elements) - 1; i >= 0; i-- {
+		generator.pop("rdx")
+		generator.emit("mov [rcx + %d], rdx", i*slotSize)
+	}
+}
+
+// operands :
+// Generates both operands of a binary expression as the given type. The left one ends up in rax or xmm0 and the
+// right one in rcx or xmm1.
+func (generator *Generator) operands(e *ast.BinaryExpr, t ast.Type) {
+	generator.value(e.Left, t)
+	if t == ast.TypeTensor {
+		generator.emit("movq rax, xmm0")
+	}
+	generator.push("rax")
+
+	generator.value(e.Right, t)
+	if t == ast.TypeTensor {
+		generator.emit("movapd xmm1, xmm0")
+	} else {
+		generator.emit("mov rcx, rax")
+	}
+
+	generator.pop("rax")
+	if t == ast.TypeTensor {
+		generator.emit("movq xmm0, rax")
+	}
+}
+
+// arithmetic :
+// Generates an arithmetic operation. A Gear division checks for zero, and for -1, which would overflow idiv.
+func (generator *Generator) arithmetic(e *ast.BinaryExpr) {
+	t := generator.info.Types[e]
+	generator.operands(e, t)
+
+	if t == ast.TypeTensor {
+		instructions := map[ast.Operator]string{
+			ast.OpAdd: "addsd",
+			ast.OpSub: "subsd",
+			ast.OpMul: "mulsd",
+			ast.OpDiv: "divsd",
+		}
+		generator.emit("%s xmm0, xmm1", instructions[e.Operator])
+		return
+	}
+
+	switch e.Operator {
+	case ast.OpAdd:
+		generator.emit("add rax, rcx")
+	case ast.OpSub:
+		generator.emit("sub rax, rcx")
+	case ast.OpMul:
+		generator.emit("imul rax, rcx")
+	case ast.OpDiv, ast.OpMod:
+		divide := generator.label()
+		done := generator.label()
+		generator.emit("test rcx, rcx")
+		generator.emit("jz mecha_fail_div_zero")
+		generator.emit("cmp rcx, -1")
+		generator.emit("jne %s", divide)
+		if e.Operator == ast.OpDiv {
+			generator.emit("neg rax")
+		} else {
+			generator.emit("xor eax, eax")
+		}
+		generator.emit("jmp %s", done)
+		generator.place(divide)
+		generator.emit("cqo")
+		generator.emit("idiv rcx")
+		if e.Operator == ast.OpMod {
+			generator.emit("mov rax, rdx")
+		}
+		generator.place(done)
+	}
+}
+
+// callArchitect :
+// Generates a call to an Architect. The arguments are evaluated into scratch slots first, so evaluating one cannot
+// clobber the registers already loaded for another. Arguments that do not fit in registers are pushed right to left.
+func (generator *Generator) callArchitect(e *ast.CallExpr) {
+	architect := generator.info.Calls[e]
+
+	scratch := make([]string, len(e.Arguments))
+	for i, argument := range e.Arguments {
+		t := architect.Parameters[i].Type
+		generator.value(argument, t)
+		scratch[i] = generator.scratchSlot()
+		generator.store(scratch[i], t)
+	}
+
+	var registers []string
+	var stacked []int
+	integers, sses := 0, 0
+	for i, parameter := range architect.Parameters {
+		switch {
+		case parameter.Type == ast.TypeTensor && sses < len(sseRegisters):
+			registers = append(registers, fmt.Sprintf("movsd %s, %s", sseRegisters[sses], scratch[i]))
+			sses++
+		case parameter.Type != ast.TypeTensor && integers < len(integerRegisters):
+			registers = append(registers, fmt.Sprintf("mov %s, %s", integerRegisters[integers], scratch[i]))
+			integers++
+		default:
+			stacked = append(stacked, i)
+		}
+	}
+
+	padding := generator.align(len(stacked) * slotSize)
+	for i := len(stacked) - 1; i >= 0; i-- {
+		generator.emit("push qword ptr %s", scratch[stacked[i]])
+	}
+	for _, register := range registers {
+		generator.emit("%s", register)
+	}
+	generator.emit("call %s", architectName(e.Name))
+	if released := len(stacked)*slotSize + padding; released > 0 {
+		generator.emit("add rsp, %d", released)
+	}
+}
+
+//**********************************************************************************************************************
+// Helpers
+//**********************************************************************************************************************
+
+// call :
+// Generates a call to a runtime function that takes its arguments in registers, keeping the stack aligned.
+func (generator *Generator) call(function string) {
+	padding := generator.align(0)
+	generator.emit("call %s", function)
+	if padding > 0 {
+		generator.emit("add rsp, %d", padding)
+	}
+}
+
+// align :
+// Pads the stack so it is 16-byte aligned once the given number of bytes of arguments has been pushed, as required
+// at every call. Returns the size of the padding, which the caller releases after the call.
+func (generator *Generator) align(arguments int) int {
+	if (generator.depth+arguments)%16 == 0 {
+		return 0
+	}
+	generator.emit("sub rsp, %d", slotSize)
+	return slotSize
+}
+
+// push :
+// Pushes a register, keeping track of the stack depth.
+func (generator *Generator) push(register string) {
+	generator.emit("push %s", register)
+	generator.depth += slotSize
+}
+
+// pop :
+// Pops into a register, keeping track of the stack depth.
+func (generator *Generator) pop(register string) {
+	generator.emit("pop %s", register)
+	generator.depth -= slotSize
+}
+
+// store :
+// Stores rax, or xmm0 for a Tensor, into a slot.
+func (generator *Generator) store(slot string, t ast.Type) {
+	if t == ast.TypeTensor {
+		generator.emit("movsd %s, xmm0", slot)
+	} else {
+		generator.emit("mov %s, rax", slot)
+	}
+}
+
+// slot :
+// Returns the operand of the stack slot of a variable or parameter, assigning one the first time the symbol is seen.
+// Every symbol has its own slot, so a shadowing declaration never overwrites the variable it hides.
+func (generator *Generator) slot(symbol *semantic.Symbol) string {
+	offset, ok := generator.slots[symbol]
+	if !ok {
+		generator.frame += slotSize
+		offset = generator.frame
+		generator.slots[symbol] = offset
+	}
+	return fmt.Sprintf("qword ptr [rbp - %d]", offset)
+}
+
+// scratchSlot :
+// Returns the operand of a new stack slot that is not tied to any symbol.
+func (generator *Generator) scratchSlot() string {
+	generator.frame += slotSize
+	return fmt.Sprintf("qword ptr [rbp - %d]", generator.frame)
+}
+
+// label :
+// Returns a new local label.
+func (generator *Generator) label() string {
+	generator.labels++
+	return fmt.Sprintf(".L%d", generator.labels)
+}
+
+// place :
+// Places a label at the current position of the code.
+func (generator *Generator) place(label string) {
+	generator.code.WriteString(label + ":\n")
+}
+
+// emit :
+// Writes a single instruction of the current Architect.
+func (generator *Generator) emit(format string, args ...any) {
+	generator.code.WriteString("    " + fmt.Sprintf(format, args...) + "\n")
+}
+
+// stringLabel :
+// Returns the label of an Omnidrone literal, adding it to .rodata the first time it is used.
+func (generator *Generator) stringLabel(value string) string {
+	index, ok := generator.strings[value]
+	if !ok {
+		index = len(generator.strings)
+		generator.strings[value] = index
+	}
+	return fmt.Sprintf(".Lstring%d", index)
+}
+
+// tensorLabel :
+// Returns the label of a Tensor literal, adding it to .rodata the first time it is used.
+func (generator *Generator) tensorLabel(value float64) string {
+	bits := math.Float64bits(value)
+	index, ok := generator.tensors[bits]
+	if !ok {
+		index = len(generator.tensors)
+		generator.tensors[bits] = index
+	}
+	return fmt.Sprintf(".Ltensor%d", index)
+}
+
+// stateLabel :
+// Returns the label of the table of the member names of a State set, adding it to .rodata the first time it is used.
+// Each entry is the address of an Omnidrone literal.
+func (generator *Generator) stateLabel(t ast.Type) string {
+	index, ok := generator.states[t]
+	if !ok {
+		index = len(generator.states)
+		generator.states[t] = index
+		for _, member := range generator.info.States[t].Members {
+			generator.stringLabel(member.Name)
+		}
+	}
+	return fmt.Sprintf(".Lstate%d", index)
+}
+
+// literals :
+// Writes the Omnidrone and Tensor literals and the State tables used by the program.
+func (generator *Generator) literals() {
+	if len(generator.strings) == 0 && len(generator.tensors) == 0 {
+		return
+	}
+	generator.output.WriteString("\n    .section .rodata\n")
+
+	if len(generator.states) > 0 {
+		types := make([]ast.Type, len(generator.states))
+		for t, index := range generator.states {
+			types[index] = t
+		}
+		generator.output.WriteString("    .p2align 3\n")
+		for i, t := range types {
+			labels := make([]string, 0, len(generator.info.States[t].Members))
+			for _, member := range generator.info.States[t].Members {
+				labels = append(labels, generator.stringLabel(member.Name))
+			}
+			generator.output.WriteString(fmt.Sprintf(".Lstate%d:\n    .quad %s\n", i, strings.Join(labels, ", ")))
+		}
+	}
+
+	values := make([]string, len(generator.strings))
+	for value, index := range generator.strings {
+		values[index] = value
+	}
+	for i, value := range values {
+		generator.output.WriteString(fmt.Sprintf(".Lstring%d:\n    .asciz %s\n", i, stringLiteral(value)))
+	}
+
+	if len(generator.tensors) == 0 {
+		return
+	}
+	bits := make([]uint64, len(generator.tensors))
+	for value, index := range generator.tensors {
+		bits[index] = value
+	}
+	generator.output.WriteString("    .p2align 3\n")
+	for i, value := range bits {
+		generator.output.WriteString(fmt.Sprintf(".Ltensor%d:\n    .quad 0x%016x\n", i, value))
+	}
+}
+
+// architectName :
+// Returns the symbol of the function generated for an Architect. The prefix keeps Architects from clashing with the
+// runtime and with _start.
+func architectName(name string) string {
+	return "mecha_architect_" + name
+}
+
+// runtimeSuffix :
+// Returns the lowercase type name used by the runtime functions, such as mecha_send_gear.
+func runtimeSuffix(t ast.Type) string {
+	return strings.ToLower(t.String())
+}
+
+// stringLiteral :
+// Quotes an Omnidrone for the .asciz directive. Anything outside printable ASCII is written as an octal escape.
+func stringLiteral(value string) string {
+	var builder strings.Builder
+	builder.WriteByte('"')
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		switch {
+		case c == '"' || c == '\\':
+			builder.WriteByte('\\')
+			builder.WriteByte(c)
+		case c < 0x20 || c >= 0x7F:
+			builder.WriteString(fmt.Sprintf("\\%03o", c))
+		default:
+			builder.WriteByte(c)
+		}
+	}
+	builder.WriteByte('"')
+	return builder.String()
+}
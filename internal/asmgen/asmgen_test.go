@@ -0,0 +1,231 @@
+package asmgen
+
+import (
+	"bytes"
+	"errors"
+	"mechanus-compiler/internal/interpreter"
+	"mechanus-compiler/internal/mechatest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// generateSource parses, analyzes and generates assembly for the given source.
+func generateSource(t *testing.T, source string) (string, error) {
+	t.Helper()
+
+	construct, info := mechatest.Analyze(t, source)
+	generator := NewGenerator(info, false)
+	return generator.Run(construct)
+}
+
+// build assembles and links the given source into a standalone executable. Skips the test when the GNU assembler or
+// linker is not installed.
+func build(t *testing.T, source string) string {
+	t.Helper()
+
+	assembler, err := exec.LookPath("as")
+	if err != nil {
+		t.Skip("no assembler found")
+	}
+	linker, err := exec.LookPath("ld")
+	if err != nil {
+		t.Skip("no linker found")
+	}
+
+	code, err := generateSource(t, source)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	dir := t.TempDir()
+	assembly := filepath.Join(dir, "program.s")
+	object := filepath.Join(dir, "program.o")
+	binary := filepath.Join(dir, "program")
+	if err := os.WriteFile(assembly, []byte(code), 0o644); err != nil {
+		t.Fatalf("failed to write assembly: %v", err)
+	}
+
+	if output, err := exec.Command(assembler, "-o", object, assembly).CombinedOutput(); err != nil {
+		t.Fatalf("failed to assemble the generated code: %v\n%s", err, output)
+	}
+	if output, err := exec.Command(linker, "-o", binary, object).CombinedOutput(); err != nil {
+		t.Fatalf("failed to link the generated code: %v\n%s", err, output)
+	}
+	return binary
+}
+
+// run runs an executable with the given input and returns what it sends and its exit code.
+func run(t *testing.T, binary, input string) (string, int) {
+	t.Helper()
+
+	var stdout bytes.Buffer
+	command := exec.Command(binary)
+	command.Stdin = strings.NewReader(input)
+	command.Stdout = &stdout
+	err := command.Run()
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return stdout.String(), exitErr.ExitCode()
+	}
+	if err != nil {
+		t.Fatalf("failed to run the program: %v", err)
+	}
+	return stdout.String(), 0
+}
+
+// TestGenerator_MissingMain ensures that a Construct without a main Architect cannot be generated.
+func TestGenerator_MissingMain(t *testing.T) {
+	if _, err := generateSource(t, mechatest.MissingMain); err == nil {
+		t.Fatal("expected an error, got nil")
+	}
+}
+
+// TestGenerator_Program checks what the program sends and integrates.
+func TestGenerator_Program(t *testing.T) {
+	binary := build(t, mechatest.Program)
+
+	output, code := run(t, binary, mechatest.ProgramInput)
+	if code != mechatest.ProgramExit {
+		t.Errorf("expected exit code %d, got %d", mechatest.ProgramExit, code)
+	}
+
+	if output != mechatest.ProgramOutput {
+		t.Errorf("expected output %q, got %q", mechatest.ProgramOutput, output)
+	}
+}
+
+// TestGenerator_Arguments checks calls with more arguments than the System V registers can hold, so some of them
+// are passed on the stack.
+func TestGenerator_Arguments(t *testing.T) {
+	source := `{
+   {
+        a - b + c - d + e - f + g - h Integrate
+   } (Gear :a, Gear :b, Gear :c, Gear :d, Gear :e, Gear :f, Gear :g, Gear :h)gears Architect
+   {
+        a + b * 2 + c * 3 + d * 4 + e * 5 + f * 6 + g * 7 + h * 8 + i * 9 + j * 10 Integrate
+   } Tensor (Tensor :a, Tensor :b, Tensor :c, Tensor :d, Tensor :e, Tensor :f, Tensor :g, Tensor :h, Tensor :i, Tensor :j)tensors Architect
+   {
+        ((1, 2, 3, 4, 5, 6, 7, 8, 9, 10)tensors)Send
+        ((8, 7, 6, 5, 4, 3, 2, 1)gears)Send
+   } ()main Architect
+} main Construct`
+
+	binary := build(t, source)
+
+	output, _ := run(t, binary, "")
+	expected := "4\n385\n"
+	if output != expected {
+		t.Errorf("expected output %q, got %q", expected, output)
+	}
+}
+
+// TestGenerator_Tensors ensures that Tensors are received and sent the same way as in the interpreter.
+func TestGenerator_Tensors(t *testing.T) {
+	source := `{
+   {
+        {
+            (t)Send
+            (t)Receive
+            i + 1 = i
+        } i < n for
+        0 =: Gear :i
+        0.0 =: Tensor :t
+        (n)Receive
+        0 =: Gear :n
+   } ()main Architect
+} main Construct`
+
+	values := []float64{0, -0.5, 1, 0.1, 1.0 / 3, 123456, 1234567, 9999995, 99999.95, 0.0001, 0.00001234565, 1e21,
+		-2.5e-300, 1.7976931348623157e308, 5e-324}
+
+	var input, expected strings.Builder
+	input.WriteString(strconv.Itoa(len(values)) + "\n")
+	for _, value := range values {
+		input.WriteString(strconv.FormatFloat(value, 'g', -1, 64) + "\n")
+		expected.WriteString(interpreter.Format(value) + "\n")
+	}
+
+	binary := build(t, source)
+
+	output, code := run(t, binary, input.String())
+	if code != 0 {
+		t.Errorf("expected exit code 0, got %d", code)
+	}
+	if output != expected.String() {
+		t.Errorf("expected output %q, got %q", expected.String(), output)
+	}
+}
+
+// TestGenerator_Switches checks that Switches hold comparisons and logical operations, skipping the right side of
+// '&&' and '||' once the left side decides the result, and that they are sent as true or false.
+func TestGenerator_Switches(t *testing.T) {
+	source := `{
+   {
+        n Integrate
+        (n)Send
+   } Gear (Gear :n)trace Architect
+   {
+        (a == b)Send
+        (b)Send
+        (a)Send
+        {
+            ("loop")Send
+        } b && !a for
+        !a || (3)trace == 3 =: Switch :b
+        (1)trace == 1 && 2.5 > 2 || (2)trace == 0 =: Switch :a
+   } ()main Architect
+} main Construct`
+
+	binary := build(t, source)
+
+	output, _ := run(t, binary, "")
+	expected := "1\n3\ntrue\ntrue\ntrue\n"
+	if output != expected {
+		t.Errorf("expected output %q, got %q", expected, output)
+	}
+}
+
+// TestGenerator_Assemblies grows an Assembly past its capacity several times, around a received Omnidrone that shares
+// the heap with it, and checks that an index outside of it stops the program.
+func TestGenerator_Assemblies(t *testing.T) {
+	source := `{
+   {
+        xs Integrate
+        {
+            (i * i)xs Append
+            i + 1 = i
+        } i < n for
+        0 =: Gear :i
+        ()Gear Assembly =: Gear Assembly :xs
+   } Gear Assembly (Gear :n)squares Architect
+   {
+        ([(xs)Length]xs)Send
+        ([20]xs)Send
+        ([9]xs + [2]xs)Send
+        (s)Send
+        (1)xs Append
+        (s)Receive
+        "" =: Omnidrone :s
+        ([0]ts)Send
+        (xs)Length / 10 = [0]ts
+        (2.5)ts Append
+        ()Tensor Assembly =: Tensor Assembly :ts
+        (20)squares =: Gear Assembly :xs
+   } ()main Architect
+} main Construct`
+
+	binary := build(t, source)
+
+	output, code := run(t, binary, "hello\n")
+	if code != 1 {
+		t.Errorf("expected exit code 1, got %d", code)
+	}
+	if expected := "2\nhello\n109\n1\n"; output != expected {
+		t.Errorf("expected output %q, got %q", expected, output)
+	}
+}
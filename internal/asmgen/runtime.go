@@ -0,0 +1,1015 @@
+package asmgen
+
+// runtime :
+// The assembly placed at the end of every generated file. It implements Send, Receive and the other operations the
+// generated code cannot do inline, using Linux system calls only, so the program can be linked without libc:
+//
+//   - Output goes through a 4 KiB buffer that is flushed before every Receive and when the program exits.
+//   - Received lines are stored on a heap grown with brk. Only Omnidrones keep their line; numbers reuse the space.
+//   - Assemblies live on the same heap, as a header holding their length, their capacity and the address of their
+//     elements, 8 bytes each. When an Append finds the elements full they are copied to a block twice as big; nothing
+//     on the heap is ever freed.
+//   - Tensors are printed with six significant digits like the "%g" of C. Between 1e-17 and 1e27 the digits are
+//     rounded on the exact value; outside of that range they come from repeated scaling in floating point, and a
+//     value whose seventh digit is at a rounding tie may print one unit off.
+//   - Received Tensors are read as a decimal mantissa of up to 18 digits scaled by a power of ten. "inf" and "nan"
+//     are not accepted.
+//
+// Every function follows the System V calling convention, except that none of them uses instructions that need a
+// 16-byte aligned stack.
+const runtime = `
+    .section .rodata
+.Lmecha_prefix:
+    .asciz "mecha: "
+.Lmecha_newline:
+    .asciz "\n"
+.Lmecha_nil_text:
+    .asciz "Nil"
+.Lmecha_true_text:
+    .asciz "true"
+.Lmecha_false_text:
+    .asciz "false"
+.Lmecha_inf_text:
+    .asciz "inf"
+.Lmecha_nan_text:
+    .asciz "nan"
+.Lmecha_empty:
+    .asciz ""
+.Lmecha_msg_div_zero:
+    .asciz "division by zero"
+.Lmecha_msg_memory:
+    .asciz "out of memory"
+.Lmecha_msg_range:
+    .asciz "Assembly index out of range"
+.Lmecha_msg_gear:
+    .asciz "invalid Gear input"
+.Lmecha_msg_tensor:
+    .asciz "invalid Tensor input"
+.Lmecha_msg_monodrone:
+    .asciz "invalid Monodrone input"
+    .p2align 3
+.Lmecha_one:
+    .double 1.0
+.Lmecha_ten:
+    .double 10.0
+.Lmecha_1e5:
+    .double 100000.0
+.Lmecha_half:
+    .double 0.5
+.Lmecha_split:
+    .double 134217729.0
+.Lmecha_pow10:
+    .double 1e0, 1e1, 1e2, 1e3, 1e4, 1e5, 1e6, 1e7, 1e8, 1e9, 1e10, 1e11
+    .double 1e12, 1e13, 1e14, 1e15, 1e16, 1e17, 1e18, 1e19, 1e20, 1e21, 1e22
+
+    .bss
+    .p2align 3
+mecha_out_buf:
+    .zero 4096
+mecha_in_buf:
+    .zero 4096
+mecha_out_len:
+    .zero 8
+mecha_in_pos:
+    .zero 8
+mecha_in_len:
+    .zero 8
+mecha_heap_cur:
+    .zero 8
+mecha_heap_end:
+    .zero 8
+
+    .text
+
+# Writes the output buffer to stdout.
+mecha_flush:
+    push rbx
+    xor ebx, ebx
+.Lmecha_flush_loop:
+    mov rdx, [rip + mecha_out_len]
+    sub rdx, rbx
+    jle .Lmecha_flush_done
+    mov eax, 1
+    mov edi, 1
+    lea rsi, [rip + mecha_out_buf]
+    add rsi, rbx
+    syscall
+    test rax, rax
+    jle .Lmecha_flush_done
+    add rbx, rax
+    jmp .Lmecha_flush_loop
+.Lmecha_flush_done:
+    mov qword ptr [rip + mecha_out_len], 0
+    pop rbx
+    ret
+
+# Appends the byte in dil to the output buffer.
+mecha_putc:
+    mov rax, [rip + mecha_out_len]
+    cmp rax, 4096
+    jb .Lmecha_putc_store
+    push rdi
+    call mecha_flush
+    pop rdi
+    xor eax, eax
+.Lmecha_putc_store:
+    lea rcx, [rip + mecha_out_buf]
+    mov [rcx + rax], dil
+    inc rax
+    mov [rip + mecha_out_len], rax
+    ret
+
+# Appends the NUL-terminated string at rdi to the output buffer.
+mecha_puts:
+    push rbx
+    mov rbx, rdi
+.Lmecha_puts_loop:
+    movzx edi, byte ptr [rbx]
+    test edi, edi
+    jz .Lmecha_puts_done
+    call mecha_putc
+    inc rbx
+    jmp .Lmecha_puts_loop
+.Lmecha_puts_done:
+    pop rbx
+    ret
+
+# Appends the unsigned integer in rdi in decimal.
+mecha_put_u64:
+    push rbx
+    sub rsp, 32
+    mov rax, rdi
+    lea rbx, [rsp + 32]
+    mov ecx, 10
+.Lmecha_put_u64_digit:
+    xor edx, edx
+    div rcx
+    add dl, '0'
+    dec rbx
+    mov [rbx], dl
+    test rax, rax
+    jnz .Lmecha_put_u64_digit
+.Lmecha_put_u64_write:
+    lea rax, [rsp + 32]
+    cmp rbx, rax
+    jae .Lmecha_put_u64_done
+    movzx edi, byte ptr [rbx]
+    call mecha_putc
+    inc rbx
+    jmp .Lmecha_put_u64_write
+.Lmecha_put_u64_done:
+    add rsp, 32
+    pop rbx
+    ret
+
+# Appends the signed integer in rdi in decimal.
+mecha_put_i64:
+    test rdi, rdi
+    jns mecha_put_u64
+    push rdi
+    mov edi, '-'
+    call mecha_putc
+    pop rdi
+    neg rdi
+    jmp mecha_put_u64
+
+# Appends the code point in edi encoded as UTF-8.
+mecha_put_utf8:
+    push rbx
+    mov ebx, edi
+    cmp ebx, 0x80
+    jae .Lmecha_put_utf8_two
+    call mecha_putc
+    jmp .Lmecha_put_utf8_done
+.Lmecha_put_utf8_two:
+    cmp ebx, 0x800
+    jae .Lmecha_put_utf8_three
+    mov edi, ebx
+    shr edi, 6
+    or edi, 0xC0
+    call mecha_putc
+    jmp .Lmecha_put_utf8_last
+.Lmecha_put_utf8_three:
+    cmp ebx, 0x10000
+    jae .Lmecha_put_utf8_four
+    mov edi, ebx
+    shr edi, 12
+    or edi, 0xE0
+    call mecha_putc
+    jmp .Lmecha_put_utf8_middle
+.Lmecha_put_utf8_four:
+    mov edi, ebx
+    shr edi, 18
+    or edi, 0xF0
+    call mecha_putc
+    mov edi, ebx
+    shr edi, 12
+    and edi, 0x3F
+    or edi, 0x80
+    call mecha_putc
+.Lmecha_put_utf8_middle:
+    mov edi, ebx
+    shr edi, 6
+    and edi, 0x3F
+    or edi, 0x80
+    call mecha_putc
+.Lmecha_put_utf8_last:
+    mov edi, ebx
+    and edi, 0x3F
+    or edi, 0x80
+    call mecha_putc
+.Lmecha_put_utf8_done:
+    pop rbx
+    ret
+
+# Appends the double in xmm0 with six significant digits, like the "%g" of C.
+mecha_put_tensor:
+    push rbx
+    push r12
+    push r13
+    sub rsp, 16
+    ucomisd xmm0, xmm0
+    jp .Lmecha_put_tensor_nan
+    movq rax, xmm0
+    btr rax, 63
+    mov [rsp + 8], rax
+    jnc .Lmecha_put_tensor_positive
+    mov edi, '-'
+    call mecha_putc
+    mov rax, [rsp + 8]
+.Lmecha_put_tensor_positive:
+    mov rcx, 0x7FF0000000000000
+    cmp rax, rcx
+    je .Lmecha_put_tensor_inf
+    test rax, rax
+    jnz .Lmecha_put_tensor_scale
+    mov edi, '0'
+    call mecha_putc
+    jmp .Lmecha_put_tensor_done
+.Lmecha_put_tensor_scale:
+    # Scale the value into [1, 10), counting the decimal exponent in r12
+    movq xmm0, rax
+    xor r12d, r12d
+    movsd xmm1, [rip + .Lmecha_ten]
+    movsd xmm2, [rip + .Lmecha_one]
+.Lmecha_put_tensor_down:
+    ucomisd xmm0, xmm1
+    jb .Lmecha_put_tensor_up
+    divsd xmm0, xmm1
+    inc r12
+    jmp .Lmecha_put_tensor_down
+.Lmecha_put_tensor_up:
+    ucomisd xmm0, xmm2
+    jae .Lmecha_put_tensor_round
+    mulsd xmm0, xmm1
+    dec r12
+    jmp .Lmecha_put_tensor_up
+.Lmecha_put_tensor_round:
+    # Round to six digits. When 10^(5-e) is exact, the value is scaled again with a single operation whose rounding
+    # error is recovered, so ties are broken on the exact value like in C
+    mov rcx, 5
+    sub rcx, r12
+    lea rdx, [rip + .Lmecha_pow10]
+    test rcx, rcx
+    js .Lmecha_put_tensor_divide
+    cmp rcx, 22
+    jg .Lmecha_put_tensor_approximate
+    movsd xmm0, [rsp + 8]
+    movsd xmm1, [rdx + 8 * rcx]
+    call mecha_two_product
+    call mecha_round_product
+    jmp .Lmecha_put_tensor_carry
+.Lmecha_put_tensor_divide:
+    neg rcx
+    cmp rcx, 22
+    jg .Lmecha_put_tensor_approximate
+    # The sign of the remainder x - q * 10^(e-5) tells on which side of q the exact quotient is
+    movsd xmm8, [rsp + 8]
+    divsd xmm8, [rdx + 8 * rcx]
+    movapd xmm0, xmm8
+    movsd xmm1, [rdx + 8 * rcx]
+    call mecha_two_product
+    movsd xmm2, [rsp + 8]
+    subsd xmm2, xmm0
+    subsd xmm2, xmm1
+    movapd xmm1, xmm2
+    movapd xmm0, xmm8
+    call mecha_round_product
+    jmp .Lmecha_put_tensor_carry
+.Lmecha_put_tensor_approximate:
+    mulsd xmm0, [rip + .Lmecha_1e5]
+    cvtsd2si rax, xmm0
+.Lmecha_put_tensor_carry:
+    # 9.999995 and above round up to the next power of ten
+    cmp rax, 1000000
+    jb .Lmecha_put_tensor_digits
+    mov eax, 100000
+    inc r12
+.Lmecha_put_tensor_digits:
+    mov ecx, 10
+    lea rbx, [rsp + 6]
+.Lmecha_put_tensor_digit:
+    xor edx, edx
+    div rcx
+    add dl, '0'
+    dec rbx
+    mov [rbx], dl
+    cmp rbx, rsp
+    jne .Lmecha_put_tensor_digit
+    # r13 is the number of digits left once the trailing zeros are removed
+    mov r13d, 6
+.Lmecha_put_tensor_trim:
+    cmp r13, 1
+    je .Lmecha_put_tensor_style
+    cmp byte ptr [rsp + r13 - 1], '0'
+    jne .Lmecha_put_tensor_style
+    dec r13
+    jmp .Lmecha_put_tensor_trim
+.Lmecha_put_tensor_style:
+    cmp r12, -4
+    jl .Lmecha_put_tensor_exponent
+    cmp r12, 6
+    jge .Lmecha_put_tensor_exponent
+    test r12, r12
+    js .Lmecha_put_tensor_small
+    # Fixed notation with e+1 digits before the point
+    xor ebx, ebx
+.Lmecha_put_tensor_integer:
+    cmp rbx, r12
+    jg .Lmecha_put_tensor_point
+    mov edi, '0'
+    cmp rbx, r13
+    jge .Lmecha_put_tensor_integer_write
+    movzx edi, byte ptr [rsp + rbx]
+.Lmecha_put_tensor_integer_write:
+    call mecha_putc
+    inc rbx
+    jmp .Lmecha_put_tensor_integer
+.Lmecha_put_tensor_point:
+    cmp rbx, r13
+    jge .Lmecha_put_tensor_done
+    mov edi, '.'
+    call mecha_putc
+.Lmecha_put_tensor_fraction:
+    cmp rbx, r13
+    jge .Lmecha_put_tensor_done
+    movzx edi, byte ptr [rsp + rbx]
+    call mecha_putc
+    inc rbx
+    jmp .Lmecha_put_tensor_fraction
+.Lmecha_put_tensor_small:
+    # Fixed notation below 1: "0." and -e-1 zeros before the digits
+    mov edi, '0'
+    call mecha_putc
+    mov edi, '.'
+    call mecha_putc
+    mov rbx, r12
+    neg rbx
+    dec rbx
+.Lmecha_put_tensor_zeros:
+    test rbx, rbx
+    jz .Lmecha_put_tensor_fraction
+    mov edi, '0'
+    call mecha_putc
+    dec rbx
+    jmp .Lmecha_put_tensor_zeros
+.Lmecha_put_tensor_exponent:
+    # Exponent notation: d[.ddddd]e+XX
+    movzx edi, byte ptr [rsp]
+    call mecha_putc
+    mov ebx, 1
+    cmp r13, 1
+    je .Lmecha_put_tensor_e
+    mov edi, '.'
+    call mecha_putc
+.Lmecha_put_tensor_mantissa:
+    cmp rbx, r13
+    jge .Lmecha_put_tensor_e
+    movzx edi, byte ptr [rsp + rbx]
+    call mecha_putc
+    inc rbx
+    jmp .Lmecha_put_tensor_mantissa
+.Lmecha_put_tensor_e:
+    mov edi, 'e'
+    call mecha_putc
+    mov edi, '+'
+    test r12, r12
+    jns .Lmecha_put_tensor_sign
+    mov edi, '-'
+    neg r12
+.Lmecha_put_tensor_sign:
+    call mecha_putc
+    cmp r12, 10
+    jae .Lmecha_put_tensor_power
+    mov edi, '0'
+    call mecha_putc
+.Lmecha_put_tensor_power:
+    mov rdi, r12
+    call mecha_put_u64
+    jmp .Lmecha_put_tensor_done
+.Lmecha_put_tensor_inf:
+    lea rdi, [rip + .Lmecha_inf_text]
+    call mecha_puts
+    jmp .Lmecha_put_tensor_done
+.Lmecha_put_tensor_nan:
+    lea rdi, [rip + .Lmecha_nan_text]
+    call mecha_puts
+.Lmecha_put_tensor_done:
+    add rsp, 16
+    pop r13
+    pop r12
+    pop rbx
+    ret
+
+# Returns the product of xmm0 and xmm1 rounded in xmm0 and its rounding error in xmm1, so that xmm0 + xmm1 is the
+# exact product (Dekker's algorithm). Only xmm0 to xmm7 are used.
+mecha_two_product:
+    movapd xmm2, xmm0
+    mulsd xmm2, xmm1
+    movsd xmm7, [rip + .Lmecha_split]
+    movapd xmm3, xmm0
+    mulsd xmm3, xmm7
+    movapd xmm4, xmm3
+    subsd xmm4, xmm0
+    subsd xmm3, xmm4
+    movapd xmm4, xmm0
+    subsd xmm4, xmm3
+    movapd xmm5, xmm1
+    mulsd xmm5, xmm7
+    movapd xmm6, xmm5
+    subsd xmm6, xmm1
+    subsd xmm5, xmm6
+    movapd xmm6, xmm1
+    subsd xmm6, xmm5
+    movapd xmm0, xmm3
+    mulsd xmm0, xmm5
+    subsd xmm0, xmm2
+    movapd xmm7, xmm3
+    mulsd xmm7, xmm6
+    addsd xmm0, xmm7
+    movapd xmm7, xmm4
+    mulsd xmm7, xmm5
+    addsd xmm0, xmm7
+    movapd xmm7, xmm4
+    mulsd xmm7, xmm6
+    addsd xmm0, xmm7
+    movapd xmm1, xmm0
+    movapd xmm0, xmm2
+    ret
+
+# Rounds the positive value in xmm0 to the nearest integer in rax. xmm0 is itself rounded and the sign of xmm1 tells
+# whether the exact value is above or below it, which decides the ties; exact ties go to the even integer.
+mecha_round_product:
+    cvttsd2si rax, xmm0
+    cvtsi2sd xmm2, rax
+    movapd xmm3, xmm0
+    subsd xmm3, xmm2
+    ucomisd xmm3, [rip + .Lmecha_half]
+    je .Lmecha_round_product_tie
+    cvtsd2si rax, xmm0
+    ret
+.Lmecha_round_product_tie:
+    xorpd xmm2, xmm2
+    ucomisd xmm1, xmm2
+    ja .Lmecha_round_product_up
+    jb .Lmecha_round_product_done
+    test al, 1
+    jz .Lmecha_round_product_done
+.Lmecha_round_product_up:
+    inc rax
+.Lmecha_round_product_done:
+    ret
+
+# Send for each type: the value followed by a newline.
+mecha_send_gear:
+    call mecha_put_i64
+    mov edi, 10
+    jmp mecha_putc
+
+mecha_send_tensor:
+    call mecha_put_tensor
+    mov edi, 10
+    jmp mecha_putc
+
+mecha_send_monodrone:
+    call mecha_put_utf8
+    mov edi, 10
+    jmp mecha_putc
+
+mecha_send_omnidrone:
+    call mecha_puts
+    mov edi, 10
+    jmp mecha_putc
+
+mecha_send_nil:
+    lea rdi, [rip + .Lmecha_nil_text]
+    jmp mecha_send_omnidrone
+
+mecha_send_switch:
+    lea rax, [rip + .Lmecha_false_text]
+    test rdi, rdi
+    lea rdi, [rip + .Lmecha_true_text]
+    cmovz rdi, rax
+    jmp mecha_send_omnidrone
+
+mecha_send_state:
+    jmp mecha_send_gear
+
+# Writes the NUL-terminated string at rdi to stderr.
+mecha_write_error:
+    mov rsi, rdi
+    xor edx, edx
+.Lmecha_write_error_length:
+    cmp byte ptr [rsi + rdx], 0
+    je .Lmecha_write_error_write
+    inc rdx
+    jmp .Lmecha_write_error_length
+.Lmecha_write_error_write:
+    mov eax, 1
+    mov edi, 2
+    syscall
+    ret
+
+# Stops the program with the message at rdi and exit code 1.
+mecha_fail:
+    push rdi
+    call mecha_flush
+    lea rdi, [rip + .Lmecha_prefix]
+    call mecha_write_error
+    pop rdi
+    call mecha_write_error
+    lea rdi, [rip + .Lmecha_newline]
+    call mecha_write_error
+    mov eax, 60
+    mov edi, 1
+    syscall
+
+mecha_fail_div_zero:
+    lea rdi, [rip + .Lmecha_msg_div_zero]
+    jmp mecha_fail
+
+# Returns the next byte of stdin in eax, or -1 at the end of the input.
+mecha_getc:
+    mov rax, [rip + mecha_in_pos]
+    cmp rax, [rip + mecha_in_len]
+    jb .Lmecha_getc_byte
+    xor eax, eax
+    xor edi, edi
+    lea rsi, [rip + mecha_in_buf]
+    mov edx, 4096
+    syscall
+    test rax, rax
+    jg .Lmecha_getc_filled
+    mov eax, -1
+    ret
+.Lmecha_getc_filled:
+    mov [rip + mecha_in_len], rax
+    xor eax, eax
+.Lmecha_getc_byte:
+    lea rcx, [rip + mecha_in_buf]
+    movzx edx, byte ptr [rcx + rax]
+    inc rax
+    mov [rip + mecha_in_pos], rax
+    mov eax, edx
+    ret
+
+# Grows the heap with brk until it ends at or after the address in rdi.
+mecha_reserve:
+    cmp rdi, [rip + mecha_heap_end]
+    jbe .Lmecha_reserve_done
+    add rdi, 65535
+    and rdi, -65536
+    push rdi
+    mov eax, 12
+    syscall
+    pop rdi
+    cmp rax, rdi
+    jb .Lmecha_reserve_fail
+    mov [rip + mecha_heap_end], rax
+.Lmecha_reserve_done:
+    ret
+.Lmecha_reserve_fail:
+    lea rdi, [rip + .Lmecha_msg_memory]
+    jmp mecha_fail
+
+# Returns the start of the free space of the heap in rax, asking brk where the heap starts the first time.
+mecha_heap:
+    mov rax, [rip + mecha_heap_cur]
+    test rax, rax
+    jnz .Lmecha_heap_done
+    mov eax, 12
+    xor edi, edi
+    syscall
+    mov [rip + mecha_heap_cur], rax
+    mov [rip + mecha_heap_end], rax
+.Lmecha_heap_done:
+    ret
+
+# Returns in rax the address of rdi bytes taken from the heap, rounded up to a multiple of 8.
+mecha_alloc:
+    push rbx
+    push r12
+    mov r12, rdi
+    call mecha_heap
+    mov rbx, rax
+    lea r12, [rbx + r12 + 7]
+    and r12, -8
+    mov rdi, r12
+    call mecha_reserve
+    mov [rip + mecha_heap_cur], r12
+    mov rax, rbx
+    pop r12
+    pop rbx
+    ret
+
+# Reads a line from stdin into the free space of the heap, without its line ending. Returns the NUL-terminated line
+# in rax and its length in rdx. The line is overwritten by the next one unless mecha_keep_line is called.
+mecha_read_line:
+    push rbx
+    push r12
+    push r13
+    call mecha_flush
+    call mecha_heap
+    mov rbx, rax
+    xor r12d, r12d
+.Lmecha_read_line_loop:
+    call mecha_getc
+    cmp eax, -1
+    je .Lmecha_read_line_end
+    cmp eax, 10
+    je .Lmecha_read_line_end
+    mov r13d, eax
+    lea rdi, [rbx + r12 + 2]
+    call mecha_reserve
+    mov [rbx + r12], r13b
+    inc r12
+    jmp .Lmecha_read_line_loop
+.Lmecha_read_line_end:
+    test r12, r12
+    jz .Lmecha_read_line_terminate
+    cmp byte ptr [rbx + r12 - 1], 13
+    jne .Lmecha_read_line_terminate
+    dec r12
+.Lmecha_read_line_terminate:
+    lea rdi, [rbx + r12 + 1]
+    call mecha_reserve
+    mov byte ptr [rbx + r12], 0
+    mov rax, rbx
+    mov rdx, r12
+    pop r13
+    pop r12
+    pop rbx
+    ret
+
+# Skips the spaces and tabs at rsi.
+mecha_skip_blanks:
+    cmp byte ptr [rsi], ' '
+    je .Lmecha_skip_blanks_next
+    cmp byte ptr [rsi], 9
+    je .Lmecha_skip_blanks_next
+    ret
+.Lmecha_skip_blanks_next:
+    inc rsi
+    jmp mecha_skip_blanks
+
+# Receive for each type. The value is returned in rax, or in xmm0 for Tensors.
+mecha_receive_gear:
+    call mecha_read_line
+    mov rsi, rax
+    call mecha_skip_blanks
+    xor r8d, r8d
+    cmp byte ptr [rsi], '-'
+    jne .Lmecha_receive_gear_plus
+    mov r8d, 1
+    inc rsi
+    jmp .Lmecha_receive_gear_start
+.Lmecha_receive_gear_plus:
+    cmp byte ptr [rsi], '+'
+    jne .Lmecha_receive_gear_start
+    inc rsi
+.Lmecha_receive_gear_start:
+    xor eax, eax
+    xor r9d, r9d
+    mov r10d, 10
+.Lmecha_receive_gear_digit:
+    movzx ecx, byte ptr [rsi]
+    sub ecx, '0'
+    cmp ecx, 9
+    ja .Lmecha_receive_gear_end
+    mul r10
+    jc .Lmecha_receive_gear_invalid
+    add rax, rcx
+    jc .Lmecha_receive_gear_invalid
+    inc r9
+    inc rsi
+    jmp .Lmecha_receive_gear_digit
+.Lmecha_receive_gear_end:
+    test r9, r9
+    jz .Lmecha_receive_gear_invalid
+    cmp byte ptr [rsi], 0
+    jne .Lmecha_receive_gear_invalid
+    test r8, r8
+    jnz .Lmecha_receive_gear_negative
+    bt rax, 63
+    jc .Lmecha_receive_gear_invalid
+    ret
+.Lmecha_receive_gear_negative:
+    mov rcx, 0x8000000000000000
+    cmp rax, rcx
+    ja .Lmecha_receive_gear_invalid
+    neg rax
+    ret
+.Lmecha_receive_gear_invalid:
+    lea rdi, [rip + .Lmecha_msg_gear]
+    jmp mecha_fail
+
+mecha_receive_state:
+    jmp mecha_receive_gear
+
+mecha_receive_tensor:
+    push r12
+    call mecha_read_line
+    mov rsi, rax
+    call mecha_skip_blanks
+    # r8: negative, rax: mantissa, r9: digits read, r10: decimal exponent, r11: significant digits kept
+    xor r8d, r8d
+    cmp byte ptr [rsi], '-'
+    jne .Lmecha_receive_tensor_plus
+    mov r8d, 1
+    inc rsi
+    jmp .Lmecha_receive_tensor_start
+.Lmecha_receive_tensor_plus:
+    cmp byte ptr [rsi], '+'
+    jne .Lmecha_receive_tensor_start
+    inc rsi
+.Lmecha_receive_tensor_start:
+    xor eax, eax
+    xor r9d, r9d
+    xor r10d, r10d
+    xor r11d, r11d
+.Lmecha_receive_tensor_integer:
+    movzx ecx, byte ptr [rsi]
+    sub ecx, '0'
+    cmp ecx, 9
+    ja .Lmecha_receive_tensor_point
+    inc r9
+    inc rsi
+    cmp r11, 18
+    jae .Lmecha_receive_tensor_dropped
+    imul rax, rax, 10
+    add rax, rcx
+    test rax, rax
+    jz .Lmecha_receive_tensor_integer
+    inc r11
+    jmp .Lmecha_receive_tensor_integer
+.Lmecha_receive_tensor_dropped:
+    inc r10
+    jmp .Lmecha_receive_tensor_integer
+.Lmecha_receive_tensor_point:
+    cmp byte ptr [rsi], '.'
+    jne .Lmecha_receive_tensor_exponent
+    inc rsi
+.Lmecha_receive_tensor_fraction:
+    movzx ecx, byte ptr [rsi]
+    sub ecx, '0'
+    cmp ecx, 9
+    ja .Lmecha_receive_tensor_exponent
+    inc r9
+    inc rsi
+    cmp r11, 18
+    jae .Lmecha_receive_tensor_fraction
+    imul rax, rax, 10
+    add rax, rcx
+    dec r10
+    test rax, rax
+    jz .Lmecha_receive_tensor_fraction
+    inc r11
+    jmp .Lmecha_receive_tensor_fraction
+.Lmecha_receive_tensor_exponent:
+    test r9, r9
+    jz .Lmecha_receive_tensor_invalid
+    mov cl, [rsi]
+    or cl, 0x20
+    cmp cl, 'e'
+    jne .Lmecha_receive_tensor_end
+    inc rsi
+    # r12: sign of the exponent, rdx: its value, r9: its digits
+    xor r12d, r12d
+    cmp byte ptr [rsi], '-'
+    jne .Lmecha_receive_tensor_exponent_plus
+    mov r12d, 1
+    inc rsi
+    jmp .Lmecha_receive_tensor_exponent_start
+.Lmecha_receive_tensor_exponent_plus:
+    cmp byte ptr [rsi], '+'
+    jne .Lmecha_receive_tensor_exponent_start
+    inc rsi
+.Lmecha_receive_tensor_exponent_start:
+    xor edx, edx
+    xor r9d, r9d
+.Lmecha_receive_tensor_exponent_digit:
+    movzx ecx, byte ptr [rsi]
+    sub ecx, '0'
+    cmp ecx, 9
+    ja .Lmecha_receive_tensor_exponent_end
+    inc r9
+    inc rsi
+    cmp rdx, 100000
+    jae .Lmecha_receive_tensor_exponent_digit
+    imul rdx, rdx, 10
+    add rdx, rcx
+    jmp .Lmecha_receive_tensor_exponent_digit
+.Lmecha_receive_tensor_exponent_end:
+    test r9, r9
+    jz .Lmecha_receive_tensor_invalid
+    test r12, r12
+    jz .Lmecha_receive_tensor_exponent_add
+    neg rdx
+.Lmecha_receive_tensor_exponent_add:
+    add r10, rdx
+.Lmecha_receive_tensor_end:
+    cmp byte ptr [rsi], 0
+    jne .Lmecha_receive_tensor_invalid
+    cvtsi2sd xmm0, rax
+    test rax, rax
+    jz .Lmecha_receive_tensor_sign
+    lea rcx, [rip + .Lmecha_pow10]
+    movsd xmm1, [rcx + 8 * 22]
+.Lmecha_receive_tensor_large:
+    cmp r10, 22
+    jle .Lmecha_receive_tensor_small
+    cmp r10, 400
+    jg .Lmecha_receive_tensor_overflow
+    mulsd xmm0, xmm1
+    sub r10, 22
+    jmp .Lmecha_receive_tensor_large
+.Lmecha_receive_tensor_small:
+    cmp r10, -22
+    jge .Lmecha_receive_tensor_scale
+    cmp r10, -400
+    jl .Lmecha_receive_tensor_underflow
+    divsd xmm0, xmm1
+    add r10, 22
+    jmp .Lmecha_receive_tensor_small
+.Lmecha_receive_tensor_scale:
+    test r10, r10
+    js .Lmecha_receive_tensor_divide
+    mulsd xmm0, [rcx + 8 * r10]
+    jmp .Lmecha_receive_tensor_sign
+.Lmecha_receive_tensor_divide:
+    neg r10
+    divsd xmm0, [rcx + 8 * r10]
+    jmp .Lmecha_receive_tensor_sign
+.Lmecha_receive_tensor_overflow:
+    mov rax, 0x7FF0000000000000
+    movq xmm0, rax
+    jmp .Lmecha_receive_tensor_sign
+.Lmecha_receive_tensor_underflow:
+    xorpd xmm0, xmm0
+.Lmecha_receive_tensor_sign:
+    test r8, r8
+    jz .Lmecha_receive_tensor_done
+    movq rax, xmm0
+    btc rax, 63
+    movq xmm0, rax
+.Lmecha_receive_tensor_done:
+    pop r12
+    ret
+.Lmecha_receive_tensor_invalid:
+    lea rdi, [rip + .Lmecha_msg_tensor]
+    jmp mecha_fail
+
+mecha_receive_monodrone:
+    call mecha_read_line
+    mov rsi, rax
+    movzx eax, byte ptr [rsi]
+    test eax, eax
+    jz .Lmecha_receive_monodrone_invalid
+    mov ecx, 1
+    cmp eax, 0x80
+    jb .Lmecha_receive_monodrone_check
+    mov edx, eax
+    and edx, 0xE0
+    cmp edx, 0xC0
+    jne .Lmecha_receive_monodrone_three
+    and eax, 0x1F
+    mov ecx, 2
+    jmp .Lmecha_receive_monodrone_continuation
+.Lmecha_receive_monodrone_three:
+    mov edx, eax
+    and edx, 0xF0
+    cmp edx, 0xE0
+    jne .Lmecha_receive_monodrone_four
+    and eax, 0x0F
+    mov ecx, 3
+    jmp .Lmecha_receive_monodrone_continuation
+.Lmecha_receive_monodrone_four:
+    mov edx, eax
+    and edx, 0xF8
+    cmp edx, 0xF0
+    jne .Lmecha_receive_monodrone_invalid
+    and eax, 0x07
+    mov ecx, 4
+.Lmecha_receive_monodrone_continuation:
+    mov r8d, 1
+.Lmecha_receive_monodrone_byte:
+    cmp r8, rcx
+    jae .Lmecha_receive_monodrone_check
+    movzx edx, byte ptr [rsi + r8]
+    mov r9d, edx
+    and r9d, 0xC0
+    cmp r9d, 0x80
+    jne .Lmecha_receive_monodrone_invalid
+    and edx, 0x3F
+    shl eax, 6
+    or eax, edx
+    inc r8
+    jmp .Lmecha_receive_monodrone_byte
+.Lmecha_receive_monodrone_check:
+    cmp byte ptr [rsi + rcx], 0
+    jne .Lmecha_receive_monodrone_invalid
+    ret
+.Lmecha_receive_monodrone_invalid:
+    lea rdi, [rip + .Lmecha_msg_monodrone]
+    jmp mecha_fail
+
+mecha_receive_omnidrone:
+    call mecha_read_line
+    lea rcx, [rax + rdx + 8]
+    and rcx, -8
+    mov [rip + mecha_heap_cur], rcx
+    ret
+
+# Returns 1 in eax if the NUL-terminated strings at rdi and rsi are equal, 0 otherwise.
+mecha_omnidrone_equal:
+    xor ecx, ecx
+.Lmecha_omnidrone_equal_loop:
+    movzx eax, byte ptr [rdi + rcx]
+    cmp al, [rsi + rcx]
+    jne .Lmecha_omnidrone_equal_different
+    inc rcx
+    test eax, eax
+    jnz .Lmecha_omnidrone_equal_loop
+    mov eax, 1
+    ret
+.Lmecha_omnidrone_equal_different:
+    xor eax, eax
+    ret
+
+# Returns in rax a new Assembly of rdi elements. The generated code fills the elements in.
+mecha_assembly_make:
+    push rbx
+    push r12
+    mov r12, rdi
+    mov edi, 24
+    call mecha_alloc
+    mov rbx, rax
+    mov [rbx], r12
+    mov [rbx + 8], r12
+    lea rdi, [r12*8]
+    call mecha_alloc
+    mov [rbx + 16], rax
+    mov rax, rbx
+    pop r12
+    pop rbx
+    ret
+
+# Returns in rax the address of the element rsi of the Assembly at rdi, failing if there is no such element.
+mecha_assembly_at:
+    cmp rsi, [rdi]
+    jae .Lmecha_assembly_at_fail
+    mov rax, [rdi + 16]
+    lea rax, [rax + rsi*8]
+    ret
+.Lmecha_assembly_at_fail:
+    lea rdi, [rip + .Lmecha_msg_range]
+    jmp mecha_fail
+
+# Adds the 8 bytes in rsi to the end of the Assembly at rdi.
+mecha_assembly_push:
+    push rbx
+    push r12
+    mov rbx, rdi
+    mov r12, rsi
+    mov rax, [rbx]
+    cmp rax, [rbx + 8]
+    jb .Lmecha_assembly_push_store
+    lea rdi, [rax*2 + 4]
+    mov [rbx + 8], rdi
+    shl rdi, 3
+    call mecha_alloc
+    mov rsi, [rbx + 16]
+    mov rcx, [rbx]
+    mov rdi, rax
+    mov [rbx + 16], rax
+    rep movsq
+.Lmecha_assembly_push_store:
+    mov rax, [rbx]
+    mov rcx, [rbx + 16]
+    mov [rcx + rax*8], r12
+    inc rax
+    mov [rbx], rax
+    pop r12
+    pop rbx
+    ret
+`
@@ -0,0 +1,605 @@
+package ast
+
+import "fmt"
+
+//**********************************************************************************************************************
+// Positions
+//**********************************************************************************************************************
+
+// Pos :
+// A location inside the source file. Line and Column start at 1, like the positions of the lexer tokens, so they
+// can be shown to the user as-is.
+type Pos struct {
+	Line   int
+	Column int
+}
+
+// String :
+// Returns the position in the same format used by the lexer and parser error messages.
+func (p Pos) String() string {
+	return fmt.Sprintf("Line: %d, Column: %d", p.Line, p.Column)
+}
+
+//**********************************************************************************************************************
+// Node interfaces
+//**********************************************************************************************************************
+
+// Node :
+// Implemented by every node of the tree.
+type Node interface {
+	Pos() Pos
+}
+
+// Command :
+// Implemented by every <CMD> form.
+type Command interface {
+	Node
+	commandNode()
+}
+
+// Expr :
+// Implemented by every node produced by the <E>, <AND>, <NOT>, <COMPARISON>, <SUM>, <T>, <F> and <X> rules.
+type Expr interface {
+	Node
+	exprNode()
+}
+
+//**********************************************************************************************************************
+// Types
+//**********************************************************************************************************************
+
+// Type :
+// One of the types accepted by the <TYPE> rule.
+//
+// A Channel is written as the type it carries followed by 'Channel', so it is stored as that element type with the
+// TypeChannel bit set: "Gear Channel" is TypeGear | TypeChannel. An Assembly, a sequence of values of one type, is
+// written the same way with 'Assembly' and stored with the TypeAssembly bit set.
+//
+// Each State set declared in the Construct has a type of its own, built by StateType. It is a TypeState that also holds
+// the number of the set above the TypeAssembly bit, so values of different sets never mix.
+type Type int
+
+const (
+	// TypeNone marks a place where no type was written, such as an Architect without a return type.
+	TypeNone Type = iota
+	TypeNil
+	TypeGear
+	TypeTensor
+	TypeState
+	TypeMonodrone
+	TypeOmnidrone
+	TypeSwitch
+
+	// TypeChannel marks a Channel of the type held by the lower bits.
+	TypeChannel Type = 1 << 4
+
+	// TypeAssembly marks an Assembly of the type held by the lower bits.
+	TypeAssembly Type = 1 << 5
+
+	// stateShift is where the number of a State set starts.
+	stateShift = 6
+)
+
+// StateType :
+// Returns the type of the State set the parser numbered index, which is its place in Construct.TypeNames. The plain
+// 'State' keeps the number 0, so index + 1 is stored.
+func StateType(index int) Type {
+	return TypeState | Type(index+1)<<stateShift
+}
+
+// StateIndex :
+// Returns the number of the State set of a type, or of the type carried by a Channel or held by an Assembly, or -1
+// if it is not a State set.
+func (t Type) StateIndex() int {
+	return int(t>>stateShift) - 1
+}
+
+// Underlying :
+// Returns the type without the State set it belongs to, keeping the TypeChannel and TypeAssembly bits. Backends
+// represent every State as a Gear-sized number, its place in the set, so they only need to look at the underlying type.
+func (t Type) Underlying() Type {
+	return t & (1<<stateShift - 1)
+}
+
+// IsChannel :
+// Checks if the type is a Channel.
+func (t Type) IsChannel() bool {
+	return t&TypeChannel != 0
+}
+
+// IsAssembly :
+// Checks if the type is an Assembly.
+func (t Type) IsAssembly() bool {
+	return t&TypeAssembly != 0
+}
+
+// Element :
+// Returns the type carried by a Channel or held by an Assembly.
+func (t Type) Element() Type {
+	return t &^ (TypeChannel | TypeAssembly)
+}
+
+// String :
+// Returns the Mechanus keyword for the type. A State set is only known by its number here, so it is shown as a plain
+// 'State'; Construct.TypeString gives its name.
+func (t Type) String() string {
+	if t.IsChannel() {
+		return t.Element().String() + " Channel"
+	}
+	if t.IsAssembly() {
+		return t.Element().String() + " Assembly"
+	}
+	switch t.Underlying() {
+	case TypeNil:
+		return "Nil"
+	case TypeGear:
+		return "Gear"
+	case TypeTensor:
+		return "Tensor"
+	case TypeState:
+		return "State"
+	case TypeMonodrone:
+		return "Monodrone"
+	case TypeOmnidrone:
+		return "Omnidrone"
+	case TypeSwitch:
+		return "Switch"
+	default:
+		return "<none>"
+	}
+}
+
+//**********************************************************************************************************************
+// Operators
+//**********************************************************************************************************************
+
+// Operator :
+// An arithmetic, comparison or logical operator used inside expressions.
+type Operator int
+
+const (
+	// Arithmetic operators
+
+	OpAdd Operator = iota
+	OpSub
+	OpMul
+	OpDiv
+	OpMod
+	OpNeg
+
+	// Comparison operators
+
+	OpGreater
+	OpGreaterEqual
+	OpLess
+	OpLessEqual
+	OpEqual
+	OpNotEqual
+
+	// Logical operators
+
+	OpAnd
+	OpOr
+	OpNot
+)
+
+// String :
+// Returns the symbol of the operator as written in the source.
+func (op Operator) String() string {
+	switch op {
+	case OpAdd:
+		return "+"
+	case OpSub, OpNeg:
+		return "-"
+	case OpMul:
+		return "*"
+	case OpDiv:
+		return "/"
+	case OpMod:
+		return "%"
+	case OpGreater:
+		return ">"
+	case OpGreaterEqual:
+		return ">="
+	case OpLess:
+		return "<"
+	case OpLessEqual:
+		return "<="
+	case OpEqual:
+		return "=="
+	case OpNotEqual:
+		return "!="
+	case OpAnd:
+		return "&&"
+	case OpOr:
+		return "||"
+	case OpNot:
+		return "!"
+	default:
+		return "?"
+	}
+}
+
+// IsComparison :
+// Checks if the operator is one of the <COMPARISON> operators, which give a Switch.
+func (op Operator) IsComparison() bool {
+	return op >= OpGreater && op <= OpNotEqual
+}
+
+// IsLogical :
+// Checks if the operator combines Switches: '&&', '||' or '!'.
+func (op Operator) IsLogical() bool {
+	return op >= OpAnd && op <= OpNot
+}
+
+//**********************************************************************************************************************
+// Program structure
+//**********************************************************************************************************************
+
+// Construct :
+// <G> ::= '{' <BODY> '}' <ID> 'Construct'
+//
+// Architects and States are stored in the order the parser found them, which is bottom-to-top. Position is the
+// 'Construct' keyword, while Open is the '{' that starts the file.
+//
+// TypeNames holds every name written as a type or declared as a State set, in the order the parser first met them,
+// so TypeNames[t.StateIndex()] is the name of a State set type t. A name may lack a declaration, which is left for the
+// semantic analysis to report.
+type Construct struct {
+	Position   Pos
+	Open       Pos
+	Name       string
+	TypeNames  []string
+	States     []*StateSet
+	Architects []*Architect
+}
+
+// TypeString :
+// Returns the type as written in the source, using the name of its State set if it has one.
+func (n *Construct) TypeString(t Type) string {
+	index := t.StateIndex()
+	if index < 0 || index >= len(n.TypeNames) {
+		return t.String()
+	}
+	if t.IsChannel() {
+		return n.TypeNames[index] + " Channel"
+	}
+	if t.IsAssembly() {
+		return n.TypeNames[index] + " Assembly"
+	}
+	return n.TypeNames[index]
+}
+
+// StateSet :
+// <BODY> ::= <BODY_REST> '(' <MEMBERS> ')' <ID> 'State'
+//
+// Members follow the source, from left to right, and each one stands for its place in the list, starting at 0. Type
+// is the type the parser gave to the name. Position is the 'State' keyword, while NamePosition is the <ID>.
+type StateSet struct {
+	Position     Pos
+	NamePosition Pos
+	Name         string
+	Type         Type
+	Members      []*StateMember
+}
+
+// StateMember :
+// A single <ID> of <MEMBERS>.
+type StateMember struct {
+	Position Pos
+	Name     string
+}
+
+// Architect :
+// <BODY> ::= <BODY_REST> '{' <CMDS> '}' <TYPE> '(' <PARAMETERS_DECL> ')' <ID> 'Architect'
+//
+// ReturnType is TypeNone when the optional <TYPE> was omitted. Position is the 'Architect' keyword, while NamePosition
+// is the <ID>.
+type Architect struct {
+	Position     Pos
+	NamePosition Pos
+	Name         string
+	Parameters   []*Parameter
+	ReturnType   Type
+	Body         *Block
+}
+
+// Parameter :
+// A single "<TYPE> ':' <ID>" entry of <PARAMETERS_DECL>.
+type Parameter struct {
+	Position Pos
+	Name     string
+	Type     Type
+}
+
+// Block :
+// The <CMDS> enclosed by a pair of braces.
+//
+// Commands are stored in execution order. Since Mechanus runs from the bottom of the file to the top, the first
+// command of a block is the one written on its last line. Position is the '}' at the bottom of the block, which the
+// parser reads first, while Open is the '{' at its top.
+type Block struct {
+	Position Pos
+	Open     Pos
+	Commands []Command
+}
+
+func (n *Construct) Pos() Pos   { return n.Position }
+func (n *StateSet) Pos() Pos    { return n.Position }
+func (n *StateMember) Pos() Pos { return n.Position }
+func (n *Architect) Pos() Pos   { return n.Position }
+func (n *Parameter) Pos() Pos   { return n.Position }
+func (n *Block) Pos() Pos       { return n.Position }
+
+//**********************************************************************************************************************
+// Commands
+//**********************************************************************************************************************
+
+// CmdIf :
+// <CMD_IF> ::= <CMD_ELIF> '{' <CMDS> '}' <CONDITION> 'if'
+//
+// Elifs are stored in evaluation order. Else is nil when the command has no 'else' block.
+type CmdIf struct {
+	Position  Pos
+	Condition Expr
+	Then      *Block
+	Elifs     []*CmdElif
+	Else      *Block
+}
+
+// CmdElif :
+// <CMD_ELIF> ::= '{' <CMDS> '}' <CONDITION> 'elif'
+type CmdElif struct {
+	Position  Pos
+	Condition Expr
+	Body      *Block
+}
+
+// CmdFor :
+// <CMD_FOR> ::= '{' <CMDS> '}' <CONDITION> 'for'
+// <CMD_FOR> ::= '{' <CMDS> '}' <E> '=:' <TYPE> ':' <VAR> 'for'
+//
+// The second form runs the body once for each element of the Assembly in Elements, declaring Name to hold it. Its
+// Condition is nil, while the first form leaves Name empty and Elements nil. NamePosition is the <VAR>.
+type CmdFor struct {
+	Position     Pos
+	Condition    Expr
+	Body         *Block
+	NamePosition Pos
+	Name         string
+	Type         Type
+	Elements     Expr
+}
+
+// CmdDeclaration :
+// <CMD_DECLARATION> ::= <E> '=:' <TYPE> ':' <VAR>
+type CmdDeclaration struct {
+	Position Pos
+	Name     string
+	Type     Type
+	Value    Expr
+}
+
+// CmdAssignment :
+// <CMD_ASSIGNMENT> ::= <E> '=' <VAR>
+// <CMD_ASSIGNMENT> ::= <E> '=' '[' <E> ']' <VAR>
+//
+// Index is nil unless the value is stored in an element of the Assembly called Name.
+type CmdAssignment struct {
+	Position Pos
+	Name     string
+	Index    Expr
+	Value    Expr
+}
+
+// CmdReceive :
+// <CMD_RECEIVE> ::= '(' <VAR> ')' [<VAR>] 'Receive'
+//
+// Channel is nil when the value is read from the input. Position is the 'Receive' keyword, while NamePosition is the
+// <VAR> inside the parentheses.
+type CmdReceive struct {
+	Position     Pos
+	NamePosition Pos
+	Name         string
+	Channel      *Identifier
+}
+
+// CmdSend :
+// <CMD_SEND> ::= '(' <E> ')' [<VAR>] 'Send'
+//
+// Channel is nil when the value is written to the output.
+type CmdSend struct {
+	Position Pos
+	Value    Expr
+	Channel  *Identifier
+}
+
+// CmdAppend :
+// <CMD_APPEND> ::= '(' <E> ')' <VAR> 'Append'
+//
+// Adds the value to the end of the Assembly, which every variable sharing it then sees.
+type CmdAppend struct {
+	Position Pos
+	Value    Expr
+	Assembly *Identifier
+}
+
+// CmdIntegrate :
+// <CMD_INTEGRATE> ::= <E> 'Integrate'
+type CmdIntegrate struct {
+	Position Pos
+	Value    Expr
+}
+
+// CmdCall :
+// <CMD_CALL> ::= '(' <PARAMETERS_CALL> ')' <ID>
+// <CMD_CALL> ::= '(' <PARAMETERS_CALL> ')' <ID> 'Detach'
+type CmdCall struct {
+	Call *CallExpr
+}
+
+func (n *CmdIf) Pos() Pos          { return n.Position }
+func (n *CmdElif) Pos() Pos        { return n.Position }
+func (n *CmdFor) Pos() Pos         { return n.Position }
+func (n *CmdDeclaration) Pos() Pos { return n.Position }
+func (n *CmdAssignment) Pos() Pos  { return n.Position }
+func (n *CmdReceive) Pos() Pos     { return n.Position }
+func (n *CmdSend) Pos() Pos        { return n.Position }
+func (n *CmdAppend) Pos() Pos      { return n.Position }
+func (n *CmdIntegrate) Pos() Pos   { return n.Position }
+func (n *CmdCall) Pos() Pos        { return n.Call.Position }
+
+func (*CmdIf) commandNode()          {}
+func (*CmdFor) commandNode()         {}
+func (*CmdDeclaration) commandNode() {}
+func (*CmdAssignment) commandNode()  {}
+func (*CmdReceive) commandNode()     {}
+func (*CmdSend) commandNode()        {}
+func (*CmdAppend) commandNode()      {}
+func (*CmdIntegrate) commandNode()   {}
+func (*CmdCall) commandNode()        {}
+
+//**********************************************************************************************************************
+// Expressions
+//**********************************************************************************************************************
+
+// BinaryExpr :
+// An arithmetic operation from <SUM> or <T>, a comparison from <COMPARISON>, or a '||' from <E> or '&&' from <AND>.
+// Left and Right follow the source, so "x - 1" has x on the Left even though the parser reads the 1 first.
+type BinaryExpr struct {
+	Position Pos
+	Operator Operator
+	Left     Expr
+	Right    Expr
+}
+
+// UnaryExpr :
+// <F> ::= -<F>
+// <NOT> ::= '!' <NOT>
+type UnaryExpr struct {
+	Position Pos
+	Operator Operator
+	Operand  Expr
+}
+
+// Identifier :
+// <X> ::= <VAR>
+type Identifier struct {
+	Position Pos
+	Name     string
+}
+
+// GearLiteral :
+// An integer literal.
+type GearLiteral struct {
+	Position Pos
+	Value    int64
+}
+
+// TensorLiteral :
+// A floating-point literal.
+type TensorLiteral struct {
+	Position Pos
+	Value    float64
+}
+
+// MonodroneLiteral :
+// A single-quoted, single-character literal.
+type MonodroneLiteral struct {
+	Position Pos
+	Value    rune
+}
+
+// OmnidroneLiteral :
+// <STRING> ::= '"' <TEXT> '"'
+// <STRING> ::= '`' <RAW_TEXT> '`'
+//
+// Value holds the text without the surrounding quotes, with its escape sequences decoded. Raw literals, written
+// between backticks, have no escape sequences and may span lines, so Value can hold line breaks.
+type OmnidroneLiteral struct {
+	Position Pos
+	Value    string
+	Raw      bool
+}
+
+// SwitchLiteral :
+// <X> ::= 'true'
+// <X> ::= 'false'
+type SwitchLiteral struct {
+	Position Pos
+	Value    bool
+}
+
+// NilLiteral :
+// <NIL> ::= 'Nil'
+type NilLiteral struct {
+	Position Pos
+}
+
+// CallExpr :
+// <X> ::= '(' <PARAMETERS_CALL> ')' <ID>
+//
+// Arguments follow the source, from left to right, so they line up with Architect.Parameters. Detached is set when
+// the call is followed by 'Detach', so the Architect runs alongside its caller and nothing waits for its result.
+type CallExpr struct {
+	Position  Pos
+	Name      string
+	Arguments []Expr
+	Detached  bool
+}
+
+// AssemblyLiteral :
+// <X> ::= '(' [<PARAMETERS_CALL>] ')' <ELEMENT_TYPE> 'Assembly'
+//
+// Type is the Assembly type, not the type of its elements. Elements follow the source, from left to right, which is
+// their order in the Assembly.
+type AssemblyLiteral struct {
+	Position Pos
+	Type     Type
+	Elements []Expr
+}
+
+// IndexExpr :
+// <X> ::= '[' <E> ']' <VAR>
+//
+// Elements are numbered from 0. Position is the ']', which the parser reads first.
+type IndexExpr struct {
+	Position Pos
+	Assembly *Identifier
+	Index    Expr
+}
+
+// LengthExpr :
+// <X> ::= '(' <E> ')' 'Length'
+type LengthExpr struct {
+	Position Pos
+	Assembly Expr
+}
+
+func (n *BinaryExpr) Pos() Pos       { return n.Position }
+func (n *UnaryExpr) Pos() Pos        { return n.Position }
+func (n *Identifier) Pos() Pos       { return n.Position }
+func (n *GearLiteral) Pos() Pos      { return n.Position }
+func (n *TensorLiteral) Pos() Pos    { return n.Position }
+func (n *MonodroneLiteral) Pos() Pos { return n.Position }
+func (n *OmnidroneLiteral) Pos() Pos { return n.Position }
+func (n *SwitchLiteral) Pos() Pos    { return n.Position }
+func (n *NilLiteral) Pos() Pos       { return n.Position }
+func (n *CallExpr) Pos() Pos         { return n.Position }
+func (n *AssemblyLiteral) Pos() Pos  { return n.Position }
+func (n *IndexExpr) Pos() Pos        { return n.Position }
+func (n *LengthExpr) Pos() Pos       { return n.Position }
+
+func (*BinaryExpr) exprNode()       {}
+func (*UnaryExpr) exprNode()        {}
+func (*Identifier) exprNode()       {}
+func (*GearLiteral) exprNode()      {}
+func (*TensorLiteral) exprNode()    {}
+func (*MonodroneLiteral) exprNode() {}
+func (*OmnidroneLiteral) exprNode() {}
+func (*SwitchLiteral) exprNode()    {}
+func (*NilLiteral) exprNode()       {}
+func (*CallExpr) exprNode()         {}
+func (*AssemblyLiteral) exprNode()  {}
+func (*IndexExpr) exprNode()        {}
+func (*LengthExpr) exprNode()       {}
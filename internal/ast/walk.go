@@ -0,0 +1,93 @@
+package ast
+
+// Inspect :
+// Traverses the tree rooted at node in depth-first order. The visit function is called for every node; if it returns
+// false, the children of that node are skipped.
+//
+// Children are visited in the order they are stored, so the commands of a Block are visited in execution order.
+func Inspect(node Node, visit func(Node) bool) {
+	if node == nil || !visit(node) {
+		return
+	}
+
+	switch n := node.(type) {
+	// Program structure
+	case *Construct:
+		for _, state := range n.States {
+			Inspect(state, visit)
+		}
+		for _, architect := range n.Architects {
+			Inspect(architect, visit)
+		}
+	case *StateSet:
+		for _, member := range n.Members {
+			Inspect(member, visit)
+		}
+	case *Architect:
+		for _, parameter := range n.Parameters {
+			Inspect(parameter, visit)
+		}
+		Inspect(n.Body, visit)
+	case *Block:
+		for _, command := range n.Commands {
+			Inspect(command, visit)
+		}
+	// Commands
+	case *CmdIf:
+		Inspect(n.Condition, visit)
+		Inspect(n.Then, visit)
+		for _, elif := range n.Elifs {
+			Inspect(elif, visit)
+		}
+		if n.Else != nil {
+			Inspect(n.Else, visit)
+		}
+	case *CmdElif:
+		Inspect(n.Condition, visit)
+		Inspect(n.Body, visit)
+	case *CmdFor:
+		Inspect(n.Condition, visit)
+		Inspect(n.Elements, visit)
+		Inspect(n.Body, visit)
+	case *CmdDeclaration:
+		Inspect(n.Value, visit)
+	case *CmdAssignment:
+		Inspect(n.Index, visit)
+		Inspect(n.Value, visit)
+	case *CmdReceive:
+		if n.Channel != nil {
+			Inspect(n.Channel, visit)
+		}
+	case *CmdSend:
+		Inspect(n.Value, visit)
+		if n.Channel != nil {
+			Inspect(n.Channel, visit)
+		}
+	case *CmdAppend:
+		Inspect(n.Value, visit)
+		Inspect(n.Assembly, visit)
+	case *CmdIntegrate:
+		Inspect(n.Value, visit)
+	case *CmdCall:
+		Inspect(n.Call, visit)
+	// Expressions
+	case *BinaryExpr:
+		Inspect(n.Left, visit)
+		Inspect(n.Right, visit)
+	case *UnaryExpr:
+		Inspect(n.Operand, visit)
+	case *CallExpr:
+		for _, argument := range n.Arguments {
+			Inspect(argument, visit)
+		}
+	case *AssemblyLiteral:
+		for _, element := range n.Elements {
+			Inspect(element, visit)
+		}
+	case *IndexExpr:
+		Inspect(n.Assembly, visit)
+		Inspect(n.Index, visit)
+	case *LengthExpr:
+		Inspect(n.Assembly, visit)
+	}
+}
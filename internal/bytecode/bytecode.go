@@ -0,0 +1,264 @@
+package bytecode
+
+import (
+	"fmt"
+	"mechanus-compiler/internal/ast"
+)
+
+//**********************************************************************************************************************
+// Opcodes
+//**********************************************************************************************************************
+
+// Opcode :
+// A single instruction of the stack machine. Each opcode is one byte, followed by at most one operand whose width is
+// given by OperandWidth. Operands are little-endian.
+type Opcode byte
+
+const (
+	// OpConst pushes the constant whose index is its 2-byte operand.
+	OpConst Opcode = iota
+	// OpNil pushes Nil.
+	OpNil
+	// OpLoad pushes the local whose slot is its 2-byte operand.
+	OpLoad
+	// OpStore pops a value into the local whose slot is its 2-byte operand.
+	OpStore
+	// OpPop discards the value on top of the stack.
+	OpPop
+	// OpWiden converts the Gear on top of the stack into a Tensor.
+	OpWiden
+
+	// Arithmetic pops the right operand, then the left one, and pushes the result.
+
+	OpAdd
+	OpSub
+	OpMul
+	OpDiv
+	OpMod
+	OpNeg
+
+	// Comparisons pop both operands like arithmetic and push the resulting Switch.
+
+	OpGreater
+	OpGreaterEqual
+	OpLess
+	OpLessEqual
+	OpEqual
+	OpNotEqual
+
+	// OpJump moves to the absolute code offset given by its 4-byte operand.
+	OpJump
+	// OpJumpIfFalse pops a Switch and jumps like OpJump if it is false.
+	OpJumpIfFalse
+	// OpJumpIfTrue pops a Switch and jumps like OpJump if it is true.
+	OpJumpIfTrue
+	// OpCall calls the function whose index is its 2-byte operand. Its arguments are on top of the stack, the last
+	// one on top, and are replaced by the integrated value.
+	OpCall
+	// OpReturn pops the integrated value and returns it to the caller.
+	OpReturn
+	// OpSend pops a value and writes it to the output.
+	OpSend
+	// OpReceive reads a line from the input and pushes it as a value of the ast.Type given by its 1-byte operand.
+	OpReceive
+	// OpDetach pops the arguments of the function whose index is its 2-byte operand, like OpCall, and runs the
+	// function alongside the caller without waiting for the value it integrates.
+	OpDetach
+	// OpChannel pops a Gear and pushes a new Channel with that capacity.
+	OpChannel
+	// OpSendChannel pops a Channel, then a value, and sends the value on the Channel.
+	OpSendChannel
+	// OpReceiveChannel pops a Channel and pushes the next value received from it.
+	OpReceiveChannel
+	// OpSelect pops a Gear, then as many values as its 2-byte operand, and pushes the value found at the place given
+	// by the Gear, counting from the deepest one. The names of the members of a State set are selected that way.
+	OpSelect
+	// OpAssembly pops as many values as its 2-byte operand and pushes a new Assembly holding them, the deepest one
+	// first.
+	OpAssembly
+	// OpIndex pops an Assembly, then a Gear, and pushes the element found at that index.
+	OpIndex
+	// OpStoreIndex pops an Assembly, then a Gear, then a value, and stores the value at that index.
+	OpStoreIndex
+	// OpAppend pops an Assembly, then a value, and adds the value to the end of the Assembly.
+	OpAppend
+	// OpLength pops an Assembly and pushes the number of its elements.
+	OpLength
+)
+
+// opcodeNames holds the mnemonics used by the disassembler.
+var opcodeNames = [...]string{
+	OpConst:          "CONST",
+	OpNil:            "NIL",
+	OpLoad:           "LOAD",
+	OpStore:          "STORE",
+	OpPop:            "POP",
+	OpWiden:          "WIDEN",
+	OpAdd:            "ADD",
+	OpSub:            "SUB",
+	OpMul:            "MUL",
+	OpDiv:            "DIV",
+	OpMod:            "MOD",
+	OpNeg:            "NEG",
+	OpGreater:        "GT",
+	OpGreaterEqual:   "GE",
+	OpLess:           "LT",
+	OpLessEqual:      "LE",
+	OpEqual:          "EQ",
+	OpNotEqual:       "NE",
+	OpJump:           "JUMP",
+	OpJumpIfFalse:    "JUMP_IF_FALSE",
+	OpJumpIfTrue:     "JUMP_IF_TRUE",
+	OpCall:           "CALL",
+	OpReturn:         "RETURN",
+	OpSend:           "SEND",
+	OpReceive:        "RECEIVE",
+	OpDetach:         "DETACH",
+	OpChannel:        "CHANNEL",
+	OpSendChannel:    "SEND_CHANNEL",
+	OpReceiveChannel: "RECEIVE_CHANNEL",
+	OpSelect:         "SELECT",
+	OpAssembly:       "ASSEMBLY",
+	OpIndex:          "INDEX",
+	OpStoreIndex:     "STORE_INDEX",
+	OpAppend:         "APPEND",
+	OpLength:         "LENGTH",
+}
+
+// String :
+// Returns the mnemonic of the opcode.
+func (op Opcode) String() string {
+	if int(op) < len(opcodeNames) {
+		return opcodeNames[op]
+	}
+	return fmt.Sprintf("OP_%d", byte(op))
+}
+
+// Valid :
+// Checks if the byte is a known opcode.
+func (op Opcode) Valid() bool {
+	return int(op) < len(opcodeNames)
+}
+
+// OperandWidth :
+// Returns the number of bytes of the operand that follows the opcode.
+func (op Opcode) OperandWidth() int {
+	switch op {
+	case OpConst, OpLoad, OpStore, OpCall, OpDetach, OpSelect, OpAssembly:
+		return 2
+	case OpJump, OpJumpIfFalse, OpJumpIfTrue:
+		return 4
+	case OpReceive:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// arithmeticOpcodes and comparisonOpcodes map the operators of the tree to their instructions.
+var (
+	arithmeticOpcodes = map[ast.Operator]Opcode{
+		ast.OpAdd: OpAdd,
+		ast.OpSub: OpSub,
+		ast.OpMul: OpMul,
+		ast.OpDiv: OpDiv,
+		ast.OpMod: OpMod,
+	}
+	comparisonOpcodes = map[ast.Operator]Opcode{
+		ast.OpGreater:      OpGreater,
+		ast.OpGreaterEqual: OpGreaterEqual,
+		ast.OpLess:         OpLess,
+		ast.OpLessEqual:    OpLessEqual,
+		ast.OpEqual:        OpEqual,
+		ast.OpNotEqual:     OpNotEqual,
+	}
+)
+
+// Operator :
+// Returns the operator of an arithmetic or comparison opcode. The second result is false for any other opcode.
+func (op Opcode) Operator() (ast.Operator, bool) {
+	switch op {
+	case OpAdd:
+		return ast.OpAdd, true
+	case OpSub:
+		return ast.OpSub, true
+	case OpMul:
+		return ast.OpMul, true
+	case OpDiv:
+		return ast.OpDiv, true
+	case OpMod:
+		return ast.OpMod, true
+	case OpGreater:
+		return ast.OpGreater, true
+	case OpGreaterEqual:
+		return ast.OpGreaterEqual, true
+	case OpLess:
+		return ast.OpLess, true
+	case OpLessEqual:
+		return ast.OpLessEqual, true
+	case OpEqual:
+		return ast.OpEqual, true
+	case OpNotEqual:
+		return ast.OpNotEqual, true
+	default:
+		return 0, false
+	}
+}
+
+//**********************************************************************************************************************
+// Programs
+//**********************************************************************************************************************
+
+// Program :
+// A compiled Construct. Constants are shared by every function and hold Gears (int64), Tensors (float64),
+// Monodrones (rune), Omnidrones (string) and Switches (bool).
+type Program struct {
+	Constants []any
+	Functions []*Function
+	// Entry is the index of the function generated for the main Architect.
+	Entry int
+}
+
+// Function :
+// The code generated for a single Architect. Its parameters take the first slots of its locals, and the locals that
+// follow the variables it declares hold the state of the loops over Assemblies.
+type Function struct {
+	Name       string
+	Parameters int
+	Locals     int
+	ReturnType ast.Type
+	Code       []byte
+}
+
+// Instruction :
+// A decoded instruction, as read by the disassembler and the verifier.
+type Instruction struct {
+	Offset  int
+	Opcode  Opcode
+	Operand int
+}
+
+// Decode :
+// Decodes the instruction at the given offset of the code. Fails if the opcode is unknown or its operand is cut short.
+func Decode(code []byte, offset int) (Instruction, error) {
+	op := Opcode(code[offset])
+	if !op.Valid() {
+		return Instruction{}, fmt.Errorf(errUnknownOpcode, byte(op), offset)
+	}
+
+	instruction := Instruction{Offset: offset, Opcode: op}
+	width := op.OperandWidth()
+	if offset+1+width > len(code) {
+		return Instruction{}, fmt.Errorf(errTruncatedInstruction, op, offset)
+	}
+	for i := 0; i < width; i++ {
+		instruction.Operand |= int(code[offset+1+i]) << (8 * i)
+	}
+	return instruction, nil
+}
+
+// Size :
+// Returns the number of bytes taken by the instruction.
+func (instruction Instruction) Size() int {
+	return 1 + instruction.Opcode.OperandWidth()
+}
@@ -0,0 +1,114 @@
+package bytecode
+
+import (
+	"bytes"
+	"mechanus-compiler/internal/mechatest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// compileSource parses, analyzes and compiles the given source.
+func compileSource(t *testing.T, source string) *Program {
+	t.Helper()
+
+	construct, info := mechatest.Analyze(t, source)
+	compiler := NewCompiler(info, false)
+	program, err := compiler.Run(construct)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return program
+}
+
+// TestBytecode_RoundTrip ensures that every example survives being written to and loaded from a .mechc file.
+func TestBytecode_RoundTrip(t *testing.T) {
+	paths, err := filepath.Glob("../../docs/examples/example*_input.mecha")
+	if err != nil || len(paths) == 0 {
+		t.Fatalf("no examples found: %v", err)
+	}
+
+	for _, path := range paths {
+		source, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("failed to read %s: %v", path, err)
+		}
+		program := compileSource(t, string(source))
+
+		var encoded bytes.Buffer
+		if err := Encode(program, &encoded); err != nil {
+			t.Fatalf("%s: failed to encode: %v", path, err)
+		}
+		loaded, err := Load(&encoded)
+		if err != nil {
+			t.Fatalf("%s: failed to load: %v", path, err)
+		}
+		if !reflect.DeepEqual(program, loaded) {
+			t.Errorf("%s: the loaded program differs from the compiled one", path)
+		}
+	}
+}
+
+// TestBytecode_Disassemble checks the listing of a small program.
+func TestBytecode_Disassemble(t *testing.T) {
+	program := compileSource(t, `{
+   {
+        x Integrate
+   } Tensor (Tensor :x)widen Architect
+   {
+        ((1)widen)Send
+   } ()main Architect
+} main Construct`)
+
+	listing := Disassemble(program)
+	for _, expected := range []string{
+		"function 0: widen",
+		"function 1: main (entry)",
+		"CONST          0      ; Gear 1",
+		"WIDEN",
+		"CALL           0      ; widen",
+	} {
+		if !strings.Contains(listing, expected) {
+			t.Errorf("expected the listing to contain %q, got:\n%s", expected, listing)
+		}
+	}
+}
+
+// TestBytecode_Verify checks that malformed programs are rejected when they are loaded.
+func TestBytecode_Verify(t *testing.T) {
+	function := func(code ...byte) *Program {
+		return &Program{Functions: []*Function{{Name: "main", Locals: 1, Code: code}}}
+	}
+
+	tests := []struct {
+		name     string
+		program  *Program
+		expected string
+	}{
+		{"unknown opcode", function(0xFF), "unknown opcode 255"},
+		{"constant out of range", function(byte(OpConst), 0, 0, byte(OpReturn)), "CONST at offset 0"},
+		{"local out of range", function(byte(OpLoad), 1, 0, byte(OpReturn)), "LOAD at offset 0"},
+		{"jump inside an instruction", function(byte(OpJump), 2, 0, 0, 0, byte(OpNil), byte(OpReturn)), "JUMP at offset 0"},
+		{"missing return", function(byte(OpNil)), "does not end with RETURN"},
+		{"truncated operand", function(byte(OpReturn), byte(OpLoad), 0), "is cut short"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var encoded bytes.Buffer
+			if err := Encode(test.program, &encoded); err != nil {
+				t.Fatalf("failed to encode: %v", err)
+			}
+			_, err := Load(&encoded)
+			if err == nil || !strings.Contains(err.Error(), test.expected) {
+				t.Errorf("expected an error containing %q, got %v", test.expected, err)
+			}
+		})
+	}
+
+	if _, err := Load(strings.NewReader("ELF")); err == nil || !strings.Contains(err.Error(), errBadMagic) {
+		t.Errorf("expected %q, got %v", errBadMagic, err)
+	}
+}
@@ -0,0 +1,591 @@
+package bytecode
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"mechanus-compiler/internal/ast"
+	"mechanus-compiler/internal/compiler_error"
+	"mechanus-compiler/internal/logger"
+	"mechanus-compiler/internal/semantic"
+	"os"
+)
+
+// Compiler :
+// This is the structure responsible for turning a checked Construct into a Program. Every Architect becomes a Function
+// and every variable or parameter gets its own local slot.
+type Compiler struct {
+	logger    *logger.Logger
+	info      *semantic.Info
+	program   *Program
+	constants map[any]int
+	functions map[string]int
+	// State of the function being compiled
+	function *Function
+	slots    map[*semantic.Symbol]int
+}
+
+// NewCompiler :
+// Initializes a new Compiler instance. info must be the result of a successful semantic analysis of the Construct
+// that will be compiled.
+func NewCompiler(info *semantic.Info, debug bool) Compiler {
+	// Initialize the logger. Log to Stderr. Set level based on the debug flag.
+	logLevel := logger.LevelInfo
+	if debug {
+		logLevel = logger.LevelDebug
+	}
+
+	return Compiler{
+		logger: logger.New(os.Stderr, logLevel),
+		info:   info,
+	}
+}
+
+// Run :
+// Compiles the given Construct.
+//
+// Fails if the Construct has no main Architect, or if it needs more constants, locals or Architects than the operands
+// of the format can address.
+func (compiler *Compiler) Run(construct *ast.Construct) (*Program, error) {
+	compiler.program = &Program{}
+	compiler.constants = make(map[any]int)
+	compiler.functions = make(map[string]int)
+
+	if compiler.info.Main == nil {
+		return nil, compiler.fail(errors.New(compiler_error.MissingMain))
+	}
+
+	// The parser stores the Architects bottom-to-top, so they are numbered in reverse to follow the source file
+	for i := len(construct.Architects) - 1; i >= 0; i-- {
+		architect := construct.Architects[i]
+		compiler.functions[architect.Name] = len(compiler.program.Functions)
+		compiler.program.Functions = append(compiler.program.Functions, &Function{
+			Name:       architect.Name,
+			Parameters: len(architect.Parameters),
+			ReturnType: semantic.ReturnType(architect).Underlying(),
+		})
+	}
+	if len(compiler.program.Functions) > math.MaxUint16+1 {
+		return nil, compiler.fail(fmt.Errorf(errTooManyFunctions, len(compiler.program.Functions)))
+	}
+	compiler.program.Entry = compiler.functions[compiler.info.Main.Name]
+
+	for _, architect := range construct.Architects {
+		if err := compiler.architect(architect); err != nil {
+			return nil, compiler.fail(err)
+		}
+	}
+
+	compiler.logger.Info(compiler_error.CodegenSuccess, nil)
+	return compiler.program, nil
+}
+
+//**********************************************************************************************************************
+// Architects and commands
+//**********************************************************************************************************************
+
+// architect :
+// Compiles a single Architect. A function that reaches the end of its code returns the zero value of its type.
+func (compiler *Compiler) architect(architect *ast.Architect) error {
+	compiler.logger.Debug("Compiling Architect", map[string]any{"name": architect.Name})
+
+	compiler.function = compiler.program.Functions[compiler.functions[architect.Name]]
+	compiler.slots = make(map[*semantic.Symbol]int)
+
+	for _, parameter := range architect.Parameters {
+		if _, err := compiler.slot(compiler.info.Defs[parameter]); err != nil {
+			return err
+		}
+	}
+	if err := compiler.block(architect.Body); err != nil {
+		return err
+	}
+
+	if err := compiler.zeroValue(compiler.function.ReturnType); err != nil {
+		return err
+	}
+	compiler.emit(OpReturn)
+	return nil
+}
+
+// block :
+// Compiles the commands of a block in execution order.
+func (compiler *Compiler) block(block *ast.Block) error {
+	for _, command := range block.Commands {
+		if err := compiler.command(command); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// command :
+// Compiles a single command.
+func (compiler *Compiler) command(command ast.Command) error {
+	switch cmd := command.(type) {
+	case *ast.CmdIf:
+		return compiler.cmdIf(cmd)
+	case *ast.CmdFor:
+		if cmd.Elements != nil {
+			return compiler.iteration(cmd)
+		}
+		start := len(compiler.function.Code)
+		exits, err := compiler.condition(cmd.Condition, false)
+		if err != nil {
+			return err
+		}
+		if err := compiler.block(cmd.Body); err != nil {
+			return err
+		}
+		compiler.emitOperand(OpJump, start)
+		compiler.patchJumps(exits)
+	case *ast.CmdDeclaration:
+		if err := compiler.value(cmd.Value, cmd.Type); err != nil {
+			return err
+		}
+		if cmd.Type.IsChannel() && compiler.info.Types[cmd.Value] == ast.TypeGear {
+			compiler.emit(OpChannel)
+		}
+		slot, err := compiler.slot(compiler.info.Defs[cmd])
+		if err != nil {
+			return err
+		}
+		compiler.emitOperand(OpStore, slot)
+	case *ast.CmdAssignment:
+		symbol := compiler.info.Uses[cmd]
+		if cmd.Index == nil {
+			if err := compiler.value(cmd.Value, symbol.Type); err != nil {
+				return err
+			}
+			compiler.emitOperand(OpStore, compiler.slots[symbol])
+			break
+		}
+		if err := compiler.value(cmd.Value, symbol.Type.Element()); err != nil {
+			return err
+		}
+		if err := compiler.expr(cmd.Index); err != nil {
+			return err
+		}
+		compiler.emitOperand(OpLoad, compiler.slots[symbol])
+		compiler.emit(OpStoreIndex)
+	case *ast.CmdReceive:
+		symbol := compiler.info.Uses[cmd]
+		if cmd.Channel != nil {
+			if err := compiler.expr(cmd.Channel); err != nil {
+				return err
+			}
+			compiler.emit(OpReceiveChannel)
+			if compiler.info.Types[cmd.Channel].Element() == ast.TypeGear && symbol.Type == ast.TypeTensor {
+				compiler.emit(OpWiden)
+			}
+		} else {
+			compiler.emitOperand(OpReceive, int(symbol.Type))
+		}
+		compiler.emitOperand(OpStore, compiler.slots[symbol])
+	case *ast.CmdSend:
+		if cmd.Channel == nil {
+			// A State is written as the name of its member, selected among the names of its set
+			state, ok := compiler.info.States[compiler.info.Types[cmd.Value]]
+			if ok {
+				for _, member := range state.Members {
+					if err := compiler.constant(member.Name); err != nil {
+						return err
+					}
+				}
+			}
+			if err := compiler.expr(cmd.Value); err != nil {
+				return err
+			}
+			if ok {
+				compiler.emitOperand(OpSelect, len(state.Members))
+			}
+			compiler.emit(OpSend)
+			break
+		}
+		if err := compiler.value(cmd.Value, compiler.info.Types[cmd.Channel].Element()); err != nil {
+			return err
+		}
+		if err := compiler.expr(cmd.Channel); err != nil {
+			return err
+		}
+		compiler.emit(OpSendChannel)
+	case *ast.CmdAppend:
+		if err := compiler.value(cmd.Value, compiler.info.Types[cmd.Assembly].Element()); err != nil {
+			return err
+		}
+		if err := compiler.expr(cmd.Assembly); err != nil {
+			return err
+		}
+		compiler.emit(OpAppend)
+	case *ast.CmdIntegrate:
+		if err := compiler.value(cmd.Value, compiler.function.ReturnType); err != nil {
+			return err
+		}
+		compiler.emit(OpReturn)
+	case *ast.CmdCall:
+		if err := compiler.expr(cmd.Call); err != nil {
+			return err
+		}
+		// A detached call leaves nothing on the stack
+		if !cmd.Call.Detached {
+			compiler.emit(OpPop)
+		}
+	}
+	return nil
+}
+
+// iteration :
+// Compiles a for over the elements of an Assembly. The Assembly, its length when the loop starts and the index of the
+// current element are kept in locals of their own, which no variable uses.
+func (compiler *Compiler) iteration(cmd *ast.CmdFor) error {
+	assembly, err := compiler.slot(nil)
+	if err != nil {
+		return err
+	}
+	length, err := compiler.slot(nil)
+	if err != nil {
+		return err
+	}
+	index, err := compiler.slot(nil)
+	if err != nil {
+		return err
+	}
+	variable, err := compiler.slot(compiler.info.Defs[cmd])
+	if err != nil {
+		return err
+	}
+
+	if err := compiler.expr(cmd.Elements); err != nil {
+		return err
+	}
+	compiler.emitOperand(OpStore, assembly)
+	compiler.emitOperand(OpLoad, assembly)
+	compiler.emit(OpLength)
+	compiler.emitOperand(OpStore, length)
+	if err := compiler.constant(int64(0)); err != nil {
+		return err
+	}
+	compiler.emitOperand(OpStore, index)
+
+	start := len(compiler.function.Code)
+	compiler.emitOperand(OpLoad, index)
+	compiler.emitOperand(OpLoad, length)
+	compiler.emit(OpLess)
+	exit := compiler.emitJump(OpJumpIfFalse)
+	compiler.emitOperand(OpLoad, index)
+	compiler.emitOperand(OpLoad, assembly)
+	compiler.emit(OpIndex)
+	if compiler.info.Types[cmd.Elements].Element() == ast.TypeGear && cmd.Type == ast.TypeTensor {
+		compiler.emit(OpWiden)
+	}
+	compiler.emitOperand(OpStore, variable)
+
+	if err := compiler.block(cmd.Body); err != nil {
+		return err
+	}
+	compiler.emitOperand(OpLoad, index)
+	if err := compiler.constant(int64(1)); err != nil {
+		return err
+	}
+	compiler.emit(OpAdd)
+	compiler.emitOperand(OpStore, index)
+	compiler.emitOperand(OpJump, start)
+	compiler.patchJumps([]int{exit})
+	return nil
+}
+
+// cmdIf :
+// Compiles an if with its elifs and else. Every branch but the last one jumps to the end once it is done.
+func (compiler *Compiler) cmdIf(cmd *ast.CmdIf) error {
+	conditions := []ast.Expr{cmd.Condition}
+	bodies := []*ast.Block{cmd.Then}
+	for _, elif := range cmd.Elifs {
+		conditions = append(conditions, elif.Condition)
+		bodies = append(bodies, elif.Body)
+	}
+
+	var ends []int
+	for i, condition := range conditions {
+		next, err := compiler.condition(condition, false)
+		if err != nil {
+			return err
+		}
+		if err := compiler.block(bodies[i]); err != nil {
+			return err
+		}
+		if i < len(conditions)-1 || cmd.Else != nil {
+			ends = append(ends, compiler.emitJump(OpJump))
+		}
+		compiler.patchJumps(next)
+	}
+
+	if cmd.Else != nil {
+		if err := compiler.block(cmd.Else); err != nil {
+			return err
+		}
+	}
+	compiler.patchJumps(ends)
+	return nil
+}
+
+// condition :
+// Compiles a <CONDITION> into jumps taken when its result equals jumpIf, and returns their offsets to be fixed by
+// patchJumps. The code falls through otherwise. The right side of '&&' and '||' is skipped once the left side decides
+// the result, and '!' only swaps the jumps.
+func (compiler *Compiler) condition(condition ast.Expr, jumpIf bool) ([]int, error) {
+	switch c := condition.(type) {
+	case *ast.UnaryExpr:
+		if c.Operator == ast.OpNot {
+			return compiler.condition(c.Operand, !jumpIf)
+		}
+	case *ast.BinaryExpr:
+		if c.Operator == ast.OpAnd || c.Operator == ast.OpOr {
+			// The left side of '&&' decides the result when it is false, and the left side of '||' when it is true
+			decides := c.Operator == ast.OpOr
+			left, err := compiler.condition(c.Left, decides)
+			if err != nil {
+				return nil, err
+			}
+			right, err := compiler.condition(c.Right, jumpIf)
+			if err != nil {
+				return nil, err
+			}
+			if decides == jumpIf {
+				return append(left, right...), nil
+			}
+			compiler.patchJumps(left)
+			return right, nil
+		}
+	}
+
+	if err := compiler.expr(condition); err != nil {
+		return nil, err
+	}
+	if jumpIf {
+		return []int{compiler.emitJump(OpJumpIfTrue)}, nil
+	}
+	return []int{compiler.emitJump(OpJumpIfFalse)}, nil
+}
+
+// switchValue :
+// Pushes the Switch given by '&&', '||' or '!'. It is compiled like a condition, so the right side of '&&' and '||'
+// is still skipped once the left side decides the result.
+func (compiler *Compiler) switchValue(expr ast.Expr) error {
+	otherwise, err := compiler.condition(expr, false)
+	if err != nil {
+		return err
+	}
+	if err := compiler.constant(true); err != nil {
+		return err
+	}
+	end := compiler.emitJump(OpJump)
+	compiler.patchJumps(otherwise)
+	if err := compiler.constant(false); err != nil {
+		return err
+	}
+	compiler.patchJumps([]int{end})
+	return nil
+}
+
+//**********************************************************************************************************************
+// Expressions
+//**********************************************************************************************************************
+
+// value :
+// Compiles an expression whose result is stored as the given type, widening a Gear into a Tensor when needed.
+func (compiler *Compiler) value(expr ast.Expr, to ast.Type) error {
+	if err := compiler.expr(expr); err != nil {
+		return err
+	}
+	if compiler.info.Types[expr] == ast.TypeGear && to == ast.TypeTensor {
+		compiler.emit(OpWiden)
+	}
+	return nil
+}
+
+// expr :
+// Compiles an expression, leaving its value on top of the stack. Operands and arguments are evaluated from left to
+// right.
+func (compiler *Compiler) expr(expr ast.Expr) error {
+	switch e := expr.(type) {
+	case *ast.GearLiteral:
+		return compiler.constant(e.Value)
+	case *ast.TensorLiteral:
+		return compiler.constant(e.Value)
+	case *ast.MonodroneLiteral:
+		return compiler.constant(e.Value)
+	case *ast.OmnidroneLiteral:
+		return compiler.constant(e.Value)
+	case *ast.SwitchLiteral:
+		return compiler.constant(e.Value)
+	case *ast.NilLiteral:
+		compiler.emit(OpNil)
+	case *ast.Identifier:
+		symbol := compiler.info.Uses[e]
+		if symbol.Kind == semantic.SymbolMember {
+			return compiler.constant(symbol.Value)
+		}
+		compiler.emitOperand(OpLoad, compiler.slots[symbol])
+	case *ast.UnaryExpr:
+		if e.Operator == ast.OpNot {
+			return compiler.switchValue(e)
+		}
+		if err := compiler.expr(e.Operand); err != nil {
+			return err
+		}
+		compiler.emit(OpNeg)
+	case *ast.BinaryExpr:
+		if e.Operator.IsLogical() {
+			return compiler.switchValue(e)
+		}
+		if err := compiler.expr(e.Left); err != nil {
+			return err
+		}
+		if err := compiler.expr(e.Right); err != nil {
+			return err
+		}
+		if opcode, ok := arithmeticOpcodes[e.Operator]; ok {
+			compiler.emit(opcode)
+		} else {
+			compiler.emit(comparisonOpcodes[e.Operator])
+		}
+	case *ast.CallExpr:
+		architect := compiler.info.Calls[e]
+		for i, argument := range e.Arguments {
+			if err := compiler.value(argument, architect.Parameters[i].Type); err != nil {
+				return err
+			}
+		}
+		if e.Detached {
+			compiler.emitOperand(OpDetach, compiler.functions[architect.Name])
+		} else {
+			compiler.emitOperand(OpCall, compiler.functions[architect.Name])
+		}
+	case *ast.AssemblyLiteral:
+		if len(e.Elements) > math.MaxUint16 {
+			return fmt.Errorf(errTooManyElements, len(e.Elements))
+		}
+		for _, element := range e.Elements {
+			if err := compiler.value(element, e.Type.Element()); err != nil {
+				return err
+			}
+		}
+		compiler.emitOperand(OpAssembly, len(e.Elements))
+	case *ast.IndexExpr:
+		if err := compiler.expr(e.Index); err != nil {
+			return err
+		}
+		if err := compiler.expr(e.Assembly); err != nil {
+			return err
+		}
+		compiler.emit(OpIndex)
+	case *ast.LengthExpr:
+		if err := compiler.expr(e.Assembly); err != nil {
+			return err
+		}
+		compiler.emit(OpLength)
+	}
+	return nil
+}
+
+// zeroValue :
+// Pushes the zero value of a type.
+func (compiler *Compiler) zeroValue(t ast.Type) error {
+	// Nil also stands for a Channel that was never made
+	if t == ast.TypeNil || t.IsChannel() {
+		compiler.emit(OpNil)
+		return nil
+	}
+	if t.IsAssembly() {
+		compiler.emitOperand(OpAssembly, 0)
+		return nil
+	}
+	switch t {
+	case ast.TypeTensor:
+		return compiler.constant(float64(0))
+	case ast.TypeMonodrone:
+		return compiler.constant(rune(0))
+	case ast.TypeOmnidrone:
+		return compiler.constant("")
+	case ast.TypeSwitch:
+		return compiler.constant(false)
+	default:
+		return compiler.constant(int64(0))
+	}
+}
+
+//**********************************************************************************************************************
+// Helpers
+//**********************************************************************************************************************
+
+// constant :
+// Pushes a constant, adding it to the pool the first time it is used.
+func (compiler *Compiler) constant(value any) error {
+	index, ok := compiler.constants[value]
+	if !ok {
+		index = len(compiler.program.Constants)
+		if index > math.MaxUint16 {
+			return fmt.Errorf(errTooManyConstants, index+1)
+		}
+		compiler.constants[value] = index
+		compiler.program.Constants = append(compiler.program.Constants, value)
+	}
+	compiler.emitOperand(OpConst, index)
+	return nil
+}
+
+// slot :
+// Assigns the next local slot of the current function to a symbol, or to nothing if symbol is nil.
+func (compiler *Compiler) slot(symbol *semantic.Symbol) (int, error) {
+	index := compiler.function.Locals
+	if index > math.MaxUint16 {
+		return 0, fmt.Errorf(errTooManyLocals, compiler.function.Name)
+	}
+	if symbol != nil {
+		compiler.slots[symbol] = index
+	}
+	compiler.function.Locals++
+	return index, nil
+}
+
+// emit :
+// Appends an instruction without operand to the current function.
+func (compiler *Compiler) emit(op Opcode) {
+	compiler.function.Code = append(compiler.function.Code, byte(op))
+}
+
+// emitOperand :
+// Appends an instruction and its operand to the current function.
+func (compiler *Compiler) emitOperand(op Opcode, operand int) {
+	compiler.emit(op)
+	for i := 0; i < op.OperandWidth(); i++ {
+		compiler.function.Code = append(compiler.function.Code, byte(operand>>(8*i)))
+	}
+}
+
+// emitJump :
+// Appends a jump whose target is not known yet and returns its offset, to be fixed by patchJump.
+func (compiler *Compiler) emitJump(op Opcode) int {
+	offset := len(compiler.function.Code)
+	compiler.emitOperand(op, 0)
+	return offset
+}
+
+// patchJumps :
+// Points the jumps at the given offsets to the end of the code generated so far.
+func (compiler *Compiler) patchJumps(offsets []int) {
+	target := len(compiler.function.Code)
+	for _, offset := range offsets {
+		for i := 0; i < 4; i++ {
+			compiler.function.Code[offset+1+i] = byte(target >> (8 * i))
+		}
+	}
+}
+
+// fail :
+// Wraps and logs an error that stopped the compilation.
+func (compiler *Compiler) fail(err error) error {
+	err = compiler_error.CodegenErrorf(compiler_error.CodegenError, err)
+	compiler.logger.Error(err, nil)
+	return err
+}
@@ -0,0 +1,90 @@
+package bytecode
+
+import (
+	"fmt"
+	"mechanus-compiler/internal/ast"
+	"strconv"
+	"strings"
+)
+
+// Disassemble :
+// Returns a human-readable listing of the program: the constant pool, then the code of every function with one
+// instruction per line. Operands that refer to constants and functions are followed by what they refer to.
+func Disassemble(program *Program) string {
+	var builder strings.Builder
+
+	builder.WriteString("constants:\n")
+	for i, constant := range program.Constants {
+		builder.WriteString(fmt.Sprintf("    %4d  %s\n", i, formatConstant(constant)))
+	}
+
+	for i, function := range program.Functions {
+		entry := ""
+		if i == program.Entry {
+			entry = " (entry)"
+		}
+		builder.WriteString(fmt.Sprintf("\nfunction %d: %s%s\n", i, function.Name, entry))
+		builder.WriteString(fmt.Sprintf("    parameters: %d, locals: %d, returns: %s\n", function.Parameters,
+			function.Locals, function.ReturnType))
+
+		for offset := 0; offset < len(function.Code); {
+			instruction, err := Decode(function.Code, offset)
+			if err != nil {
+				builder.WriteString(fmt.Sprintf("    %04d  <%v>\n", offset, err))
+				break
+			}
+			builder.WriteString(fmt.Sprintf("    %04d  %s\n", offset, formatInstruction(program, instruction)))
+			offset += instruction.Size()
+		}
+	}
+
+	return builder.String()
+}
+
+// formatInstruction :
+// Formats a single instruction with its operand.
+func formatInstruction(program *Program, instruction Instruction) string {
+	name := instruction.Opcode.String()
+	switch instruction.Opcode {
+	case OpConst:
+		if instruction.Operand < len(program.Constants) {
+			constant := formatConstant(program.Constants[instruction.Operand])
+			return fmt.Sprintf("%-14s %-6d ; %s", name, instruction.Operand, constant)
+		}
+	case OpCall, OpDetach:
+		if instruction.Operand < len(program.Functions) {
+			function := program.Functions[instruction.Operand].Name
+			return fmt.Sprintf("%-14s %-6d ; %s", name, instruction.Operand, function)
+		}
+	case OpReceive:
+		return fmt.Sprintf("%-14s %s", name, ast.Type(instruction.Operand))
+	}
+
+	if instruction.Opcode.OperandWidth() == 0 {
+		return name
+	}
+	return fmt.Sprintf("%-14s %d", name, instruction.Operand)
+}
+
+// formatConstant :
+// Formats a constant with its type, quoting Monodrones and Omnidrones.
+func formatConstant(constant any) string {
+	switch value := constant.(type) {
+	case int64:
+		return "Gear " + strconv.FormatInt(value, 10)
+	case float64:
+		text := strconv.FormatFloat(value, 'g', -1, 64)
+		if !strings.ContainsAny(text, ".eEnN") {
+			text += ".0"
+		}
+		return "Tensor " + text
+	case rune:
+		return "Monodrone " + strconv.QuoteRune(value)
+	case string:
+		return "Omnidrone " + strconv.Quote(value)
+	case bool:
+		return "Switch " + strconv.FormatBool(value)
+	default:
+		return fmt.Sprint(value)
+	}
+}
@@ -0,0 +1,246 @@
+package bytecode
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"mechanus-compiler/internal/ast"
+)
+
+// A .mechc file starts with Magic and Version, followed by the constant pool, the functions and the entry index. Every
+// number is little-endian:
+//
+//	constants: u32 count, then per constant a u8 ast.Type tag and its payload
+//	           (Gear: i64, Tensor: f64 bits, Monodrone: i32, Omnidrone: u32 length and UTF-8 bytes, Switch: u8)
+//	functions: u32 count, then per function a u16 name length and name, u16 parameters, u16 locals,
+//	           u8 return ast.Type, u32 code length and code
+//	entry:     u32 function index
+const (
+	Magic   = "MECH"
+	Version = 3
+	// Extension is the file extension of compiled programs.
+	Extension = ".mechc"
+)
+
+const (
+	errBadMagic             = "not a Mechanus bytecode file"
+	errBadVersion           = "unsupported bytecode version %d, expected %d"
+	errBadConstant          = "constant %d has an unknown type tag %d"
+	errUnknownOpcode        = "unknown opcode %d at offset %d"
+	errTruncatedInstruction = "instruction %s at offset %d is cut short"
+	errBadOperand           = "%s at offset %d of '%s' refers to %d, which is out of range"
+	errBadEntry             = "entry function %d is out of range"
+	errBadLocals            = "function '%s' has %d parameter(s) but only %d local(s)"
+	errMissingReturn        = "function '%s' does not end with RETURN"
+	errTooManyConstants     = "too many constants: %d"
+	errTooManyFunctions     = "too many Architects: %d"
+	errTooManyElements      = "too many elements in an Assembly literal: %d"
+	errTooManyLocals        = "too many variables in Architect '%s'"
+)
+
+// Encode :
+// Writes the program in the .mechc format.
+func Encode(program *Program, w io.Writer) error {
+	out := bufio.NewWriter(w)
+	write := func(value any) {
+		// Writes to a bufio.Writer only fail once the underlying writer does, which Flush reports
+		_ = binary.Write(out, binary.LittleEndian, value)
+	}
+
+	out.WriteString(Magic)
+	write(uint8(Version))
+
+	write(uint32(len(program.Constants)))
+	for _, constant := range program.Constants {
+		switch value := constant.(type) {
+		case int64:
+			write(uint8(ast.TypeGear))
+			write(value)
+		case float64:
+			write(uint8(ast.TypeTensor))
+			write(math.Float64bits(value))
+		case rune:
+			write(uint8(ast.TypeMonodrone))
+			write(value)
+		case string:
+			write(uint8(ast.TypeOmnidrone))
+			write(uint32(len(value)))
+			out.WriteString(value)
+		case bool:
+			write(uint8(ast.TypeSwitch))
+			write(value)
+		default:
+			return fmt.Errorf("unexpected constant %T", constant)
+		}
+	}
+
+	write(uint32(len(program.Functions)))
+	for _, function := range program.Functions {
+		write(uint16(len(function.Name)))
+		out.WriteString(function.Name)
+		write(uint16(function.Parameters))
+		write(uint16(function.Locals))
+		write(uint8(function.ReturnType))
+		write(uint32(len(function.Code)))
+		out.Write(function.Code)
+	}
+
+	write(uint32(program.Entry))
+	return out.Flush()
+}
+
+// Load :
+// Reads a program in the .mechc format and verifies it, so the VM can trust every operand.
+func Load(r io.Reader) (*Program, error) {
+	in := bufio.NewReader(r)
+	var err error
+	read := func(value any) {
+		if err == nil {
+			err = binary.Read(in, binary.LittleEndian, value)
+		}
+	}
+	readBytes := func(length int) []byte {
+		// Copying grows the buffer as the data arrives, so a corrupted length cannot allocate gigabytes up front
+		var data bytes.Buffer
+		if err == nil {
+			_, err = io.CopyN(&data, in, int64(length))
+		}
+		return data.Bytes()
+	}
+
+	if magic := readBytes(len(Magic)); err != nil || !bytes.Equal(magic, []byte(Magic)) {
+		return nil, errors.New(errBadMagic)
+	}
+	var version uint8
+	read(&version)
+	if err == nil && version != Version {
+		return nil, fmt.Errorf(errBadVersion, version, Version)
+	}
+
+	program := &Program{}
+
+	var count uint32
+	read(&count)
+	for i := 0; err == nil && i < int(count); i++ {
+		var tag uint8
+		read(&tag)
+		switch ast.Type(tag) {
+		case ast.TypeGear:
+			var value int64
+			read(&value)
+			program.Constants = append(program.Constants, value)
+		case ast.TypeTensor:
+			var bits uint64
+			read(&bits)
+			program.Constants = append(program.Constants, math.Float64frombits(bits))
+		case ast.TypeMonodrone:
+			var value rune
+			read(&value)
+			program.Constants = append(program.Constants, value)
+		case ast.TypeOmnidrone:
+			var length uint32
+			read(&length)
+			program.Constants = append(program.Constants, string(readBytes(int(length))))
+		case ast.TypeSwitch:
+			var value bool
+			read(&value)
+			program.Constants = append(program.Constants, value)
+		default:
+			if err == nil {
+				return nil, fmt.Errorf(errBadConstant, i, tag)
+			}
+		}
+	}
+
+	read(&count)
+	for i := 0; err == nil && i < int(count); i++ {
+		var nameLength, parameters, locals uint16
+		var returnType uint8
+		var codeLength uint32
+
+		read(&nameLength)
+		name := string(readBytes(int(nameLength)))
+		read(&parameters)
+		read(&locals)
+		read(&returnType)
+		read(&codeLength)
+		code := readBytes(int(codeLength))
+
+		program.Functions = append(program.Functions, &Function{
+			Name:       name,
+			Parameters: int(parameters),
+			Locals:     int(locals),
+			ReturnType: ast.Type(returnType),
+			Code:       code,
+		})
+	}
+
+	var entry uint32
+	read(&entry)
+	if err != nil {
+		return nil, fmt.Errorf("truncated bytecode file: %w", err)
+	}
+	program.Entry = int(entry)
+
+	if err := Verify(program); err != nil {
+		return nil, err
+	}
+	return program, nil
+}
+
+// Verify :
+// Checks that every instruction of the program is well formed and that its operands are in range: constants, locals
+// and functions must exist, jumps must land on an instruction and every function must end with RETURN.
+func Verify(program *Program) error {
+	if program.Entry < 0 || program.Entry >= len(program.Functions) {
+		return fmt.Errorf(errBadEntry, program.Entry)
+	}
+
+	for _, function := range program.Functions {
+		if function.Locals < function.Parameters {
+			return fmt.Errorf(errBadLocals, function.Name, function.Parameters, function.Locals)
+		}
+
+		starts := make(map[int]bool)
+		var jumps []Instruction
+		var last Instruction
+		for offset := 0; offset < len(function.Code); {
+			instruction, err := Decode(function.Code, offset)
+			if err != nil {
+				return err
+			}
+			starts[offset] = true
+			last = instruction
+
+			limit := -1
+			switch instruction.Opcode {
+			case OpConst:
+				limit = len(program.Constants)
+			case OpLoad, OpStore:
+				limit = function.Locals
+			case OpCall, OpDetach:
+				limit = len(program.Functions)
+			case OpJump, OpJumpIfFalse, OpJumpIfTrue:
+				jumps = append(jumps, instruction)
+			}
+			if limit >= 0 && instruction.Operand >= limit {
+				return fmt.Errorf(errBadOperand, instruction.Opcode, offset, function.Name, instruction.Operand)
+			}
+			offset += instruction.Size()
+		}
+
+		if len(function.Code) == 0 || last.Opcode != OpReturn {
+			return fmt.Errorf(errMissingReturn, function.Name)
+		}
+		for _, jump := range jumps {
+			if !starts[jump.Operand] {
+				return fmt.Errorf(errBadOperand, jump.Opcode, jump.Offset, function.Name, jump.Operand)
+			}
+		}
+	}
+	return nil
+}
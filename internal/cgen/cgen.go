@@ -0,0 +1,453 @@
+package cgen
+
+import (
+	"fmt"
+	"mechanus-compiler/internal/ast"
+	"mechanus-compiler/internal/compiler_error"
+	"mechanus-compiler/internal/logger"
+	"mechanus-compiler/internal/semantic"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Generator :
+// This is the structure responsible for turning a checked Construct into a C99 translation unit. Every Architect
+// becomes a C function and the C main function calls the "main" Architect, using the Gear it integrates as the exit
+// code of the process.
+type Generator struct {
+	logger *logger.Logger
+	info   *semantic.Info
+	names  map[*semantic.Symbol]string
+	taken  map[string]int
+	output strings.Builder
+	indent int
+}
+
+// indentation is the text used for each level of nesting in the generated code.
+const indentation = "    "
+
+// NewGenerator :
+// Initializes a new Generator instance. info must be the result of a successful semantic analysis of the Construct
+// that will be generated.
+func NewGenerator(info *semantic.Info, debug bool) Generator {
+	// Initialize the logger. Log to Stderr. Set level based on the debug flag.
+	logLevel := logger.LevelInfo
+	if debug {
+		logLevel = logger.LevelDebug
+	}
+
+	return Generator{
+		logger: logger.New(os.Stderr, logLevel),
+		info:   info,
+	}
+}
+
+// Run :
+// Generates the C source for the given Construct.
+//
+// Fails if the Construct has no main Architect, or if it detaches an Architect or uses Channels: the generated code
+// is C99, which has no threads to run a detached Architect on.
+func (generator *Generator) Run(construct *ast.Construct) (string, error) {
+	generator.output.Reset()
+	generator.names = make(map[*semantic.Symbol]string)
+	generator.taken = make(map[string]int)
+	generator.indent = 0
+
+	entry := generator.info.Main
+	if entry == nil {
+		err := compiler_error.CodegenErrorf(compiler_error.CodegenError, fmt.Errorf(compiler_error.MissingMain))
+		generator.logger.Error(err, nil)
+		return "", err
+	}
+
+	if generator.info.Concurrent {
+		unsupported := fmt.Errorf(compiler_error.Unsupported, "C")
+		err := compiler_error.CodegenErrorf(compiler_error.CodegenError, unsupported)
+		generator.logger.Error(err, nil)
+		return "", err
+	}
+
+	generator.output.WriteString(fmt.Sprintf("/* Generated from the %s Construct. */\n\n", construct.Name))
+	generator.output.WriteString(runtime)
+
+	// The parser stores the Architects bottom-to-top, so they are emitted in reverse to follow the source file
+	architects := make([]*ast.Architect, 0, len(construct.Architects))
+	for i := len(construct.Architects) - 1; i >= 0; i-- {
+		architects = append(architects, construct.Architects[i])
+	}
+
+	// Prototypes first, so every Architect can call any other one
+	generator.output.WriteString("\n")
+	for _, architect := range architects {
+		generator.line(generator.signature(architect) + ";")
+	}
+
+	for _, architect := range architects {
+		generator.output.WriteString("\n")
+		generator.architect(architect)
+	}
+
+	generator.output.WriteString("\n")
+	generator.line("int main(void) {")
+	generator.indent++
+	if semantic.ReturnType(entry) == ast.TypeGear {
+		generator.line(fmt.Sprintf("return (int)%s();", architectName(entry.Name)))
+	} else {
+		generator.line(fmt.Sprintf("%s();", architectName(entry.Name)))
+		generator.line("return 0;")
+	}
+	generator.indent--
+	generator.line("}")
+
+	generator.logger.Info(compiler_error.CodegenSuccess, nil)
+	return generator.output.String(), nil
+}
+
+//**********************************************************************************************************************
+// Architects and commands
+//**********************************************************************************************************************
+
+// signature :
+// Returns the C declaration of the function generated for an Architect.
+func (generator *Generator) signature(architect *ast.Architect) string {
+	parameters := make([]string, 0, len(architect.Parameters))
+	for _, parameter := range architect.Parameters {
+		name := generator.symbolName(generator.info.Defs[parameter])
+		parameters = append(parameters, cType(parameter.Type)+" "+name)
+	}
+	if len(parameters) == 0 {
+		parameters = append(parameters, "void")
+	}
+
+	returnType := cType(semantic.ReturnType(architect))
+	return fmt.Sprintf("%s %s(%s)", returnType, architectName(architect.Name), strings.Join(parameters, ", "))
+}
+
+// architect :
+// Generates the function of a single Architect. An Architect that reaches the end of its body without an Integrate
+// returns the zero value of its type.
+func (generator *Generator) architect(architect *ast.Architect) {
+	generator.logger.Debug("Generating Architect", map[string]any{"name": architect.Name})
+
+	generator.line(generator.signature(architect) + " {")
+	generator.indent++
+	generator.commands(architect.Body.Commands)
+	generator.line(fmt.Sprintf("return %s;", zeroValue(semantic.ReturnType(architect))))
+	generator.indent--
+	generator.line("}")
+}
+
+// block :
+// Generates the commands of a nested block one level deeper. The caller writes the braces around it.
+func (generator *Generator) block(block *ast.Block) {
+	generator.indent++
+	generator.commands(block.Commands)
+	generator.indent--
+}
+
+// commands :
+// Generates a list of commands. They are already stored in execution order.
+func (generator *Generator) commands(commands []ast.Command) {
+	for _, command := range commands {
+		generator.command(command)
+	}
+}
+
+// command :
+// Generates a single command.
+func (generator *Generator) command(command ast.Command) {
+	switch cmd := command.(type) {
+	case *ast.CmdIf:
+		generator.line(fmt.Sprintf("if (%s) {", generator.expr(cmd.Condition)))
+		generator.block(cmd.Then)
+		for _, elif := range cmd.Elifs {
+			generator.line(fmt.Sprintf("} else if (%s) {", generator.expr(elif.Condition)))
+			generator.block(elif.Body)
+		}
+		if cmd.Else != nil {
+			generator.line("} else {")
+			generator.block(cmd.Else)
+		}
+		generator.line("}")
+	case *ast.CmdFor:
+		if cmd.Elements != nil {
+			generator.iteration(cmd)
+			break
+		}
+		generator.line(fmt.Sprintf("while (%s) {", generator.expr(cmd.Condition)))
+		generator.block(cmd.Body)
+		generator.line("}")
+	case *ast.CmdDeclaration:
+		name := generator.symbolName(generator.info.Defs[cmd])
+		generator.line(fmt.Sprintf("%s %s = %s;", cType(cmd.Type), name, generator.expr(cmd.Value)))
+	case *ast.CmdAssignment:
+		symbol := generator.info.Uses[cmd]
+		name := generator.symbolName(symbol)
+		if cmd.Index == nil {
+			generator.line(fmt.Sprintf("%s = %s;", name, generator.expr(cmd.Value)))
+			break
+		}
+		element := cType(symbol.Type.Element())
+		generator.store(element, generator.expr(cmd.Value),
+			fmt.Sprintf("(%s *)mecha_assembly_at(%s, %s)", element, name, generator.expr(cmd.Index)))
+	case *ast.CmdReceive:
+		symbol := generator.info.Uses[cmd]
+		generator.line(fmt.Sprintf("%s = mecha_receive_%s();", generator.symbolName(symbol), runtimeSuffix(symbol.Type)))
+	case *ast.CmdSend:
+		t := generator.info.Types[cmd.Value]
+		// A State is written as the name of its member, taken from an array of the names of its set
+		if state, ok := generator.info.States[t]; ok {
+			names := make([]string, 0, len(state.Members))
+			for _, member := range state.Members {
+				names = append(names, stringLiteral(member.Name))
+			}
+			generator.line(fmt.Sprintf("mecha_send_omnidrone(((const mecha_omnidrone[]){%s})[%s]);",
+				strings.Join(names, ", "), generator.expr(cmd.Value)))
+			break
+		}
+		generator.line(fmt.Sprintf("mecha_send_%s(%s);", runtimeSuffix(t), generator.expr(cmd.Value)))
+	case *ast.CmdAppend:
+		element := cType(generator.info.Types[cmd.Assembly].Element())
+		generator.store(element, generator.expr(cmd.Value),
+			fmt.Sprintf("(%s *)mecha_assembly_push(%s)", element, generator.expr(cmd.Assembly)))
+	case *ast.CmdIntegrate:
+		generator.line(fmt.Sprintf("return %s;", generator.expr(cmd.Value)))
+	case *ast.CmdCall:
+		generator.line(generator.expr(cmd.Call) + ";")
+	}
+}
+
+// store :
+// Writes a value to the address of an element of an Assembly. The value is computed first, since computing it may
+// append to the same Assembly and move its elements.
+func (generator *Generator) store(element, value, address string) {
+	generator.line("{")
+	generator.indent++
+	generator.line(fmt.Sprintf("%s mecha_value = %s;", element, value))
+	generator.line(fmt.Sprintf("*%s = mecha_value;", address))
+	generator.indent--
+	generator.line("}")
+}
+
+// iteration :
+// Generates a for over the elements of an Assembly. The Assembly and its length are taken once, before the loop, in
+// variables whose names no symbol can take; a nested loop shadows them with its own.
+func (generator *Generator) iteration(cmd *ast.CmdFor) {
+	element := cType(generator.info.Types[cmd.Elements].Element())
+	generator.line("{")
+	generator.indent++
+	generator.line(fmt.Sprintf("mecha_assembly mecha_elements = %s;", generator.expr(cmd.Elements)))
+	generator.line("mecha_gear mecha_length = mecha_assembly_length(mecha_elements);")
+	generator.line("for (mecha_gear mecha_index = 0; mecha_index < mecha_length; mecha_index++) {")
+	generator.indent++
+	generator.line(fmt.Sprintf("%s %s = *(%s *)mecha_assembly_at(mecha_elements, mecha_index);", cType(cmd.Type),
+		generator.symbolName(generator.info.Defs[cmd]), element))
+	generator.commands(cmd.Body.Commands)
+	generator.indent--
+	generator.line("}")
+	generator.indent--
+	generator.line("}")
+}
+
+//**********************************************************************************************************************
+// Expressions
+//**********************************************************************************************************************
+
+// expr :
+// Returns the C expression for a Mechanus expression. Every operation is parenthesized, so the precedence rules of C
+// never come into play.
+func (generator *Generator) expr(expr ast.Expr) string {
+	switch e := expr.(type) {
+	case *ast.GearLiteral:
+		return fmt.Sprintf("INT64_C(%d)", e.Value)
+	case *ast.TensorLiteral:
+		return tensorLiteral(e.Value)
+	case *ast.MonodroneLiteral:
+		return fmt.Sprintf("((mecha_monodrone)%d)", e.Value)
+	case *ast.OmnidroneLiteral:
+		return stringLiteral(e.Value)
+	case *ast.SwitchLiteral:
+		if e.Value {
+			return "true"
+		}
+		return "false"
+	case *ast.NilLiteral:
+		return "((mecha_nil)0)"
+	case *ast.Identifier:
+		symbol := generator.info.Uses[e]
+		if symbol.Kind == semantic.SymbolMember {
+			return fmt.Sprintf("((mecha_state)%d)", symbol.Value)
+		}
+		return generator.symbolName(symbol)
+	case *ast.UnaryExpr:
+		return fmt.Sprintf("(%s%s)", e.Operator, generator.expr(e.Operand))
+	case *ast.BinaryExpr:
+		return generator.binary(e)
+	case *ast.CallExpr:
+		return fmt.Sprintf("%s(%s)", architectName(e.Name), strings.Join(generator.exprs(e.Arguments), ", "))
+	case *ast.AssemblyLiteral:
+		return assembly(e.Type, generator.exprs(e.Elements))
+	case *ast.IndexExpr:
+		element := cType(generator.info.Types[e])
+		return fmt.Sprintf("(*(%s *)mecha_assembly_at(%s, %s))", element, generator.expr(e.Assembly),
+			generator.expr(e.Index))
+	case *ast.LengthExpr:
+		return fmt.Sprintf("mecha_assembly_length(%s)", generator.expr(e.Assembly))
+	}
+	return ""
+}
+
+// exprs :
+// Returns the C expressions for a list of Mechanus expressions, such as the arguments of a call.
+func (generator *Generator) exprs(exprs []ast.Expr) []string {
+	values := make([]string, 0, len(exprs))
+	for _, expr := range exprs {
+		values = append(values, generator.expr(expr))
+	}
+	return values
+}
+
+// binary :
+// Returns the C expression for an arithmetic operation, a comparison or a logical operation. Gear division and modulo
+// go through the runtime, which stops the program on a division by zero, and Omnidrones are compared by content. C
+// already skips the right side of '&&' and '||' once the left side decides the result.
+func (generator *Generator) binary(e *ast.BinaryExpr) string {
+	left := generator.expr(e.Left)
+	right := generator.expr(e.Right)
+
+	if e.Operator.IsComparison() || e.Operator.IsLogical() {
+		if generator.info.Types[e.Left] == ast.TypeOmnidrone {
+			equal := fmt.Sprintf("mecha_omnidrone_equal(%s, %s)", left, right)
+			if e.Operator == ast.OpNotEqual {
+				return "(!" + equal + ")"
+			}
+			return equal
+		}
+		return fmt.Sprintf("(%s %s %s)", left, e.Operator, right)
+	}
+
+	if generator.info.Types[e] == ast.TypeGear {
+		switch e.Operator {
+		case ast.OpDiv:
+			return fmt.Sprintf("mecha_gear_div(%s, %s)", left, right)
+		case ast.OpMod:
+			return fmt.Sprintf("mecha_gear_mod(%s, %s)", left, right)
+		}
+	}
+	return fmt.Sprintf("(%s %s %s)", left, e.Operator, right)
+}
+
+//**********************************************************************************************************************
+// Helpers
+//**********************************************************************************************************************
+
+// symbolName :
+// Returns the C name of a variable or parameter. Every symbol gets its own name, since a shadowing declaration such
+// as "x + 1 =: Gear :x" reads the outer x, while in C the new variable would already be in scope in its initializer.
+func (generator *Generator) symbolName(symbol *semantic.Symbol) string {
+	if name, ok := generator.names[symbol]; ok {
+		return name
+	}
+
+	name := "m_" + symbol.Name
+	if count := generator.taken[name]; count > 0 {
+		name = fmt.Sprintf("%s_%d", name, count)
+	}
+	generator.taken["m_"+symbol.Name]++
+	generator.names[symbol] = name
+	return name
+}
+
+// line :
+// Writes a single line of code at the current indentation.
+func (generator *Generator) line(code string) {
+	generator.output.WriteString(strings.Repeat(indentation, generator.indent))
+	generator.output.WriteString(code)
+	generator.output.WriteString("\n")
+}
+
+// architectName :
+// Returns the C name of the function generated for an Architect. The prefix keeps Architects such as "main" or
+// "printf" from clashing with C.
+func architectName(name string) string {
+	return "mecha_" + name
+}
+
+// cType :
+// Returns the C type used for a Mechanus type. Assemblies of every type share a single C type.
+func cType(t ast.Type) string {
+	if t.IsAssembly() {
+		return "mecha_assembly"
+	}
+	return "mecha_" + runtimeSuffix(t)
+}
+
+// runtimeSuffix :
+// Returns the lowercase type name used by the runtime types and functions, such as mecha_gear or mecha_send_gear.
+func runtimeSuffix(t ast.Type) string {
+	return strings.ToLower(t.String())
+}
+
+// zeroValue :
+// Returns the C expression for the zero value of a type. An Assembly starts empty.
+func zeroValue(t ast.Type) string {
+	if t.IsAssembly() {
+		return assembly(t, nil)
+	}
+	switch t {
+	case ast.TypeTensor:
+		return "0.0"
+	case ast.TypeOmnidrone:
+		return `""`
+	case ast.TypeSwitch:
+		return "false"
+	default:
+		return "0"
+	}
+}
+
+// assembly :
+// Returns the C expression for a new Assembly of the given type, holding the elements. They are copied from a
+// compound literal, which C converts to the type of the elements.
+func assembly(t ast.Type, elements []string) string {
+	element := cType(t.Element())
+	if len(elements) == 0 {
+		return fmt.Sprintf("mecha_assembly_make(sizeof(%s), 0, NULL)", element)
+	}
+	return fmt.Sprintf("mecha_assembly_make(sizeof(%s), %d, (%s[]){%s})", element, len(elements), element,
+		strings.Join(elements, ", "))
+}
+
+// tensorLiteral :
+// Formats a Tensor so it reads back as the exact same double and is never mistaken for an integer constant.
+func tensorLiteral(value float64) string {
+	text := strconv.FormatFloat(value, 'g', -1, 64)
+	if !strings.ContainsAny(text, ".eE") {
+		text += ".0"
+	}
+	return text
+}
+
+// stringLiteral :
+// Quotes an Omnidrone as a C string literal. Anything outside printable ASCII is written as an octal escape, which
+// keeps UTF-8 text intact without depending on the source character set of the C compiler.
+func stringLiteral(value string) string {
+	var builder strings.Builder
+	builder.WriteByte('"')
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		switch {
+		case c == '"' || c == '\\':
+			builder.WriteByte('\\')
+			builder.WriteByte(c)
+		case c < 0x20 || c >= 0x7F || c == '?':
+			// '?' is escaped too, so that no trigraph can ever be formed
+			builder.WriteString(fmt.Sprintf("\\%03o", c))
+		default:
+			builder.WriteByte(c)
+		}
+	}
+	builder.WriteByte('"')
+	return builder.String()
+}
@@ -0,0 +1,115 @@
+package cgen
+
+import (
+	"bytes"
+	"errors"
+	"mechanus-compiler/internal/mechatest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// generateSource parses, analyzes and generates C for the given source.
+func generateSource(t *testing.T, source string) (string, error) {
+	t.Helper()
+
+	construct, info := mechatest.Analyze(t, source)
+	generator := NewGenerator(info, false)
+	return generator.Run(construct)
+}
+
+// TestGenerator_MissingMain ensures that a Construct without a main Architect cannot be generated.
+func TestGenerator_MissingMain(t *testing.T) {
+	if _, err := generateSource(t, mechatest.MissingMain); err == nil {
+		t.Fatal("expected an error, got nil")
+	}
+}
+
+// TestGenerator_Concurrency ensures that Detach and Channels, which the C runtime does not support, are reported
+// instead of generated.
+func TestGenerator_Concurrency(t *testing.T) {
+	source := `{
+   {
+        ()main Detach
+   } ()main Architect
+} main Construct`
+
+	_, err := generateSource(t, source)
+	if err == nil || !strings.Contains(err.Error(), "Detach and Channels are not supported by the C backend") {
+		t.Errorf("expected the C backend to reject Detach, got %v", err)
+	}
+}
+
+// TestGenerator_Shadowing ensures that a shadowing declaration gets its own C name, so its initializer still reads
+// the outer variable.
+func TestGenerator_Shadowing(t *testing.T) {
+	code, err := generateSource(t, mechatest.Program)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !strings.Contains(code, "mecha_gear m_x_1 = (m_x + INT64_C(1));") {
+		t.Errorf("expected the inner x to be renamed, got:\n%s", code)
+	}
+}
+
+// TestStringLiteral checks the escaping of Omnidrones.
+func TestStringLiteral(t *testing.T) {
+	tests := map[string]string{
+		`plain`:     `"plain"`,
+		`say "hi"`:  `"say \"hi\""`,
+		`back\`:     `"back\\"`,
+		"tab\there": `"tab\011here"`,
+		"olá":       `"ol\303\241"`,
+		"what??!":   `"what\077\077!"`,
+	}
+
+	for value, expected := range tests {
+		if got := stringLiteral(value); got != expected {
+			t.Errorf("stringLiteral(%q) = %s, expected %s", value, got, expected)
+		}
+	}
+}
+
+// TestGenerator_Compile compiles the generated code with the system C compiler and checks what the program sends and
+// integrates. Skipped when no C compiler is installed.
+func TestGenerator_Compile(t *testing.T) {
+	compiler, err := exec.LookPath("cc")
+	if err != nil {
+		t.Skip("no C compiler found")
+	}
+
+	code, err := generateSource(t, mechatest.Program)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	dir := t.TempDir()
+	source := filepath.Join(dir, "program.c")
+	binary := filepath.Join(dir, "program")
+	if err := os.WriteFile(source, []byte(code), 0o644); err != nil {
+		t.Fatalf("failed to write C source: %v", err)
+	}
+
+	build := exec.Command(compiler, "-std=c99", "-Wall", "-Wextra", "-Werror", "-pedantic", "-o", binary, source)
+	if output, err := build.CombinedOutput(); err != nil {
+		t.Fatalf("failed to compile the generated code: %v\n%s", err, output)
+	}
+
+	var stdout bytes.Buffer
+	run := exec.Command(binary)
+	run.Stdin = strings.NewReader(mechatest.ProgramInput)
+	run.Stdout = &stdout
+	err = run.Run()
+
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != mechatest.ProgramExit {
+		t.Errorf("expected exit code %d, got %v", mechatest.ProgramExit, err)
+	}
+
+	if stdout.String() != mechatest.ProgramOutput {
+		t.Errorf("expected output %q, got %q", mechatest.ProgramOutput, stdout.String())
+	}
+}
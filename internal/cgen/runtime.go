@@ -0,0 +1,247 @@
+package cgen
+
+// runtime :
+// The C code placed at the top of every generated file. It maps the Mechanus types to C types and implements Send,
+// Receive, the checked Gear operations and Assemblies, so the generated functions only need plain C expressions and
+// calls.
+// Everything is declared "static inline" so that unused parts of the runtime do not raise warnings.
+const runtime = `#include <errno.h>
+#include <inttypes.h>
+#include <stdbool.h>
+#include <stdint.h>
+#include <stdio.h>
+#include <stdlib.h>
+#include <string.h>
+
+typedef int64_t mecha_gear;
+typedef double mecha_tensor;
+typedef int32_t mecha_monodrone;
+typedef const char *mecha_omnidrone;
+typedef int64_t mecha_state;
+typedef bool mecha_switch;
+typedef int mecha_nil;
+
+static inline void mecha_fail(const char *message) {
+    fflush(stdout);
+    fprintf(stderr, "mecha: %s\n", message);
+    exit(1);
+}
+
+static inline mecha_gear mecha_gear_div(mecha_gear left, mecha_gear right) {
+    if (right == 0) {
+        mecha_fail("division by zero");
+    }
+    if (left == INT64_MIN && right == -1) {
+        return INT64_MIN;
+    }
+    return left / right;
+}
+
+static inline mecha_gear mecha_gear_mod(mecha_gear left, mecha_gear right) {
+    if (right == 0) {
+        mecha_fail("division by zero");
+    }
+    if (right == -1) {
+        return 0;
+    }
+    return left % right;
+}
+
+/* An Assembly is shared by every variable it is assigned to, so it is a pointer to its elements, which may be of any
+   type and grow as values are appended. Assemblies are never freed: they live until the program exits. */
+typedef struct {
+    int64_t length;
+    int64_t capacity;
+    size_t size;
+    char *elements;
+} mecha_assembly_data;
+typedef mecha_assembly_data *mecha_assembly;
+
+static inline mecha_assembly mecha_assembly_make(size_t size, int64_t length, const void *elements) {
+    mecha_assembly assembly = malloc(sizeof(mecha_assembly_data));
+
+    if (assembly == NULL) {
+        mecha_fail("out of memory");
+    }
+    assembly->length = length;
+    assembly->capacity = length;
+    assembly->size = size;
+    assembly->elements = NULL;
+    if (length > 0) {
+        assembly->elements = malloc(size * (size_t)length);
+        if (assembly->elements == NULL) {
+            mecha_fail("out of memory");
+        }
+        memcpy(assembly->elements, elements, size * (size_t)length);
+    }
+    return assembly;
+}
+
+/* Returns the address of an element, which the generated code reads or writes through a pointer to its type. */
+static inline void *mecha_assembly_at(mecha_assembly assembly, mecha_gear index) {
+    if (index < 0 || index >= assembly->length) {
+        mecha_fail("Assembly index out of range");
+    }
+    return assembly->elements + assembly->size * (size_t)index;
+}
+
+/* Adds an element to the end of an Assembly and returns its address, so the generated code can write it. */
+static inline void *mecha_assembly_push(mecha_assembly assembly) {
+    if (assembly->length == assembly->capacity) {
+        assembly->capacity = assembly->capacity == 0 ? 4 : assembly->capacity * 2;
+        assembly->elements = realloc(assembly->elements, assembly->size * (size_t)assembly->capacity);
+        if (assembly->elements == NULL) {
+            mecha_fail("out of memory");
+        }
+    }
+    return assembly->elements + assembly->size * (size_t)assembly->length++;
+}
+
+static inline mecha_gear mecha_assembly_length(mecha_assembly assembly) {
+    return assembly->length;
+}
+
+static inline int mecha_omnidrone_equal(mecha_omnidrone left, mecha_omnidrone right) {
+    return strcmp(left, right) == 0;
+}
+
+static inline void mecha_send_gear(mecha_gear value) {
+    printf("%" PRId64 "\n", value);
+}
+
+static inline void mecha_send_tensor(mecha_tensor value) {
+    printf("%g\n", value);
+}
+
+static inline void mecha_send_monodrone(mecha_monodrone value) {
+    uint32_t c = (uint32_t)value;
+    if (c < 0x80) {
+        putchar((int)c);
+    } else if (c < 0x800) {
+        putchar((int)(0xC0 | (c >> 6)));
+        putchar((int)(0x80 | (c & 0x3F)));
+    } else if (c < 0x10000) {
+        putchar((int)(0xE0 | (c >> 12)));
+        putchar((int)(0x80 | ((c >> 6) & 0x3F)));
+        putchar((int)(0x80 | (c & 0x3F)));
+    } else {
+        putchar((int)(0xF0 | (c >> 18)));
+        putchar((int)(0x80 | ((c >> 12) & 0x3F)));
+        putchar((int)(0x80 | ((c >> 6) & 0x3F)));
+        putchar((int)(0x80 | (c & 0x3F)));
+    }
+    putchar('\n');
+}
+
+static inline void mecha_send_omnidrone(mecha_omnidrone value) {
+    printf("%s\n", value);
+}
+
+static inline void mecha_send_switch(mecha_switch value) {
+    printf("%s\n", value ? "true" : "false");
+}
+
+static inline void mecha_send_nil(mecha_nil value) {
+    (void)value;
+    printf("Nil\n");
+}
+
+/* Reads a single line from stdin without its line ending. The line is never freed: received Omnidrones live until
+   the program exits. */
+static inline char *mecha_read_line(void) {
+    size_t capacity = 64;
+    size_t length = 0;
+    char *line = malloc(capacity);
+    int c;
+
+    if (line == NULL) {
+        mecha_fail("out of memory");
+    }
+    while ((c = getchar()) != EOF && c != '\n') {
+        if (length + 1 >= capacity) {
+            capacity *= 2;
+            line = realloc(line, capacity);
+            if (line == NULL) {
+                mecha_fail("out of memory");
+            }
+        }
+        line[length++] = (char)c;
+    }
+    if (length > 0 && line[length - 1] == '\r') {
+        length--;
+    }
+    line[length] = '\0';
+    return line;
+}
+
+static inline mecha_gear mecha_receive_gear(void) {
+    char *line = mecha_read_line();
+    char *end;
+    long long value;
+
+    errno = 0;
+    value = strtoll(line, &end, 10);
+    if (end == line || *end != '\0' || errno != 0) {
+        mecha_fail("invalid Gear input");
+    }
+    free(line);
+    return (mecha_gear)value;
+}
+
+static inline mecha_tensor mecha_receive_tensor(void) {
+    char *line = mecha_read_line();
+    char *end;
+    double value;
+
+    errno = 0;
+    value = strtod(line, &end);
+    if (end == line || *end != '\0' || errno != 0) {
+        mecha_fail("invalid Tensor input");
+    }
+    free(line);
+    return value;
+}
+
+static inline mecha_monodrone mecha_receive_monodrone(void) {
+    char *line = mecha_read_line();
+    const unsigned char *s = (const unsigned char *)line;
+    uint32_t value;
+    size_t size;
+
+    if (s[0] < 0x80) {
+        value = s[0];
+        size = 1;
+    } else if ((s[0] & 0xE0) == 0xC0) {
+        value = s[0] & 0x1F;
+        size = 2;
+    } else if ((s[0] & 0xF0) == 0xE0) {
+        value = s[0] & 0x0F;
+        size = 3;
+    } else if ((s[0] & 0xF8) == 0xF0) {
+        value = s[0] & 0x07;
+        size = 4;
+    } else {
+        mecha_fail("invalid Monodrone input");
+        return 0;
+    }
+    for (size_t i = 1; i < size; i++) {
+        if ((s[i] & 0xC0) != 0x80) {
+            mecha_fail("invalid Monodrone input");
+        }
+        value = (value << 6) | (s[i] & 0x3F);
+    }
+    if (s[0] == '\0' || s[size] != '\0') {
+        mecha_fail("invalid Monodrone input");
+    }
+    free(line);
+    return (mecha_monodrone)value;
+}
+
+static inline mecha_omnidrone mecha_receive_omnidrone(void) {
+    return mecha_read_line();
+}
+
+static inline mecha_state mecha_receive_state(void) {
+    return mecha_receive_gear();
+}
+`
@@ -0,0 +1,20 @@
+package compiler_error
+
+import "fmt"
+
+const (
+	CodegenSuccess = "code generation completed with no errors"
+	CodegenError   = "code generation error"
+	MissingMain    = "the Construct has no main Architect"
+	UnknownEmit    = "unknown emit target"
+	Unsupported    = "Detach and Channels are not supported by the %s backend"
+)
+
+// CodegenErrorf :
+// Wraps an existing error with additional context and the ErrCodegen type.
+//
+// Example usage:
+// return CodegenErrorf("caller function", ErrSomething)
+func CodegenErrorf(context string, err error) error {
+	return fmt.Errorf("(%s) %s -> %w", ErrCodegen, context, err)
+}
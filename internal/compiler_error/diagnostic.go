@@ -0,0 +1,269 @@
+package compiler_error
+
+import (
+	"errors"
+	"fmt"
+	"mechanus-compiler/internal/ast"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Severity :
+// How serious a Diagnostic is.
+type Severity int
+
+const (
+	SeverityError Severity = iota
+	SeverityWarning
+	SeverityNote
+)
+
+// String :
+// Returns the lowercase name of the severity, as printed in front of a rendered Diagnostic.
+func (s Severity) String() string {
+	switch s {
+	case SeverityWarning:
+		return "warning"
+	case SeverityNote:
+		return "note"
+	default:
+		return "error"
+	}
+}
+
+// Diagnostic codes. Lexical errors start at E0001, syntax errors at E0100, semantic errors at E0200, type errors at
+// E0300 and the errors that stop a running program at E0400.
+const (
+	CodeUnknownCharacter      = "E0001"
+	CodeUnterminatedString    = "E0002"
+	CodeUnterminatedComment   = "E0003"
+	CodeInvalidMonodrone      = "E0004"
+	CodeInvalidEscape         = "E0005"
+	CodeUnexpectedToken       = "E0100"
+	CodeExpectedToken         = "E0101"
+	CodeTooManyErrors         = "E0102"
+	CodeUndeclaredVariable    = "E0200"
+	CodeDuplicateDeclaration  = "E0201"
+	CodeDuplicateArchitect    = "E0202"
+	CodeUndefinedArchitect    = "E0203"
+	CodeWrongArgumentCount    = "E0204"
+	CodeDuplicateState        = "E0205"
+	CodeDuplicateMember       = "E0206"
+	CodeUndeclaredState       = "E0207"
+	CodeChangedMember         = "E0208"
+	CodeMainParameters        = "E0209"
+	CodeMismatchedDeclaration = "E0300"
+	CodeMismatchedAssignment  = "E0301"
+	CodeMismatchedIntegrate   = "E0302"
+	CodeMismatchedArgument    = "E0303"
+	CodeInvalidOperation      = "E0304"
+	CodeInvalidUnary          = "E0305"
+	CodeInvalidComparison     = "E0306"
+	CodeInvalidReceive        = "E0307"
+	CodeInvalidSend           = "E0308"
+	CodeMismatchedSend        = "E0309"
+	CodeMismatchedReceive     = "E0310"
+	CodeNotChannel            = "E0311"
+	CodeChannelCapacity       = "E0312"
+	CodeDetachedValue         = "E0313"
+	CodeExpectedCondition     = "E0314"
+	CodeNotAssembly           = "E0315"
+	CodeExpectedAssembly      = "E0316"
+	CodeInvalidIndex          = "E0317"
+	CodeMismatchedElement     = "E0318"
+	CodeMismatchedStore       = "E0319"
+	CodeMismatchedAppend      = "E0320"
+	CodeMismatchedIteration   = "E0321"
+	CodeRuntime               = "E0400"
+)
+
+// Span :
+// A range of the source file, from the first character of Start up to, but not including, End. A Span whose End is
+// not after its Start on the same line marks the single character at Start. The zero Span marks no location.
+type Span struct {
+	Start ast.Pos
+	End   ast.Pos
+}
+
+// Until :
+// Returns the position right after the span: its End, or the column after Start when it marks a single character.
+func (span Span) Until() ast.Pos {
+	if span.End.Line > span.Start.Line || (span.End.Line == span.Start.Line && span.End.Column > span.Start.Column) {
+		return span.End
+	}
+	return ast.Pos{Line: span.Start.Line, Column: span.Start.Column + 1}
+}
+
+// Fix :
+// A suggested edit: the text covered by Span is replaced by Replacement. An empty Span inserts Replacement right
+// before Span.Start.
+type Fix struct {
+	Message     string
+	Span        Span
+	Replacement string
+}
+
+// Diagnostic :
+// A problem found in the source file, with everything needed to show it to the user: where it is, what it is and, when
+// the compiler can tell, how to fix it.
+type Diagnostic struct {
+	Severity Severity
+	// Kind is the phase that found the problem, such as ErrSyntax
+	Kind    AnalysisError
+	Code    string
+	File    string
+	Span    Span
+	Message string
+	Notes   []string
+	Fix     *Fix
+}
+
+// Error :
+// Returns the message followed by its position, in the same format as the other compiler errors.
+func (d *Diagnostic) Error() string {
+	if d.Span.Start.Line == 0 {
+		return d.Message
+	}
+	return fmt.Sprintf("%s at %s", d.Message, d.Span.Start)
+}
+
+// Reported :
+// Marks a Diagnostic as shown to the user by the command line, in the format it was asked for. The logger only writes
+// errors carrying one in debug mode.
+func (d *Diagnostic) Reported() {}
+
+// Diagnostics :
+// Collects every Diagnostic wrapped inside an error, including the ones joined with errors.Join, in order.
+func Diagnostics(err error) []*Diagnostic {
+	if err == nil {
+		return nil
+	}
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		var diagnostics []*Diagnostic
+		for _, inner := range joined.Unwrap() {
+			diagnostics = append(diagnostics, Diagnostics(inner)...)
+		}
+		return diagnostics
+	}
+
+	var diagnostic *Diagnostic
+	if errors.As(err, &diagnostic) {
+		return []*Diagnostic{diagnostic}
+	}
+	return nil
+}
+
+// Render :
+// Formats a Diagnostic for a terminal, quoting the line of source it points at and underlining the span with carets:
+//
+//	error[E0101]: expected ':', got 'Gear'
+//	  --> example.mecha:3:7
+//	   |
+//	 3 |    } (Gear x)helper Architect
+//	   |       ^^^^
+//	   = note: Mechanus reads each line from right to left, so ':' is expected between 'Gear' and 'x'
+//	   = help: insert ':'
+//	   |
+//	 3 |    } (Gear :x)helper Architect
+//	   |            +
+//
+// source is the whole content of the file the Diagnostic belongs to. The snippets are left out when the span is not
+// inside it.
+func Render(diagnostic *Diagnostic, source string) string {
+	var builder strings.Builder
+	lines := strings.Split(strings.ReplaceAll(source, "\r\n", "\n"), "\n")
+
+	builder.WriteString(diagnostic.Severity.String())
+	if diagnostic.Code != "" {
+		builder.WriteString("[" + diagnostic.Code + "]")
+	}
+	builder.WriteString(": " + diagnostic.Message + "\n")
+
+	start := diagnostic.Span.Start
+	width := len(strconv.Itoa(start.Line))
+	if diagnostic.Fix != nil {
+		width = max(width, len(strconv.Itoa(diagnostic.Fix.Span.Start.Line)))
+	}
+	gutter := strings.Repeat(" ", width)
+
+	location := diagnostic.File
+	if start.Line > 0 {
+		location = fmt.Sprintf("%s:%d:%d", location, start.Line, start.Column)
+	}
+	if location != "" {
+		builder.WriteString(fmt.Sprintf("%s--> %s\n", gutter, location))
+	}
+
+	if line, ok := sourceLine(lines, start); ok {
+		builder.WriteString(gutter + " |\n")
+		writeSnippet(&builder, width, start.Line, line, start.Column, spanWidth(diagnostic.Span), '^')
+	}
+
+	for _, note := range diagnostic.Notes {
+		builder.WriteString(fmt.Sprintf("%s = note: %s\n", gutter, note))
+	}
+
+	if fix := diagnostic.Fix; fix != nil {
+		builder.WriteString(fmt.Sprintf("%s = help: %s\n", gutter, fix.Message))
+		if line, ok := sourceLine(lines, fix.Span.Start); ok {
+			end := fix.Span.Start.Column - 1 + spanWidth(fix.Span)
+			if fix.Span.End.Line != fix.Span.Start.Line || fix.Span.End.Column <= fix.Span.Start.Column {
+				end = fix.Span.Start.Column - 1
+			}
+			characters := []rune(line)
+			fixed := string(characters[:fix.Span.Start.Column-1]) + fix.Replacement +
+				string(characters[min(end, len(characters)):])
+
+			builder.WriteString(gutter + " |\n")
+			writeSnippet(&builder, width, fix.Span.Start.Line, fixed, fix.Span.Start.Column,
+				max(utf8.RuneCountInString(fix.Replacement), 1), '+')
+		}
+	}
+
+	return builder.String()
+}
+
+// sourceLine :
+// Returns the line a position points at, if the position is inside the source. Columns are counted in characters, and
+// a position right after the last character of a line is still inside it.
+func sourceLine(lines []string, position ast.Pos) (string, bool) {
+	if position.Line < 1 || position.Line > len(lines) {
+		return "", false
+	}
+	line := lines[position.Line-1]
+	if position.Column < 1 || position.Column > utf8.RuneCountInString(line)+1 {
+		return "", false
+	}
+	return line, true
+}
+
+// spanWidth :
+// Returns the number of characters underlined for a span: its length on its first line, and at least one.
+func spanWidth(span Span) int {
+	if span.End.Line != span.Start.Line || span.End.Column <= span.Start.Column {
+		return 1
+	}
+	return span.End.Column - span.Start.Column
+}
+
+// writeSnippet :
+// Writes a numbered line of source with a marker under the given columns. Tabs before the marker are kept, so it
+// lines up with the source whatever the tab width of the terminal.
+func writeSnippet(builder *strings.Builder, width, number int, line string, column, length int, marker byte) {
+	builder.WriteString(fmt.Sprintf("%*d | %s\n", width, number, line))
+
+	var padding strings.Builder
+	for i, character := range []rune(line) {
+		if i >= column-1 {
+			break
+		}
+		if character == '\t' {
+			padding.WriteByte('\t')
+		} else {
+			padding.WriteByte(' ')
+		}
+	}
+	builder.WriteString(fmt.Sprintf("%s | %s%s\n", strings.Repeat(" ", width), padding.String(),
+		strings.Repeat(string(marker), length)))
+}
@@ -0,0 +1,101 @@
+package compiler_error
+
+import (
+	"errors"
+	"fmt"
+	"mechanus-compiler/internal/ast"
+	"testing"
+)
+
+const diagnosticSource = "{\n   } (Gear x)helper Architect\n\t\"text Send\n} main Construct"
+
+func TestRender(t *testing.T) {
+	diagnostic := &Diagnostic{
+		Code:    CodeExpectedToken,
+		File:    "example.mecha",
+		Span:    Span{Start: ast.Pos{Line: 2, Column: 7}, End: ast.Pos{Line: 2, Column: 11}},
+		Message: "expected ':', got 'Gear'",
+		Notes:   []string{"':' is expected right before 'x'"},
+		Fix: &Fix{
+			Message:     "insert ':'",
+			Span:        Span{Start: ast.Pos{Line: 2, Column: 12}, End: ast.Pos{Line: 2, Column: 12}},
+			Replacement: ":",
+		},
+	}
+
+	expected := `error[E0101]: expected ':', got 'Gear'
+ --> example.mecha:2:7
+  |
+2 |    } (Gear x)helper Architect
+  |       ^^^^
+  = note: ':' is expected right before 'x'
+  = help: insert ':'
+  |
+2 |    } (Gear :x)helper Architect
+  |            +
+`
+	if got := Render(diagnostic, diagnosticSource); got != expected {
+		t.Errorf("unexpected rendering:\n%s\nexpected:\n%s", got, expected)
+	}
+}
+
+func TestRender_Tabs(t *testing.T) {
+	diagnostic := &Diagnostic{
+		Code:    CodeUnterminatedString,
+		Span:    Span{Start: ast.Pos{Line: 3, Column: 2}},
+		Message: UnterminatedString,
+	}
+
+	expected := "error[E0002]: unterminated string literal\n" +
+		" --> :3:2\n" +
+		"  |\n" +
+		"3 | \t\"text Send\n" +
+		"  | \t^\n"
+	if got := Render(diagnostic, diagnosticSource); got != expected {
+		t.Errorf("unexpected rendering:\n%q\nexpected:\n%q", got, expected)
+	}
+}
+
+func TestRender_UTF8(t *testing.T) {
+	diagnostic := &Diagnostic{
+		Code:    CodeUnknownCharacter,
+		Span:    Span{Start: ast.Pos{Line: 1, Column: 9}, End: ast.Pos{Line: 1, Column: 10}},
+		Message: fmt.Sprintf(UnknownCharacter, "¤"),
+	}
+
+	expected := "error[E0001]: unknown character '¤'\n" +
+		" --> :1:9\n" +
+		"  |\n" +
+		"1 | \"héllo\" ¤ Send\n" +
+		"  |         ^\n"
+	if got := Render(diagnostic, "\"héllo\" ¤ Send"); got != expected {
+		t.Errorf("unexpected rendering:\n%q\nexpected:\n%q", got, expected)
+	}
+}
+
+func TestRender_NoSpan(t *testing.T) {
+	diagnostic := &Diagnostic{Code: CodeTooManyErrors, File: "example.mecha", Message: "too many syntax errors"}
+
+	expected := "error[E0102]: too many syntax errors\n --> example.mecha\n"
+	if got := Render(diagnostic, diagnosticSource); got != expected {
+		t.Errorf("unexpected rendering:\n%q\nexpected:\n%q", got, expected)
+	}
+}
+
+func TestDiagnostics(t *testing.T) {
+	first := &Diagnostic{Message: "first", Span: Span{Start: ast.Pos{Line: 1, Column: 2}}}
+	second := &Diagnostic{Message: "second"}
+	err := errors.Join(
+		SyntaxErrorf(SyntaxError, first),
+		fmt.Errorf("no diagnostic"),
+		LexerErrorf("outer", LexerErrorf("inner", second)),
+	)
+
+	diagnostics := Diagnostics(err)
+	if len(diagnostics) != 2 || diagnostics[0] != first || diagnostics[1] != second {
+		t.Fatalf("expected both diagnostics in order, got %v", diagnostics)
+	}
+	if first.Error() != "first at Line: 1, Column: 2" {
+		t.Errorf("unexpected error text %q", first.Error())
+	}
+}
@@ -8,8 +8,12 @@ func (e AnalysisError) Error() string { return string(e) }
 
 // Error types
 const (
-	ErrFile    AnalysisError = "file error"
-	ErrLexical AnalysisError = "lexical error"
-	ErrSyntax  AnalysisError = "syntax error"
-	ErrToken   AnalysisError = "token error"
+	ErrFile     AnalysisError = "file error"
+	ErrLexical  AnalysisError = "lexical error"
+	ErrSyntax   AnalysisError = "syntax error"
+	ErrSemantic AnalysisError = "semantic error"
+	ErrType     AnalysisError = "type error"
+	ErrCodegen  AnalysisError = "code generation error"
+	ErrRuntime  AnalysisError = "runtime error"
+	ErrToken    AnalysisError = "token error"
 )
@@ -3,9 +3,13 @@ package compiler_error
 import "fmt"
 
 const (
-	LexerSuccess     = "lexical analysis completed with no errors"
-	LexerError       = "lexical analysis completed with an error"
-	IdentifiedTokens = "Identified Tokens (token/lexeme):"
+	LexerSuccess        = "lexical analysis completed with no errors"
+	LexerError          = "lexical analysis completed with an error"
+	IdentifiedTokens    = "Identified Tokens (token/lexeme):"
+	UnterminatedString  = "unterminated string literal"
+	UnterminatedComment = "unterminated multiline comment"
+	UnknownCharacter    = "unknown character '%s'"
+	InvalidEscape       = "invalid escape sequence '%s'"
 )
 
 // LexerErrorf :
@@ -0,0 +1,319 @@
+package compiler_error
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+)
+
+// Formats accepted by WriteDiagnostics.
+const (
+	FormatText  = "text"
+	FormatJSON  = "json"
+	FormatSARIF = "sarif"
+)
+
+const UnknownDiagnosticsFormat = "unknown diagnostics format"
+
+// codeDescriptions holds the short description of every diagnostic code, used as the rules of a SARIF log.
+var codeDescriptions = map[string]string{
+	CodeUnknownCharacter:      "Unknown character",
+	CodeUnterminatedString:    "Unterminated string literal",
+	CodeUnterminatedComment:   "Unterminated multiline comment",
+	CodeInvalidMonodrone:      "Invalid Monodrone literal",
+	CodeUnexpectedToken:       "Unexpected token",
+	CodeExpectedToken:         "Missing symbol",
+	CodeTooManyErrors:         "Too many syntax errors",
+	CodeUndeclaredVariable:    "Undeclared variable",
+	CodeDuplicateDeclaration:  "Duplicate declaration",
+	CodeDuplicateArchitect:    "Duplicate Architect",
+	CodeUndefinedArchitect:    "Undefined Architect",
+	CodeWrongArgumentCount:    "Wrong argument count",
+	CodeDuplicateState:        "Duplicate State",
+	CodeDuplicateMember:       "Duplicate State member",
+	CodeUndeclaredState:       "Undeclared State",
+	CodeChangedMember:         "Changed State member",
+	CodeMainParameters:        "Parameters on the main Architect",
+	CodeMismatchedDeclaration: "Mismatched declaration",
+	CodeMismatchedAssignment:  "Mismatched assignment",
+	CodeMismatchedIntegrate:   "Mismatched Integrate",
+	CodeMismatchedArgument:    "Mismatched argument",
+	CodeInvalidOperation:      "Invalid operands",
+	CodeInvalidUnary:          "Invalid unary operand",
+	CodeInvalidComparison:     "Invalid comparison",
+	CodeInvalidReceive:        "Invalid Receive",
+	CodeInvalidSend:           "Invalid Send",
+	CodeMismatchedSend:        "Mismatched Channel Send",
+	CodeMismatchedReceive:     "Mismatched Channel Receive",
+	CodeNotChannel:            "Not a Channel",
+	CodeChannelCapacity:       "Invalid Channel capacity",
+	CodeDetachedValue:         "Use of a detached result",
+	CodeExpectedCondition:     "Condition that is not a Switch",
+	CodeNotAssembly:           "Not an Assembly",
+	CodeExpectedAssembly:      "Expected an Assembly",
+	CodeInvalidIndex:          "Invalid Assembly index",
+	CodeMismatchedElement:     "Mismatched Assembly element",
+	CodeMismatchedStore:       "Mismatched Assembly store",
+	CodeMismatchedAppend:      "Mismatched Append",
+	CodeMismatchedIteration:   "Mismatched for variable",
+	CodeRuntime:               "Runtime error",
+}
+
+// WriteDiagnostics :
+// Writes diagnostics in a machine-readable format: FormatJSON writes one JSON object per line for each Diagnostic, and
+// FormatSARIF writes a single SARIF 2.1.0 log, even when there are no diagnostics. FormatText is left to Render, which
+// needs the source file.
+//
+// Fails if the format is unknown or if the writer fails.
+func WriteDiagnostics(w io.Writer, format string, diagnostics []*Diagnostic) error {
+	switch format {
+	case FormatJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetEscapeHTML(false)
+		for _, diagnostic := range diagnostics {
+			if err := encoder.Encode(newJSONDiagnostic(diagnostic)); err != nil {
+				return err
+			}
+		}
+		return nil
+	case FormatSARIF:
+		encoder := json.NewEncoder(w)
+		encoder.SetEscapeHTML(false)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(newSARIFLog(diagnostics))
+	default:
+		return fmt.Errorf("%s '%s'", UnknownDiagnosticsFormat, format)
+	}
+}
+
+//**********************************************************************************************************************
+// JSON
+//**********************************************************************************************************************
+
+// jsonDiagnostic :
+// A Diagnostic as written by FormatJSON. Positions are 1-based and the end column is exclusive.
+type jsonDiagnostic struct {
+	File      string   `json:"file"`
+	Line      int      `json:"line"`
+	Column    int      `json:"column"`
+	EndLine   int      `json:"endLine,omitempty"`
+	EndColumn int      `json:"endColumn,omitempty"`
+	Severity  string   `json:"severity"`
+	Kind      string   `json:"kind,omitempty"`
+	Code      string   `json:"code"`
+	Message   string   `json:"message"`
+	Notes     []string `json:"notes,omitempty"`
+	Fix       *jsonFix `json:"fix,omitempty"`
+}
+
+// jsonFix :
+// A Fix as written by FormatJSON.
+type jsonFix struct {
+	Message     string `json:"message"`
+	Line        int    `json:"line"`
+	Column      int    `json:"column"`
+	EndLine     int    `json:"endLine"`
+	EndColumn   int    `json:"endColumn"`
+	Replacement string `json:"replacement"`
+}
+
+// newJSONDiagnostic :
+// Converts a Diagnostic into the object written by FormatJSON.
+func newJSONDiagnostic(diagnostic *Diagnostic) jsonDiagnostic {
+	result := jsonDiagnostic{
+		File:     diagnostic.File,
+		Line:     diagnostic.Span.Start.Line,
+		Column:   diagnostic.Span.Start.Column,
+		Severity: diagnostic.Severity.String(),
+		Kind:     string(diagnostic.Kind),
+		Code:     diagnostic.Code,
+		Message:  diagnostic.Message,
+		Notes:    diagnostic.Notes,
+	}
+	if diagnostic.Span.Start.Line > 0 {
+		end := diagnostic.Span.Until()
+		result.EndLine, result.EndColumn = end.Line, end.Column
+	}
+	if fix := diagnostic.Fix; fix != nil {
+		end := fix.Span.End
+		if end.Line == 0 {
+			end = fix.Span.Start
+		}
+		result.Fix = &jsonFix{
+			Message:     fix.Message,
+			Line:        fix.Span.Start.Line,
+			Column:      fix.Span.Start.Column,
+			EndLine:     end.Line,
+			EndColumn:   end.Column,
+			Replacement: fix.Replacement,
+		}
+	}
+	return result
+}
+
+//**********************************************************************************************************************
+// SARIF
+//**********************************************************************************************************************
+
+const (
+	sarifVersion  = "2.1.0"
+	sarifSchema   = "https://json.schemastore.org/sarif-2.1.0.json"
+	sarifToolName = "mecha"
+)
+
+type sarifLog struct {
+	Version string     `json:"version"`
+	Schema  string     `json:"$schema"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool       sarifTool     `json:"tool"`
+	ColumnKind string        `json:"columnKind"`
+	Results    []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name  string      `json:"name"`
+	Rules []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string       `json:"id"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId,omitempty"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations,omitempty"`
+	Fixes     []sarifFix      `json:"fixes,omitempty"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           *sarifRegion          `json:"region,omitempty"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine   int `json:"startLine"`
+	StartColumn int `json:"startColumn"`
+	EndLine     int `json:"endLine,omitempty"`
+	EndColumn   int `json:"endColumn,omitempty"`
+}
+
+type sarifFix struct {
+	Description     sarifMessage          `json:"description"`
+	ArtifactChanges []sarifArtifactChange `json:"artifactChanges"`
+}
+
+type sarifArtifactChange struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Replacements     []sarifReplacement    `json:"replacements"`
+}
+
+type sarifReplacement struct {
+	DeletedRegion   sarifRegion  `json:"deletedRegion"`
+	InsertedContent sarifMessage `json:"insertedContent"`
+}
+
+// newSARIFLog :
+// Builds a SARIF log with a single run of the compiler. Every code used by the diagnostics becomes a rule. Columns are
+// counted in characters, like in the rest of the compiler, rather than in the UTF-16 units SARIF assumes by default.
+func newSARIFLog(diagnostics []*Diagnostic) sarifLog {
+	run := sarifRun{
+		Tool:       sarifTool{Driver: sarifDriver{Name: sarifToolName, Rules: []sarifRule{}}},
+		ColumnKind: "unicodeCodePoints",
+		Results:    []sarifResult{},
+	}
+
+	codes := make(map[string]bool)
+	for _, diagnostic := range diagnostics {
+		if diagnostic.Code != "" && !codes[diagnostic.Code] {
+			codes[diagnostic.Code] = true
+			run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, sarifRule{
+				ID:               diagnostic.Code,
+				ShortDescription: sarifMessage{Text: codeDescriptions[diagnostic.Code]},
+			})
+		}
+		run.Results = append(run.Results, newSARIFResult(diagnostic))
+	}
+	sort.Slice(run.Tool.Driver.Rules, func(i, j int) bool {
+		return run.Tool.Driver.Rules[i].ID < run.Tool.Driver.Rules[j].ID
+	})
+
+	return sarifLog{Version: sarifVersion, Schema: sarifSchema, Runs: []sarifRun{run}}
+}
+
+// newSARIFResult :
+// Converts a Diagnostic into a SARIF result. Notes are appended to the message, which SARIF shows as a whole.
+func newSARIFResult(diagnostic *Diagnostic) sarifResult {
+	message := diagnostic.Message
+	for _, note := range diagnostic.Notes {
+		message += "\nnote: " + note
+	}
+
+	result := sarifResult{
+		RuleID:  diagnostic.Code,
+		Level:   diagnostic.Severity.String(),
+		Message: sarifMessage{Text: message},
+	}
+
+	artifact := sarifArtifactLocation{URI: filepath.ToSlash(diagnostic.File)}
+	if diagnostic.File != "" {
+		location := sarifLocation{PhysicalLocation: sarifPhysicalLocation{ArtifactLocation: artifact}}
+		if diagnostic.Span.Start.Line > 0 {
+			end := diagnostic.Span.Until()
+			location.PhysicalLocation.Region = &sarifRegion{
+				StartLine:   diagnostic.Span.Start.Line,
+				StartColumn: diagnostic.Span.Start.Column,
+				EndLine:     end.Line,
+				EndColumn:   end.Column,
+			}
+		}
+		result.Locations = []sarifLocation{location}
+	}
+
+	if fix := diagnostic.Fix; fix != nil && diagnostic.File != "" {
+		// An empty deleted region is an insertion
+		end := fix.Span.End
+		if end.Line == 0 {
+			end = fix.Span.Start
+		}
+		result.Fixes = []sarifFix{{
+			Description: sarifMessage{Text: fix.Message},
+			ArtifactChanges: []sarifArtifactChange{{
+				ArtifactLocation: artifact,
+				Replacements: []sarifReplacement{{
+					DeletedRegion: sarifRegion{
+						StartLine:   fix.Span.Start.Line,
+						StartColumn: fix.Span.Start.Column,
+						EndLine:     end.Line,
+						EndColumn:   end.Column,
+					},
+					InsertedContent: sarifMessage{Text: fix.Replacement},
+				}},
+			}},
+		}}
+	}
+	return result
+}
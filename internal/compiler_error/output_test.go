@@ -0,0 +1,105 @@
+package compiler_error
+
+import (
+	"bytes"
+	"encoding/json"
+	"mechanus-compiler/internal/ast"
+	"strings"
+	"testing"
+)
+
+// outputDiagnostics are a missing ':' with its fix and an error limit without a position.
+func outputDiagnostics() []*Diagnostic {
+	return []*Diagnostic{
+		{
+			Kind:    ErrSyntax,
+			Code:    CodeExpectedToken,
+			File:    "example.mecha",
+			Span:    Span{Start: ast.Pos{Line: 2, Column: 7}, End: ast.Pos{Line: 2, Column: 11}},
+			Message: "expected ':', got 'Gear'",
+			Notes:   []string{"read from right to left"},
+			Fix: &Fix{
+				Message:     "insert ':'",
+				Span:        Span{Start: ast.Pos{Line: 2, Column: 12}},
+				Replacement: ":",
+			},
+		},
+		{Kind: ErrSyntax, Code: CodeTooManyErrors, File: "example.mecha", Message: "too many syntax errors"},
+	}
+}
+
+func TestWriteDiagnostics_JSON(t *testing.T) {
+	var buffer bytes.Buffer
+	if err := WriteDiagnostics(&buffer, FormatJSON, outputDiagnostics()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buffer.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected one line per diagnostic, got:\n%s", buffer.String())
+	}
+	expected := `{"file":"example.mecha","line":2,"column":7,"endLine":2,"endColumn":11,"severity":"error",` +
+		`"kind":"syntax error","code":"E0101","message":"expected ':', got 'Gear'","notes":["read from right to left"],` +
+		`"fix":{"message":"insert ':'","line":2,"column":12,"endLine":2,"endColumn":12,"replacement":":"}}`
+	if lines[0] != expected {
+		t.Errorf("unexpected JSON:\n%s\nexpected:\n%s", lines[0], expected)
+	}
+	if !strings.Contains(lines[1], `"line":0,"column":0,"severity":"error"`) {
+		t.Errorf("expected no end position without a span, got %s", lines[1])
+	}
+}
+
+func TestWriteDiagnostics_SARIF(t *testing.T) {
+	var buffer bytes.Buffer
+	if err := WriteDiagnostics(&buffer, FormatSARIF, outputDiagnostics()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var log sarifLog
+	if err := json.Unmarshal(buffer.Bytes(), &log); err != nil {
+		t.Fatalf("invalid SARIF log: %v", err)
+	}
+	if log.Version != "2.1.0" || len(log.Runs) != 1 {
+		t.Fatalf("expected a single SARIF 2.1.0 run, got %+v", log)
+	}
+
+	run := log.Runs[0]
+	if rules := run.Tool.Driver.Rules; len(rules) != 2 || rules[0].ID != CodeExpectedToken {
+		t.Errorf("expected a rule per code, got %+v", rules)
+	}
+	if len(run.Results) != 2 {
+		t.Fatalf("expected 2 results, got %d", len(run.Results))
+	}
+
+	result := run.Results[0]
+	region := result.Locations[0].PhysicalLocation.Region
+	if region == nil || *region != (sarifRegion{StartLine: 2, StartColumn: 7, EndLine: 2, EndColumn: 11}) {
+		t.Errorf("unexpected region %+v", region)
+	}
+	if result.Message.Text != "expected ':', got 'Gear'\nnote: read from right to left" {
+		t.Errorf("unexpected message %q", result.Message.Text)
+	}
+	replacement := result.Fixes[0].ArtifactChanges[0].Replacements[0]
+	if replacement.InsertedContent.Text != ":" || replacement.DeletedRegion.EndColumn != 12 {
+		t.Errorf("unexpected fix %+v", replacement)
+	}
+	if run.Results[1].Locations[0].PhysicalLocation.Region != nil {
+		t.Errorf("expected no region without a span")
+	}
+}
+
+func TestWriteDiagnostics_SARIFEmpty(t *testing.T) {
+	var buffer bytes.Buffer
+	if err := WriteDiagnostics(&buffer, FormatSARIF, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(buffer.String(), `"results": []`) {
+		t.Errorf("expected an empty list of results, got:\n%s", buffer.String())
+	}
+}
+
+func TestWriteDiagnostics_UnknownFormat(t *testing.T) {
+	if err := WriteDiagnostics(&bytes.Buffer{}, "xml", nil); err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+}
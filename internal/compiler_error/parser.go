@@ -6,6 +6,7 @@ const (
 	SyntaxSuccess        = "syntax analysis completed with no errors"
 	SyntaxError          = "syntax error"
 	MissingConstructBody = "missing Construct body"
+	TooManySyntaxErrors  = "too many syntax errors, stopping after %d"
 )
 
 // SyntaxErrorf :
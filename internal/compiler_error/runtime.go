@@ -0,0 +1,38 @@
+package compiler_error
+
+import (
+	"fmt"
+	"mechanus-compiler/internal/ast"
+)
+
+const (
+	RuntimeError   = "runtime error"
+	DivisionByZero = "division by zero"
+	InvalidInput   = "invalid %s input %q"
+	Deadlock       = "every Architect is waiting on a Channel"
+	NilChannel     = "use of a Channel that was never made"
+	NegativeBuffer = "cannot make a Channel with a negative capacity of %d"
+	OutOfRange     = "Assembly index out of range"
+)
+
+// RuntimeErrorf :
+// Wraps an existing error with additional context and the ErrRuntime type.
+//
+// Example usage:
+// return RuntimeErrorf("caller function", ErrSomething)
+func RuntimeErrorf(context string, err error) error {
+	return fmt.Errorf("(%s) %s -> %w", ErrRuntime, context, err)
+}
+
+// RuntimeDiagnostic :
+// Builds the Diagnostic of an error that stopped a running program at the given position. The zero position is used
+// when the program does not know where it was, as in the VM.
+func RuntimeDiagnostic(position ast.Pos, message string) *Diagnostic {
+	return &Diagnostic{
+		Severity: SeverityError,
+		Kind:     ErrRuntime,
+		Code:     CodeRuntime,
+		Span:     Span{Start: position, End: position},
+		Message:  message,
+	}
+}
@@ -0,0 +1,17 @@
+package compiler_error
+
+import "fmt"
+
+const (
+	SemanticSuccess = "semantic analysis completed with no errors"
+	SemanticError   = "semantic error"
+)
+
+// SemanticErrorf :
+// Wraps an existing error with additional context and the ErrSemantic type.
+//
+// Example usage:
+// return SemanticErrorf("caller function", ErrSomething)
+func SemanticErrorf(context string, err error) error {
+	return fmt.Errorf("(%s) %s -> %w", ErrSemantic, context, err)
+}
@@ -0,0 +1,17 @@
+package compiler_error
+
+import "fmt"
+
+const (
+	TypeSuccess = "type checking completed with no errors"
+	TypeError   = "type error"
+)
+
+// TypeErrorf :
+// Wraps an existing error with additional context and the ErrType type.
+//
+// Example usage:
+// return TypeErrorf("caller function", ErrSomething)
+func TypeErrorf(context string, err error) error {
+	return fmt.Errorf("(%s) %s -> %w", ErrType, context, err)
+}
@@ -0,0 +1,143 @@
+package format
+
+import (
+	"fmt"
+	"strings"
+)
+
+// contextLines is the number of unchanged lines shown around each change of a diff.
+const contextLines = 3
+
+// edit :
+// A line of a diff: kept (' '), removed ('-') or added ('+').
+type edit struct {
+	kind byte
+	text string
+}
+
+// Diff :
+// Returns the changes from before to after as a unified diff, like "diff -u" prints them, with both sides named after
+// the file. It returns an empty string when there is no change.
+func Diff(name, before, after string) string {
+	if before == after {
+		return ""
+	}
+
+	edits := diffLines(splitLines(before), splitLines(after))
+
+	// Each change is shown with the lines around it, and changes whose context overlaps share a hunk
+	type hunk struct{ from, to int }
+	hunks := make([]hunk, 0)
+	for i, e := range edits {
+		if e.kind == ' ' {
+			continue
+		}
+		from, to := max(i-contextLines, 0), min(i+contextLines+1, len(edits))
+		if n := len(hunks); n > 0 && from <= hunks[n-1].to {
+			hunks[n-1].to = to
+		} else {
+			hunks = append(hunks, hunk{from: from, to: to})
+		}
+	}
+
+	var output strings.Builder
+	fmt.Fprintf(&output, "--- %s\n+++ %s\n", name, name)
+
+	oldLine, newLine, position := 1, 1, 0
+	for _, h := range hunks {
+		// Count the lines of both sides before the hunk, then inside it
+		for ; position < h.from; position++ {
+			oldLine, newLine = advance(edits[position], oldLine, newLine)
+		}
+		oldEnd, newEnd := oldLine, newLine
+		for _, e := range edits[h.from:h.to] {
+			oldEnd, newEnd = advance(e, oldEnd, newEnd)
+		}
+
+		fmt.Fprintf(&output, "@@ -%s +%s @@\n", hunkRange(oldLine, oldEnd-oldLine), hunkRange(newLine, newEnd-newLine))
+		for _, e := range edits[h.from:h.to] {
+			output.WriteByte(e.kind)
+			output.WriteString(e.text)
+			output.WriteString("\n")
+		}
+	}
+
+	return output.String()
+}
+
+// advance :
+// Returns the next line of both sides of a diff, after the given edit.
+func advance(e edit, oldLine, newLine int) (int, int) {
+	if e.kind != '+' {
+		oldLine++
+	}
+	if e.kind != '-' {
+		newLine++
+	}
+	return oldLine, newLine
+}
+
+// hunkRange :
+// Returns the range of a hunk header. An empty range is placed on the line before it, as "diff -u" does.
+func hunkRange(start, count int) string {
+	if count == 0 {
+		start--
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", start)
+	}
+	return fmt.Sprintf("%d,%d", start, count)
+}
+
+// splitLines :
+// Splits a text into lines, without the line break of the last one.
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
+
+// diffLines :
+// Returns the shortest list of edits that turns before into after, found with the longest common subsequence of
+// their lines. Source files are small, so the quadratic table is not a concern.
+func diffLines(before, after []string) []edit {
+	// common[i][j] is the length of the longest common subsequence of before[i:] and after[j:]
+	common := make([][]int, len(before)+1)
+	for i := range common {
+		common[i] = make([]int, len(after)+1)
+	}
+	for i := len(before) - 1; i >= 0; i-- {
+		for j := len(after) - 1; j >= 0; j-- {
+			if before[i] == after[j] {
+				common[i][j] = common[i+1][j+1] + 1
+			} else {
+				common[i][j] = max(common[i+1][j], common[i][j+1])
+			}
+		}
+	}
+
+	edits := make([]edit, 0, len(before)+len(after))
+	i, j := 0, 0
+	for i < len(before) && j < len(after) {
+		switch {
+		case before[i] == after[j]:
+			edits = append(edits, edit{kind: ' ', text: before[i]})
+			i++
+			j++
+		case common[i+1][j] >= common[i][j+1]:
+			edits = append(edits, edit{kind: '-', text: before[i]})
+			i++
+		default:
+			edits = append(edits, edit{kind: '+', text: after[j]})
+			j++
+		}
+	}
+	for ; i < len(before); i++ {
+		edits = append(edits, edit{kind: '-', text: before[i]})
+	}
+	for ; j < len(after); j++ {
+		edits = append(edits, edit{kind: '+', text: after[j]})
+	}
+	return edits
+}
@@ -0,0 +1,544 @@
+package format
+
+import (
+	"fmt"
+	"io"
+	"mechanus-compiler/internal/ast"
+	"mechanus-compiler/internal/compiler_error"
+	"mechanus-compiler/internal/lexer"
+	"mechanus-compiler/internal/logger"
+	"mechanus-compiler/internal/parser"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Formatter :
+// This is the structure responsible for printing a source file back in the canonical layout: one command per line,
+// blocks indented by their nesting, single spaces around operators and normalized parameter lists. Comments are kept
+// where they were, next to the command of their line or on their own lines, and single blank lines between commands
+// are kept too.
+type Formatter struct {
+	logger  *logger.Logger
+	debug   bool
+	name    string
+	content string
+	source  []string
+	lines   []line
+	root    *ast.Construct // Names the State sets used as types
+}
+
+// line :
+// A line of the formatted file. Anchor is the line of the source file it comes from, or the first one for a multiline
+// comment, whose last one is end. They are used to put comments and blank lines back in place. Closing lines start
+// with the '}' of a block. Verbatim lines hold a raw Omnidrone that spans lines, whose lines after the first are
+// written as they are. Their first line ends inside the Omnidrone, so only its indentation is replaced.
+type line struct {
+	depth    int
+	text     string
+	anchor   int
+	end      int
+	closing  bool
+	verbatim bool
+}
+
+// indentation is the text used for each level of nesting.
+const indentation = "    "
+
+// NewFormatter :
+// Initializes a new Formatter instance reading the source from input. The name is the one given to diagnostics.
+//
+// Fails if it is not possible to read the source.
+func NewFormatter(input io.Reader, name string, debug bool) (Formatter, error) {
+	// Initialize the logger. Log to Stderr. Set level based on the debug flag.
+	logLevel := logger.LevelInfo
+	if debug {
+		logLevel = logger.LevelDebug
+	}
+	lg := logger.New(os.Stderr, logLevel)
+
+	// The source is kept to find comments and blank lines, and handed to the parser when running
+	content, err := io.ReadAll(input)
+	if err != nil {
+		err = compiler_error.FileErrorf("NewFormatter", err)
+		lg.Error(err, nil)
+		return Formatter{}, err
+	}
+
+	// Lines are split like the lexer does, so columns match its positions
+	source := strings.Split(string(content), "\n")
+	for i := range source {
+		source[i] = strings.TrimSuffix(source[i], "\r")
+	}
+
+	return Formatter{
+		logger:  lg,
+		debug:   debug,
+		name:    name,
+		content: string(content),
+		source:  source,
+	}, nil
+}
+
+// Run :
+// Parses the source file and returns it formatted.
+//
+// Fails if the source file has lexical or syntax errors, since a broken file cannot be printed back without losing
+// what could not be parsed.
+func (formatter *Formatter) Run() (string, error) {
+	formatter.lines = nil
+	formatter.root = nil
+
+	syntax, err := parser.NewParser(strings.NewReader(formatter.content), formatter.name, formatter.debug)
+	if err != nil {
+		return "", err
+	}
+	construct, err := syntax.Run()
+	if err != nil {
+		return "", err
+	}
+
+	formatter.root = construct
+	formatter.construct(construct)
+	formatter.placeComments(syntax.Comments())
+
+	formatter.logger.Debug("Source formatted", map[string]any{"lines": len(formatter.lines)})
+	return formatter.render(), nil
+}
+
+//**********************************************************************************************************************
+// Program structure
+//**********************************************************************************************************************
+
+// construct :
+// Prints the Construct with its Architects and State sets, in the order they are written. Both lists are stored
+// bottom-to-top, so they are merged from their ends.
+func (formatter *Formatter) construct(construct *ast.Construct) {
+	formatter.emit(0, "{", construct.Open.Line, false)
+	architects, states := len(construct.Architects)-1, len(construct.States)-1
+	for architects >= 0 || states >= 0 {
+		if states >= 0 && (architects < 0 ||
+			construct.States[states].Position.Line < construct.Architects[architects].Position.Line) {
+			formatter.state(construct.States[states], 1)
+			states--
+			continue
+		}
+		formatter.architect(construct.Architects[architects], 1)
+		architects--
+	}
+	formatter.emit(0, fmt.Sprintf("} %s Construct", construct.Name), construct.Position.Line, true)
+}
+
+// state :
+// Prints a State set: "(Idle, Running)Machine State".
+func (formatter *Formatter) state(state *ast.StateSet, depth int) {
+	members := make([]string, len(state.Members))
+	for i, member := range state.Members {
+		members[i] = member.Name
+	}
+	formatter.emit(depth, fmt.Sprintf("(%s)%s State", strings.Join(members, ", "), state.Name), state.Position.Line,
+		false)
+}
+
+// architect :
+// Prints an Architect, closing its body with its header: "} Tensor (Gear :g)half Architect".
+func (formatter *Formatter) architect(architect *ast.Architect, depth int) {
+	parameters := make([]string, len(architect.Parameters))
+	for i, parameter := range architect.Parameters {
+		parameters[i] = fmt.Sprintf("%s :%s", formatter.root.TypeString(parameter.Type), parameter.Name)
+	}
+
+	header := fmt.Sprintf("(%s)%s Architect", strings.Join(parameters, ", "), architect.Name)
+	if architect.ReturnType != ast.TypeNone {
+		header = formatter.root.TypeString(architect.ReturnType) + " " + header
+	}
+
+	formatter.emit(depth, "{", architect.Body.Open.Line, false)
+	formatter.commands(architect.Body, depth+1)
+	formatter.emit(depth, "} "+header, architect.Position.Line, true)
+}
+
+// commands :
+// Prints the commands of a block in the order they are written, which is the reverse of the execution order.
+func (formatter *Formatter) commands(block *ast.Block, depth int) {
+	for i := len(block.Commands) - 1; i >= 0; i-- {
+		formatter.command(block.Commands[i], depth)
+	}
+}
+
+//**********************************************************************************************************************
+// Commands
+//**********************************************************************************************************************
+
+// segment :
+// One of the blocks of an if, with the header written after its '}'.
+type segment struct {
+	block     *ast.Block
+	header    string
+	condition ast.Expr
+	anchor    int
+}
+
+// command :
+// Prints a single command. Commands that own blocks span several lines.
+func (formatter *Formatter) command(command ast.Command, depth int) {
+	switch c := command.(type) {
+	case *ast.CmdIf:
+		// The else block is written at the top, and the if block at the bottom
+		segments := make([]segment, 0, len(c.Elifs)+2)
+		if c.Else != nil {
+			segments = append(segments, segment{block: c.Else, header: "else", anchor: c.Else.Position.Line})
+		}
+		for i := len(c.Elifs) - 1; i >= 0; i-- {
+			elif := c.Elifs[i]
+			segments = append(segments, segment{
+				block:     elif.Body,
+				header:    formatter.expression(elif.Condition) + " elif",
+				condition: elif.Condition,
+				anchor:    elif.Position.Line,
+			})
+		}
+		segments = append(segments, segment{
+			block:     c.Then,
+			header:    formatter.expression(c.Condition) + " if",
+			condition: c.Condition,
+			anchor:    c.Position.Line,
+		})
+
+		formatter.emit(depth, "{", segments[0].block.Open.Line, false)
+		for i, segment := range segments {
+			formatter.commands(segment.block, depth+1)
+			text := "} " + segment.header
+			if i < len(segments)-1 {
+				text += " {"
+			}
+			formatter.emit(depth, text, segment.anchor, true)
+			formatter.rawLines(segment.condition)
+		}
+	case *ast.CmdFor:
+		header, condition := formatter.expression(c.Condition), c.Condition
+		if c.Elements != nil {
+			header = fmt.Sprintf("%s =: %s :%s", formatter.expression(c.Elements), formatter.root.TypeString(c.Type),
+				c.Name)
+			condition = c.Elements
+		}
+		formatter.emit(depth, "{", c.Body.Open.Line, false)
+		formatter.commands(c.Body, depth+1)
+		formatter.emit(depth, "} "+header+" for", c.Position.Line, true)
+		formatter.rawLines(condition)
+		return
+	case *ast.CmdDeclaration:
+		text := fmt.Sprintf("%s =: %s :%s", formatter.expression(c.Value), formatter.root.TypeString(c.Type), c.Name)
+		formatter.emit(depth, text, c.Position.Line, false)
+	case *ast.CmdAssignment:
+		target := c.Name
+		if c.Index != nil {
+			target = fmt.Sprintf("[%s]%s", formatter.expression(c.Index), c.Name)
+		}
+		formatter.emit(depth, fmt.Sprintf("%s = %s", formatter.expression(c.Value), target), c.Position.Line, false)
+	case *ast.CmdReceive:
+		formatter.emit(depth, fmt.Sprintf("(%s)%sReceive", c.Name, channel(c.Channel)), c.Position.Line, false)
+	case *ast.CmdSend:
+		send := fmt.Sprintf("(%s)%sSend", formatter.expression(c.Value), channel(c.Channel))
+		formatter.emit(depth, send, c.Position.Line, false)
+	case *ast.CmdAppend:
+		text := fmt.Sprintf("(%s)%s Append", formatter.expression(c.Value), c.Assembly.Name)
+		formatter.emit(depth, text, c.Position.Line, false)
+	case *ast.CmdIntegrate:
+		formatter.emit(depth, formatter.expression(c.Value)+" Integrate", c.Position.Line, false)
+	case *ast.CmdCall:
+		formatter.emit(depth, formatter.expression(c.Call), c.Call.Position.Line, false)
+	default:
+		return
+	}
+	formatter.rawLines(command)
+}
+
+// emit :
+// Adds a line of code to the formatted file.
+func (formatter *Formatter) emit(depth int, text string, anchor int, closing bool) {
+	formatter.lines = append(formatter.lines, line{
+		depth:   depth,
+		text:    text,
+		anchor:  anchor,
+		closing: closing,
+		end:     anchor,
+	})
+}
+
+// rawLines :
+// Stretches the last line over the raw Omnidrones of a node that span lines. Their lines are kept as they are, since
+// indenting them would change their text.
+func (formatter *Formatter) rawLines(node ast.Node) {
+	last := &formatter.lines[len(formatter.lines)-1]
+	ast.Inspect(node, func(n ast.Node) bool {
+		if literal, ok := n.(*ast.OmnidroneLiteral); ok && literal.Raw && strings.Contains(literal.Value, "\n") {
+			last.anchor = min(last.anchor, literal.Position.Line)
+			last.end = max(last.end, literal.Position.Line+strings.Count(literal.Value, "\n"))
+			last.verbatim = true
+		}
+		return true
+	})
+}
+
+//**********************************************************************************************************************
+// Expressions
+//**********************************************************************************************************************
+
+// Precedence levels, from the loosest to the tightest binding.
+const (
+	precedenceOr = iota + 1
+	precedenceAnd
+	precedenceNot
+	precedenceComparison
+	precedenceSum
+	precedenceProduct
+	precedenceUnary
+	precedenceOperand
+)
+
+// precedence :
+// Returns how tightly an expression binds.
+func precedence(expr ast.Expr) int {
+	switch e := expr.(type) {
+	case *ast.BinaryExpr:
+		switch {
+		case e.Operator == ast.OpOr:
+			return precedenceOr
+		case e.Operator == ast.OpAnd:
+			return precedenceAnd
+		case e.Operator.IsComparison():
+			return precedenceComparison
+		case e.Operator == ast.OpAdd || e.Operator == ast.OpSub:
+			return precedenceSum
+		default:
+			return precedenceProduct
+		}
+	case *ast.UnaryExpr:
+		if e.Operator == ast.OpNot {
+			return precedenceNot
+		}
+		return precedenceUnary
+	default:
+		return precedenceOperand
+	}
+}
+
+// expression :
+// Prints an expression with single spaces around binary operators. Parentheses are only written where the
+// precedence needs them, so "(a * b) + c" becomes "a * b + c".
+func (formatter *Formatter) expression(expr ast.Expr) string {
+	switch e := expr.(type) {
+	case *ast.BinaryExpr:
+		// Operators are left-associative, so an operand on the right with the same precedence needs parentheses.
+		// Comparisons do not chain, so a comparison on either side of another one needs them too.
+		level := precedence(e)
+		parenthesize := precedence(e.Left) < level
+		if e.Operator.IsComparison() {
+			parenthesize = precedence(e.Left) <= level
+		}
+		left := formatter.operand(e.Left, parenthesize)
+		right := formatter.operand(e.Right, precedence(e.Right) <= level)
+		return fmt.Sprintf("%s %s %s", left, e.Operator, right)
+	case *ast.UnaryExpr:
+		if e.Operator == ast.OpNot {
+			// '!' binds looser than a comparison, but "!(a > 1)" reads better than "!a > 1"
+			parenthesize := precedence(e.Operand) != precedenceNot && precedence(e.Operand) != precedenceOperand
+			return e.Operator.String() + formatter.operand(e.Operand, parenthesize)
+		}
+		return e.Operator.String() + formatter.operand(e.Operand, precedence(e.Operand) < precedenceUnary)
+	case *ast.Identifier:
+		return e.Name
+	case *ast.GearLiteral:
+		return strconv.FormatInt(e.Value, 10)
+	case *ast.TensorLiteral:
+		// A Tensor keeps its decimal point, or it would be read back as a Gear
+		text := strconv.FormatFloat(e.Value, 'f', -1, 64)
+		if !strings.Contains(text, ".") {
+			text += ".0"
+		}
+		return text
+	case *ast.MonodroneLiteral:
+		return lexer.Quote(string(e.Value), lexer.SingleQuote)
+	case *ast.OmnidroneLiteral:
+		if e.Raw {
+			return string(lexer.Backtick) + e.Value + string(lexer.Backtick)
+		}
+		return lexer.Quote(e.Value, lexer.DoubleQuote)
+	case *ast.SwitchLiteral:
+		return strconv.FormatBool(e.Value)
+	case *ast.NilLiteral:
+		return "Nil"
+	case *ast.CallExpr:
+		arguments := make([]string, len(e.Arguments))
+		for i, argument := range e.Arguments {
+			arguments[i] = formatter.expression(argument)
+		}
+		if e.Detached {
+			return fmt.Sprintf("(%s)%s Detach", strings.Join(arguments, ", "), e.Name)
+		}
+		return fmt.Sprintf("(%s)%s", strings.Join(arguments, ", "), e.Name)
+	case *ast.AssemblyLiteral:
+		elements := make([]string, len(e.Elements))
+		for i, element := range e.Elements {
+			elements[i] = formatter.expression(element)
+		}
+		return fmt.Sprintf("(%s)%s", strings.Join(elements, ", "), formatter.root.TypeString(e.Type))
+	case *ast.IndexExpr:
+		return fmt.Sprintf("[%s]%s", formatter.expression(e.Index), e.Assembly.Name)
+	case *ast.LengthExpr:
+		return fmt.Sprintf("(%s)Length", formatter.expression(e.Assembly))
+	default:
+		return ""
+	}
+}
+
+// channel :
+// Prints the Channel of a Send or Receive followed by a space, or nothing when it uses the input or output.
+func channel(name *ast.Identifier) string {
+	if name == nil {
+		return ""
+	}
+	return name.Name + " "
+}
+
+// operand :
+// Prints an operand of an operator, in parentheses if asked to.
+func (formatter *Formatter) operand(expr ast.Expr, parenthesize bool) string {
+	if parenthesize {
+		return "(" + formatter.expression(expr) + ")"
+	}
+	return formatter.expression(expr)
+}
+
+//**********************************************************************************************************************
+// Comments and layout
+//**********************************************************************************************************************
+
+// placeComments :
+// Puts the comments back among the lines of code. A comment that shares its source line with code stays on that
+// line: a single line comment, and everything to its left, goes before the code, while a multiline comment keeps the
+// side it was on. Any other comment gets lines of its own, before the first line of code written below it.
+func (formatter *Formatter) placeComments(comments []lexer.Comment) {
+	// The lexer finds comments from the bottom of the file to the top
+	comments = append([]lexer.Comment(nil), comments...)
+	sort.Slice(comments, func(i, j int) bool {
+		a, b := comments[i].Span.Start, comments[j].Span.Start
+		return a.Line < b.Line || (a.Line == b.Line && a.Column < b.Column)
+	})
+
+	anchors := make(map[int]int)
+	for i := len(formatter.lines) - 1; i >= 0; i-- {
+		anchors[formatter.lines[i].anchor] = i
+	}
+
+	prefixes := make(map[int][]string)
+	suffixes := make(map[int][]string)
+	standalone := make([]lexer.Comment, 0, len(comments))
+	for _, comment := range comments {
+		start, end := comment.Span.Start, comment.Span.End
+		index, ok := anchors[start.Line]
+		if !ok || start.Line != end.Line {
+			standalone = append(standalone, comment)
+			continue
+		}
+		singleLine := strings.HasSuffix(comment.Text, lexer.SingleLineComment)
+		if singleLine || end.Column-1 <= formatter.codeStart(start.Line, comments) {
+			prefixes[index] = append(prefixes[index], comment.Text)
+		} else {
+			suffixes[index] = append(suffixes[index], comment.Text)
+		}
+	}
+
+	lines := make([]line, 0, len(formatter.lines)+len(standalone))
+	next := 0
+	for i, code := range formatter.lines {
+		for next < len(standalone) && standalone[next].Span.Start.Line < code.anchor {
+			lines = append(lines, commentLine(standalone[next], code.depth, code.closing))
+			next++
+		}
+
+		parts := make([]string, 0, len(prefixes[i])+1+len(suffixes[i]))
+		parts = append(append(append(parts, prefixes[i]...), code.text), suffixes[i]...)
+		code.text = strings.Join(parts, " ")
+		lines = append(lines, code)
+	}
+	for ; next < len(standalone); next++ {
+		lines = append(lines, commentLine(standalone[next], 0, false))
+	}
+
+	formatter.lines = lines
+}
+
+// commentLine :
+// Returns a comment on lines of its own, indented like the line of code below it. A comment right above a '}' belongs
+// to the block that the '}' closes.
+func commentLine(comment lexer.Comment, depth int, closing bool) line {
+	if closing {
+		depth++
+	}
+	return line{
+		depth:  depth,
+		text:   comment.Text,
+		anchor: comment.Span.Start.Line,
+		end:    comment.Span.End.Line,
+	}
+}
+
+// codeStart :
+// Returns the 0-based column of the first character of code in a source line, once the comments on it are removed.
+func (formatter *Formatter) codeStart(lineNumber int, comments []lexer.Comment) int {
+	text := []rune(formatter.source[lineNumber-1])
+	for _, comment := range comments {
+		if comment.Span.Start.Line != lineNumber || comment.Span.End.Line != lineNumber {
+			continue
+		}
+		for column := comment.Span.Start.Column - 1; column < comment.Span.End.Column-1; column++ {
+			text[column] = ' '
+		}
+	}
+	return len(text) - len([]rune(strings.TrimLeft(string(text), " \t")))
+}
+
+// render :
+// Writes the formatted lines. A single blank line is kept wherever the source had blank lines, except right after a
+// '{' or right before a '}'.
+func (formatter *Formatter) render() string {
+	var output strings.Builder
+	for i, current := range formatter.lines {
+		if i > 0 && !current.closing && !strings.HasSuffix(formatter.lines[i-1].text, "{") &&
+			formatter.blankBetween(formatter.lines[i-1].end, current.anchor) {
+			output.WriteString("\n")
+		}
+
+		// The lines of a multiline comment are indented like its first line
+		for i, text := range strings.Split(current.text, "\n") {
+			if current.verbatim && i > 0 {
+				output.WriteString(text + "\n")
+				continue
+			}
+			if current.verbatim {
+				text = strings.TrimLeft(text, " \t")
+			} else {
+				text = strings.TrimSpace(text)
+			}
+			if text != "" {
+				output.WriteString(strings.Repeat(indentation, current.depth) + text)
+			}
+			output.WriteString("\n")
+		}
+	}
+	return output.String()
+}
+
+// blankBetween :
+// Checks if there is a blank line in the source between two lines, both excluded.
+func (formatter *Formatter) blankBetween(above, below int) bool {
+	for number := above + 1; number < below && number <= len(formatter.source); number++ {
+		if strings.TrimSpace(formatter.source[number-1]) == "" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,241 @@
+package format
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// formatSource formats the given source.
+func formatSource(t *testing.T, source string) (string, error) {
+	t.Helper()
+
+	formatter, err := NewFormatter(strings.NewReader(source), "input.mecha", false)
+	if err != nil {
+		t.Fatalf("failed to create formatter: %v", err)
+	}
+	return formatter.Run()
+}
+
+// TestFormatter_Idempotent ensures that formatting every example twice gives the same result as formatting it once.
+func TestFormatter_Idempotent(t *testing.T) {
+	paths, err := filepath.Glob("../../docs/examples/example*_input.mecha")
+	if err != nil || len(paths) == 0 {
+		t.Fatalf("no examples found: %v", err)
+	}
+
+	for _, path := range paths {
+		source, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("failed to read %s: %v", path, err)
+		}
+
+		once, err := formatSource(t, string(source))
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", path, err)
+			continue
+		}
+		twice, err := formatSource(t, once)
+		if err != nil {
+			t.Errorf("%s: the formatted source does not parse: %v", path, err)
+			continue
+		}
+		if once != twice {
+			t.Errorf("%s: formatting is not idempotent:\n%s", path, Diff(path, once, twice))
+		}
+	}
+}
+
+// TestFormatter_Layout checks indentation, spacing, parameter lists and comments on a messy source.
+func TestFormatter_Layout(t *testing.T) {
+	source := `  top //
+{
+  {
+   {
+      (x)Send  */ kept on its line /*
+   }   x<1 for
+          note // x+1*2   =   x
+   1 Integrate (x)Send
+   0=:Gear:x
+  }Tensor(Gear:a,Tensor:b)  f Architect
+
+
+  {
+     ((1, 2.50)f) - (3 - 4) Integrate
+     {
+      */ spans
+         two lines /*
+     } else {
+       (a)Receive
+
+     } 1==1 if
+  } ()main Architect
+ } main Construct`
+
+	expected := `top //
+{
+    {
+        {
+            (x)Send */ kept on its line /*
+        } x < 1 for
+        note // x + 1 * 2 = x
+        1 Integrate
+        (x)Send
+        0 =: Gear :x
+    } Tensor (Gear :a, Tensor :b)f Architect
+
+    {
+        (1, 2.5)f - (3 - 4) Integrate
+        {
+            */ spans
+            two lines /*
+        } else {
+            (a)Receive
+        } 1 == 1 if
+    } ()main Architect
+} main Construct
+`
+
+	formatted, err := formatSource(t, source)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if formatted != expected {
+		t.Errorf("unexpected layout:\n%s", Diff("layout", expected, formatted))
+	}
+}
+
+// TestFormatter_RawStrings ensures that the lines of a raw Omnidrone are kept as they are, while the code around them
+// is indented.
+func TestFormatter_RawStrings(t *testing.T) {
+	source := "{\n{\n(`a // \n b`)Send\n(t)Send\n  `first\n   second \\n\n`   =: Omnidrone :t\n(\"tab\\t\")Send\n" +
+		"} ()main Architect\n} main Construct\n"
+	expected := "{\n    {\n        (`a // \n b`)Send\n        (t)Send\n        `first\n   second \\n\n` =: Omnidrone :t\n" +
+		"        (\"tab\\t\")Send\n    } ()main Architect\n} main Construct\n"
+
+	formatted, err := formatSource(t, source)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if formatted != expected {
+		t.Errorf("unexpected layout:\n%s", Diff("layout", expected, formatted))
+	}
+}
+
+// TestFormatter_Conditions ensures that parentheses are only kept where the precedence of '||', '&&' and '!' needs
+// them, and always around an operand of '!' that is itself an operation.
+func TestFormatter_Conditions(t *testing.T) {
+	source := "{\n{\n{\n} ((a>1)||(!(b<2)&&c==3)) && !!(d!=4) if\n} ()main Architect\n} main Construct\n"
+	expected := "{\n    {\n        {\n        } (a > 1 || !(b < 2) && c == 3) && !!(d != 4) if\n    } ()main Architect\n" +
+		"} main Construct\n"
+
+	formatted, err := formatSource(t, source)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if formatted != expected {
+		t.Errorf("unexpected layout:\n%s", Diff("layout", expected, formatted))
+	}
+}
+
+// TestFormatter_Switches checks that Switch literals are written in lowercase, and that a comparison keeps the
+// parentheses around a comparison on either side, since comparisons do not chain.
+func TestFormatter_Switches(t *testing.T) {
+	source := "{\n{\n (a<1)==(b>2)  =:Switch:s\n TRUE&&!False =:  Switch :t\n} ()main Architect\n} main Construct\n"
+	expected := "{\n    {\n        (a < 1) == (b > 2) =: Switch :s\n        true && !false =: Switch :t\n" +
+		"    } ()main Architect\n} main Construct\n"
+
+	formatted, err := formatSource(t, source)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if formatted != expected {
+		t.Errorf("unexpected layout:\n%s", Diff("layout", expected, formatted))
+	}
+}
+
+// TestFormatter_Assemblies checks the layout of Assembly literals and types, indexes, Length, Append, stores into an
+// element and iteration.
+func TestFormatter_Assemblies(t *testing.T) {
+	source := "{\n{\n{\n(x)Send\n}xs=:Gear:x  for\n(( xs )Length)xs   Append\n5=[ 0 ]xs\n([1]xs)Send\n" +
+		"( 1,2 )Gear  Assembly=:Gear Assembly:xs\n()Tensor Assembly =:Tensor Assembly:ts\n} ()main Architect\n" +
+		"} main Construct\n"
+	expected := "{\n    {\n        {\n            (x)Send\n        } xs =: Gear :x for\n" +
+		"        ((xs)Length)xs Append\n        5 = [0]xs\n        ([1]xs)Send\n        (1, 2)Gear Assembly =: Gear Assembly :xs\n" +
+		"        ()Tensor Assembly =: Tensor Assembly :ts\n    } ()main Architect\n} main Construct\n"
+
+	formatted, err := formatSource(t, source)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if formatted != expected {
+		t.Errorf("unexpected layout:\n%s", Diff("layout", expected, formatted))
+	}
+}
+
+// TestFormatter_Concurrency checks the layout of Channel types, Send and Receive on a Channel, and Detach.
+func TestFormatter_Concurrency(t *testing.T) {
+	source := "{\n{\n(v)c  Send\n(v)  c Receive\n(1,c)main   Detach\n0=:Gear   Channel:c\n} ()main Architect\n} main Construct\n"
+	expected := "{\n    {\n        (v)c Send\n        (v)c Receive\n        (1, c)main Detach\n        0 =: Gear Channel :c\n" +
+		"    } ()main Architect\n} main Construct\n"
+
+	formatted, err := formatSource(t, source)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if formatted != expected {
+		t.Errorf("unexpected layout:\n%s", Diff("layout", expected, formatted))
+	}
+}
+
+// TestFormatter_States checks the layout of a State set and keeps it in its place among the Architects.
+func TestFormatter_States(t *testing.T) {
+	source := "{\n{\n} ()main Architect\n(  A,B ,C )Phase   State\n{\n} Phase (Phase:p)next Architect\n" +
+		"} main Construct\n"
+	expected := "{\n    {\n    } ()main Architect\n    (A, B, C)Phase State\n" +
+		"    {\n    } Phase (Phase :p)next Architect\n} main Construct\n"
+
+	formatted, err := formatSource(t, source)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if formatted != expected {
+		t.Errorf("unexpected layout:\n%s", Diff("layout", expected, formatted))
+	}
+}
+
+// TestFormatter_SyntaxError ensures that a broken source is not formatted.
+func TestFormatter_SyntaxError(t *testing.T) {
+	if _, err := formatSource(t, "{\n  {\n    0 Integrate Integrate\n  } ()main Architect\n} main Construct\n"); err == nil {
+		t.Error("expected a syntax error, got nil")
+	}
+}
+
+// TestDiff checks the hunks of a unified diff.
+func TestDiff(t *testing.T) {
+	before := "a\nb\nc\nd\ne\nf\ng\nh\ni\nj\n"
+	after := "a\nB\nc\nd\ne\nf\ng\nh\ni\nj\nk\n"
+
+	expected := `--- file
++++ file
+@@ -1,5 +1,5 @@
+ a
+-b
++B
+ c
+ d
+ e
+@@ -8,3 +8,4 @@
+ h
+ i
+ j
++k
+`
+	if diff := Diff("file", before, after); diff != expected {
+		t.Errorf("unexpected diff:\n%s", diff)
+	}
+	if diff := Diff("file", before, before); diff != "" {
+		t.Errorf("expected no diff, got:\n%s", diff)
+	}
+}
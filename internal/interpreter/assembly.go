@@ -0,0 +1,67 @@
+package interpreter
+
+import (
+	"errors"
+	"mechanus-compiler/internal/compiler_error"
+	"sync"
+)
+
+// Assembly :
+// The elements of an Assembly, shared by every variable it was assigned to, so an element stored or appended through
+// one of them is seen by all. Detached Architects may share an Assembly too, so every access holds its mutex.
+type Assembly struct {
+	mutex    sync.Mutex
+	elements []Value
+}
+
+// ErrOutOfRange is returned when an element is read or stored outside of an Assembly.
+var ErrOutOfRange = errors.New(compiler_error.OutOfRange)
+
+// NewAssembly :
+// Makes an Assembly holding the given elements, which it takes ownership of.
+func NewAssembly(elements []Value) *Assembly {
+	return &Assembly{elements: elements}
+}
+
+// Len :
+// Returns the number of elements of the Assembly.
+func (assembly *Assembly) Len() int64 {
+	assembly.mutex.Lock()
+	defer assembly.mutex.Unlock()
+	return int64(len(assembly.elements))
+}
+
+// Get :
+// Returns the element at index.
+//
+// Fails if there is no such element.
+func (assembly *Assembly) Get(index int64) (Value, error) {
+	assembly.mutex.Lock()
+	defer assembly.mutex.Unlock()
+	if index < 0 || index >= int64(len(assembly.elements)) {
+		return nil, ErrOutOfRange
+	}
+	return assembly.elements[index], nil
+}
+
+// Set :
+// Replaces the element at index.
+//
+// Fails if there is no such element.
+func (assembly *Assembly) Set(index int64, value Value) error {
+	assembly.mutex.Lock()
+	defer assembly.mutex.Unlock()
+	if index < 0 || index >= int64(len(assembly.elements)) {
+		return ErrOutOfRange
+	}
+	assembly.elements[index] = value
+	return nil
+}
+
+// Append :
+// Adds an element to the end of the Assembly.
+func (assembly *Assembly) Append(value Value) {
+	assembly.mutex.Lock()
+	defer assembly.mutex.Unlock()
+	assembly.elements = append(assembly.elements, value)
+}
@@ -0,0 +1,223 @@
+package interpreter
+
+import (
+	"errors"
+	"fmt"
+	"mechanus-compiler/internal/compiler_error"
+	"sync"
+	"sync/atomic"
+)
+
+// Channel :
+// A Channel made by a declaration, holding the values sent to it until they are received. A Send may leave its value
+// while the buffer holds fewer values than the capacity plus the Architects waiting to Receive, so an unbuffered
+// Channel only takes a value that another Architect is already waiting for.
+type Channel struct {
+	capacity  int64
+	buffer    []Value
+	receivers int64
+}
+
+// NewChannel :
+// Makes a Channel that holds up to capacity values nobody is waiting for.
+//
+// Fails if the capacity is negative.
+func NewChannel(capacity int64) (*Channel, error) {
+	if capacity < 0 {
+		return nil, fmt.Errorf(compiler_error.NegativeBuffer, capacity)
+	}
+	return &Channel{capacity: capacity}, nil
+}
+
+var (
+	// ErrHalted is returned to the Architects still running once the program stopped, either because main
+	// finished or because another Architect failed. The failure itself is kept by the Scheduler.
+	ErrHalted = errors.New("the program has halted")
+	// ErrDeadlock is returned to the last Architect that starts waiting on a Channel.
+	ErrDeadlock = errors.New(compiler_error.Deadlock)
+	// ErrNilChannel is returned when a Channel variable is used before a Channel was made for it.
+	ErrNilChannel = errors.New(compiler_error.NilChannel)
+)
+
+// Scheduler :
+// Coordinates the Architects of a program that run alongside each other, each on its own goroutine. It counts the
+// Architects that are not waiting on a Channel, so a deadlock is found as soon as the last one starts waiting, keeps
+// the first error of a detached Architect, and orders their use of the input and output.
+type Scheduler struct {
+	mutex   sync.Mutex
+	changed *sync.Cond
+	running int // Architects that are not waiting, including those woken up but not yet running again
+	waiting int // Architects waiting for a Channel to change
+	halted  atomic.Bool
+	err     error
+
+	input  sync.Mutex
+	output sync.Mutex
+}
+
+// NewScheduler :
+// Initializes a new Scheduler, counting the main Architect as running.
+func NewScheduler() *Scheduler {
+	scheduler := &Scheduler{running: 1}
+	scheduler.changed = sync.NewCond(&scheduler.mutex)
+	return scheduler
+}
+
+// Detach :
+// Runs an Architect on its own goroutine. Nobody waits for it to finish, but the error it fails with, if any, halts
+// the whole program.
+func (scheduler *Scheduler) Detach(run func() error) {
+	scheduler.mutex.Lock()
+	scheduler.running++
+	scheduler.mutex.Unlock()
+
+	go func() {
+		err := run()
+
+		scheduler.mutex.Lock()
+		defer scheduler.mutex.Unlock()
+		scheduler.running--
+		if err != nil && !errors.Is(err, ErrHalted) && scheduler.err == nil {
+			scheduler.err = err
+			scheduler.halted.Store(true)
+		}
+		// The Architects still waiting must check whether anyone is left to wake them up
+		scheduler.wake()
+	}()
+}
+
+// Halted :
+// Checks if the program stopped. Running Architects check it before every command.
+func (scheduler *Scheduler) Halted() bool {
+	return scheduler.halted.Load()
+}
+
+// Stop :
+// Halts the program once main finished. The Architects still running stop at their next command, and none of them
+// writes to the output after Stop returns.
+func (scheduler *Scheduler) Stop() {
+	scheduler.output.Lock()
+	scheduler.halted.Store(true)
+	scheduler.output.Unlock()
+
+	scheduler.mutex.Lock()
+	defer scheduler.mutex.Unlock()
+	scheduler.wake()
+}
+
+// Failure :
+// Waits for the error of the detached Architect that halted the program. Only called by main after it got ErrHalted.
+func (scheduler *Scheduler) Failure() error {
+	scheduler.mutex.Lock()
+	defer scheduler.mutex.Unlock()
+	for scheduler.err == nil {
+		scheduler.changed.Wait()
+	}
+	return scheduler.err
+}
+
+// Send :
+// Leaves a value on a Channel, waiting until there is room for it.
+//
+// Fails if the Channel was never made, on a deadlock, or with ErrHalted if the program stopped while waiting.
+func (scheduler *Scheduler) Send(channel *Channel, value Value) error {
+	if channel == nil {
+		return ErrNilChannel
+	}
+
+	scheduler.mutex.Lock()
+	defer scheduler.mutex.Unlock()
+	for int64(len(channel.buffer)) >= channel.capacity+channel.receivers {
+		if err := scheduler.wait(); err != nil {
+			return err
+		}
+	}
+	channel.buffer = append(channel.buffer, value)
+	scheduler.wake()
+	return nil
+}
+
+// Receive :
+// Takes the oldest value of a Channel, waiting until there is one.
+//
+// Fails like Send.
+func (scheduler *Scheduler) Receive(channel *Channel) (Value, error) {
+	if channel == nil {
+		return nil, ErrNilChannel
+	}
+
+	scheduler.mutex.Lock()
+	defer scheduler.mutex.Unlock()
+	channel.receivers++
+	defer func() { channel.receivers-- }()
+
+	// A new receiver makes room for a Send waiting on an unbuffered Channel
+	scheduler.wake()
+	for len(channel.buffer) == 0 {
+		if err := scheduler.wait(); err != nil {
+			return nil, err
+		}
+	}
+	value := channel.buffer[0]
+	channel.buffer = channel.buffer[1:]
+	scheduler.wake()
+	return value, nil
+}
+
+// Output :
+// Runs write while no other Architect writes to the output.
+//
+// Fails with ErrHalted, without running write, once the program stopped.
+func (scheduler *Scheduler) Output(write func() error) error {
+	scheduler.output.Lock()
+	defer scheduler.output.Unlock()
+	if scheduler.Halted() {
+		return ErrHalted
+	}
+	return write()
+}
+
+// Input :
+// Runs read while no other Architect reads from the input. See Output.
+func (scheduler *Scheduler) Input(read func() error) error {
+	scheduler.input.Lock()
+	defer scheduler.input.Unlock()
+	if scheduler.Halted() {
+		return ErrHalted
+	}
+	return read()
+}
+
+// wait :
+// Waits for another Architect to change a Channel. Must be called with the mutex held.
+//
+// Fails with ErrDeadlock if every other Architect is waiting too, or with ErrHalted once the program stopped.
+func (scheduler *Scheduler) wait() error {
+	if scheduler.Halted() {
+		return ErrHalted
+	}
+
+	scheduler.running--
+	if scheduler.running == 0 {
+		scheduler.running++
+		scheduler.halted.Store(true)
+		scheduler.wake()
+		return ErrDeadlock
+	}
+	scheduler.waiting++
+	scheduler.changed.Wait()
+
+	if scheduler.Halted() {
+		return ErrHalted
+	}
+	return nil
+}
+
+// wake :
+// Wakes every waiting Architect up so it checks its Channel again. They count as running from now on, so none of
+// them mistakes the others for being stuck before they had the chance to look. Must be called with the mutex held.
+func (scheduler *Scheduler) wake() {
+	scheduler.running += scheduler.waiting
+	scheduler.waiting = 0
+	scheduler.changed.Broadcast()
+}
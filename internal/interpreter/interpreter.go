@@ -0,0 +1,466 @@
+package interpreter
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"mechanus-compiler/internal/ast"
+	"mechanus-compiler/internal/compiler_error"
+	"mechanus-compiler/internal/logger"
+	"mechanus-compiler/internal/semantic"
+	"os"
+	"strings"
+)
+
+// Interpreter :
+// This is the structure responsible for running a checked Construct directly from its tree. Execution starts at the
+// main Architect; Send writes to output and Receive reads lines from input. Detached Architects run on goroutines
+// coordinated by the scheduler.
+type Interpreter struct {
+	logger    *logger.Logger
+	info      *semantic.Info
+	input     *bufio.Reader
+	output    *bufio.Writer
+	scheduler *Scheduler
+}
+
+// frame :
+// The variables and parameters of a single Architect call. Every declaration has its own symbol, so shadowed names
+// never collide and nested blocks do not need frames of their own.
+type frame map[*semantic.Symbol]Value
+
+// NewInterpreter :
+// Initializes a new Interpreter instance. info must be the result of a successful semantic analysis of the Construct
+// that will be run.
+func NewInterpreter(info *semantic.Info, input io.Reader, output io.Writer, debug bool) Interpreter {
+	// Initialize the logger. Log to Stderr. Set level based on the debug flag.
+	logLevel := logger.LevelInfo
+	if debug {
+		logLevel = logger.LevelDebug
+	}
+
+	return Interpreter{
+		logger: logger.New(os.Stderr, logLevel),
+		info:   info,
+		input:  bufio.NewReader(input),
+		output: bufio.NewWriter(output),
+	}
+}
+
+// Run :
+// Runs the main Architect of the given Construct and returns the exit code of the program, which is the Gear it
+// integrates. Architects that integrate any other type exit with 0.
+//
+// Fails if the Construct has no main Architect, or on a runtime error such as a division by zero, a Receive that
+// cannot be parsed or a deadlock, including one inside a detached Architect. The exit code is 1 in that case.
+// Detached Architects still running when main finishes are stopped.
+func (interpreter *Interpreter) Run(construct *ast.Construct) (int64, error) {
+	interpreter.scheduler = NewScheduler()
+	defer func() {
+		interpreter.scheduler.Stop()
+		if err := interpreter.output.Flush(); err != nil {
+			interpreter.logger.Error(compiler_error.FileErrorf("Interpreter.Run", err), nil)
+		}
+	}()
+
+	entry := interpreter.info.Main
+	if entry == nil {
+		diagnostic := compiler_error.RuntimeDiagnostic(ast.Pos{}, compiler_error.MissingMain)
+		err := compiler_error.RuntimeErrorf(compiler_error.RuntimeError, diagnostic)
+		interpreter.logger.Error(err, nil)
+		return 1, err
+	}
+
+	interpreter.logger.Debug("Running Construct", map[string]any{"name": construct.Name})
+	value, err := interpreter.call(entry, nil)
+	if errors.Is(err, ErrHalted) {
+		// A detached Architect failed, and its error is the one that stopped the program
+		err = interpreter.scheduler.Failure()
+	}
+	if err != nil {
+		return 1, err
+	}
+
+	if gear, ok := value.(int64); ok {
+		return gear, nil
+	}
+	return 0, nil
+}
+
+//**********************************************************************************************************************
+// Architects and commands
+//**********************************************************************************************************************
+
+// call :
+// Runs an Architect with the given arguments and returns the value it integrates.
+func (interpreter *Interpreter) call(architect *ast.Architect, arguments []Value) (Value, error) {
+	interpreter.logger.Debug("Calling Architect", map[string]any{"name": architect.Name})
+
+	variables := make(frame)
+	for i, parameter := range architect.Parameters {
+		variables[interpreter.info.Defs[parameter]] = Convert(arguments[i], parameter.Type)
+	}
+
+	returnType := semantic.ReturnType(architect)
+	integrated, value, err := interpreter.block(variables, architect.Body)
+	if err != nil {
+		return nil, err
+	}
+	if !integrated {
+		return ZeroValue(returnType), nil
+	}
+	return Convert(value, returnType), nil
+}
+
+// block :
+// Runs the commands of a block in order. Reports whether an Integrate was reached, along with its value.
+//
+// Every block, including each turn of a loop, first checks that the program was not halted, which is enough to stop
+// any detached Architect that is still running.
+func (interpreter *Interpreter) block(variables frame, block *ast.Block) (bool, Value, error) {
+	if interpreter.scheduler.Halted() {
+		return false, nil, ErrHalted
+	}
+	for _, command := range block.Commands {
+		integrated, value, err := interpreter.command(variables, command)
+		if err != nil || integrated {
+			return integrated, value, err
+		}
+	}
+	return false, nil, nil
+}
+
+// command :
+// Runs a single command. See block.
+func (interpreter *Interpreter) command(variables frame, command ast.Command) (bool, Value, error) {
+	switch cmd := command.(type) {
+	case *ast.CmdIf:
+		ok, err := interpreter.condition(variables, cmd.Condition)
+		if err != nil {
+			return false, nil, err
+		}
+		if ok {
+			return interpreter.block(variables, cmd.Then)
+		}
+		for _, elif := range cmd.Elifs {
+			ok, err := interpreter.condition(variables, elif.Condition)
+			if err != nil {
+				return false, nil, err
+			}
+			if ok {
+				return interpreter.block(variables, elif.Body)
+			}
+		}
+		if cmd.Else != nil {
+			return interpreter.block(variables, cmd.Else)
+		}
+	case *ast.CmdFor:
+		if cmd.Elements != nil {
+			return interpreter.iteration(variables, cmd)
+		}
+		for {
+			ok, err := interpreter.condition(variables, cmd.Condition)
+			if err != nil || !ok {
+				return false, nil, err
+			}
+			integrated, value, err := interpreter.block(variables, cmd.Body)
+			if err != nil || integrated {
+				return integrated, value, err
+			}
+		}
+	case *ast.CmdDeclaration:
+		value, err := interpreter.expr(variables, cmd.Value)
+		if err != nil {
+			return false, nil, err
+		}
+		if capacity, ok := value.(int64); ok && cmd.Type.IsChannel() {
+			if value, err = NewChannel(capacity); err != nil {
+				return false, nil, interpreter.fail(cmd.Position, err)
+			}
+		}
+		variables[interpreter.info.Defs[cmd]] = Convert(value, cmd.Type)
+	case *ast.CmdAssignment:
+		value, err := interpreter.expr(variables, cmd.Value)
+		if err != nil {
+			return false, nil, err
+		}
+		symbol := interpreter.info.Uses[cmd]
+		if cmd.Index == nil {
+			variables[symbol] = Convert(value, symbol.Type)
+			break
+		}
+		index, err := interpreter.expr(variables, cmd.Index)
+		if err != nil {
+			return false, nil, err
+		}
+		assembly := variables[symbol].(*Assembly)
+		if err := assembly.Set(index.(int64), Convert(value, symbol.Type.Element())); err != nil {
+			return false, nil, interpreter.fail(cmd.Position, err)
+		}
+	case *ast.CmdReceive:
+		symbol := interpreter.info.Uses[cmd]
+		var value Value
+		var err error
+		if cmd.Channel != nil {
+			value, err = interpreter.scheduler.Receive(interpreter.channel(variables, cmd.Channel))
+		} else {
+			value, err = interpreter.receive(symbol.Type)
+		}
+		if err != nil {
+			return false, nil, interpreter.stop(cmd.Position, err)
+		}
+		variables[symbol] = Convert(value, symbol.Type)
+	case *ast.CmdSend:
+		value, err := interpreter.expr(variables, cmd.Value)
+		if err != nil {
+			return false, nil, err
+		}
+		if cmd.Channel != nil {
+			element := interpreter.info.Uses[cmd.Channel].Type.Element()
+			err = interpreter.scheduler.Send(interpreter.channel(variables, cmd.Channel), Convert(value, element))
+		} else {
+			text := Format(value)
+			// A State is written as the name of its member
+			if state, ok := interpreter.info.States[interpreter.info.Types[cmd.Value]]; ok {
+				text = state.Members[value.(int64)].Name
+			}
+			err = interpreter.scheduler.Output(func() error {
+				_, err := interpreter.output.WriteString(text + "\n")
+				return err
+			})
+		}
+		if err != nil {
+			return false, nil, interpreter.stop(cmd.Position, err)
+		}
+	case *ast.CmdAppend:
+		value, err := interpreter.expr(variables, cmd.Value)
+		if err != nil {
+			return false, nil, err
+		}
+		symbol := interpreter.info.Uses[cmd.Assembly]
+		variables[symbol].(*Assembly).Append(Convert(value, symbol.Type.Element()))
+	case *ast.CmdIntegrate:
+		value, err := interpreter.expr(variables, cmd.Value)
+		if err != nil {
+			return false, nil, err
+		}
+		return true, value, nil
+	case *ast.CmdCall:
+		if !cmd.Call.Detached {
+			if _, err := interpreter.expr(variables, cmd.Call); err != nil {
+				return false, nil, err
+			}
+			break
+		}
+
+		// The arguments are evaluated before the Architect is detached, like the arguments of a goroutine
+		arguments, err := interpreter.arguments(variables, cmd.Call)
+		if err != nil {
+			return false, nil, err
+		}
+		architect := interpreter.info.Calls[cmd.Call]
+		interpreter.scheduler.Detach(func() error {
+			_, err := interpreter.call(architect, arguments)
+			return err
+		})
+	}
+	return false, nil, nil
+}
+
+// iteration :
+// Runs the body of a for once for each element of an Assembly, which is stored in the loop variable first. The number
+// of turns is the length of the Assembly when the loop starts, so appending to it inside the body does not make the
+// loop go on forever.
+func (interpreter *Interpreter) iteration(variables frame, cmd *ast.CmdFor) (bool, Value, error) {
+	value, err := interpreter.expr(variables, cmd.Elements)
+	if err != nil {
+		return false, nil, err
+	}
+	assembly := value.(*Assembly)
+	symbol := interpreter.info.Defs[cmd]
+
+	length := assembly.Len()
+	for i := int64(0); i < length; i++ {
+		element, err := assembly.Get(i)
+		if err != nil {
+			return false, nil, interpreter.fail(cmd.Position, err)
+		}
+		variables[symbol] = Convert(element, cmd.Type)
+		integrated, value, err := interpreter.block(variables, cmd.Body)
+		if err != nil || integrated {
+			return integrated, value, err
+		}
+	}
+	return false, nil, nil
+}
+
+// receive :
+// Reads a line from the input and parses it as a value of the given type. Pending output is flushed first, so a
+// prompt sent right before the Receive is visible.
+func (interpreter *Interpreter) receive(t ast.Type) (Value, error) {
+	var line string
+	err := interpreter.scheduler.Input(func() error {
+		if err := interpreter.scheduler.Output(interpreter.output.Flush); err != nil {
+			return err
+		}
+
+		var err error
+		line, err = interpreter.input.ReadString('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\n")
+	line = strings.TrimSuffix(line, "\r")
+	return Parse(line, t)
+}
+
+// channel :
+// Returns the Channel held by a variable, which is nil if no Channel was made for it.
+func (interpreter *Interpreter) channel(variables frame, name *ast.Identifier) *Channel {
+	channel, _ := variables[interpreter.info.Uses[name]].(*Channel)
+	return channel
+}
+
+//**********************************************************************************************************************
+// Expressions
+//**********************************************************************************************************************
+
+// condition :
+// Evaluates the <CONDITION> of an if, elif or for, which gives a Switch.
+func (interpreter *Interpreter) condition(variables frame, condition ast.Expr) (bool, error) {
+	value, err := interpreter.expr(variables, condition)
+	if err != nil {
+		return false, err
+	}
+	return value.(bool), nil
+}
+
+// expr :
+// Evaluates an expression. Operands and arguments are evaluated from left to right, and the right side of '&&' and
+// '||' only when it can still change the result.
+func (interpreter *Interpreter) expr(variables frame, expr ast.Expr) (Value, error) {
+	switch e := expr.(type) {
+	case *ast.GearLiteral:
+		return e.Value, nil
+	case *ast.TensorLiteral:
+		return e.Value, nil
+	case *ast.MonodroneLiteral:
+		return e.Value, nil
+	case *ast.OmnidroneLiteral:
+		return e.Value, nil
+	case *ast.SwitchLiteral:
+		return e.Value, nil
+	case *ast.NilLiteral:
+		return Nil{}, nil
+	case *ast.Identifier:
+		symbol := interpreter.info.Uses[e]
+		if symbol.Kind == semantic.SymbolMember {
+			return symbol.Value, nil
+		}
+		return variables[symbol], nil
+	case *ast.UnaryExpr:
+		operand, err := interpreter.expr(variables, e.Operand)
+		if err != nil {
+			return nil, err
+		}
+		if e.Operator == ast.OpNot {
+			return !operand.(bool), nil
+		}
+		return Negate(operand), nil
+	case *ast.BinaryExpr:
+		left, err := interpreter.expr(variables, e.Left)
+		if err != nil {
+			return nil, err
+		}
+		if e.Operator.IsLogical() {
+			if left.(bool) == (e.Operator == ast.OpOr) {
+				return left, nil
+			}
+			return interpreter.expr(variables, e.Right)
+		}
+		right, err := interpreter.expr(variables, e.Right)
+		if err != nil {
+			return nil, err
+		}
+		if e.Operator.IsComparison() {
+			return Compare(e.Operator, left, right), nil
+		}
+		value, err := Arithmetic(e.Operator, left, right)
+		if err != nil {
+			return nil, interpreter.fail(e.Position, err)
+		}
+		return value, nil
+	case *ast.CallExpr:
+		arguments, err := interpreter.arguments(variables, e)
+		if err != nil {
+			return nil, err
+		}
+		return interpreter.call(interpreter.info.Calls[e], arguments)
+	case *ast.AssemblyLiteral:
+		elements := make([]Value, 0, len(e.Elements))
+		for _, element := range e.Elements {
+			value, err := interpreter.expr(variables, element)
+			if err != nil {
+				return nil, err
+			}
+			elements = append(elements, Convert(value, e.Type.Element()))
+		}
+		return NewAssembly(elements), nil
+	case *ast.IndexExpr:
+		index, err := interpreter.expr(variables, e.Index)
+		if err != nil {
+			return nil, err
+		}
+		value, err := variables[interpreter.info.Uses[e.Assembly]].(*Assembly).Get(index.(int64))
+		if err != nil {
+			return nil, interpreter.fail(e.Position, err)
+		}
+		return value, nil
+	case *ast.LengthExpr:
+		value, err := interpreter.expr(variables, e.Assembly)
+		if err != nil {
+			return nil, err
+		}
+		return value.(*Assembly).Len(), nil
+	}
+	return nil, fmt.Errorf("unexpected expression %T", expr)
+}
+
+// arguments :
+// Evaluates the arguments of a call from left to right.
+func (interpreter *Interpreter) arguments(variables frame, call *ast.CallExpr) ([]Value, error) {
+	arguments := make([]Value, 0, len(call.Arguments))
+	for _, argument := range call.Arguments {
+		value, err := interpreter.expr(variables, argument)
+		if err != nil {
+			return nil, err
+		}
+		arguments = append(arguments, value)
+	}
+	return arguments, nil
+}
+
+// fail :
+// Wraps and logs an error that stopped the program at the given position, as a Diagnostic pointing there.
+func (interpreter *Interpreter) fail(position ast.Pos, err error) error {
+	diagnostic := compiler_error.RuntimeDiagnostic(position, err.Error())
+	err = compiler_error.RuntimeErrorf(compiler_error.RuntimeError, diagnostic)
+
+	interpreter.logger.Error(err, map[string]any{"position": position.String()})
+	return err
+}
+
+// stop :
+// Like fail, but lets ErrHalted through as-is, since the Architect that halted the program reported its own error.
+func (interpreter *Interpreter) stop(position ast.Pos, err error) error {
+	if errors.Is(err, ErrHalted) {
+		return err
+	}
+	return interpreter.fail(position, err)
+}
@@ -0,0 +1,369 @@
+package interpreter
+
+import (
+	"bytes"
+	"errors"
+	"mechanus-compiler/internal/ast"
+	"mechanus-compiler/internal/compiler_error"
+	"mechanus-compiler/internal/mechatest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// runSource parses, analyzes and runs the given source with the given input. Returns what the program sent, its exit
+// code and the runtime error, if any.
+func runSource(t *testing.T, source, input string) (string, int64, error) {
+	t.Helper()
+
+	construct, info := mechatest.Analyze(t, source)
+
+	var output bytes.Buffer
+	interpreter := NewInterpreter(info, strings.NewReader(input), &output, false)
+	exitCode, err := interpreter.Run(construct)
+	return output.String(), exitCode, err
+}
+
+// TestInterpreter_Examples ensures that every example program greets the world and exits with 0.
+func TestInterpreter_Examples(t *testing.T) {
+	paths, err := filepath.Glob("../../docs/examples/example*_input.mecha")
+	if err != nil || len(paths) == 0 {
+		t.Fatalf("no examples found: %v", err)
+	}
+
+	for _, path := range paths {
+		source, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("failed to read %s: %v", path, err)
+		}
+		output, exitCode, err := runSource(t, string(source), "")
+		if err != nil || exitCode != 0 || output != "Hello, world!\n" {
+			t.Errorf("%s: got output %q, exit code %d and error %v", path, output, exitCode, err)
+		}
+	}
+}
+
+// TestInterpreter_Program runs a program that uses every command.
+func TestInterpreter_Program(t *testing.T) {
+	output, exitCode, err := runSource(t, mechatest.Program, mechatest.ProgramInput)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if exitCode != mechatest.ProgramExit {
+		t.Errorf("expected exit code %d, got %d", mechatest.ProgramExit, exitCode)
+	}
+	if output != mechatest.ProgramOutput {
+		t.Errorf("expected output %q, got %q", mechatest.ProgramOutput, output)
+	}
+}
+
+// TestInterpreter_Recursion checks calls, early Integrates and the widening of arguments and integrated values.
+func TestInterpreter_Recursion(t *testing.T) {
+	source := `{
+   {
+        n * (n - 1)factorial Integrate
+        {
+            1 Integrate
+        } n <= 1 if
+   } Tensor (Tensor :n)factorial Architect
+   {
+        ((10)factorial)Send
+   } ()main Architect
+} main Construct`
+
+	output, _, err := runSource(t, source, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if output != "3.6288e+06\n" {
+		t.Errorf("expected output %q, got %q", "3.6288e+06\n", output)
+	}
+}
+
+// TestInterpreter_Detach runs detached Architects that send their results on an unbuffered Channel. A Gear sent on a
+// Tensor Channel is widened, and a detached Architect still running when main finishes is stopped.
+func TestInterpreter_Detach(t *testing.T) {
+	source := `{
+   {
+        (n * n)out Send
+   } (Gear :n, Tensor Channel :out)square Architect
+   {
+        {
+            i + 1 = i
+        } i > 0 for
+        1 =: Gear :i
+   } ()spin Architect
+   {
+        sum Integrate
+        (sum)Send
+        {
+            sum + value = sum
+            (value)squares Receive
+            i + 1 = i
+        } i < 4 for
+        0 =: Gear :i
+        0.0 =: Tensor :value
+        0.0 =: Tensor :sum
+        {
+            (n, squares)square Detach
+            n + 1 = n
+        } n < 4 for
+        0 =: Gear :n
+        0 =: Tensor Channel :squares
+        ()spin Detach
+   } Tensor ()main Architect
+} main Construct`
+
+	output, exitCode, err := runSource(t, source, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if output != "30\n" || exitCode != 0 {
+		t.Errorf("expected output %q and exit code 0, got %q and %d", "30\n", output, exitCode)
+	}
+}
+
+// TestInterpreter_States steps a State set through its members and checks that sending a member prints its name.
+func TestInterpreter_States(t *testing.T) {
+	source := `{
+    (Idle, Running, Halted)Machine State
+    {
+        Idle Integrate
+        {
+            Halted Integrate
+        } s == Running if
+        {
+            Running Integrate
+        } s == Idle if
+    } Machine (Machine :s)step Architect
+    {
+        (n)Send
+        {
+            (s)Send
+            (s)step = s
+            n + 1 = n
+        } s != Halted for
+        (s)Send
+        0 =: Gear :n
+        Idle =: Machine :s
+    } ()main Architect
+} main Construct`
+
+	output, _, err := runSource(t, source, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := "Idle\nRunning\nHalted\n2\n"; output != expected {
+		t.Errorf("expected output %q, got %q", expected, output)
+	}
+}
+
+// TestInterpreter_Switches stores comparisons and logical operations in Switches, checking that '&&' and '||' still
+// skip their right side once the left side decides the result, and that an Architect integrates false by default.
+func TestInterpreter_Switches(t *testing.T) {
+	source := `{
+    {
+        n % 2 == 0 Integrate
+    } Switch (Gear :n)even Architect
+    {
+        n Integrate
+        (n)Send
+    } Gear (Gear :n)trace Architect
+    {
+    } Switch ()nothing Architect
+    {
+        (()nothing)Send
+        (a == b)Send
+        (b)Send
+        (a)Send
+        !a || (3)trace == 3 =: Switch :b
+        (1)trace == 1 && (4)even || (2)trace == 0 =: Switch :a
+    } ()main Architect
+} main Construct`
+
+	output, _, err := runSource(t, source, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := "1\n3\ntrue\ntrue\ntrue\nfalse\n"; output != expected {
+		t.Errorf("expected output %q, got %q", expected, output)
+	}
+}
+
+// TestInterpreter_Assemblies checks literals, indexing, Length and Append, that Assemblies are shared between the
+// variables and parameters holding them, that a for visits the elements present when it started, and that an
+// Architect integrates an empty Assembly by default.
+func TestInterpreter_Assemblies(t *testing.T) {
+	source := `{
+    {
+        (7)xs Append
+    } (Gear Assembly :xs)grow Architect
+    {
+    } Tensor Assembly ()nothing Architect
+    {
+        ((xs)Length)Send
+        ((()nothing)Length)Send
+        ([3]ts)Send
+        ([0]ts)Send
+        (ts)Length - 1 = [0]ts
+        (4)ts Append
+        (0.5, 1, 2)Tensor Assembly =: Tensor Assembly :ts
+        {
+            (x)Send
+            (7)ys Append
+        } ys =: Tensor :x for
+        ((ys)Length)Send
+        (xs)grow
+        xs =: Gear Assembly :ys
+        (1, 2)Gear Assembly =: Gear Assembly :xs
+    } ()main Architect
+} main Construct`
+
+	output, _, err := runSource(t, source, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := "3\n1\n2\n7\n3\n4\n0\n6\n"; output != expected {
+		t.Errorf("expected output %q, got %q", expected, output)
+	}
+}
+
+// TestInterpreter_RuntimeErrors checks that the program stops on runtime errors, each reported as a Diagnostic.
+func TestInterpreter_RuntimeErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		source   string
+		input    string
+		expected string
+	}{
+		{
+			name: "division by zero",
+			source: `{
+   {
+        (1 / n)Send
+        0 =: Gear :n
+   } ()main Architect
+} main Construct`,
+			expected: "division by zero",
+		},
+		{
+			name: "invalid input",
+			source: `{
+   {
+        (n)Receive
+        0 =: Gear :n
+   } ()main Architect
+} main Construct`,
+			input:    "ten\n",
+			expected: `invalid Gear input "ten"`,
+		},
+		{
+			name: "deadlock",
+			source: `{
+   {
+        (n)c Receive
+        (1)c Send
+        0 =: Gear :n
+        0 =: Gear Channel :c
+   } ()main Architect
+} main Construct`,
+			expected: "every Architect is waiting on a Channel",
+		},
+		{
+			name: "channel never made",
+			source: `{
+   {
+   } Gear Channel ()none Architect
+   {
+        (1)c Send
+        ()none =: Gear Channel :c
+   } ()main Architect
+} main Construct`,
+			expected: "use of a Channel that was never made",
+		},
+		{
+			name: "negative capacity",
+			source: `{
+   {
+        -1 =: Gear Channel :c
+   } ()main Architect
+} main Construct`,
+			expected: "cannot make a Channel with a negative capacity of -1",
+		},
+		{
+			name: "index out of range",
+			source: `{
+   {
+        ([2]xs)Send
+        (1, 2)Gear Assembly =: Gear Assembly :xs
+   } ()main Architect
+} main Construct`,
+			expected: "Assembly index out of range at Line: 3",
+		},
+		{
+			name: "detached failure",
+			source: `{
+   {
+        (1 / n)out Send
+   } (Gear :n, Gear Channel :out)inverse Architect
+   {
+        (n)c Receive
+        0 =: Gear :n
+        (0, c)inverse Detach
+        0 =: Gear Channel :c
+   } ()main Architect
+} main Construct`,
+			expected: "division by zero at Line: 3",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, exitCode, err := runSource(t, test.source, test.input)
+			if err == nil {
+				t.Fatalf("expected an error containing %q, got nil", test.expected)
+			}
+			if !strings.Contains(err.Error(), test.expected) {
+				t.Errorf("expected an error containing %q, got %q", test.expected, err.Error())
+			}
+			diagnostics := compiler_error.Diagnostics(err)
+			if len(diagnostics) != 1 || diagnostics[0].Code != compiler_error.CodeRuntime {
+				t.Errorf("expected a single runtime Diagnostic, got %v", diagnostics)
+			}
+			if exitCode != 1 {
+				t.Errorf("expected exit code 1, got %d", exitCode)
+			}
+		})
+	}
+}
+
+// TestCompare checks the comparison rules, including NaN.
+func TestCompare(t *testing.T) {
+	nan := Value(float64(0))
+	nan = nan.(float64) / nan.(float64)
+
+	tests := []struct {
+		operator    ast.Operator
+		left, right Value
+		expected    bool
+	}{
+		{ast.OpLess, int64(1), 1.5, true},
+		{ast.OpGreaterEqual, 'b', 'a', true},
+		{ast.OpEqual, "a", "a", true},
+		{ast.OpNotEqual, Nil{}, Nil{}, false},
+		{ast.OpEqual, nan, nan, false},
+		{ast.OpNotEqual, nan, int64(1), true},
+		{ast.OpLessEqual, nan, int64(1), false},
+	}
+
+	for _, test := range tests {
+		if got := Compare(test.operator, test.left, test.right); got != test.expected {
+			t.Errorf("%v %s %v = %t, expected %t", test.left, test.operator, test.right, got, test.expected)
+		}
+	}
+
+	if _, err := Arithmetic(ast.OpMod, int64(1), int64(0)); !errors.Is(err, ErrDivisionByZero) {
+		t.Errorf("expected a division by zero, got %v", err)
+	}
+}
@@ -0,0 +1,223 @@
+package interpreter
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"mechanus-compiler/internal/ast"
+	"mechanus-compiler/internal/compiler_error"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Value :
+// A Mechanus value at run time. Gears are int64, Tensors are float64, Monodrones are rune, Omnidrones are string,
+// Switches are bool, States are int64, Nil is the Nil struct, Channels are *Channel and Assemblies are *Assembly.
+type Value any
+
+// Nil :
+// The only value of the Nil type.
+type Nil struct{}
+
+// ErrDivisionByZero is returned when a Gear is divided by zero.
+var ErrDivisionByZero = errors.New(compiler_error.DivisionByZero)
+
+// Convert :
+// Converts a value to the type of the variable, parameter or Architect it is stored in. The only conversion Mechanus
+// allows is the widening of a Gear into a Tensor, so every other value is returned as-is.
+func Convert(value Value, to ast.Type) Value {
+	if gear, ok := value.(int64); ok && to == ast.TypeTensor {
+		return float64(gear)
+	}
+	return value
+}
+
+// ZeroValue :
+// Returns the value integrated by an Architect of the given type that reaches the end of its body.
+func ZeroValue(t ast.Type) Value {
+	if t.IsChannel() {
+		return (*Channel)(nil)
+	}
+	if t.IsAssembly() {
+		return NewAssembly(nil)
+	}
+	switch t {
+	case ast.TypeTensor:
+		return float64(0)
+	case ast.TypeMonodrone:
+		return rune(0)
+	case ast.TypeOmnidrone:
+		return ""
+	case ast.TypeSwitch:
+		return false
+	case ast.TypeNil:
+		return Nil{}
+	default:
+		return int64(0)
+	}
+}
+
+// Format :
+// Returns the text written by Send for a value. Tensors use six significant digits, like the "%g" of the C backend,
+// so both produce the same output.
+func Format(value Value) string {
+	switch v := value.(type) {
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		switch {
+		case math.IsNaN(v):
+			return "nan"
+		case math.IsInf(v, 1):
+			return "inf"
+		case math.IsInf(v, -1):
+			return "-inf"
+		}
+		return strconv.FormatFloat(v, 'g', 6, 64)
+	case rune:
+		return string(v)
+	case string:
+		return v
+	case bool:
+		return strconv.FormatBool(v)
+	case Nil:
+		return "Nil"
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// Parse :
+// Reads a value of the given type from a line received from stdin. The line must hold exactly one value.
+func Parse(line string, t ast.Type) (Value, error) {
+	invalid := fmt.Errorf(compiler_error.InvalidInput, t, line)
+
+	switch t {
+	case ast.TypeGear, ast.TypeState:
+		value, err := strconv.ParseInt(strings.TrimLeft(line, " \t"), 10, 64)
+		if err != nil {
+			return nil, invalid
+		}
+		return value, nil
+	case ast.TypeTensor:
+		value, err := strconv.ParseFloat(strings.TrimLeft(line, " \t"), 64)
+		if err != nil {
+			return nil, invalid
+		}
+		return value, nil
+	case ast.TypeMonodrone:
+		value, size := utf8.DecodeRuneInString(line)
+		if value == utf8.RuneError || size != len(line) {
+			return nil, invalid
+		}
+		return value, nil
+	case ast.TypeOmnidrone:
+		return line, nil
+	default:
+		return nil, invalid
+	}
+}
+
+// Arithmetic :
+// Applies an arithmetic operator. A Gear mixed with a Tensor is widened first. Dividing a Gear by zero is an error,
+// while Tensors follow IEEE 754.
+func Arithmetic(operator ast.Operator, left, right Value) (Value, error) {
+	l, lGear := left.(int64)
+	r, rGear := right.(int64)
+	if lGear && rGear {
+		switch operator {
+		case ast.OpAdd:
+			return l + r, nil
+		case ast.OpSub:
+			return l - r, nil
+		case ast.OpMul:
+			return l * r, nil
+		case ast.OpDiv, ast.OpMod:
+			if r == 0 {
+				return nil, ErrDivisionByZero
+			}
+			if operator == ast.OpDiv {
+				return l / r, nil
+			}
+			return l % r, nil
+		}
+	}
+
+	lf := Convert(left, ast.TypeTensor).(float64)
+	rf := Convert(right, ast.TypeTensor).(float64)
+	switch operator {
+	case ast.OpAdd:
+		return lf + rf, nil
+	case ast.OpSub:
+		return lf - rf, nil
+	case ast.OpMul:
+		return lf * rf, nil
+	default:
+		return lf / rf, nil
+	}
+}
+
+// Negate :
+// Applies the unary '-'.
+func Negate(value Value) Value {
+	if gear, ok := value.(int64); ok {
+		return -gear
+	}
+	return -value.(float64)
+}
+
+// Compare :
+// Applies a comparison operator. Numbers are compared after widening, Monodrones by code point, and every other
+// type only supports '==' and '!='.
+func Compare(operator ast.Operator, left, right Value) bool {
+	var order int
+	switch l := left.(type) {
+	case rune:
+		order = compareOrdered(l, right.(rune))
+	case int64, float64:
+		lGear, lOk := left.(int64)
+		rGear, rOk := right.(int64)
+		if lOk && rOk {
+			order = compareOrdered(lGear, rGear)
+			break
+		}
+		lTensor := Convert(left, ast.TypeTensor).(float64)
+		rTensor := Convert(right, ast.TypeTensor).(float64)
+		// NaN is not ordered against anything, so only '!=' holds
+		if math.IsNaN(lTensor) || math.IsNaN(rTensor) {
+			return operator == ast.OpNotEqual
+		}
+		order = compareOrdered(lTensor, rTensor)
+	default:
+		return (left == right) == (operator == ast.OpEqual)
+	}
+
+	switch operator {
+	case ast.OpGreater:
+		return order > 0
+	case ast.OpGreaterEqual:
+		return order >= 0
+	case ast.OpLess:
+		return order < 0
+	case ast.OpLessEqual:
+		return order <= 0
+	case ast.OpEqual:
+		return order == 0
+	default:
+		return order != 0
+	}
+}
+
+// compareOrdered :
+// Returns -1, 0 or 1 when a is less than, equal to or greater than b.
+func compareOrdered[T int64 | float64 | rune](a, b T) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,590 @@
+package ir
+
+import (
+	"errors"
+	"fmt"
+	"mechanus-compiler/internal/ast"
+	"mechanus-compiler/internal/compiler_error"
+	"mechanus-compiler/internal/logger"
+	"mechanus-compiler/internal/semantic"
+	"os"
+)
+
+// Builder :
+// This is the structure responsible for lowering a checked Construct into a Program. Expressions are split into
+// three-address instructions on temporaries, and conditions, ifs and fors become branches between basic blocks.
+type Builder struct {
+	logger *logger.Logger
+	info   *semantic.Info
+	// State of the function being built
+	function *Function
+	current  *Block
+	vars     map[*semantic.Symbol]*Var
+	taken    map[string]int
+	labels   map[string]int
+}
+
+// NewBuilder :
+// Initializes a new Builder instance. info must be the result of a successful semantic analysis of the Construct that
+// will be lowered.
+func NewBuilder(info *semantic.Info, debug bool) Builder {
+	// Initialize the logger. Log to Stderr. Set level based on the debug flag.
+	logLevel := logger.LevelInfo
+	if debug {
+		logLevel = logger.LevelDebug
+	}
+
+	return Builder{
+		logger: logger.New(os.Stderr, logLevel),
+		info:   info,
+	}
+}
+
+// Run :
+// Lowers the given Construct.
+//
+// Fails if the Construct has no main Architect.
+func (builder *Builder) Run(construct *ast.Construct) (*Program, error) {
+	if builder.info.Main == nil {
+		err := compiler_error.CodegenErrorf(compiler_error.CodegenError, errors.New(compiler_error.MissingMain))
+		builder.logger.Error(err, nil)
+		return nil, err
+	}
+
+	// The parser stores the Architects bottom-to-top, so they are lowered in reverse to follow the source file
+	program := &Program{Name: construct.Name}
+	for i := len(construct.Architects) - 1; i >= 0; i-- {
+		program.Functions = append(program.Functions, builder.architect(construct.Architects[i]))
+	}
+
+	builder.logger.Info(compiler_error.CodegenSuccess, nil)
+	return program, nil
+}
+
+//**********************************************************************************************************************
+// Architects and commands
+//**********************************************************************************************************************
+
+// architect :
+// Lowers a single Architect. An Architect that reaches the end of its body without an Integrate returns the zero
+// value of its type.
+func (builder *Builder) architect(architect *ast.Architect) *Function {
+	builder.logger.Debug("Lowering Architect", map[string]any{"name": architect.Name})
+
+	builder.function = &Function{Name: architect.Name, Result: semantic.ReturnType(architect)}
+	builder.vars = make(map[*semantic.Symbol]*Var)
+	builder.taken = make(map[string]int)
+	builder.labels = make(map[string]int)
+
+	for _, parameter := range architect.Parameters {
+		builder.function.Parameters = append(builder.function.Parameters, builder.declare(builder.info.Defs[parameter]))
+	}
+
+	builder.current = builder.newBlock("entry")
+	builder.block(architect.Body)
+	builder.terminate(&Return{Value: Zero(builder.function.Result)})
+
+	builder.removeUnreachable()
+	return builder.function
+}
+
+// block :
+// Lowers the commands of a block. They are already stored in execution order.
+func (builder *Builder) block(block *ast.Block) {
+	for _, command := range block.Commands {
+		builder.command(command)
+	}
+}
+
+// command :
+// Lowers a single command.
+func (builder *Builder) command(command ast.Command) {
+	switch cmd := command.(type) {
+	case *ast.CmdIf:
+		builder.cmdIf(cmd)
+	case *ast.CmdFor:
+		if cmd.Elements != nil {
+			builder.iteration(cmd)
+			return
+		}
+		// for.cond checks the condition before every iteration, and the body jumps back to it
+		prefix := builder.prefix("for")
+		condition := builder.newBlock(prefix + ".cond")
+		body := builder.newBlock(prefix + ".body")
+		end := builder.newBlock(prefix + ".end")
+
+		builder.terminate(&Jump{Target: condition})
+		builder.current = condition
+		builder.branch(cmd.Condition, body, end)
+		builder.current = body
+		builder.block(cmd.Body)
+		builder.terminate(&Jump{Target: condition})
+		builder.current = end
+		builder.moveToEnd(end)
+	case *ast.CmdDeclaration:
+		variable := builder.declare(builder.info.Defs[cmd])
+		if cmd.Type.IsChannel() && builder.info.Types[cmd.Value] == ast.TypeGear {
+			// A Gear is the capacity of a new Channel, while another Channel is shared
+			builder.emit(&MakeChannel{Dest: variable, Capacity: builder.expr(cmd.Value, nil)})
+			return
+		}
+		builder.value(cmd.Value, cmd.Type, variable)
+	case *ast.CmdAssignment:
+		variable := builder.vars[builder.info.Uses[cmd]]
+		if cmd.Index == nil {
+			builder.value(cmd.Value, variable.VarType, variable)
+			return
+		}
+		value := builder.value(cmd.Value, variable.VarType.Element(), nil)
+		index := builder.expr(cmd.Index, nil)
+		builder.emit(&StoreIndex{Assembly: variable, Index: index, Value: value})
+	case *ast.CmdReceive:
+		variable := builder.vars[builder.info.Uses[cmd]]
+		if cmd.Channel == nil {
+			builder.emit(&Receive{Dest: variable})
+			return
+		}
+		channel := builder.expr(cmd.Channel, nil)
+		if channel.Type().Element() == ast.TypeGear && variable.VarType == ast.TypeTensor {
+			element := builder.newTemp(ast.TypeGear)
+			builder.emit(&ReceiveChannel{Dest: element, Channel: channel})
+			builder.emit(&Widen{Dest: variable, Source: element})
+			return
+		}
+		builder.emit(&ReceiveChannel{Dest: variable, Channel: channel})
+	case *ast.CmdSend:
+		if cmd.Channel == nil {
+			builder.emit(&Send{Value: builder.expr(cmd.Value, nil)})
+			return
+		}
+		channel := builder.expr(cmd.Channel, nil)
+		value := builder.value(cmd.Value, channel.Type().Element(), nil)
+		builder.emit(&SendChannel{Channel: channel, Value: value})
+	case *ast.CmdAppend:
+		assembly := builder.expr(cmd.Assembly, nil)
+		value := builder.value(cmd.Value, assembly.Type().Element(), nil)
+		builder.emit(&Append{Assembly: assembly, Value: value})
+	case *ast.CmdIntegrate:
+		value := builder.value(cmd.Value, builder.function.Result, nil)
+		builder.terminate(&Return{Value: value})
+	case *ast.CmdCall:
+		builder.call(cmd.Call, nil)
+	}
+}
+
+// iteration :
+// Lowers a for over the elements of an Assembly. The Assembly and its length are taken once, before the loop, and a
+// variable of its own counts the elements:
+//
+//	%0 = xs; %1 = length %0; for1.index = 0; jump for1.cond
+//	for1.cond: branch for1.index < %1, for1.body, for1.end
+//	for1.body: x = %0[for1.index]; ...; for1.index = for1.index + 1; jump for1.cond
+//	for1.end:
+func (builder *Builder) iteration(cmd *ast.CmdFor) {
+	prefix := builder.prefix("for")
+	condition := builder.newBlock(prefix + ".cond")
+	body := builder.newBlock(prefix + ".body")
+	end := builder.newBlock(prefix + ".end")
+
+	t := builder.info.Types[cmd.Elements]
+	assembly := builder.value(cmd.Elements, t, builder.newTemp(t))
+	length := builder.newTemp(ast.TypeGear)
+	builder.emit(&Length{Dest: length, Assembly: assembly})
+	index := &Var{Name: prefix + ".index", VarType: ast.TypeGear}
+	builder.function.Locals = append(builder.function.Locals, index)
+	builder.emit(&Copy{Dest: index, Source: &Const{ConstType: ast.TypeGear, Value: int64(0)}})
+	builder.terminate(&Jump{Target: condition})
+
+	builder.current = condition
+	builder.terminate(&Branch{Operator: ast.OpLess, Left: index, Right: length, Then: body, Else: end})
+
+	builder.current = body
+	variable := builder.declare(builder.info.Defs[cmd])
+	if t.Element() == ast.TypeGear && cmd.Type == ast.TypeTensor {
+		element := builder.newTemp(ast.TypeGear)
+		builder.emit(&Index{Dest: element, Assembly: assembly, Index: index})
+		builder.emit(&Widen{Dest: variable, Source: element})
+	} else {
+		builder.emit(&Index{Dest: variable, Assembly: assembly, Index: index})
+	}
+	builder.block(cmd.Body)
+	one := &Const{ConstType: ast.TypeGear, Value: int64(1)}
+	builder.emit(&Binary{Dest: index, Operator: ast.OpAdd, Left: index, Right: one})
+	builder.terminate(&Jump{Target: condition})
+	builder.current = end
+	builder.moveToEnd(end)
+}
+
+// cmdIf :
+// Lowers an if with its elifs and else. Each condition branches to its body or to the next condition, and every body
+// jumps to if.end once it is done:
+//
+//	branch cond, if.then, if.elif1
+//	if.then:  ...; jump if.end
+//	if.elif1: branch cond1, if.elif1.then, if.else
+//	...
+//	if.else:  ...; jump if.end
+//	if.end:
+func (builder *Builder) cmdIf(cmd *ast.CmdIf) {
+	prefix := builder.prefix("if")
+	conditions := []ast.Expr{cmd.Condition}
+	bodies := []*ast.Block{cmd.Then}
+	for _, elif := range cmd.Elifs {
+		conditions = append(conditions, elif.Condition)
+		bodies = append(bodies, elif.Body)
+	}
+
+	end := builder.newBlock(prefix + ".end")
+	for i, condition := range conditions {
+		thenLabel := prefix + ".then"
+		if i > 0 {
+			thenLabel = fmt.Sprintf("%s.elif%d.then", prefix, i)
+		}
+		then := builder.newBlock(thenLabel)
+
+		next := end
+		switch {
+		case i < len(conditions)-1:
+			next = builder.newBlock(fmt.Sprintf("%s.elif%d", prefix, i+1))
+		case cmd.Else != nil:
+			next = builder.newBlock(prefix + ".else")
+		}
+
+		builder.branch(condition, then, next)
+		builder.current = then
+		builder.block(bodies[i])
+		builder.terminate(&Jump{Target: end})
+		builder.current = next
+	}
+
+	if cmd.Else != nil {
+		builder.block(cmd.Else)
+		builder.terminate(&Jump{Target: end})
+		builder.current = end
+	}
+
+	builder.moveToEnd(end)
+}
+
+// branch :
+// Ends the current block with a <CONDITION>. The right side of '&&' and '||' gets a block of its own, which is only
+// reached when the left side does not decide the result, and '!' swaps the targets:
+//
+//	branch left, and1.rhs, otherwise
+//	and1.rhs: branch right, then, otherwise
+//
+// Any other Switch is compared with true.
+func (builder *Builder) branch(condition ast.Expr, then, otherwise *Block) {
+	if not, ok := condition.(*ast.UnaryExpr); ok {
+		builder.branch(not.Operand, otherwise, then)
+		return
+	}
+
+	comparison, ok := condition.(*ast.BinaryExpr)
+	if !ok || !comparison.Operator.IsComparison() && !comparison.Operator.IsLogical() {
+		builder.terminate(&Branch{
+			Operator: ast.OpEqual,
+			Left:     builder.expr(condition, nil),
+			Right:    &Const{ConstType: ast.TypeSwitch, Value: true},
+			Then:     then,
+			Else:     otherwise,
+		})
+		return
+	}
+	switch comparison.Operator {
+	case ast.OpAnd:
+		rhs := builder.blockAfterCurrent(builder.prefix("and") + ".rhs")
+		builder.branch(comparison.Left, rhs, otherwise)
+		builder.current = rhs
+		builder.branch(comparison.Right, then, otherwise)
+	case ast.OpOr:
+		rhs := builder.blockAfterCurrent(builder.prefix("or") + ".rhs")
+		builder.branch(comparison.Left, then, rhs)
+		builder.current = rhs
+		builder.branch(comparison.Right, then, otherwise)
+	default:
+		builder.compare(comparison, then, otherwise)
+	}
+}
+
+// compare :
+// Ends the current block with a comparison. A Gear compared with a Tensor is widened first.
+func (builder *Builder) compare(comparison *ast.BinaryExpr, then, otherwise *Block) {
+	operandType := builder.operandType(comparison)
+	builder.terminate(&Branch{
+		Operator: comparison.Operator,
+		Left:     builder.value(comparison.Left, operandType, nil),
+		Right:    builder.value(comparison.Right, operandType, nil),
+		Then:     then,
+		Else:     otherwise,
+	})
+}
+
+// operandType :
+// Returns the type both operands of a comparison are converted to, which is a Tensor when a Gear meets a Tensor.
+func (builder *Builder) operandType(comparison *ast.BinaryExpr) ast.Type {
+	left := builder.info.Types[comparison.Left]
+	right := builder.info.Types[comparison.Right]
+	if left == ast.TypeTensor || right == ast.TypeTensor {
+		return ast.TypeTensor
+	}
+	return left
+}
+
+// logical :
+// Lowers '&&' or '||' into a Switch. The result is found by branching like a condition, and each outcome writes it:
+//
+//	branch left, and1.rhs, switch1.false
+//	and1.rhs:      branch right, switch1.true, switch1.false
+//	switch1.true:  dest = true; jump switch1.end
+//	switch1.false: dest = false; jump switch1.end
+//	switch1.end:
+func (builder *Builder) logical(logical *ast.BinaryExpr, dest Value) Value {
+	prefix := builder.prefix("switch")
+	then := builder.newBlock(prefix + ".true")
+	otherwise := builder.newBlock(prefix + ".false")
+	end := builder.newBlock(prefix + ".end")
+
+	builder.branch(logical, then, otherwise)
+	dest = builder.destination(dest, ast.TypeSwitch)
+	for _, outcome := range []*Block{then, otherwise} {
+		builder.current = outcome
+		builder.emit(&Copy{Dest: dest, Source: &Const{ConstType: ast.TypeSwitch, Value: outcome == then}})
+		builder.terminate(&Jump{Target: end})
+	}
+	builder.current = end
+	builder.moveToEnd(end)
+	return dest
+}
+
+//**********************************************************************************************************************
+// Expressions
+//**********************************************************************************************************************
+
+// value :
+// Lowers an expression whose result is stored as the given type, widening a Gear into a Tensor. When dest is not
+// nil, the result is written there and dest is returned.
+func (builder *Builder) value(expr ast.Expr, to ast.Type, dest Value) Value {
+	if builder.info.Types[expr] == ast.TypeGear && to == ast.TypeTensor {
+		source := builder.expr(expr, nil)
+		if dest == nil {
+			dest = builder.newTemp(to)
+		}
+		builder.emit(&Widen{Dest: dest, Source: source})
+		return dest
+	}
+
+	value := builder.expr(expr, dest)
+	if dest != nil && value != dest {
+		builder.emit(&Copy{Dest: dest, Source: value})
+		return dest
+	}
+	return value
+}
+
+// expr :
+// Lowers an expression and returns the value holding its result. Operations write their result to dest, or to a
+// new temporary when dest is nil, while variables and literals are returned as they are. Operands and arguments are
+// lowered from left to right.
+func (builder *Builder) expr(expr ast.Expr, dest Value) Value {
+	t := builder.info.Types[expr]
+
+	switch e := expr.(type) {
+	case *ast.GearLiteral:
+		return &Const{ConstType: t, Value: e.Value}
+	case *ast.TensorLiteral:
+		return &Const{ConstType: t, Value: e.Value}
+	case *ast.MonodroneLiteral:
+		return &Const{ConstType: t, Value: e.Value}
+	case *ast.OmnidroneLiteral:
+		return &Const{ConstType: t, Value: e.Value}
+	case *ast.SwitchLiteral:
+		return &Const{ConstType: t, Value: e.Value}
+	case *ast.NilLiteral:
+		return &Const{ConstType: t}
+	case *ast.Identifier:
+		symbol := builder.info.Uses[e]
+		if symbol.Kind == semantic.SymbolMember {
+			return &Const{ConstType: t, Value: symbol.Value}
+		}
+		return builder.vars[symbol]
+	case *ast.UnaryExpr:
+		operand := builder.expr(e.Operand, nil)
+		dest = builder.destination(dest, t)
+		builder.emit(&Unary{Dest: dest, Operator: e.Operator, Operand: operand})
+		return dest
+	case *ast.BinaryExpr:
+		if e.Operator.IsLogical() {
+			return builder.logical(e, dest)
+		}
+		operandType := t
+		if e.Operator.IsComparison() {
+			operandType = builder.operandType(e)
+		}
+		left := builder.value(e.Left, operandType, nil)
+		right := builder.value(e.Right, operandType, nil)
+		dest = builder.destination(dest, t)
+		builder.emit(&Binary{Dest: dest, Operator: e.Operator, Left: left, Right: right})
+		return dest
+	case *ast.CallExpr:
+		return builder.call(e, builder.destination(dest, t))
+	case *ast.AssemblyLiteral:
+		elements := make([]Value, len(e.Elements))
+		for i, element := range e.Elements {
+			elements[i] = builder.value(element, t.Element(), nil)
+		}
+		dest = builder.destination(dest, t)
+		builder.emit(&MakeAssembly{Dest: dest, Elements: elements})
+		return dest
+	case *ast.IndexExpr:
+		index := builder.expr(e.Index, nil)
+		assembly := builder.expr(e.Assembly, nil)
+		dest = builder.destination(dest, t)
+		builder.emit(&Index{Dest: dest, Assembly: assembly, Index: index})
+		return dest
+	case *ast.LengthExpr:
+		assembly := builder.expr(e.Assembly, nil)
+		dest = builder.destination(dest, t)
+		builder.emit(&Length{Dest: dest, Assembly: assembly})
+		return dest
+	}
+	return nil
+}
+
+// call :
+// Lowers a call, widening every argument to the type of its parameter. dest is nil when the integrated value is
+// discarded, which is always the case for a detached call.
+func (builder *Builder) call(call *ast.CallExpr, dest Value) Value {
+	architect := builder.info.Calls[call]
+	arguments := make([]Value, len(call.Arguments))
+	for i, argument := range call.Arguments {
+		arguments[i] = builder.value(argument, architect.Parameters[i].Type, nil)
+	}
+	if call.Detached {
+		builder.emit(&Detach{Function: architect.Name, Arguments: arguments})
+		return nil
+	}
+	builder.emit(&Call{Dest: dest, Function: architect.Name, Arguments: arguments})
+	return dest
+}
+
+//**********************************************************************************************************************
+// Helpers
+//**********************************************************************************************************************
+
+// declare :
+// Creates the variable of a parameter or declaration. A name that is already taken in the function gets a ".N"
+// suffix.
+func (builder *Builder) declare(symbol *semantic.Symbol) *Var {
+	name := symbol.Name
+	if count := builder.taken[symbol.Name]; count > 0 {
+		name = fmt.Sprintf("%s.%d", name, count)
+	}
+	builder.taken[symbol.Name]++
+
+	variable := &Var{Name: name, VarType: symbol.Type}
+	builder.vars[symbol] = variable
+	if symbol.Kind != semantic.SymbolParameter {
+		builder.function.Locals = append(builder.function.Locals, variable)
+	}
+	return variable
+}
+
+// destination :
+// Returns dest, or a new temporary of the given type when dest is nil.
+func (builder *Builder) destination(dest Value, t ast.Type) Value {
+	if dest != nil {
+		return dest
+	}
+	return builder.newTemp(t)
+}
+
+// newTemp :
+// Creates the next temporary of the current function.
+func (builder *Builder) newTemp(t ast.Type) *Temp {
+	temp := &Temp{ID: builder.function.Temps, TempType: t}
+	builder.function.Temps++
+	return temp
+}
+
+// prefix :
+// Returns a unique prefix for the labels of an if or a for, such as "if1" or "for2".
+func (builder *Builder) prefix(kind string) string {
+	builder.labels[kind]++
+	return fmt.Sprintf("%s%d", kind, builder.labels[kind])
+}
+
+// newBlock :
+// Creates an empty block at the end of the current function.
+func (builder *Builder) newBlock(label string) *Block {
+	block := &Block{Label: label}
+	builder.function.Blocks = append(builder.function.Blocks, block)
+	return block
+}
+
+// blockAfterCurrent :
+// Creates an empty block right after the current one, so the dump lists it before the blocks it branches to.
+func (builder *Builder) blockAfterCurrent(label string) *Block {
+	block := &Block{Label: label}
+	blocks := builder.function.Blocks
+	for i, b := range blocks {
+		if b == builder.current {
+			builder.function.Blocks = append(append(blocks[:i+1:i+1], block), blocks[i+1:]...)
+			return block
+		}
+	}
+	builder.function.Blocks = append(blocks, block)
+	return block
+}
+
+// moveToEnd :
+// Moves a block after every other block of the current function. The end of an if or a for is created before its
+// bodies, and is moved once they are lowered so the dump lists the blocks in the order of the source.
+func (builder *Builder) moveToEnd(block *Block) {
+	blocks := builder.function.Blocks
+	for i, b := range blocks {
+		if b == block {
+			builder.function.Blocks = append(append(blocks[:i:i], blocks[i+1:]...), block)
+			return
+		}
+	}
+}
+
+// emit :
+// Appends an instruction to the current block.
+func (builder *Builder) emit(instruction Instruction) {
+	builder.current.Instructions = append(builder.current.Instructions, instruction)
+}
+
+// terminate :
+// Ends the current block. Code that follows a terminator, such as the commands after an Integrate, can never run, so
+// it is collected in a new block without predecessors that removeUnreachable drops.
+func (builder *Builder) terminate(terminator Terminator) {
+	builder.current.Terminator = terminator
+	builder.current = builder.newBlock(fmt.Sprintf("unreachable%d", len(builder.function.Blocks)))
+	builder.current.Terminator = &Return{Value: Zero(builder.function.Result)}
+}
+
+// removeUnreachable :
+// Drops the blocks of the current function that cannot be reached from its entry block, keeping the others in order.
+func (builder *Builder) removeUnreachable() {
+	reachable := make(map[*Block]bool)
+	pending := []*Block{builder.function.Blocks[0]}
+	for len(pending) > 0 {
+		block := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		if reachable[block] {
+			continue
+		}
+		reachable[block] = true
+		pending = append(pending, block.Terminator.Successors()...)
+	}
+
+	blocks := builder.function.Blocks[:0]
+	for _, block := range builder.function.Blocks {
+		if reachable[block] {
+			blocks = append(blocks, block)
+		}
+	}
+	builder.function.Blocks = blocks
+}
@@ -0,0 +1,456 @@
+// Package ir lowers a checked Construct into three-address code over basic blocks, which "-emit ir" dumps.
+//
+// No backend reads a Program yet: the C, assembly, LLVM, WebAssembly and bytecode generators still walk the AST with
+// the semantic.Info, each lowering ifs, fors and short-circuit conditions on its own. Moving them onto the IR is a
+// known gap.
+package ir
+
+import (
+	"fmt"
+	"mechanus-compiler/internal/ast"
+	"strconv"
+	"strings"
+)
+
+//**********************************************************************************************************************
+// Values
+//**********************************************************************************************************************
+
+// Value :
+// An operand of an instruction: a variable, a temporary or a constant. Every value has the Mechanus type it holds.
+type Value interface {
+	Type() ast.Type
+	String() string
+	value()
+}
+
+// Var :
+// A variable or parameter of a function. Each declaration gets its own Var, so a variable shadowing another one in a
+// nested block has a different name, with a ".N" suffix. A for over an Assembly counts its elements in a Var of its
+// own, named after the loop, such as "for1.index".
+type Var struct {
+	Name    string
+	VarType ast.Type
+}
+
+// Temp :
+// A temporary holding the result of an instruction. Temporaries are numbered from 0 in each function and are
+// assigned exactly once along any path. The Switch given by '&&' or '||' is the only one written by two blocks, one
+// for each result.
+type Temp struct {
+	ID       int
+	TempType ast.Type
+}
+
+// Const :
+// A literal value: an int64 for a Gear, a float64 for a Tensor, a rune for a Monodrone, a string for an Omnidrone, a
+// bool for a Switch and nil for Nil. The only Assembly constant is an empty one, and the only Channel constant is the
+// one that was never made, written as Nil. The Value of both is nil too.
+type Const struct {
+	ConstType ast.Type
+	Value     any
+}
+
+func (v *Var) Type() ast.Type   { return v.VarType }
+func (t *Temp) Type() ast.Type  { return t.TempType }
+func (c *Const) Type() ast.Type { return c.ConstType }
+
+func (v *Var) String() string  { return v.Name }
+func (t *Temp) String() string { return "%" + strconv.Itoa(t.ID) }
+
+// String :
+// Returns the constant as it would be written in the source. Tensors always show a decimal point or an exponent, so
+// they never read as Gears.
+func (c *Const) String() string {
+	switch value := c.Value.(type) {
+	case int64:
+		return strconv.FormatInt(value, 10)
+	case float64:
+		text := strconv.FormatFloat(value, 'g', -1, 64)
+		if !strings.ContainsAny(text, ".eIN") {
+			text += ".0"
+		}
+		return text
+	case rune:
+		return strconv.QuoteRune(value)
+	case string:
+		return strconv.Quote(value)
+	case bool:
+		return strconv.FormatBool(value)
+	default:
+		if c.ConstType.IsAssembly() {
+			return "()" + c.ConstType.String()
+		}
+		return "Nil"
+	}
+}
+
+func (*Var) value()   {}
+func (*Temp) value()  {}
+func (*Const) value() {}
+
+// Zero :
+// Returns the zero value of a type, the value of an Architect that ends without an Integrate.
+func Zero(t ast.Type) *Const {
+	if t.IsAssembly() || t.IsChannel() {
+		return &Const{ConstType: t}
+	}
+	switch t {
+	case ast.TypeNil:
+		return &Const{ConstType: t}
+	case ast.TypeTensor:
+		return &Const{ConstType: t, Value: float64(0)}
+	case ast.TypeMonodrone:
+		return &Const{ConstType: t, Value: rune(0)}
+	case ast.TypeOmnidrone:
+		return &Const{ConstType: t, Value: ""}
+	case ast.TypeSwitch:
+		return &Const{ConstType: t, Value: false}
+	default:
+		return &Const{ConstType: t, Value: int64(0)}
+	}
+}
+
+//**********************************************************************************************************************
+// Instructions
+//**********************************************************************************************************************
+
+// Instruction :
+// A single three-address instruction inside a block. Instructions that produce a value write it to their Dest, which
+// is a *Var or a *Temp.
+type Instruction interface {
+	String() string
+	instruction()
+}
+
+// Copy :
+// Dest = Source
+type Copy struct {
+	Dest   Value
+	Source Value
+}
+
+// Widen :
+// Dest = widen Source, converting a Gear into a Tensor.
+type Widen struct {
+	Dest   Value
+	Source Value
+}
+
+// Unary :
+// Dest = -Operand or Dest = !Operand.
+type Unary struct {
+	Dest     Value
+	Operator ast.Operator
+	Operand  Value
+}
+
+// Binary :
+// Dest = Left Operator Right, for the arithmetic and comparison operators. Both operands have the type of Dest, except
+// for a comparison, whose Dest is a Switch.
+type Binary struct {
+	Dest     Value
+	Operator ast.Operator
+	Left     Value
+	Right    Value
+}
+
+// Call :
+// Dest = call Function(Arguments). Dest is nil when the integrated value is discarded.
+type Call struct {
+	Dest      Value
+	Function  string
+	Arguments []Value
+}
+
+// Send :
+// Writes a value to the output.
+type Send struct {
+	Value Value
+}
+
+// Receive :
+// Dest = receive, reading a line from the input as a value of the type of Dest.
+type Receive struct {
+	Dest Value
+}
+
+// MakeAssembly :
+// Dest = assembly(Elements), a new Assembly holding the elements in order. They already have its element type.
+type MakeAssembly struct {
+	Dest     Value
+	Elements []Value
+}
+
+// Index :
+// Dest = Assembly[Index], stopping the program if there is no such element.
+type Index struct {
+	Dest     Value
+	Assembly Value
+	Index    Value
+}
+
+// StoreIndex :
+// Assembly[Index] = Value, stopping the program if there is no such element.
+type StoreIndex struct {
+	Assembly Value
+	Index    Value
+	Value    Value
+}
+
+// Append :
+// Adds Value to the end of Assembly.
+type Append struct {
+	Assembly Value
+	Value    Value
+}
+
+// Length :
+// Dest = length Assembly.
+type Length struct {
+	Dest     Value
+	Assembly Value
+}
+
+// MakeChannel :
+// Dest = channel Capacity, a new Channel that holds up to Capacity values nobody received yet.
+type MakeChannel struct {
+	Dest     Value
+	Capacity Value
+}
+
+// SendChannel :
+// Sends Value on Channel, waiting while it is full. Value already has the type the Channel carries.
+type SendChannel struct {
+	Channel Value
+	Value   Value
+}
+
+// ReceiveChannel :
+// Dest = receive from Channel, waiting until a value is sent on it.
+type ReceiveChannel struct {
+	Dest    Value
+	Channel Value
+}
+
+// Detach :
+// Runs Function(Arguments) alongside the caller. Nothing waits for it, so there is no Dest.
+type Detach struct {
+	Function  string
+	Arguments []Value
+}
+
+func (i *Copy) String() string  { return fmt.Sprintf("%s = %s", definition(i.Dest), i.Source) }
+func (i *Widen) String() string { return fmt.Sprintf("%s = widen %s", definition(i.Dest), i.Source) }
+func (i *Unary) String() string {
+	return fmt.Sprintf("%s = %s%s", definition(i.Dest), i.Operator, i.Operand)
+}
+func (i *Binary) String() string {
+	return fmt.Sprintf("%s = %s %s %s", definition(i.Dest), i.Left, i.Operator, i.Right)
+}
+func (i *Send) String() string    { return fmt.Sprintf("send %s", i.Value) }
+func (i *Receive) String() string { return fmt.Sprintf("%s = receive", definition(i.Dest)) }
+func (i *Index) String() string {
+	return fmt.Sprintf("%s = %s[%s]", definition(i.Dest), i.Assembly, i.Index)
+}
+func (i *StoreIndex) String() string { return fmt.Sprintf("%s[%s] = %s", i.Assembly, i.Index, i.Value) }
+func (i *Append) String() string     { return fmt.Sprintf("append %s, %s", i.Assembly, i.Value) }
+func (i *Length) String() string {
+	return fmt.Sprintf("%s = length %s", definition(i.Dest), i.Assembly)
+}
+func (i *MakeChannel) String() string {
+	return fmt.Sprintf("%s = channel %s", definition(i.Dest), i.Capacity)
+}
+func (i *SendChannel) String() string { return fmt.Sprintf("send %s to %s", i.Value, i.Channel) }
+func (i *ReceiveChannel) String() string {
+	return fmt.Sprintf("%s = receive from %s", definition(i.Dest), i.Channel)
+}
+
+// String :
+// Returns the call as "call f(a, b)", with its destination when the integrated value is kept.
+func (i *Call) String() string {
+	call := fmt.Sprintf("call %s(%s)", i.Function, list(i.Arguments))
+	if i.Dest == nil {
+		return call
+	}
+	return definition(i.Dest) + " = " + call
+}
+
+// String :
+// Returns the detached call as "detach f(a, b)".
+func (i *Detach) String() string {
+	return fmt.Sprintf("detach %s(%s)", i.Function, list(i.Arguments))
+}
+
+// String :
+// Returns the new Assembly as "assembly(a, b)".
+func (i *MakeAssembly) String() string {
+	return fmt.Sprintf("%s = assembly(%s)", definition(i.Dest), list(i.Elements))
+}
+
+func (*Copy) instruction()           {}
+func (*Widen) instruction()          {}
+func (*Unary) instruction()          {}
+func (*Binary) instruction()         {}
+func (*Call) instruction()           {}
+func (*Send) instruction()           {}
+func (*Receive) instruction()        {}
+func (*MakeAssembly) instruction()   {}
+func (*Index) instruction()          {}
+func (*StoreIndex) instruction()     {}
+func (*Append) instruction()         {}
+func (*Length) instruction()         {}
+func (*MakeChannel) instruction()    {}
+func (*SendChannel) instruction()    {}
+func (*ReceiveChannel) instruction() {}
+func (*Detach) instruction()         {}
+
+// definition :
+// Returns the destination of an instruction. Temporaries show their type, since this is the only place they are
+// declared.
+func definition(dest Value) string {
+	if temp, ok := dest.(*Temp); ok {
+		return fmt.Sprintf("%s: %s", temp, temp.TempType)
+	}
+	return dest.String()
+}
+
+// list :
+// Returns the arguments of a call or the elements of an Assembly, separated by commas.
+func list(values []Value) string {
+	texts := make([]string, len(values))
+	for i, value := range values {
+		texts[i] = value.String()
+	}
+	return strings.Join(texts, ", ")
+}
+
+//**********************************************************************************************************************
+// Terminators
+//**********************************************************************************************************************
+
+// Terminator :
+// The instruction that ends a block and moves to the next one, or leaves the function.
+type Terminator interface {
+	// Successors returns the blocks the terminator may move to.
+	Successors() []*Block
+	String() string
+	terminator()
+}
+
+// Jump :
+// Moves to Target.
+type Jump struct {
+	Target *Block
+}
+
+// Branch :
+// Moves to Then if the comparison Left Operator Right holds, or to Else otherwise. Both operands have the same type.
+type Branch struct {
+	Operator ast.Operator
+	Left     Value
+	Right    Value
+	Then     *Block
+	Else     *Block
+}
+
+// Return :
+// Leaves the function, integrating Value.
+type Return struct {
+	Value Value
+}
+
+func (t *Jump) Successors() []*Block   { return []*Block{t.Target} }
+func (t *Branch) Successors() []*Block { return []*Block{t.Then, t.Else} }
+func (t *Return) Successors() []*Block { return nil }
+
+func (t *Jump) String() string { return "jump " + t.Target.Label }
+func (t *Branch) String() string {
+	return fmt.Sprintf("branch %s %s %s, %s, %s", t.Left, t.Operator, t.Right, t.Then.Label, t.Else.Label)
+}
+func (t *Return) String() string { return "return " + t.Value.String() }
+
+func (*Jump) terminator()   {}
+func (*Branch) terminator() {}
+func (*Return) terminator() {}
+
+//**********************************************************************************************************************
+// Programs
+//**********************************************************************************************************************
+
+// Program :
+// The IR of a Construct. Functions follow the order of the Architects in the source file.
+type Program struct {
+	Name      string
+	Functions []*Function
+}
+
+// Function :
+// The IR of a single Architect. Blocks[0] is the entry block, and every block is reachable from it. Locals holds the
+// variables declared in the body, in order of declaration.
+type Function struct {
+	Name       string
+	Parameters []*Var
+	Locals     []*Var
+	Result     ast.Type
+	Blocks     []*Block
+	// Temps is the number of temporaries used by the function.
+	Temps int
+}
+
+// Block :
+// A basic block: instructions that always run in sequence, ended by a single Terminator.
+type Block struct {
+	Label        string
+	Instructions []Instruction
+	Terminator   Terminator
+}
+
+// Function :
+// Returns the function with the given name, or nil if there is none.
+func (program *Program) Function(name string) *Function {
+	for _, function := range program.Functions {
+		if function.Name == name {
+			return function
+		}
+	}
+	return nil
+}
+
+// String :
+// Returns the textual dump of the program, as written by "mecha -emit ir".
+func (program *Program) String() string {
+	var builder strings.Builder
+	builder.WriteString(fmt.Sprintf(";; IR of the %s Construct.\n", program.Name))
+	for _, function := range program.Functions {
+		builder.WriteString("\n")
+		builder.WriteString(function.String())
+	}
+	return builder.String()
+}
+
+// String :
+// Returns the textual dump of a function: its signature, its variables and its blocks.
+func (function *Function) String() string {
+	var builder strings.Builder
+
+	parameters := make([]string, len(function.Parameters))
+	for i, parameter := range function.Parameters {
+		parameters[i] = fmt.Sprintf("%s %s", parameter.Name, parameter.VarType)
+	}
+	builder.WriteString(fmt.Sprintf("func %s(%s) %s {\n", function.Name, strings.Join(parameters, ", "),
+		function.Result))
+	for _, local := range function.Locals {
+		builder.WriteString(fmt.Sprintf("  var %s %s\n", local.Name, local.VarType))
+	}
+
+	for _, block := range function.Blocks {
+		builder.WriteString(block.Label + ":\n")
+		for _, instruction := range block.Instructions {
+			builder.WriteString("  " + instruction.String() + "\n")
+		}
+		builder.WriteString("  " + block.Terminator.String() + "\n")
+	}
+	builder.WriteString("}\n")
+	return builder.String()
+}
@@ -0,0 +1,280 @@
+package ir
+
+import (
+	"mechanus-compiler/internal/ast"
+	"mechanus-compiler/internal/mechatest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// lowerSource parses, analyzes and lowers the given source.
+func lowerSource(t *testing.T, source string) (*Program, error) {
+	t.Helper()
+
+	construct, info := mechatest.Analyze(t, source)
+	builder := NewBuilder(info, false)
+	return builder.Run(construct)
+}
+
+// TestBuilder_MissingMain ensures that a Construct without a main Architect cannot be lowered.
+func TestBuilder_MissingMain(t *testing.T) {
+	if _, err := lowerSource(t, mechatest.MissingMain); err == nil {
+		t.Fatal("expected an error, got nil")
+	}
+}
+
+// TestBuilder_Dump checks the lowering of a for loop around an if/elif/else chain, of a call and of the widening of
+// an integrated Gear.
+func TestBuilder_Dump(t *testing.T) {
+	source := `{
+   {
+        ((3)half)Send
+        {
+            {
+                ("large")Send
+            } else {
+                ("medium")Send
+            } i < 4 elif {
+                ("small")Send
+            } i < 2 if
+            i + 1 = i
+        } i < 5 for
+        0 =: Gear :i
+   } ()main Architect
+   {
+        -g / 2 Integrate
+   } Tensor (Gear :g)half Architect
+} main Construct`
+
+	expected := `;; IR of the main Construct.
+
+func main() Gear {
+  var i Gear
+entry:
+  i = 0
+  jump for1.cond
+for1.cond:
+  branch i < 5, for1.body, for1.end
+for1.body:
+  i = i + 1
+  branch i < 2, if1.then, if1.elif1
+if1.then:
+  send "small"
+  jump if1.end
+if1.elif1:
+  branch i < 4, if1.elif1.then, if1.else
+if1.elif1.then:
+  send "medium"
+  jump if1.end
+if1.else:
+  send "large"
+  jump if1.end
+if1.end:
+  jump for1.cond
+for1.end:
+  %0: Tensor = call half(3)
+  send %0
+  return 0
+}
+
+func half(g Gear) Tensor {
+entry:
+  %0: Gear = -g
+  %1: Gear = %0 / 2
+  %2: Tensor = widen %1
+  return %2
+}
+`
+
+	program, err := lowerSource(t, source)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := program.String(); got != expected {
+		t.Errorf("unexpected dump:\n%s\nexpected:\n%s", got, expected)
+	}
+}
+
+// TestBuilder_Assemblies checks the lowering of a for over the elements of an Assembly, which widens each one into
+// the Tensor it declares, of a store into an element, of Append and of Length.
+func TestBuilder_Assemblies(t *testing.T) {
+	source := `{
+   {
+        {
+            (x)Send
+        } xs =: Tensor :x for
+        ((xs)Length)xs Append
+        5 = [0]xs
+        (1, 2)Gear Assembly =: Gear Assembly :xs
+   } ()main Architect
+} main Construct`
+
+	expected := `;; IR of the main Construct.
+
+func main() Gear {
+  var xs Gear Assembly
+  var for1.index Gear
+  var x Tensor
+entry:
+  xs = assembly(1, 2)
+  xs[0] = 5
+  %0: Gear = length xs
+  append xs, %0
+  %1: Gear Assembly = xs
+  %2: Gear = length %1
+  for1.index = 0
+  jump for1.cond
+for1.cond:
+  branch for1.index < %2, for1.body, for1.end
+for1.body:
+  %3: Gear = %1[for1.index]
+  x = widen %3
+  send x
+  for1.index = for1.index + 1
+  jump for1.cond
+for1.end:
+  return 0
+}
+`
+
+	program, err := lowerSource(t, source)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := program.String(); got != expected {
+		t.Errorf("unexpected dump:\n%s\nexpected:\n%s", got, expected)
+	}
+}
+
+// TestBuilder_Concurrency checks the lowering of Channels made from a capacity or shared, of a detached call, of a
+// Tensor received from a Gear Channel, and of the zero value of a Channel.
+func TestBuilder_Concurrency(t *testing.T) {
+	source := `{
+   {
+        (t)Send
+        (t)c Receive
+        0.0 =: Tensor :t
+        (2, c)square Detach
+        out =: Gear Channel :c
+        1 =: Gear Channel :out
+   } ()main Architect
+   {
+        (n * n)out Send
+   } (Gear :n, Gear Channel :out)square Architect
+   {
+   } Gear Channel ()never Architect
+} main Construct`
+
+	expected := `;; IR of the main Construct.
+
+func main() Gear {
+  var out Gear Channel
+  var c Gear Channel
+  var t Tensor
+entry:
+  out = channel 1
+  c = out
+  detach square(2, c)
+  t = 0.0
+  %0: Gear = receive from c
+  t = widen %0
+  send t
+  return 0
+}
+
+func square(n Gear, out Gear Channel) Gear {
+entry:
+  %0: Gear = n * n
+  send %0 to out
+  return 0
+}
+
+func never() Gear Channel {
+entry:
+  return Nil
+}
+`
+
+	program, err := lowerSource(t, source)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := program.String(); got != expected {
+		t.Errorf("unexpected dump:\n%s\nexpected:\n%s", got, expected)
+	}
+}
+
+// TestBuilder_Examples checks that every block of the examples ends with a terminator whose successors belong to the
+// same function, and that labels are unique.
+func TestBuilder_Examples(t *testing.T) {
+	paths, err := filepath.Glob("../../docs/examples/example*_input.mecha")
+	if err != nil || len(paths) == 0 {
+		t.Fatalf("no examples found: %v", err)
+	}
+
+	for _, path := range paths {
+		name := strings.TrimSuffix(filepath.Base(path), "_input.mecha")
+		t.Run(name, func(t *testing.T) {
+			source, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("failed to read %s: %v", path, err)
+			}
+			program, err := lowerSource(t, string(source))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if program.Function("main") == nil {
+				t.Fatal("missing main function")
+			}
+
+			for _, function := range program.Functions {
+				blocks := make(map[*Block]bool)
+				labels := make(map[string]bool)
+				for _, block := range function.Blocks {
+					if labels[block.Label] {
+						t.Errorf("%s: duplicate label %s", function.Name, block.Label)
+					}
+					blocks[block] = true
+					labels[block.Label] = true
+				}
+				for _, block := range function.Blocks {
+					if block.Terminator == nil {
+						t.Fatalf("%s: block %s has no terminator", function.Name, block.Label)
+					}
+					for _, successor := range block.Terminator.Successors() {
+						if !blocks[successor] {
+							t.Errorf("%s: block %s moves to a block outside the function", function.Name, block.Label)
+						}
+					}
+				}
+			}
+		})
+	}
+}
+
+// TestConst_String checks that constants are written as in the source, with Tensors never reading as Gears.
+func TestConst_String(t *testing.T) {
+	tests := []struct {
+		constant *Const
+		expected string
+	}{
+		{&Const{ConstType: ast.TypeGear, Value: int64(-3)}, "-3"},
+		{&Const{ConstType: ast.TypeTensor, Value: float64(2)}, "2.0"},
+		{&Const{ConstType: ast.TypeTensor, Value: 0.25}, "0.25"},
+		{&Const{ConstType: ast.TypeTensor, Value: 1e21}, "1e+21"},
+		{&Const{ConstType: ast.TypeMonodrone, Value: 'A'}, "'A'"},
+		{&Const{ConstType: ast.TypeOmnidrone, Value: "say \"hi\""}, `"say \"hi\""`},
+		{&Const{ConstType: ast.TypeSwitch, Value: true}, "true"},
+		{Zero(ast.TypeSwitch), "false"},
+		{Zero(ast.TypeNil), "Nil"},
+		{Zero(ast.TypeTensor | ast.TypeAssembly), "()Tensor Assembly"},
+	}
+
+	for _, test := range tests {
+		if got := test.constant.String(); got != test.expected {
+			t.Errorf("expected %s, got %s", test.expected, got)
+		}
+	}
+}
@@ -1,44 +1,83 @@
 package lexer
 
 import (
-	"bufio"
 	"fmt"
+	"io"
+	"iter"
+	"mechanus-compiler/internal/ast"
 	"mechanus-compiler/internal/compiler_error"
 	"mechanus-compiler/internal/logger"
 	"os"
+	"strconv"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 )
 
 // Lexer :
 // This is the structure responsible for making the lexical analysis of the source file. It checks for unrecognized
 // lexemes and, if it finds one, it returns an error code.
 type Lexer struct {
-	logger           *logger.Logger
-	inputFile        *os.File
-	lines            []string
-	outputFile       *os.File
-	lookAhead        rune
-	token            int
-	lexeme           string
-	pointer          int
-	inputLine        string
-	currentLine      int
-	currentColumn    int
-	errorMessage     error
-	identifiedTokens strings.Builder
-	commentBlock     bool
+	logger       *logger.Logger
+	name         string
+	lines        []string
+	lineOffsets  []int
+	lookAhead    rune
+	width        int
+	token        int
+	lexeme       string
+	value        string
+	pointer      int
+	inputLine    string
+	currentLine  int
+	errorMessage error
+	comments     []Comment
+	// Position of the character consumed last and span of the lexeme collected last, both 0-based. Columns are byte
+	// indexes into the line, and are only counted in characters when they are handed out.
+	consumedLine   int
+	consumedColumn int
+	lexemeStart    [2]int
+	lexemeEnd      [2]int
 }
 
+// Token :
+// A token of the source file. Kind is one of the Token IDs and Lexeme is written in source order, even though it is
+// read from right to left. Span holds the 1-based line and column of the first character of the token and of the one
+// right after it, with columns counted in characters rather than bytes, and Offset and EndOffset are the same two
+// places as byte offsets from the start of the source. For Omnidrone and Monodrone literals, Value is the text between
+// the quotes with its escape sequences decoded, or the text between the backticks of a raw Omnidrone.
+type Token struct {
+	Kind      int
+	Lexeme    string
+	Value     string
+	Span      compiler_error.Span
+	Offset    int
+	EndOffset int
+}
+
+// Comment :
+// A comment of the source file. The lexer keeps comments aside instead of turning them into tokens, so tools that
+// print the source back, like the formatter, do not lose them. Text is the comment as written, with its delimiters and
+// the line breaks of a multiline comment, and Span uses the same numbering as the Span of a Token.
+type Comment struct {
+	Text string
+	Span compiler_error.Span
+}
+
+// endOfInput is stored in lex.lookAhead once the top of the source file has been passed.
+const endOfInput rune = -1
+
 //**********************************************************************************************************************
 // Public controllers
 //**********************************************************************************************************************
 
 // NewLexer :
-// Initializes a new Lexer instance with the provided input and output files. It also sets up various initial values
-// for the lexer.
+// Initializes a new Lexer instance reading the source from input. The name is only used to point diagnostics at the
+// source, so it does not have to be a real file. Since Mechanus is read from the bottom of the source to the top, the
+// whole input is loaded here, but tokens are only produced as they are asked for.
 //
-// Fails if it is not possible to read the source file.
-func NewLexer(inputFile, outputFile *os.File, debug bool) (Lexer, error) {
+// Fails if it is not possible to read the input, or if it is empty.
+func NewLexer(input io.Reader, name string, debug bool) (Lexer, error) {
 	// Initialize the logger. Log to Stderr. Set level based on the debug flag.
 	logLevel := logger.LevelInfo
 	if debug {
@@ -48,20 +87,19 @@ func NewLexer(inputFile, outputFile *os.File, debug bool) (Lexer, error) {
 
 	// Initialize the structure
 	lex := Lexer{
-		logger:        lg,
-		inputFile:     inputFile,
-		outputFile:    outputFile,
-		lines:         make([]string, 0),
-		currentLine:   0,
-		currentColumn: 0,
-		pointer:       0,
-		inputLine:     "",
-		token:         TNilValue,
-		errorMessage:  nil,
-	}
-
-	// Read the source file
-	if err := lex.readLines(); err != nil {
+		logger:       lg,
+		name:         name,
+		lines:        make([]string, 0),
+		lineOffsets:  make([]int, 0),
+		currentLine:  0,
+		pointer:      0,
+		inputLine:    "",
+		token:        TNilValue,
+		errorMessage: nil,
+	}
+
+	// Read the source
+	if err := lex.readLines(input); err != nil {
 		err = compiler_error.FileErrorf("NewLexer", err)
 		// Use the new logger to log the error
 		lex.logger.Error(err, map[string]any{"source": "NewLexer"})
@@ -79,106 +117,102 @@ func NewLexer(inputFile, outputFile *os.File, debug bool) (Lexer, error) {
 	return lex, nil
 }
 
-// NextToken :
+// NewLexerFromString :
+// Initializes a new Lexer instance over a source held in memory.
+//
+// Fails if the source is empty.
+func NewLexerFromString(source, name string, debug bool) (Lexer, error) {
+	return NewLexer(strings.NewReader(source), name, debug)
+}
+
+// Next :
+// Advances the lexer and returns the token found. Once the top of the source is passed, a TInputEnd token is
+// returned. An unknown character is returned as a TLexError token, whose diagnostic is given by Fail.
+//
+// Fails if the lexer cannot go on, such as when a string literal or a multiline comment is never closed.
+func (lex *Lexer) Next() (Token, error) {
+	kind, err := lex.nextToken()
+	if err != nil {
+		return Token{Kind: TLexError}, err
+	}
+	return Token{
+		Kind:      kind,
+		Lexeme:    reverse(lex.lexeme),
+		Value:     lex.value,
+		Span:      lex.lexemeSpan(),
+		Offset:    lex.offset(lex.lexemeStart),
+		EndOffset: lex.offset(lex.lexemeEnd),
+	}, nil
+}
+
+// Tokens :
+// Returns an iterator over the remaining tokens, from the bottom of the source to the top. The iteration ends at the
+// top of the source, without yielding the TInputEnd token, or right after the first error, which is yielded with the
+// token that caused it.
+func (lex *Lexer) Tokens() iter.Seq2[Token, error] {
+	return func(yield func(Token, error) bool) {
+		for {
+			token, err := lex.Next()
+			if err == nil && token.Kind == TLexError {
+				err = lex.Fail()
+			}
+			if err == nil && token.Kind == TInputEnd {
+				return
+			}
+			if !yield(token, err) || err != nil {
+				return
+			}
+		}
+	}
+}
+
 // Advances the lexer to the next token, checking for separators, alphabetical characters, numerical characters, string
 // literals, or symbols.
-func (lex *Lexer) NextToken() (int, error) {
-	errSalt := "Lexer.NextToken"
+func (lex *Lexer) nextToken() (int, error) {
+	errSalt := "Lexer.nextToken"
 
-	// Check if lex.lookAhead is inside a comment block
-	if lex.commentBlock {
-		if err := lex.skipComment(); err != nil {
+	for lex.isSeparatorCharacter() {
+		if err := lex.moveLookAhead(); err != nil {
 			err = compiler_error.LexerErrorf(errSalt, err)
-			lex.logger.Error(err, map[string]any{"source": errSalt})
 			return -1, err
 		}
-	} else {
-		for lex.isSeparatorCharacter() {
-			if err := lex.moveLookAhead(); err != nil {
-				err = compiler_error.LexerErrorf(errSalt, err)
-				return -1, err
-			}
-		}
 	}
 
-	err := lex.collectLexeme()
-
-	if lex.token == TSingleLineComment {
-		_, err = lex.NextToken()
+	// Check if the top of the source file was reached
+	if lex.lookAhead == endOfInput {
+		lex.token = TInputEnd
+		lex.lexeme = ""
+		lex.lexemeStart = [2]int{0, 0}
+		lex.lexemeEnd = [2]int{0, 0}
+		return lex.token, nil
 	}
 
-	if err != nil {
+	if err := lex.collectLexeme(); err != nil {
 		err = compiler_error.LexerErrorf(errSalt, err)
 		lex.logger.Error(err, map[string]any{"source": errSalt})
 		return -1, err
 	}
 
+	// Comments are kept aside, and the token after them is returned instead
+	if lex.token == TSingleLineComment || lex.token == TOpenMultilineComment {
+		return lex.nextToken()
+	}
+
 	lex.logger.Debug("Token processed", map[string]any{"tokenID": lex.token})
 
 	return lex.token, nil
 }
 
-// WIP :
-// Checks if Lexer should keep working.
-func (lex *Lexer) WIP() bool {
-	return lex.token != TInputEnd && lex.token != TLexError
-}
-
-// DisplayToken :
-// Displays the current token and lexeme to the output.
-func (lex *Lexer) DisplayToken() {
-	var tokenLexeme string
-	lex.lexeme = reverse(lex.lexeme)
-	tokenLexeme = lex.identifyDisplayToken()
-	fmt.Println(tokenLexeme + " ( " + lex.lexeme + " )")
-	lex.storeTokens(tokenLexeme + " ( " + lex.lexeme + " )")
+// Comments :
+// Returns the comments read so far, in the order they were found, from the bottom of the file to the top.
+func (lex *Lexer) Comments() []Comment {
+	return lex.comments
 }
 
-// GetToken :
-// Returns the current Token ID.
-func (lex *Lexer) GetToken() int {
-	return lex.token
-}
-
-// GetLexeme :
-// Returns the current lexeme.
-func (lex *Lexer) GetLexeme() string {
-	return lex.lexeme
-}
-
-// DisplayPos :
-// Returns the current line and column in a formatted string.
-func (lex *Lexer) DisplayPos() string {
-	return fmt.Sprintf("Line: %d, Column: %d", lex.currentLine+1, lex.currentColumn+1)
-}
-
-// GetPos :
-// Returns an array with the current line and column.
-func (lex *Lexer) GetPos() []int {
-	return []int{lex.currentLine, lex.currentColumn}
-}
-
-// Close :
-// Closes the specified file (either input or output).
-func (lex *Lexer) Close(file string) {
-	lex.logger.Debug("Closing file", map[string]any{"file_type": file})
-
-	switch file {
-	case "input":
-		if err := lex.inputFile.Close(); err != nil {
-			err = compiler_error.FileErrorf("Lexer.Close", err)
-			lex.logger.Error(err, nil)
-			return
-		}
-	case "output":
-		if err := lex.outputFile.Close(); err != nil {
-			err = compiler_error.FileErrorf("Lexer.Close", err)
-			lex.logger.Error(err, nil)
-			return
-		}
-	}
-
-	lex.logger.Info(compiler_error.FileCloseSuccess, nil)
+// FileName :
+// Returns the name of the source, as given to NewLexer.
+func (lex *Lexer) FileName() string {
+	return lex.name
 }
 
 // Fail :
@@ -190,47 +224,11 @@ func (lex *Lexer) Fail() error {
 	return nil
 }
 
-// WriteOutput :
-// Writes the identified tokens to the output file.
-func (lex *Lexer) WriteOutput() error {
-	errSalt := "(Lexer.WriteOutput)"
-
-	if lex.outputFile == nil {
-		err := compiler_error.FileErrorf(errSalt, fmt.Errorf(compiler_error.UninitializedFile))
-		lex.logger.Error(err, nil)
-		return err
-	}
-
-	file, err := os.Create("output.txt")
-
-	if err != nil {
-		err = compiler_error.FileErrorf(errSalt, err)
-		lex.logger.Error(err, nil)
-		return err
-	}
-	defer func(file *os.File) {
-		if err := file.Close(); err != nil {
-			err = compiler_error.FileErrorf(errSalt, err)
-			lex.logger.Error(err, nil)
-			return
-		}
-	}(file)
-
-	if _, err = file.WriteString(lex.identifiedTokens.String()); err != nil {
-		err = compiler_error.FileErrorf(errSalt, err)
-		lex.logger.Error(err, nil)
-		return err
-	}
-
-	lex.logger.Info(compiler_error.FileCreateSuccess, nil)
-	return nil
-}
-
-// ShowTokens :
-// Displays the list of identified tokens.
-func (lex *Lexer) ShowTokens() {
-	lex.logger.Debug(compiler_error.IdentifiedTokens, nil)
-	fmt.Println(lex.identifiedTokens.String())
+// DisplayTokenName :
+// Returns the output name of a Token ID, such as T_ID or T_OPEN_BRACES.
+func DisplayTokenName(token int) string {
+	lex := Lexer{token: token}
+	return lex.identifyDisplayToken()
 }
 
 //**********************************************************************************************************************
@@ -239,22 +237,30 @@ func (lex *Lexer) ShowTokens() {
 
 // ----- File handling -------------------------------------------------------------------------------------------------
 
-// Reads all lines from source file and stores them inside lex.lines
+// Reads all lines from the input and stores them inside lex.lines, without their line breaks, and where each of them
+// starts inside lex.lineOffsets.
 //
-// Fails if it is not possible to read the source file, or if the source file is empty.
-func (lex *Lexer) readLines() error {
-	scanner := bufio.NewScanner(lex.inputFile)
-
-	for scanner.Scan() {
-		lex.lines = append(lex.lines, scanner.Text())
-	}
-
-	if err := scanner.Err(); err != nil {
+// Fails if it is not possible to read the input, or if the input is empty.
+func (lex *Lexer) readLines(input io.Reader) error {
+	content, err := io.ReadAll(input)
+	if err != nil {
 		err = compiler_error.FileErrorf("Lexer.readLines", err)
 		lex.logger.Error(err, nil)
 		return err
 	}
 
+	offset := 0
+	for rest := string(content); rest != ""; {
+		line, after, found := strings.Cut(rest, "\n")
+		lex.lines = append(lex.lines, strings.TrimSuffix(line, "\r"))
+		lex.lineOffsets = append(lex.lineOffsets, offset)
+		offset += len(line)
+		if found {
+			offset++
+		}
+		rest = after
+	}
+
 	if len(lex.lines) == 0 {
 		err := compiler_error.FileErrorf("Lexer.readLines", fmt.Errorf(compiler_error.EmptyFile))
 		lex.logger.Error(err, nil)
@@ -263,46 +269,40 @@ func (lex *Lexer) readLines() error {
 
 	lex.currentLine = len(lex.lines) - 1
 	lex.inputLine = lex.lines[lex.currentLine]
-	lex.currentColumn = len(lex.inputLine)
-	lex.pointer = lex.currentColumn
+	lex.pointer = len(lex.inputLine)
 	return nil
 }
 
-// Moves the pointer to the next character in the current line. If the end of the line is reached, it loads the next
-// line.
-//
-// Fails when reaching EOF.
+// Consumes lex.lookAhead, remembering where it was, and moves to the next character.
 func (lex *Lexer) moveLookAhead() error {
-	// end of line reached
-	lex.pointer--
+	lex.consumedLine = lex.currentLine
+	lex.consumedColumn = lex.pointer
+	return lex.advanceLookAhead()
+}
 
+// Moves the pointer to the next character in the current line. If the end of the line is reached, it loads the next
+// line. Once the top of the file is passed, lex.lookAhead is set to endOfInput.
+//
+// Characters are decoded from UTF-8 backwards, so lex.pointer is left at the first byte of lex.lookAhead and
+// lex.width holds how many bytes it takes.
+func (lex *Lexer) advanceLookAhead() error {
 	// Check if the end of the line (right to left) was reached
-	if lex.pointer < 0 {
-		// Move the cursor up one line
-		err := lex.nextLine()
-
-		// Check if EOF was reached
-		if err != nil {
-			err = compiler_error.FileErrorf("Lexer.moveLookAhead", err)
-			return err
+	if lex.pointer <= 0 {
+		// Move the cursor up one line. The only possible failure is reaching the top of the file.
+		if err := lex.nextLine(); err != nil {
+			lex.lookAhead = endOfInput
+			lex.width = 0
+			return nil
 		}
 
-		// Check if the current line is not empty
-		if len(lex.inputLine) >= 1 {
-			lex.lookAhead = rune(lex.inputLine[lex.pointer])
-		} else { // Move to the next line if it is
-			err := lex.moveLookAhead()
-
-			// Check if EOF was reached
-			if err != nil {
-				return err
-			}
+		// Move to the next line if this one is empty
+		if len(lex.inputLine) == 0 {
+			return lex.advanceLookAhead()
 		}
-
-	} else { // If the end of the line was not reached, collect the next character
-		lex.currentColumn = lex.pointer + 1
-		lex.lookAhead = rune(lex.inputLine[lex.pointer])
 	}
+
+	lex.lookAhead, lex.width = utf8.DecodeLastRuneInString(lex.inputLine[:lex.pointer])
+	lex.pointer -= lex.width
 	return nil
 }
 
@@ -312,43 +312,74 @@ func (lex *Lexer) nextLine() error {
 	lex.currentLine--
 
 	// Check if the top of the file was reached
-	if lex.currentLine <= 0 {
+	if lex.currentLine < 0 {
 		lex.logger.Debug(compiler_error.EndOfFileReached, nil)
 		return compiler_error.FileError(fmt.Errorf(compiler_error.EndOfFileReached))
 	}
 
 	// Collect the content of the line
 	lex.inputLine = lex.lines[lex.currentLine]
-	lex.pointer = len(lex.inputLine) - 1
+	lex.pointer = len(lex.inputLine)
 	return nil
 }
 
-// Skips over a comment block until the end of the comment is reached.
+// Skips the rest of the current line, leaving lex.lookAhead at the last character of the line above. Everything to
+// the left of the single line comment symbol, which ends at lex.lexemeEnd, is kept as a comment.
+func (lex *Lexer) skipLine() error {
+	line, end := lex.lexemeEnd[0], lex.lexemeEnd[1]
+	text := strings.TrimLeft(lex.lines[line][:end], " \t")
+	lex.comments = append(lex.comments, Comment{
+		Text: text,
+		Span: lex.diagnosticSpan(line, end-len(text), end),
+	})
+
+	lex.pointer = 0
+	return lex.moveLookAhead()
+}
+
+// Skips over a comment block, whose opening symbol ends at lex.lexemeEnd, until the symbol that closes it is consumed.
+// The whole block is kept as a comment.
 func (lex *Lexer) skipComment() error {
+	opening := lex.diagnosticSpan(lex.lexemeEnd[0], lex.lexemeEnd[1]-len(OpenMultilineComment), lex.lexemeEnd[1])
+
 	for !lex.multilineCommentEnd() {
+		if lex.lookAhead == endOfInput {
+			diagnostic := lex.diagnostic(compiler_error.CodeUnterminatedComment, compiler_error.UnterminatedComment,
+				opening)
+			diagnostic.Notes = []string{noteReadingOrder}
+			err := compiler_error.LexerErrorf("Lexer.skipComment", diagnostic)
+			lex.logger.Error(err, nil)
+			return err
+		}
 		if err := lex.moveLookAhead(); err != nil {
 			err = compiler_error.LexerErrorf("Lexer.skipComment", err)
 			lex.logger.Error(err, nil)
 			return err
 		}
 	}
+
+	// Consume both characters of the closing symbol
+	for range CloseMultilineComment {
+		if err := lex.moveLookAhead(); err != nil {
+			err = compiler_error.LexerErrorf("Lexer.skipComment", err)
+			lex.logger.Error(err, nil)
+			return err
+		}
+	}
+
+	start, end := [2]int{lex.consumedLine, lex.consumedColumn}, lex.lexemeEnd
+	lex.comments = append(lex.comments, Comment{
+		Text: lex.sourceText(start, end),
+		Span: compiler_error.Span{Start: lex.position(start), End: lex.position(end)},
+	})
 	return nil
 }
 
-// Checks if the current position marks the end of a multiline comment.
+// Checks if lex.lookAhead is the right character of the symbol that closes a multiline comment. The symbol is read
+// from right to left, like everything else.
 func (lex *Lexer) multilineCommentEnd() bool {
-	// Checks that pointing to lex.pointer+1 won't raise an index out of bound exception
-	// AND
-	// Checks if lex.lookAhead == '*'
-	// AND
-	// Checks if the current char + the next char == CloseMultilineComment
-	if lex.pointer+1 <= len(lex.inputLine) && lex.lookAhead == '*' {
-		temp := fmt.Sprintf("%c%c", lex.lookAhead, lex.inputLine[lex.pointer])
-		if temp == CloseMultilineComment {
-			return true
-		}
-	}
-	return false
+	return lex.lookAhead == rune(CloseMultilineComment[1]) && lex.pointer >= 1 &&
+		lex.inputLine[lex.pointer-1] == CloseMultilineComment[0]
 }
 
 // Reverses a string. Used to output the correct lexeme
@@ -362,9 +393,11 @@ func reverse(s string) string {
 
 // ----- Lexeme identifiers --------------------------------------------------------------------------------------------
 
-// Collects the newly found lexeme
+// Collects the newly found lexeme, recording where it is. The lexeme is read from its last character to its first.
 func (lex *Lexer) collectLexeme() error {
 	var err error
+	lex.lexemeEnd = [2]int{lex.currentLine, lex.pointer + lex.width}
+	lex.value = ""
 
 	if lex.isAlphabeticalCharacter() {
 		err = lex.alphabeticalCharacter()
@@ -372,6 +405,8 @@ func (lex *Lexer) collectLexeme() error {
 		err = lex.numericalCharacter()
 	} else if lex.isQuotation() {
 		err = lex.quoteCharacters()
+	} else if lex.lookAhead == Backtick {
+		err = lex.rawCharacters()
 	} else {
 		err = lex.symbolCharacter()
 	}
@@ -382,6 +417,12 @@ func (lex *Lexer) collectLexeme() error {
 		return err
 	}
 
+	lex.lexemeStart = [2]int{lex.consumedLine, lex.consumedColumn}
+	if lex.token == TLexError {
+		lex.errorMessage = lex.diagnostic(compiler_error.CodeUnknownCharacter,
+			fmt.Sprintf(compiler_error.UnknownCharacter, lex.lexeme), lex.lexemeSpan())
+	}
+
 	return nil
 }
 
@@ -431,6 +472,10 @@ func matchesSingleCharSymbols(lookAhead rune) bool {
 		return true
 	case CloseBraces:
 		return true
+	case OpenBrackets:
+		return true
+	case CloseBrackets:
+		return true
 	default:
 		return false
 	}
@@ -485,11 +530,26 @@ func (lex *Lexer) alphabeticalCharacter() error {
 		lex.token = TMonodrone
 	case Omnidrone:
 		lex.token = TOmnidrone
+	case Switch:
+		lex.token = TSwitch
+	case Channel:
+		lex.token = TChannel
+	case Assembly:
+		lex.token = TAssembly
+	// Values
+	case True:
+		lex.token = TTrue
+	case False:
+		lex.token = TFalse
 	// Built-in functions
 	case Send:
 		lex.token = TSend
 	case Receive:
 		lex.token = TReceive
+	case Length:
+		lex.token = TLength
+	case Append:
+		lex.token = TAppend
 	default:
 		lex.token = TId
 	}
@@ -510,7 +570,7 @@ func (lex *Lexer) numericalCharacter() error {
 
 	floatSeparatorFound := false
 
-	for (lex.lookAhead >= '0' && lex.lookAhead <= '9') || (lex.lookAhead >= '.' && !floatSeparatorFound) {
+	for (lex.lookAhead >= '0' && lex.lookAhead <= '9') || (lex.lookAhead == '.' && !floatSeparatorFound) {
 		if lex.lookAhead == '.' {
 			floatSeparatorFound = true
 		}
@@ -561,7 +621,9 @@ func (lex *Lexer) multiSymbolCharacter(temp rune) error {
 
 	uniqueSymbol := false
 
-	if checkMultiSymbolMatch(temp, lex.lookAhead) {
+	// A symbol never spans a line break, so a character at the start of a line is not joined with the end of the
+	// line above
+	if lex.currentLine == lex.lexemeEnd[0] && checkMultiSymbolMatch(temp, lex.lookAhead) {
 		sbLexeme.WriteRune(lex.lookAhead)
 
 		if err := lex.moveLookAhead(); err != nil {
@@ -578,15 +640,15 @@ func (lex *Lexer) multiSymbolCharacter(temp rune) error {
 	// Construction tokens
 	case SingleLineComment:
 		lex.token = TSingleLineComment
-		// The lexical analyzer can jump to the next line because anything to the right of the single line comment
+		// The lexical analyzer can jump to the next line because anything to the left of the single line comment
 		// symbol, "//", should be ignored
-		err = lex.nextLine()
+		err = lex.skipLine()
 	case OpenMultilineComment:
 		lex.token = TOpenMultilineComment
-		lex.commentBlock = true
+		// The comment is read right away, so its end is not mistaken for a token
+		err = lex.skipComment()
 	case CloseMultilineComment:
 		lex.token = TCloseMultilineComment
-		lex.commentBlock = false
 	// Conditional and repetition tokens
 	case GreaterEqualOperator:
 		lex.token = TGreaterEqualOperator
@@ -671,6 +733,10 @@ func (lex *Lexer) uniqueSymbolCharacter(temp rune) {
 		lex.token = TOpenBraces
 	case CloseBraces:
 		lex.token = TCloseBraces
+	case OpenBrackets:
+		lex.token = TOpenBrackets
+	case CloseBrackets:
+		lex.token = TCloseBrackets
 	// Operators
 	case GreaterThanOperator:
 		lex.token = TGreaterThanOperator
@@ -691,32 +757,42 @@ func (lex *Lexer) uniqueSymbolCharacter(temp rune) {
 	case AttributionOperator:
 		lex.token = TAttributionOperator
 	default:
+		// The diagnostic is built by collectLexeme, once the position of the character is known
 		lex.token = TLexError
-		lex.errorMessage = fmt.Errorf("Lexer error on line: %d\nRecognized upon reaching column: %d\nError line: <%s>\nUnknown token: %c", lex.currentLine, lex.currentColumn, lex.inputLine, lex.lookAhead)
 	}
 	lex.lexeme = sbLexeme.String()
 }
 
-// Handles string literals, either single or double-quoted.
+// Handles string literals, either single or double-quoted. Escape sequences are written like in most languages, in
+// source order, so a quote only closes the literal if it is not escaped: the lexer, which meets the closing quote
+// first, checks that it is not preceded by an odd number of backslashes. Once the whole literal is read, its escape
+// sequences are decoded into lex.value.
 func (lex *Lexer) quoteCharacters() error {
-	charCount := 0
 	char := lex.lookAhead
-	if char == '\'' {
-		charCount = 1
-	}
 	sbLexeme := strings.Builder{}
 	sbLexeme.WriteRune(lex.lookAhead)
 	errSalt := "(Lexer.quoteCharacters)"
 
+	// The quote that opens the literal is its last character in the source
+	quote := lex.diagnosticSpan(lex.lexemeEnd[0], lex.lexemeEnd[1]-1, lex.lexemeEnd[1])
+	if lex.escaped() {
+		diagnostic := lex.diagnostic(compiler_error.CodeUnterminatedString, compiler_error.UnterminatedString, quote)
+		diagnostic.Notes = []string{noteEscapedQuote}
+		return diagnostic
+	}
+
 	if err := lex.moveLookAhead(); err != nil {
 		err = compiler_error.LexerErrorf(errSalt, err)
 		lex.logger.Error(err, nil)
 		return err
 	}
 
-	for lex.lookAhead != char {
-		if char == '\'' && charCount > 1 {
-			return fmt.Errorf(compiler_error.InvalidMonodrone)
+	for lex.lookAhead != char || lex.escaped() {
+		// A quoted literal cannot go past the start of its line, unlike a raw one
+		if lex.lookAhead == endOfInput || lex.currentLine != lex.lexemeEnd[0] {
+			diagnostic := lex.diagnostic(compiler_error.CodeUnterminatedString, compiler_error.UnterminatedString, quote)
+			diagnostic.Notes = []string{noteQuoteLine}
+			return diagnostic
 		}
 
 		sbLexeme.WriteRune(lex.lookAhead)
@@ -726,8 +802,6 @@ func (lex *Lexer) quoteCharacters() error {
 			lex.logger.Error(err, nil)
 			return err
 		}
-
-		charCount++
 	}
 
 	sbLexeme.WriteRune(lex.lookAhead)
@@ -745,9 +819,157 @@ func (lex *Lexer) quoteCharacters() error {
 	case SingleQuote:
 		lex.token = TSingleQuote
 	}
+
+	// The text of the literal starts right after the quote consumed last
+	text := reverse(lex.lexeme)
+	text = text[1 : len(text)-1]
+	line, start := lex.consumedLine, lex.consumedColumn+1
+
+	value, from, to := unescape(text)
+	if from >= 0 {
+		return lex.diagnostic(compiler_error.CodeInvalidEscape,
+			fmt.Sprintf(compiler_error.InvalidEscape, text[from:to]), lex.diagnosticSpan(line, start+from, start+to))
+	}
+	if char == SingleQuote && utf8.RuneCountInString(value) != 1 {
+		return lex.diagnostic(compiler_error.CodeInvalidMonodrone, compiler_error.InvalidMonodrone,
+			lex.diagnosticSpan(line, start-1, lex.lexemeEnd[1]))
+	}
+	lex.value = value
 	return nil
 }
 
+// Handles raw Omnidrone literals, written between backticks. They hold their text exactly as written, without escape
+// sequences, and may span several lines. Since the lexer meets the closing backtick first, it reads up to the opening
+// one, but the text is taken from the source as it is written: its lines go from the top to the bottom.
+func (lex *Lexer) rawCharacters() error {
+	errSalt := "Lexer.rawCharacters"
+	closing := lex.diagnosticSpan(lex.lexemeEnd[0], lex.lexemeEnd[1]-1, lex.lexemeEnd[1])
+
+	if err := lex.moveLookAhead(); err != nil {
+		err = compiler_error.LexerErrorf(errSalt, err)
+		lex.logger.Error(err, nil)
+		return err
+	}
+
+	for lex.lookAhead != Backtick {
+		if lex.lookAhead == endOfInput {
+			diagnostic := lex.diagnostic(compiler_error.CodeUnterminatedString, compiler_error.UnterminatedString,
+				closing)
+			diagnostic.Notes = []string{noteReadingOrder}
+			return diagnostic
+		}
+		if err := lex.moveLookAhead(); err != nil {
+			err = compiler_error.LexerErrorf(errSalt, err)
+			lex.logger.Error(err, nil)
+			return err
+		}
+	}
+
+	if err := lex.moveLookAhead(); err != nil {
+		err = compiler_error.LexerErrorf(errSalt, err)
+		lex.logger.Error(err, nil)
+		return err
+	}
+
+	text := lex.sourceText([2]int{lex.consumedLine, lex.consumedColumn}, lex.lexemeEnd)
+	lex.lexeme = reverse(text)
+	lex.value = text[1 : len(text)-1]
+	lex.token = TBacktick
+	return nil
+}
+
+// Returns the text of the source from a 0-based line and byte index up to another, excluded, in source order.
+func (lex *Lexer) sourceText(start, end [2]int) string {
+	text := make([]string, 0, end[0]-start[0]+1)
+	for line := start[0]; line <= end[0]; line++ {
+		from, to := 0, len(lex.lines[line])
+		if line == start[0] {
+			from = start[1]
+		}
+		if line == end[0] {
+			to = end[1]
+		}
+		text = append(text, lex.lines[line][from:to])
+	}
+	return strings.Join(text, "\n")
+}
+
+// Checks if the quote in lex.lookAhead is escaped, that is, preceded in its line by an odd number of backslashes.
+func (lex *Lexer) escaped() bool {
+	count := 0
+	for i := lex.pointer - 1; i >= 0 && lex.inputLine[i] == Backslash; i-- {
+		count++
+	}
+	return count%2 == 1
+}
+
+// Decodes the escape sequences of the text of a literal, written in source order. Returns the decoded text, or the
+// byte range [from, to) of the first invalid escape sequence, with from set to -1 when there is none.
+func unescape(text string) (string, int, int) {
+	var sbValue strings.Builder
+	for i := 0; i < len(text); i++ {
+		if text[i] != Backslash {
+			sbValue.WriteByte(text[i])
+			continue
+		}
+
+		// A backslash always starts a sequence, and a trailing one cannot happen since it would escape the quote
+		start := i
+		i++
+		switch text[i] {
+		case 'n':
+			sbValue.WriteByte('\n')
+		case 't':
+			sbValue.WriteByte('\t')
+		case Backslash, DoubleQuote, SingleQuote:
+			sbValue.WriteByte(text[i])
+		case 'u':
+			// \u{...} holds the code point in 1 to 6 hexadecimal digits
+			end := strings.IndexByte(text[i:], '}')
+			if i+1 >= len(text) || text[i+1] != '{' || end < 0 {
+				_, size := utf8.DecodeRuneInString(text[i:])
+				return "", start, i + size
+			}
+			end += i
+			code, err := strconv.ParseUint(text[i+2:end], 16, 32)
+			if err != nil || end-i-2 > 6 || !utf8.ValidRune(rune(code)) {
+				return "", start, end + 1
+			}
+			sbValue.WriteRune(rune(code))
+			i = end
+		default:
+			_, size := utf8.DecodeRuneInString(text[i:])
+			return "", start, i + size
+		}
+	}
+	return sbValue.String(), -1, -1
+}
+
+// Quote :
+// Returns a value written as a literal between the given quotes, escaping what cannot be written as is. It is the
+// reverse of the decoding done by the lexer.
+func Quote(value string, quote rune) string {
+	var sbLiteral strings.Builder
+	sbLiteral.WriteRune(quote)
+	for _, char := range value {
+		switch {
+		case char == '\n':
+			sbLiteral.WriteString(`\n`)
+		case char == '\t':
+			sbLiteral.WriteString(`\t`)
+		case char == Backslash || char == quote:
+			sbLiteral.WriteByte(Backslash)
+			sbLiteral.WriteRune(char)
+		case !unicode.IsPrint(char):
+			sbLiteral.WriteString(fmt.Sprintf(`\u{%X}`, char))
+		default:
+			sbLiteral.WriteRune(char)
+		}
+	}
+	sbLiteral.WriteRune(quote)
+	return sbLiteral.String()
+}
+
 // ----- Display methods -----------------------------------------------------------------------------------------------
 
 func (lex *Lexer) identifyDisplayToken() string {
@@ -783,6 +1005,8 @@ func (lex *Lexer) displayConstructionToken() string {
 		return OutputMonodrone
 	case TDoubleQuote:
 		return OutputOmnidrone
+	case TBacktick:
+		return OutputRawString
 	default:
 		return "N/A"
 	}
@@ -821,10 +1045,21 @@ func (lex *Lexer) displayTypeToken() string {
 		return OutputMonodrone
 	case TOmnidrone:
 		return OutputOmnidrone
+	case TSwitch:
+		return OutputSwitch
+	case TChannel:
+		return OutputChannel
+	case TAssembly:
+		return OutputAssembly
 	case TTypeName:
 		return OutputTypeName
 	case TId:
 		return OutputId
+	// Values
+	case TTrue:
+		return OutputTrue
+	case TFalse:
+		return OutputFalse
 	default:
 		return "N/A"
 	}
@@ -841,6 +1076,10 @@ func (lex *Lexer) displayStructureToken() string {
 		return OutputOpenBraces
 	case TCloseBraces:
 		return OutputCloseBraces
+	case TOpenBrackets:
+		return OutputOpenBrackets
+	case TCloseBrackets:
+		return OutputCloseBrackets
 	case TSingleLineComment:
 		return OutputSingleLineComment
 	case TOpenMultilineComment:
@@ -901,6 +1140,10 @@ func (lex *Lexer) displayFunctions() string {
 		return OutputSend
 	case TReceive:
 		return OutputReceive
+	case TLength:
+		return OutputLength
+	case TAppend:
+		return OutputAppend
 	default:
 		return "N/A"
 	}
@@ -908,8 +1151,46 @@ func (lex *Lexer) displayFunctions() string {
 
 // ----- Helper methods ------------------------------------------------------------------------------------------------
 
-// Stores an identified token into the identifiedTokens builder.
-func (lex *Lexer) storeTokens(identifiedToken string) {
-	lex.identifiedTokens.WriteString(identifiedToken)
-	lex.identifiedTokens.WriteString("\n")
+// noteReadingOrder explains the diagnostics of literals and comments left open, which are found at their right end.
+const noteReadingOrder = "Mechanus reads each line from right to left, starting from the last line, so this is where " +
+	"it opens: it must be closed to its left or on a line above"
+
+// noteQuoteLine explains the diagnostics of quoted literals left open, which cannot span lines.
+const noteQuoteLine = "Mechanus reads each line from right to left, so this is where it opens: it must be closed to " +
+	"its left, on the same line. Raw Omnidrones, written between backticks, can span lines"
+
+// noteEscapedQuote explains why the quote at the right end of a literal does not open it.
+const noteEscapedQuote = "the quote is escaped by the backslash to its left, so it cannot close a literal"
+
+// Builds a Diagnostic for an error of the lexer.
+func (lex *Lexer) diagnostic(code, message string, span compiler_error.Span) *compiler_error.Diagnostic {
+	return &compiler_error.Diagnostic{
+		Severity: compiler_error.SeverityError,
+		Kind:     compiler_error.ErrLexical,
+		Code:     code,
+		File:     lex.FileName(),
+		Span:     span,
+		Message:  message,
+	}
+}
+
+// Returns where the current lexeme is in the source file, with 1-based lines and columns. The end of the input is
+// placed at the top of the file.
+func (lex *Lexer) lexemeSpan() compiler_error.Span {
+	return compiler_error.Span{Start: lex.position(lex.lexemeStart), End: lex.position(lex.lexemeEnd)}
+}
+
+// Returns the 1-based line and column of a 0-based line and byte index, counting the column in characters.
+func (lex *Lexer) position(at [2]int) ast.Pos {
+	return ast.Pos{Line: at[0] + 1, Column: utf8.RuneCountInString(lex.lines[at[0]][:at[1]]) + 1}
+}
+
+// Returns the byte offset, from the start of the source, of a 0-based line and column.
+func (lex *Lexer) offset(position [2]int) int {
+	return lex.lineOffsets[position[0]] + position[1]
+}
+
+// Returns the span of the 0-based byte indexes [start, end) of a 0-based line.
+func (lex *Lexer) diagnosticSpan(line, start, end int) compiler_error.Span {
+	return compiler_error.Span{Start: lex.position([2]int{line, start}), End: lex.position([2]int{line, end})}
 }
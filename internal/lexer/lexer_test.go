@@ -0,0 +1,302 @@
+package lexer
+
+import (
+	"mechanus-compiler/internal/ast"
+	"mechanus-compiler/internal/compiler_error"
+	"strings"
+	"testing"
+)
+
+// collect returns every token of the source, in the order the lexer reads them.
+func collect(t *testing.T, lex *Lexer) ([]Token, error) {
+	t.Helper()
+
+	tokens := make([]Token, 0)
+	for token, err := range lex.Tokens() {
+		if err != nil {
+			return tokens, err
+		}
+		tokens = append(tokens, token)
+	}
+	return tokens, nil
+}
+
+// TestLexer_Tokens checks the kind, lexeme and span of each token of a string source, read from the bottom to the top
+// and from right to left, with comments left out. The byte offsets of each token must cover its lexeme, past a Windows
+// line break.
+func TestLexer_Tokens(t *testing.T) {
+	source := "note //\r\n(Gear :x)test\n  \"hi\" Integrate"
+	lex, err := NewLexerFromString(source, "input.mecha", false)
+	if err != nil {
+		t.Fatalf("failed to create lexer: %v", err)
+	}
+
+	tokens, err := collect(t, &lex)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := []struct {
+		kind       int
+		lexeme     string
+		start, end ast.Pos
+	}{
+		{kind: TIntegrate, lexeme: "Integrate", start: ast.Pos{Line: 3, Column: 8}, end: ast.Pos{Line: 3, Column: 17}},
+		{kind: TDoubleQuote, lexeme: `"hi"`, start: ast.Pos{Line: 3, Column: 3}, end: ast.Pos{Line: 3, Column: 7}},
+		{kind: TId, lexeme: "test", start: ast.Pos{Line: 2, Column: 10}, end: ast.Pos{Line: 2, Column: 14}},
+		{kind: TCloseParentheses, lexeme: ")", start: ast.Pos{Line: 2, Column: 9}, end: ast.Pos{Line: 2, Column: 10}},
+		{kind: TId, lexeme: "x", start: ast.Pos{Line: 2, Column: 8}, end: ast.Pos{Line: 2, Column: 9}},
+		{kind: TColon, lexeme: ":", start: ast.Pos{Line: 2, Column: 7}, end: ast.Pos{Line: 2, Column: 8}},
+		{kind: TGear, lexeme: "Gear", start: ast.Pos{Line: 2, Column: 2}, end: ast.Pos{Line: 2, Column: 6}},
+		{kind: TOpenParentheses, lexeme: "(", start: ast.Pos{Line: 2, Column: 1}, end: ast.Pos{Line: 2, Column: 2}},
+	}
+	if len(tokens) != len(expected) {
+		t.Fatalf("expected %d tokens, got %+v", len(expected), tokens)
+	}
+	for i, e := range expected {
+		token := tokens[i]
+		if token.Kind != e.kind || token.Lexeme != e.lexeme || token.Span.Start != e.start || token.Span.End != e.end {
+			t.Errorf("token %d: expected %q (%d) at %s-%s, got %q (%d) at %s-%s", i, e.lexeme, e.kind, e.start, e.end,
+				token.Lexeme, token.Kind, token.Span.Start, token.Span.End)
+		}
+		if text := source[token.Offset:token.EndOffset]; text != token.Lexeme {
+			t.Errorf("token %d: expected the offsets to cover %q, got %q", i, token.Lexeme, text)
+		}
+	}
+}
+
+// TestLexer_Reader ensures that a lexer reads the same tokens from an io.Reader as from a string.
+func TestLexer_Reader(t *testing.T) {
+	source := "{\n  {\n    0 Integrate\n  } ()main Architect\n} main Construct\n"
+
+	fromString, err := NewLexerFromString(source, "input.mecha", false)
+	if err != nil {
+		t.Fatalf("failed to create lexer: %v", err)
+	}
+	fromReader, err := NewLexer(strings.NewReader(source), "input.mecha", false)
+	if err != nil {
+		t.Fatalf("failed to create lexer: %v", err)
+	}
+
+	expected, _ := collect(t, &fromString)
+	tokens, err := collect(t, &fromReader)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(tokens) != 12 || len(tokens) != len(expected) {
+		t.Fatalf("expected 12 tokens from both sources, got %d and %d", len(expected), len(tokens))
+	}
+	for i := range tokens {
+		if tokens[i] != expected[i] {
+			t.Errorf("token %d: expected %+v, got %+v", i, expected[i], tokens[i])
+		}
+	}
+	if name := fromReader.FileName(); name != "input.mecha" {
+		t.Errorf("expected the name input.mecha, got %s", name)
+	}
+}
+
+// TestLexer_Error ensures that the iteration stops at the first lexical error, which is yielded with a TLexError token.
+func TestLexer_Error(t *testing.T) {
+	lex, err := NewLexerFromString("0 Integrate\n\"open Integrate", "input.mecha", false)
+	if err != nil {
+		t.Fatalf("failed to create lexer: %v", err)
+	}
+
+	var last Token
+	count := 0
+	for token, err := range lex.Tokens() {
+		count++
+		last = token
+		if err == nil {
+			continue
+		}
+		if token.Kind != TLexError {
+			t.Errorf("expected a TLexError token, got %d", token.Kind)
+		}
+	}
+	if count != 3 || last.Kind != TLexError {
+		t.Errorf("expected the iteration to stop at the error, got %d tokens ending with %+v", count, last)
+	}
+}
+
+// TestLexer_UTF8 ensures that multi-byte characters are read whole inside literals and comments, and that columns are
+// counted in characters while offsets are counted in bytes.
+func TestLexer_UTF8(t *testing.T) {
+	comment := "*/ çà /* 'é' \"héllo ✓\" naïve //"
+	source := comment + "\n'é' \"héllo ✓\" */ ça /*"
+	lex, err := NewLexerFromString(source, "input.mecha", false)
+	if err != nil {
+		t.Fatalf("failed to create lexer: %v", err)
+	}
+
+	tokens, err := collect(t, &lex)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(tokens) != 2 {
+		t.Fatalf("expected 2 tokens, got %+v", tokens)
+	}
+
+	omnidrone, monodrone := tokens[0], tokens[1]
+	if omnidrone.Kind != TDoubleQuote || omnidrone.Lexeme != `"héllo ✓"` {
+		t.Errorf("expected the Omnidrone \"héllo ✓\", got %q (%d)", omnidrone.Lexeme, omnidrone.Kind)
+	}
+	if start, end := omnidrone.Span.Start, omnidrone.Span.End; start.Column != 5 || end.Column != 14 {
+		t.Errorf("expected the Omnidrone on columns 5 to 14, got %d to %d", start.Column, end.Column)
+	}
+	if monodrone.Kind != TSingleQuote || monodrone.Lexeme != "'é'" || monodrone.Span.End.Column != 4 {
+		t.Errorf("expected the Monodrone 'é' to end on column 4, got %q (%d) ending on %d", monodrone.Lexeme,
+			monodrone.Kind, monodrone.Span.End.Column)
+	}
+	for _, token := range tokens {
+		if text := source[token.Offset:token.EndOffset]; text != token.Lexeme {
+			t.Errorf("expected the offsets to cover %q, got %q", token.Lexeme, text)
+		}
+	}
+
+	comments := lex.Comments()
+	if len(comments) != 2 || comments[0].Text != "*/ ça /*" || comments[1].Text != comment {
+		t.Errorf("expected both comments to be kept whole, got %+v", comments)
+	}
+}
+
+// TestLexer_LineBreakSymbol ensures that a symbol starting a line is not joined with the end of the line above, even
+// when both would make a comment symbol.
+func TestLexer_LineBreakSymbol(t *testing.T) {
+	lex, err := NewLexerFromString("    text //\n*", "input.mecha", false)
+	if err != nil {
+		t.Fatalf("failed to create lexer: %v", err)
+	}
+
+	tokens, err := collect(t, &lex)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(tokens) != 1 || tokens[0].Kind != TMultiplicationOperator ||
+		tokens[0].Span.Start != (ast.Pos{Line: 2, Column: 1}) {
+		t.Fatalf("expected a single '*' on 2:1, got %+v", tokens)
+	}
+	if comments := lex.Comments(); len(comments) != 1 || comments[0].Text != "text //" {
+		t.Errorf("expected the line above to stay a comment, got %+v", comments)
+	}
+}
+
+// TestLexer_UnknownCharacter ensures that a multi-byte character outside a literal is reported whole.
+func TestLexer_UnknownCharacter(t *testing.T) {
+	lex, err := NewLexerFromString("0 Integrate ¤", "input.mecha", false)
+	if err != nil {
+		t.Fatalf("failed to create lexer: %v", err)
+	}
+
+	token, err := lex.Next()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if token.Kind != TLexError || token.Lexeme != "¤" || token.Span.Start.Column != 13 {
+		t.Errorf("expected '¤' to be unknown on column 13, got %q (%d) on %d", token.Lexeme, token.Kind,
+			token.Span.Start.Column)
+	}
+}
+
+// TestLexer_Escapes checks the value decoded from literals with escape sequences, and the diagnostics of the broken
+// ones.
+func TestLexer_Escapes(t *testing.T) {
+	tests := []struct {
+		source string
+		value  string
+		code   string
+		start  int
+		end    int
+	}{
+		{source: `"say \"hi\""`, value: `say "hi"`},
+		{source: `"a\\"`, value: `a\`},
+		{source: `"tab\there\nline"`, value: "tab\there\nline"},
+		{source: `"\u{48}\u{1F600}"`, value: "H\U0001F600"},
+		{source: `'\''`, value: "'"},
+		{source: `'\n'`, value: "\n"},
+		{source: `'é'`, value: "é"},
+		{source: `"bad \q"`, code: compiler_error.CodeInvalidEscape, start: 6, end: 8},
+		{source: `"bad \u{D800}"`, code: compiler_error.CodeInvalidEscape, start: 6, end: 14},
+		{source: `"bad \u41"`, code: compiler_error.CodeInvalidEscape, start: 6, end: 8},
+		{source: `'ab'`, code: compiler_error.CodeInvalidMonodrone, start: 1, end: 5},
+		{source: `"open\"`, code: compiler_error.CodeUnterminatedString, start: 7, end: 8},
+	}
+
+	for _, test := range tests {
+		lex, err := NewLexerFromString(test.source, "input.mecha", false)
+		if err != nil {
+			t.Fatalf("failed to create lexer: %v", err)
+		}
+
+		token, err := lex.Next()
+		if test.code == "" {
+			if err != nil || token.Value != test.value || token.Lexeme != test.source {
+				t.Errorf("%s: expected the value %q, got %q (%v)", test.source, test.value, token.Value, err)
+			}
+			continue
+		}
+
+		diagnostics := compiler_error.Diagnostics(err)
+		if len(diagnostics) != 1 {
+			t.Errorf("%s: expected a diagnostic, got %v", test.source, err)
+			continue
+		}
+		span := diagnostics[0].Span
+		if diagnostics[0].Code != test.code || span.Start.Column != test.start || span.End.Column != test.end {
+			t.Errorf("%s: expected %s on columns %d to %d, got %s on %d to %d", test.source, test.code, test.start,
+				test.end, diagnostics[0].Code, span.Start.Column, span.End.Column)
+		}
+	}
+}
+
+// TestQuote ensures that quoting a value gives back a literal with the same value.
+func TestQuote(t *testing.T) {
+	values := map[rune]string{DoubleQuote: "say \"it's\"\tnow\\\n\x01", SingleQuote: "'"}
+	for quote, value := range values {
+		literal := Quote(value, quote)
+		lex, err := NewLexerFromString(literal, "input.mecha", false)
+		if err != nil {
+			t.Fatalf("failed to create lexer: %v", err)
+		}
+		if token, err := lex.Next(); err != nil || token.Value != value {
+			t.Errorf("expected %s to hold %q, got %q (%v)", literal, value, token.Value, err)
+		}
+	}
+}
+
+// TestLexer_RawStrings ensures that a raw Omnidrone keeps its text as written, from the top line to the bottom one,
+// while a quoted literal cannot span lines.
+func TestLexer_RawStrings(t *testing.T) {
+	source := "(`first \\n\n  \"second\"`)Send"
+	lex, err := NewLexerFromString(source, "input.mecha", false)
+	if err != nil {
+		t.Fatalf("failed to create lexer: %v", err)
+	}
+
+	tokens, err := collect(t, &lex)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(tokens) != 4 {
+		t.Fatalf("expected 4 tokens, got %+v", tokens)
+	}
+	raw := tokens[2]
+	if raw.Kind != TBacktick || raw.Value != "first \\n\n  \"second\"" || raw.Lexeme != source[1:len(source)-5] {
+		t.Errorf("expected the raw Omnidrone to keep its text, got %q (%d) holding %q", raw.Lexeme, raw.Kind, raw.Value)
+	}
+	if start, end := raw.Span.Start, raw.Span.End; start != (ast.Pos{Line: 1, Column: 2}) ||
+		end != (ast.Pos{Line: 2, Column: 12}) {
+		t.Errorf("expected the raw Omnidrone from 1:2 to 2:12, got %s to %s", start, end)
+	}
+
+	for _, broken := range []string{"`open\nline", "\"open\nline\""} {
+		lex, err := NewLexerFromString(broken, "input.mecha", false)
+		if err != nil {
+			t.Fatalf("failed to create lexer: %v", err)
+		}
+		if _, err := collect(t, &lex); err == nil {
+			t.Errorf("%q: expected an unterminated literal, got nil", broken)
+		}
+	}
+}
@@ -14,6 +14,7 @@ const (
 	TColon
 	TSingleQuote
 	TDoubleQuote
+	TBacktick
 
 	//	 Conditional and repetition tokens
 
@@ -29,6 +30,8 @@ const (
 	TCloseParentheses
 	TOpenBraces
 	TCloseBraces
+	TOpenBrackets
+	TCloseBrackets
 	TSingleLineComment
 	TOpenMultilineComment
 	TCloseMultilineComment
@@ -61,13 +64,23 @@ const (
 	TState
 	TMonodrone
 	TOmnidrone
+	TSwitch
+	TChannel
+	TAssembly
 	TTypeName
 	TId
 
+	//	 Value tokens
+
+	TTrue
+	TFalse
+
 	// Built-in functions
 
 	TSend
 	TReceive
+	TLength
+	TAppend
 
 	//	 Control tokens
 
@@ -105,13 +118,33 @@ const (
 	State     = "STATE"
 	Monodrone = "MONODRONE"
 	Omnidrone = "OMNIDRONE"
+	Switch    = "SWITCH"
+	Channel   = "CHANNEL"
+	Assembly  = "ASSEMBLY"
+
+	//	 Value tokens
+
+	True  = "TRUE"
+	False = "FALSE"
 
 	// Built-in functions
 
 	Send    = "SEND"
 	Receive = "RECEIVE"
+	Length  = "LENGTH"
+	Append  = "APPEND"
 )
 
+// Keywords lists every keyword above as it is usually written in the source. The lexer does not mind the case of
+// keywords, so this is only the spelling offered to the user.
+var Keywords = []string{
+	"Construct", "Architect", "Integrate",
+	"if", "else", "elif", "for", "Detach",
+	"Nil", "Gear", "Tensor", "State", "Monodrone", "Omnidrone", "Switch", "Channel", "Assembly",
+	"true", "false",
+	"Send", "Receive", "Length", "Append",
+}
+
 // Unique-symbol tokens
 const (
 	// Construction tokens
@@ -120,6 +153,8 @@ const (
 	Colon       = ':'
 	DoubleQuote = '"'
 	SingleQuote = '\''
+	Backtick    = '`'
+	Backslash   = '\\'
 
 	//	 Structure tokens
 
@@ -127,6 +162,8 @@ const (
 	CloseParentheses = ')'
 	OpenBraces       = '{'
 	CloseBraces      = '}'
+	OpenBrackets     = '['
+	CloseBrackets    = ']'
 
 	//	 Operators
 
@@ -173,6 +210,7 @@ const (
 	OutputComma     = "T_COMMA"
 	OutputColon     = "T_COLON"
 	OutputString    = "T_STRING"
+	OutputRawString = "T_RAW_STRING"
 
 	//   Conditional and repetition tokens
 
@@ -190,15 +228,25 @@ const (
 	OutputState     = "T_STATE"
 	OutputMonodrone = "T_MONODRONE"
 	OutputOmnidrone = "T_OMNIDRONE"
+	OutputSwitch    = "T_SWITCH"
+	OutputChannel   = "T_CHANNEL"
+	OutputAssembly  = "T_ASSEMBLY"
 	OutputTypeName  = "T_TYPE"
 	OutputId        = "T_ID"
 
+	//   Value tokens
+
+	OutputTrue  = "T_TRUE"
+	OutputFalse = "T_FALSE"
+
 	//   Structure tokens
 
 	OutputOpenParentheses       = "T_OPEN_PARENTHESES"
 	OutputCloseParentheses      = "T_CLOSE_PARENTHESES"
 	OutputOpenBraces            = "T_OPEN_BRACES"
 	OutputCloseBraces           = "T_CLOSE_BRACES"
+	OutputOpenBrackets          = "T_OPEN_BRACKETS"
+	OutputCloseBrackets         = "T_CLOSE_BRACKETS"
 	OutputSingleLineComment     = "T_SINGLE_LINE_COMMENT"
 	OutputOpenMultilineComment  = "T_OPEN_MULTILINE_COMMENT"
 	OutputCloseMultilineComment = "T_CLOSE_MULTILINE_COMMENT"
@@ -238,4 +286,6 @@ const (
 
 	OutputSend    = "T_SEND"
 	OutputReceive = "T_RECEIVE"
+	OutputLength  = "T_LENGTH"
+	OutputAppend  = "T_APPEND"
 )
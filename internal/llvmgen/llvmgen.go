@@ -0,0 +1,784 @@
+package llvmgen
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"mechanus-compiler/internal/ast"
+	"mechanus-compiler/internal/compiler_error"
+	"mechanus-compiler/internal/logger"
+	"mechanus-compiler/internal/semantic"
+	"os"
+	"strings"
+)
+
+// Generator :
+// This is the structure responsible for turning a checked Construct into a textual LLVM IR module. Every Architect
+// becomes a function and the C main function calls the "main" Architect, using the Gear it integrates as the exit
+// code of the process. The module only uses opaque pointers and leaves the target triple out, so llc and clang pick
+// the host target.
+//
+// Gears and States are i64, Tensors are double, Monodrones are i32 code points, Omnidrones are pointers to
+// NUL-terminated global string constants, Nil is an i8 that is always 0 and Assemblies are pointers to a header kept
+// by the runtime. Every variable and parameter lives in a
+// stack slot allocated in the entry block, which "opt -passes=mem2reg" turns into registers.
+type Generator struct {
+	logger *logger.Logger
+	info   *semantic.Info
+	output strings.Builder
+	// Omnidrone literals, emitted as global constants after the functions in the order they were first used
+	strings map[string]int
+	order   []string
+	// Tables of the member names of the State sets sent by the program, emitted after the Omnidrones
+	states     map[ast.Type]int
+	stateOrder []ast.Type
+	// State of the Architect being generated
+	slots      strings.Builder
+	code       strings.Builder
+	names      map[*semantic.Symbol]string
+	taken      map[string]int
+	temps      int
+	labels     int
+	terminated bool
+	result     ast.Type
+}
+
+// NewGenerator :
+// Initializes a new Generator instance. info must be the result of a successful semantic analysis of the Construct
+// that will be generated.
+func NewGenerator(info *semantic.Info, debug bool) Generator {
+	// Initialize the logger. Log to Stderr. Set level based on the debug flag.
+	logLevel := logger.LevelInfo
+	if debug {
+		logLevel = logger.LevelDebug
+	}
+
+	return Generator{
+		logger: logger.New(os.Stderr, logLevel),
+		info:   info,
+	}
+}
+
+// Run :
+// Generates the LLVM IR module for the given Construct.
+//
+// Fails if the Construct has no main Architect, or if it detaches an Architect or uses Channels, since the module
+// only calls into the C standard library, which has nothing to run two Architects at once.
+func (generator *Generator) Run(construct *ast.Construct) (string, error) {
+	generator.output.Reset()
+	generator.strings = make(map[string]int)
+	generator.order = nil
+	generator.states = make(map[ast.Type]int)
+	generator.stateOrder = nil
+
+	entry := generator.info.Main
+	if entry == nil {
+		err := compiler_error.CodegenErrorf(compiler_error.CodegenError, errors.New(compiler_error.MissingMain))
+		generator.logger.Error(err, nil)
+		return "", err
+	}
+
+	if generator.info.Concurrent {
+		unsupported := fmt.Errorf(compiler_error.Unsupported, "LLVM")
+		err := compiler_error.CodegenErrorf(compiler_error.CodegenError, unsupported)
+		generator.logger.Error(err, nil)
+		return "", err
+	}
+
+	header := fmt.Sprintf("; Generated from the %s Construct.\n", construct.Name)
+	header += fmt.Sprintf("source_filename = %s\n\n", stringLiteral(construct.Name))
+
+	// The parser stores the Architects bottom-to-top, so they are emitted in reverse to follow the source file
+	for i := len(construct.Architects) - 1; i >= 0; i-- {
+		generator.output.WriteString("\n")
+		generator.architect(construct.Architects[i])
+	}
+
+	generator.output.WriteString("\ndefine i32 @main() {\nentry:\n")
+	returnType := semantic.ReturnType(entry)
+	call := fmt.Sprintf("  %%code = call %s @%s()\n", irType(returnType), architectName(entry.Name))
+	generator.output.WriteString(call)
+	if returnType == ast.TypeGear {
+		generator.output.WriteString("  %exit = trunc i64 %code to i32\n")
+		generator.output.WriteString("  ret i32 %exit\n")
+	} else {
+		generator.output.WriteString("  ret i32 0\n")
+	}
+	generator.output.WriteString("}\n")
+
+	generator.literals()
+
+	// The runtime goes first, but only what the functions use is known once they are generated
+	module := generator.output.String()
+	generator.logger.Info(compiler_error.CodegenSuccess, nil)
+	return header + linkRuntime(module) + module, nil
+}
+
+//**********************************************************************************************************************
+// Architects and commands
+//**********************************************************************************************************************
+
+// architect :
+// Generates the function of a single Architect. The body is generated first, so the stack slots of every variable it
+// declares can be allocated at the top of the entry block. An Architect that reaches the end of its body without an
+// Integrate returns the zero value of its type.
+func (generator *Generator) architect(architect *ast.Architect) {
+	generator.logger.Debug("Generating Architect", map[string]any{"name": architect.Name})
+
+	generator.slots.Reset()
+	generator.code.Reset()
+	generator.names = make(map[*semantic.Symbol]string)
+	generator.taken = make(map[string]int)
+	generator.temps = 0
+	generator.labels = 0
+	generator.terminated = false
+	generator.result = semantic.ReturnType(architect)
+
+	parameters := make([]string, 0, len(architect.Parameters))
+	for i, parameter := range architect.Parameters {
+		t := irType(parameter.Type)
+		argument := fmt.Sprintf("%%arg.%d", i)
+		parameters = append(parameters, t+" "+argument)
+		generator.emit("store %s %s, ptr %s", t, argument, generator.slot(generator.info.Defs[parameter]))
+	}
+
+	generator.commands(architect.Body.Commands)
+	generator.emit("ret %s %s", irType(generator.result), generator.zeroValue(generator.result))
+
+	signature := fmt.Sprintf("%s @%s(%s)", irType(generator.result), architectName(architect.Name),
+		strings.Join(parameters, ", "))
+	generator.output.WriteString("define " + signature + " {\n")
+	generator.output.WriteString("entry:\n")
+	generator.output.WriteString(generator.slots.String())
+	generator.output.WriteString(generator.code.String())
+	generator.output.WriteString("}\n")
+}
+
+// block :
+// Generates the commands of a nested block.
+func (generator *Generator) block(block *ast.Block) {
+	generator.commands(block.Commands)
+}
+
+// commands :
+// Generates a list of commands. They are already stored in execution order.
+func (generator *Generator) commands(commands []ast.Command) {
+	for _, command := range commands {
+		generator.command(command)
+	}
+}
+
+// command :
+// Generates a single command.
+func (generator *Generator) command(command ast.Command) {
+	switch cmd := command.(type) {
+	case *ast.CmdIf:
+		end := generator.label()
+		next := generator.label()
+		generator.branch(cmd.Condition, next)
+		generator.block(cmd.Then)
+		generator.jump(end)
+		for _, elif := range cmd.Elifs {
+			generator.place(next)
+			next = generator.label()
+			generator.branch(elif.Condition, next)
+			generator.block(elif.Body)
+			generator.jump(end)
+		}
+		generator.place(next)
+		if cmd.Else != nil {
+			generator.block(cmd.Else)
+		}
+		generator.jump(end)
+		generator.place(end)
+	case *ast.CmdFor:
+		if cmd.Elements != nil {
+			generator.iteration(cmd)
+			break
+		}
+		start := generator.label()
+		end := generator.label()
+		generator.jump(start)
+		generator.place(start)
+		generator.branch(cmd.Condition, end)
+		generator.block(cmd.Body)
+		generator.jump(start)
+		generator.place(end)
+	case *ast.CmdDeclaration:
+		value := generator.value(cmd.Value, cmd.Type)
+		generator.emit("store %s %s, ptr %s", irType(cmd.Type), value, generator.slot(generator.info.Defs[cmd]))
+	case *ast.CmdAssignment:
+		symbol := generator.info.Uses[cmd]
+		if cmd.Index == nil {
+			value := generator.value(cmd.Value, symbol.Type)
+			generator.emit("store %s %s, ptr %s", irType(symbol.Type), value, generator.slot(symbol))
+			break
+		}
+		// The value is computed before the address of the element, since computing it may append to the Assembly
+		// and move its elements
+		element := symbol.Type.Element()
+		value := generator.value(cmd.Value, element)
+		index := generator.expr(cmd.Index)
+		assembly := generator.temp()
+		generator.emit("%s = load ptr, ptr %s", assembly, generator.slot(symbol))
+		generator.emit("store %s %s, ptr %s", irType(element), value, generator.at(assembly, index))
+	case *ast.CmdReceive:
+		symbol := generator.info.Uses[cmd]
+		value := generator.temp()
+		generator.emit("%s = call %s @mecha_receive_%s()", value, irType(symbol.Type), runtimeSuffix(symbol.Type))
+		generator.emit("store %s %s, ptr %s", irType(symbol.Type), value, generator.slot(symbol))
+	case *ast.CmdSend:
+		t := generator.info.Types[cmd.Value]
+		value := generator.expr(cmd.Value)
+		// A State is written as the name of its member, loaded from the table of the names of its set
+		if state, ok := generator.info.States[t]; ok {
+			address := generator.temp()
+			generator.emit("%s = getelementptr inbounds [%d x ptr], ptr %s, i64 0, i64 %s", address,
+				len(state.Members), generator.stateGlobal(t), value)
+			value = generator.temp()
+			generator.emit("%s = load ptr, ptr %s", value, address)
+			t = ast.TypeOmnidrone
+		}
+		generator.emit("call void @mecha_send_%s(%s %s)", runtimeSuffix(t), irType(t), value)
+	case *ast.CmdAppend:
+		element := generator.info.Types[cmd.Assembly].Element()
+		value := generator.value(cmd.Value, element)
+		assembly := generator.expr(cmd.Assembly)
+		address := generator.temp()
+		generator.emit("%s = call ptr @mecha_assembly_push(ptr %s)", address, assembly)
+		generator.emit("store %s %s, ptr %s", irType(element), value, address)
+	case *ast.CmdIntegrate:
+		value := generator.value(cmd.Value, generator.result)
+		generator.emit("ret %s %s", irType(generator.result), value)
+		generator.terminated = true
+	case *ast.CmdCall:
+		generator.expr(cmd.Call)
+	}
+}
+
+// iteration :
+// Generates a for over the elements of an Assembly. The Assembly and its length are taken once, before the loop, and
+// the index of the current element lives in a stack slot named after the label of the loop.
+func (generator *Generator) iteration(cmd *ast.CmdFor) {
+	element := generator.info.Types[cmd.Elements].Element()
+	assembly := generator.expr(cmd.Elements)
+	length := generator.temp()
+	generator.emit("%s = call i64 @mecha_assembly_length(ptr %s)", length, assembly)
+
+	start := generator.label()
+	body := generator.label()
+	end := generator.label()
+	slot := "%" + start + ".index"
+	generator.slots.WriteString(fmt.Sprintf("  %s = alloca i64\n", slot))
+	generator.emit("store i64 0, ptr %s", slot)
+	generator.jump(start)
+
+	generator.place(start)
+	index := generator.temp()
+	generator.emit("%s = load i64, ptr %s", index, slot)
+	more := generator.temp()
+	generator.emit("%s = icmp slt i64 %s, %s", more, index, length)
+	generator.emit("br i1 %s, label %%%s, label %%%s", more, body, end)
+	generator.terminated = true
+
+	generator.place(body)
+	value := generator.temp()
+	generator.emit("%s = load %s, ptr %s", value, irType(element), generator.at(assembly, index))
+	if element == ast.TypeGear && cmd.Type == ast.TypeTensor {
+		widened := generator.temp()
+		generator.emit("%s = sitofp i64 %s to double", widened, value)
+		value = widened
+	}
+	generator.emit("store %s %s, ptr %s", irType(cmd.Type), value, generator.slot(generator.info.Defs[cmd]))
+	generator.block(cmd.Body)
+	next := generator.temp()
+	generator.emit("%s = add i64 %s, 1", next, index)
+	generator.emit("store i64 %s, ptr %s", next, slot)
+	generator.jump(start)
+	generator.place(end)
+}
+
+// branch :
+// Evaluates the <CONDITION> of an if, elif or for and jumps to otherwise when it does not hold. Code generated next
+// runs when it holds.
+func (generator *Generator) branch(condition ast.Expr, otherwise string) {
+	holds := generator.label()
+	generator.branchTo(condition, holds, otherwise)
+	generator.place(holds)
+}
+
+// branchTo :
+// Ends the current basic block with a jump to then when the <CONDITION> holds and to otherwise when it does not. The
+// right side of '&&' and '||' gets a basic block of its own, which is only reached when the left side does not decide
+// the result, and '!' swaps the targets. Any other Switch is branched on directly.
+func (generator *Generator) branchTo(condition ast.Expr, then, otherwise string) {
+	if not, ok := condition.(*ast.UnaryExpr); ok {
+		generator.branchTo(not.Operand, otherwise, then)
+		return
+	}
+
+	logical, _ := condition.(*ast.BinaryExpr)
+	switch {
+	case logical != nil && logical.Operator == ast.OpAnd:
+		rhs := generator.label()
+		generator.branchTo(logical.Left, rhs, otherwise)
+		generator.place(rhs)
+		generator.branchTo(logical.Right, then, otherwise)
+	case logical != nil && logical.Operator == ast.OpOr:
+		rhs := generator.label()
+		generator.branchTo(logical.Left, then, rhs)
+		generator.place(rhs)
+		generator.branchTo(logical.Right, then, otherwise)
+	default:
+		generator.emit("br i1 %s, label %%%s, label %%%s", generator.expr(condition), then, otherwise)
+		generator.terminated = true
+	}
+}
+
+// switchValue :
+// Evaluates '&&' or '||' as a Switch. It branches like a <CONDITION>, so the right side is still skipped once the left
+// side decides the result, and a phi picks the result from the block the branch reached.
+func (generator *Generator) switchValue(logical *ast.BinaryExpr) string {
+	holds := generator.label()
+	fails := generator.label()
+	end := generator.label()
+	generator.branchTo(logical, holds, fails)
+	generator.place(holds)
+	generator.jump(end)
+	generator.place(fails)
+	generator.place(end)
+	value := generator.temp()
+	generator.emit("%s = phi i1 [true, %%%s], [false, %%%s]", value, holds, fails)
+	return value
+}
+
+//**********************************************************************************************************************
+// Expressions
+//**********************************************************************************************************************
+
+// condition :
+// Returns the i1 holding the result of a comparison. Numbers are widened to Tensors when one side is a Tensor, and
+// every Tensor comparison except '!=' is false when NaN is involved. Omnidrones are compared by content.
+func (generator *Generator) condition(condition ast.Expr) string {
+	comparison := condition.(*ast.BinaryExpr)
+	left := generator.info.Types[comparison.Left]
+	right := generator.info.Types[comparison.Right]
+
+	if left == ast.TypeTensor || right == ast.TypeTensor {
+		l := generator.value(comparison.Left, ast.TypeTensor)
+		r := generator.value(comparison.Right, ast.TypeTensor)
+		result := generator.temp()
+		generator.emit("%s = fcmp %s double %s, %s", result, floatPredicate(comparison.Operator), l, r)
+		return result
+	}
+
+	l := generator.expr(comparison.Left)
+	r := generator.expr(comparison.Right)
+	result := generator.temp()
+	if left != ast.TypeOmnidrone {
+		generator.emit("%s = icmp %s %s %s, %s", result, intPredicate(comparison.Operator), irType(left), l, r)
+		return result
+	}
+
+	generator.emit("%s = call i1 @mecha_omnidrone_equal(ptr %s, ptr %s)", result, l, r)
+	if comparison.Operator == ast.OpNotEqual {
+		equal := result
+		result = generator.temp()
+		generator.emit("%s = xor i1 %s, true", result, equal)
+	}
+	return result
+}
+
+// value :
+// Evaluates an expression that is stored where a value of type to is expected, widening a Gear into a Tensor.
+func (generator *Generator) value(expr ast.Expr, to ast.Type) string {
+	value := generator.expr(expr)
+	if generator.info.Types[expr] == ast.TypeGear && to == ast.TypeTensor {
+		widened := generator.temp()
+		generator.emit("%s = sitofp i64 %s to double", widened, value)
+		return widened
+	}
+	return value
+}
+
+// expr :
+// Evaluates an expression and returns the operand holding its value: a constant or a temporary. Operands and
+// arguments are evaluated from left to right.
+func (generator *Generator) expr(expr ast.Expr) string {
+	switch e := expr.(type) {
+	case *ast.GearLiteral:
+		return fmt.Sprintf("%d", e.Value)
+	case *ast.TensorLiteral:
+		return tensorLiteral(e.Value)
+	case *ast.MonodroneLiteral:
+		return fmt.Sprintf("%d", e.Value)
+	case *ast.OmnidroneLiteral:
+		return generator.stringGlobal(e.Value)
+	case *ast.SwitchLiteral:
+		return fmt.Sprintf("%t", e.Value)
+	case *ast.NilLiteral:
+		return "0"
+	case *ast.Identifier:
+		symbol := generator.info.Uses[e]
+		if symbol.Kind == semantic.SymbolMember {
+			return fmt.Sprintf("%d", symbol.Value)
+		}
+		value := generator.temp()
+		generator.emit("%s = load %s, ptr %s", value, irType(symbol.Type), generator.slot(symbol))
+		return value
+	case *ast.UnaryExpr:
+		operand := generator.expr(e.Operand)
+		value := generator.temp()
+		if e.Operator == ast.OpNot {
+			generator.emit("%s = xor i1 %s, true", value, operand)
+		} else if generator.info.Types[e] == ast.TypeTensor {
+			generator.emit("%s = fneg double %s", value, operand)
+		} else {
+			generator.emit("%s = sub i64 0, %s", value, operand)
+		}
+		return value
+	case *ast.BinaryExpr:
+		switch {
+		case e.Operator.IsLogical():
+			return generator.switchValue(e)
+		case e.Operator.IsComparison():
+			return generator.condition(e)
+		default:
+			return generator.arithmetic(e)
+		}
+	case *ast.CallExpr:
+		architect := generator.info.Calls[e]
+		arguments := make([]string, 0, len(e.Arguments))
+		for i, argument := range e.Arguments {
+			t := architect.Parameters[i].Type
+			arguments = append(arguments, irType(t)+" "+generator.value(argument, t))
+		}
+		value := generator.temp()
+		generator.emit("%s = call %s @%s(%s)", value, irType(semantic.ReturnType(architect)), architectName(e.Name),
+			strings.Join(arguments, ", "))
+		return value
+	case *ast.AssemblyLiteral:
+		return generator.assembly(e)
+	case *ast.IndexExpr:
+		index := generator.expr(e.Index)
+		assembly := generator.expr(e.Assembly)
+		value := generator.temp()
+		t := irType(generator.info.Types[e])
+		generator.emit("%s = load %s, ptr %s", value, t, generator.at(assembly, index))
+		return value
+	case *ast.LengthExpr:
+		assembly := generator.expr(e.Assembly)
+		value := generator.temp()
+		generator.emit("%s = call i64 @mecha_assembly_length(ptr %s)", value, assembly)
+		return value
+	}
+	return ""
+}
+
+// assembly :
+// Evaluates an Assembly literal. Its elements are evaluated first and then stored one by one into a new Assembly.
+func (generator *Generator) assembly(e *ast.AssemblyLiteral) string {
+	element := e.Type.Element()
+	values := make([]string, 0, len(e.Elements))
+	for _, value := range e.Elements {
+		values = append(values, generator.value(value, element))
+	}
+
+	assembly := generator.temp()
+	generator.emit("%s = call ptr @mecha_assembly_make(i64 %d, i64 %d)", assembly, elementSize(element),
+		len(values))
+	for i, value := range values {
+		generator.emit("store %s %s, ptr %s", irType(element), value, generator.at(assembly, fmt.Sprint(i)))
+	}
+	return assembly
+}
+
+// at :
+// Returns a temporary holding the address of an element of an Assembly, which the runtime checks is in range.
+func (generator *Generator) at(assembly, index string) string {
+	address := generator.temp()
+	generator.emit("%s = call ptr @mecha_assembly_at(ptr %s, i64 %s)", address, assembly, index)
+	return address
+}
+
+// arithmetic :
+// Evaluates an arithmetic operation. Gear division and modulo go through the runtime, which stops the program on a
+// division by zero.
+func (generator *Generator) arithmetic(e *ast.BinaryExpr) string {
+	t := generator.info.Types[e]
+	left := generator.value(e.Left, t)
+	right := generator.value(e.Right, t)
+	value := generator.temp()
+
+	switch {
+	case t == ast.TypeGear && e.Operator == ast.OpDiv:
+		generator.emit("%s = call i64 @mecha_gear_div(i64 %s, i64 %s)", value, left, right)
+	case t == ast.TypeGear && e.Operator == ast.OpMod:
+		generator.emit("%s = call i64 @mecha_gear_mod(i64 %s, i64 %s)", value, left, right)
+	default:
+		generator.emit("%s = %s %s %s, %s", value, instruction(e.Operator, t), irType(t), left, right)
+	}
+	return value
+}
+
+//**********************************************************************************************************************
+// Helpers
+//**********************************************************************************************************************
+
+// slot :
+// Returns the stack slot of a variable or parameter, allocating it in the entry block the first time. Every symbol
+// gets its own slot, so shadowed names never collide, and the ".addr" suffix keeps slots apart from temporaries.
+func (generator *Generator) slot(symbol *semantic.Symbol) string {
+	if name, ok := generator.names[symbol]; ok {
+		return name
+	}
+
+	name := "%" + symbol.Name + ".addr"
+	if count := generator.taken[symbol.Name]; count > 0 {
+		name = fmt.Sprintf("%s.%d", name, count)
+	}
+	generator.taken[symbol.Name]++
+	generator.names[symbol] = name
+	generator.slots.WriteString(fmt.Sprintf("  %s = alloca %s\n", name, irType(symbol.Type)))
+	return name
+}
+
+// temp :
+// Returns a new temporary.
+func (generator *Generator) temp() string {
+	generator.temps++
+	return fmt.Sprintf("%%t%d", generator.temps)
+}
+
+// label :
+// Returns a new basic block label.
+func (generator *Generator) label() string {
+	generator.labels++
+	return fmt.Sprintf("L%d", generator.labels)
+}
+
+// place :
+// Starts the basic block with the given label, ending the current one with a jump to it if it is still open.
+func (generator *Generator) place(label string) {
+	generator.jump(label)
+	generator.code.WriteString(label + ":\n")
+	generator.terminated = false
+}
+
+// jump :
+// Ends the current basic block with a jump, unless it already ended with a branch or a return.
+func (generator *Generator) jump(label string) {
+	if generator.terminated {
+		return
+	}
+	generator.code.WriteString(fmt.Sprintf("  br label %%%s\n", label))
+	generator.terminated = true
+}
+
+// emit :
+// Writes a single instruction. Code that follows an Integrate can never run, but it still needs a basic block of its
+// own, so one is opened for it.
+func (generator *Generator) emit(format string, args ...any) {
+	if generator.terminated {
+		generator.place(generator.label())
+	}
+	generator.code.WriteString("  " + fmt.Sprintf(format, args...) + "\n")
+}
+
+// stringGlobal :
+// Returns the global constant holding an Omnidrone.
+func (generator *Generator) stringGlobal(value string) string {
+	index, ok := generator.strings[value]
+	if !ok {
+		index = len(generator.order)
+		generator.strings[value] = index
+		generator.order = append(generator.order, value)
+	}
+	return fmt.Sprintf("@.str.%d", index)
+}
+
+// stateGlobal :
+// Returns the global constant holding the member names of a State set, as pointers to Omnidrone constants.
+func (generator *Generator) stateGlobal(t ast.Type) string {
+	index, ok := generator.states[t]
+	if !ok {
+		index = len(generator.stateOrder)
+		generator.states[t] = index
+		generator.stateOrder = append(generator.stateOrder, t)
+		for _, member := range generator.info.States[t].Members {
+			generator.stringGlobal(member.Name)
+		}
+	}
+	return fmt.Sprintf("@.state.%d", index)
+}
+
+// literals :
+// Writes the global constants of the Omnidrones and State tables used by the program.
+func (generator *Generator) literals() {
+	if len(generator.order) > 0 {
+		generator.output.WriteString("\n")
+	}
+	for i, value := range generator.order {
+		generator.output.WriteString(fmt.Sprintf("@.str.%d = private unnamed_addr constant [%d x i8] c%s\n", i,
+			len(value)+1, stringLiteral(value+"\x00")))
+	}
+	for i, t := range generator.stateOrder {
+		members := generator.info.States[t].Members
+		names := make([]string, 0, len(members))
+		for _, member := range members {
+			names = append(names, "ptr "+generator.stringGlobal(member.Name))
+		}
+		generator.output.WriteString(fmt.Sprintf("@.state.%d = private unnamed_addr constant [%d x ptr] [%s]\n", i,
+			len(members), strings.Join(names, ", ")))
+	}
+}
+
+// zeroValue :
+// Returns the value integrated by an Architect of the given type that reaches the end of its body. It is a constant,
+// except for the empty Assembly, which is made by the runtime.
+func (generator *Generator) zeroValue(t ast.Type) string {
+	if t.IsAssembly() {
+		value := generator.temp()
+		generator.emit("%s = call ptr @mecha_assembly_make(i64 %d, i64 0)", value, elementSize(t.Element()))
+		return value
+	}
+	switch t {
+	case ast.TypeTensor:
+		return tensorLiteral(0)
+	case ast.TypeOmnidrone:
+		return generator.stringGlobal("")
+	default:
+		return "0"
+	}
+}
+
+// architectName :
+// Returns the name of the function generated for an Architect. The prefix keeps Architects from clashing with the
+// runtime and with the C library.
+func architectName(name string) string {
+	return "mecha_architect_" + name
+}
+
+// irType :
+// Returns the LLVM type used for a Mechanus type.
+func irType(t ast.Type) string {
+	if t.IsAssembly() {
+		return "ptr"
+	}
+	switch t {
+	case ast.TypeTensor:
+		return "double"
+	case ast.TypeMonodrone:
+		return "i32"
+	case ast.TypeOmnidrone:
+		return "ptr"
+	case ast.TypeSwitch:
+		return "i1"
+	case ast.TypeNil:
+		return "i8"
+	default:
+		return "i64"
+	}
+}
+
+// elementSize :
+// Returns the number of bytes taken by an element of an Assembly of the given type, matching its irType.
+func elementSize(t ast.Type) int {
+	switch irType(t) {
+	case "i1", "i8":
+		return 1
+	case "i32":
+		return 4
+	default:
+		return 8
+	}
+}
+
+// runtimeSuffix :
+// Returns the lowercase type name used by the runtime functions, such as mecha_send_gear.
+func runtimeSuffix(t ast.Type) string {
+	return strings.ToLower(t.String())
+}
+
+// instruction :
+// Returns the instruction for an arithmetic operator on Gears or Tensors. Gear division and modulo are not listed,
+// since they go through the runtime.
+func instruction(operator ast.Operator, t ast.Type) string {
+	prefix := ""
+	if t == ast.TypeTensor {
+		prefix = "f"
+	}
+
+	switch operator {
+	case ast.OpAdd:
+		return prefix + "add"
+	case ast.OpSub:
+		return prefix + "sub"
+	case ast.OpMul:
+		return prefix + "mul"
+	default:
+		return "fdiv"
+	}
+}
+
+// intPredicate :
+// Returns the icmp predicate for a comparison.
+func intPredicate(operator ast.Operator) string {
+	switch operator {
+	case ast.OpGreater:
+		return "sgt"
+	case ast.OpGreaterEqual:
+		return "sge"
+	case ast.OpLess:
+		return "slt"
+	case ast.OpLessEqual:
+		return "sle"
+	case ast.OpEqual:
+		return "eq"
+	default:
+		return "ne"
+	}
+}
+
+// floatPredicate :
+// Returns the fcmp predicate for a comparison. Only '!=' is unordered, so it is the one that holds against NaN.
+func floatPredicate(operator ast.Operator) string {
+	switch operator {
+	case ast.OpGreater:
+		return "ogt"
+	case ast.OpGreaterEqual:
+		return "oge"
+	case ast.OpLess:
+		return "olt"
+	case ast.OpLessEqual:
+		return "ole"
+	case ast.OpEqual:
+		return "oeq"
+	default:
+		return "une"
+	}
+}
+
+// tensorLiteral :
+// Formats a Tensor as the hexadecimal form of its bits, the only one LLVM accepts for every double.
+func tensorLiteral(value float64) string {
+	return fmt.Sprintf("0x%016X", math.Float64bits(value))
+}
+
+// stringLiteral :
+// Quotes a string for LLVM IR. Anything outside printable ASCII, along with '"' and '\', is written as a hexadecimal
+// escape.
+func stringLiteral(value string) string {
+	var builder strings.Builder
+	builder.WriteByte('"')
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		if c < 0x20 || c >= 0x7F || c == '"' || c == '\\' {
+			builder.WriteString(fmt.Sprintf("\\%02X", c))
+			continue
+		}
+		builder.WriteByte(c)
+	}
+	builder.WriteByte('"')
+	return builder.String()
+}
@@ -0,0 +1,162 @@
+package llvmgen
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"mechanus-compiler/internal/mechatest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// update rewrites the golden files instead of comparing against them: go test ./internal/llvmgen -update
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// generateSource parses, analyzes and generates LLVM IR for the given source.
+func generateSource(t *testing.T, source string) (string, error) {
+	t.Helper()
+
+	construct, info := mechatest.Analyze(t, source)
+	generator := NewGenerator(info, false)
+	return generator.Run(construct)
+}
+
+// TestGenerator_MissingMain ensures that a Construct without a main Architect cannot be generated.
+func TestGenerator_MissingMain(t *testing.T) {
+	if _, err := generateSource(t, mechatest.MissingMain); err == nil {
+		t.Fatal("expected an error, got nil")
+	}
+}
+
+// TestGenerator_Golden compares the IR generated for every example program with its golden file in testdata.
+func TestGenerator_Golden(t *testing.T) {
+	paths, err := filepath.Glob("../../docs/examples/example*_input.mecha")
+	if err != nil || len(paths) == 0 {
+		t.Fatalf("no examples found: %v", err)
+	}
+
+	for _, path := range paths {
+		name := strings.TrimSuffix(filepath.Base(path), "_input.mecha")
+		t.Run(name, func(t *testing.T) {
+			source, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("failed to read %s: %v", path, err)
+			}
+			code, err := generateSource(t, string(source))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			golden := filepath.Join("testdata", name+".ll")
+			if *update {
+				if err := os.WriteFile(golden, []byte(code), 0o644); err != nil {
+					t.Fatalf("failed to write %s: %v", golden, err)
+				}
+				return
+			}
+
+			expected, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("failed to read %s: %v", golden, err)
+			}
+			if code != string(expected) {
+				t.Errorf("the IR for %s does not match %s, run the tests with -update if the change is intended",
+					path, golden)
+			}
+		})
+	}
+}
+
+// TestStringLiteral checks the escaping of Omnidrones.
+func TestStringLiteral(t *testing.T) {
+	tests := map[string]string{
+		`plain`:    `"plain"`,
+		`say "hi"`: `"say \22hi\22"`,
+		`back\`:    `"back\5C"`,
+		"line\n":   `"line\0A"`,
+		"olá":      `"ol\C3\A1"`,
+	}
+
+	for value, expected := range tests {
+		if got := stringLiteral(value); got != expected {
+			t.Errorf("stringLiteral(%q) = %s, expected %s", value, got, expected)
+		}
+	}
+}
+
+// TestLinkRuntime ensures that a module only gets the runtime it reaches, through the runtime functions it calls.
+func TestLinkRuntime(t *testing.T) {
+	linked := linkRuntime("  %t1 = call i64 @mecha_gear_div(i64 %t2, i64 %t3)\n")
+
+	for _, name := range []string{"@mecha_gear_div", "@mecha_fail", "@.mecha.division", "@.mecha.error", "@stderr",
+		"@fprintf", "@exit"} {
+		if !strings.Contains(linked, name+" ") && !strings.Contains(linked, name+"(") {
+			t.Errorf("expected %s to be linked", name)
+		}
+	}
+	for _, name := range []string{"%mecha.assembly", "@mecha_send_gear", "@mecha_read_line", "@printf"} {
+		if strings.Contains(linked, name) {
+			t.Errorf("expected %s to be left out", name)
+		}
+	}
+	if strings.Contains(linked, "\n\n\n") || !strings.HasSuffix(linked, "}\n") {
+		t.Errorf("expected the linked runtime to keep its layout, got:\n%s", linked)
+	}
+}
+
+// TestGenerator_Run runs the generated IR with the LLVM interpreter and checks what the program sends and
+// integrates. Skipped when lli is not installed.
+func TestGenerator_Run(t *testing.T) {
+	lli, err := exec.LookPath("lli")
+	if err != nil {
+		t.Skip("lli not found")
+	}
+
+	code, err := generateSource(t, mechatest.Program)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	source := filepath.Join(t.TempDir(), "program.ll")
+	if err := os.WriteFile(source, []byte(code), 0o644); err != nil {
+		t.Fatalf("failed to write IR: %v", err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	run := exec.Command(lli, append(opaquePointers(t, lli), source)...)
+	run.Stdin = strings.NewReader(mechatest.ProgramInput)
+	run.Stdout = &stdout
+	run.Stderr = &stderr
+	err = run.Run()
+
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != mechatest.ProgramExit {
+		t.Errorf("expected exit code %d, got %v\n%s", mechatest.ProgramExit, err, stderr.String())
+	}
+
+	if stdout.String() != mechatest.ProgramOutput {
+		t.Errorf("expected output %q, got %q", mechatest.ProgramOutput, stdout.String())
+	}
+}
+
+// opaquePointers returns the flag that LLVM releases before 15 need to read "ptr".
+func opaquePointers(t *testing.T, tool string) []string {
+	t.Helper()
+
+	output, err := exec.Command(tool, "--version").Output()
+	if err != nil {
+		t.Fatalf("failed to get the LLVM version: %v", err)
+	}
+	match := regexp.MustCompile(`LLVM version (\d+)`).FindSubmatch(output)
+	if match == nil {
+		return nil
+	}
+	if version, _ := strconv.Atoi(string(match[1])); version < 15 {
+		return []string{"-opaque-pointers"}
+	}
+	return nil
+}
@@ -0,0 +1,544 @@
+package llvmgen
+
+import (
+	"regexp"
+	"strings"
+)
+
+// runtime :
+// The LLVM IR placed at the top of the generated modules, which only keep the parts they use. It implements Send,
+// Receive and the checked Gear operations on top of the C library, so the generated functions only need plain
+// instructions and calls. The behaviour matches the runtime of the C backend:
+//   - Send prints the value followed by a newline; Tensors use the "%g" of printf.
+//   - Receive reads a line and fails with exit code 1 when it does not hold a valid value. Received Omnidrones live
+//     until the program exits.
+//   - Gear division and modulo by zero stop the program with exit code 1.
+//   - An Assembly is a pointer to a %mecha.assembly: its length, its capacity, the size of its elements and the
+//     elements themselves, grown with realloc. Indexing outside of it stops the program with exit code 1.
+//
+// errno is reached through __errno_location, which both glibc and musl provide.
+const runtime = `@stderr = external global ptr
+
+%mecha.assembly = type { i64, i64, i64, ptr }
+
+declare i32 @printf(ptr, ...)
+declare i32 @fprintf(ptr, ptr, ...)
+declare i32 @putchar(i32)
+declare i32 @getchar()
+declare i32 @fflush(ptr)
+declare ptr @malloc(i64)
+declare ptr @realloc(ptr, i64)
+declare void @free(ptr)
+declare i64 @strtoll(ptr, ptr, i32)
+declare double @strtod(ptr, ptr)
+declare i32 @strcmp(ptr, ptr)
+declare ptr @__errno_location()
+declare void @exit(i32)
+declare double @llvm.fabs.f64(double)
+
+@.mecha.gear = private unnamed_addr constant [6 x i8] c"%lld\0A\00"
+@.mecha.tensor = private unnamed_addr constant [4 x i8] c"%g\0A\00"
+@.mecha.omnidrone = private unnamed_addr constant [4 x i8] c"%s\0A\00"
+@.mecha.nil = private unnamed_addr constant [5 x i8] c"Nil\0A\00"
+@.mecha.true = private unnamed_addr constant [6 x i8] c"true\0A\00"
+@.mecha.false = private unnamed_addr constant [7 x i8] c"false\0A\00"
+@.mecha.error = private unnamed_addr constant [11 x i8] c"mecha: %s\0A\00"
+@.mecha.division = private unnamed_addr constant [17 x i8] c"division by zero\00"
+@.mecha.memory = private unnamed_addr constant [14 x i8] c"out of memory\00"
+@.mecha.range = private unnamed_addr constant [28 x i8] c"Assembly index out of range\00"
+@.mecha.invalid.gear = private unnamed_addr constant [19 x i8] c"invalid Gear input\00"
+@.mecha.invalid.tensor = private unnamed_addr constant [21 x i8] c"invalid Tensor input\00"
+@.mecha.invalid.monodrone = private unnamed_addr constant [24 x i8] c"invalid Monodrone input\00"
+
+define internal void @mecha_fail(ptr %message) noreturn {
+entry:
+  %flushed = call i32 @fflush(ptr null)
+  %stream = load ptr, ptr @stderr
+  %written = call i32 (ptr, ptr, ...) @fprintf(ptr %stream, ptr @.mecha.error, ptr %message)
+  call void @exit(i32 1)
+  unreachable
+}
+
+define internal i64 @mecha_gear_div(i64 %left, i64 %right) {
+entry:
+  %zero = icmp eq i64 %right, 0
+  br i1 %zero, label %fail, label %check
+fail:
+  call void @mecha_fail(ptr @.mecha.division)
+  unreachable
+check:
+  %minus = icmp eq i64 %right, -1
+  br i1 %minus, label %negate, label %divide
+negate:
+  ; INT64_MIN / -1 overflows sdiv, while the negation wraps back to INT64_MIN
+  %negated = sub i64 0, %left
+  ret i64 %negated
+divide:
+  %result = sdiv i64 %left, %right
+  ret i64 %result
+}
+
+define internal i64 @mecha_gear_mod(i64 %left, i64 %right) {
+entry:
+  %zero = icmp eq i64 %right, 0
+  br i1 %zero, label %fail, label %check
+fail:
+  call void @mecha_fail(ptr @.mecha.division)
+  unreachable
+check:
+  %minus = icmp eq i64 %right, -1
+  br i1 %minus, label %none, label %divide
+none:
+  ret i64 0
+divide:
+  %result = srem i64 %left, %right
+  ret i64 %result
+}
+
+define internal i1 @mecha_omnidrone_equal(ptr %left, ptr %right) {
+entry:
+  %order = call i32 @strcmp(ptr %left, ptr %right)
+  %equal = icmp eq i32 %order, 0
+  ret i1 %equal
+}
+
+; Makes an Assembly of length elements of the given size, which the generated code then stores.
+define internal ptr @mecha_assembly_make(i64 %size, i64 %length) {
+entry:
+  %assembly = call ptr @malloc(i64 32)
+  %missing = icmp eq ptr %assembly, null
+  br i1 %missing, label %memory, label %fill
+fill:
+  %bytes = mul i64 %size, %length
+  %elements = call ptr @malloc(i64 %bytes)
+  %empty = icmp eq ptr %elements, null
+  %needed = icmp ne i64 %bytes, 0
+  %lost = and i1 %empty, %needed
+  br i1 %lost, label %memory, label %done
+done:
+  %length.addr = getelementptr inbounds %mecha.assembly, ptr %assembly, i32 0, i32 0
+  store i64 %length, ptr %length.addr
+  %capacity.addr = getelementptr inbounds %mecha.assembly, ptr %assembly, i32 0, i32 1
+  store i64 %length, ptr %capacity.addr
+  %size.addr = getelementptr inbounds %mecha.assembly, ptr %assembly, i32 0, i32 2
+  store i64 %size, ptr %size.addr
+  %elements.addr = getelementptr inbounds %mecha.assembly, ptr %assembly, i32 0, i32 3
+  store ptr %elements, ptr %elements.addr
+  ret ptr %assembly
+memory:
+  call void @mecha_fail(ptr @.mecha.memory)
+  unreachable
+}
+
+; Returns the address of an element, which the generated code loads or stores with the type of the elements.
+define internal ptr @mecha_assembly_at(ptr %assembly, i64 %index) {
+entry:
+  %length.addr = getelementptr inbounds %mecha.assembly, ptr %assembly, i32 0, i32 0
+  %length = load i64, ptr %length.addr
+  %outside = icmp uge i64 %index, %length
+  br i1 %outside, label %fail, label %found
+fail:
+  call void @mecha_fail(ptr @.mecha.range)
+  unreachable
+found:
+  %size.addr = getelementptr inbounds %mecha.assembly, ptr %assembly, i32 0, i32 2
+  %size = load i64, ptr %size.addr
+  %elements.addr = getelementptr inbounds %mecha.assembly, ptr %assembly, i32 0, i32 3
+  %elements = load ptr, ptr %elements.addr
+  %offset = mul i64 %size, %index
+  %element = getelementptr i8, ptr %elements, i64 %offset
+  ret ptr %element
+}
+
+; Adds an element to the end of an Assembly and returns its address, so the generated code can store it.
+define internal ptr @mecha_assembly_push(ptr %assembly) {
+entry:
+  %length.addr = getelementptr inbounds %mecha.assembly, ptr %assembly, i32 0, i32 0
+  %length = load i64, ptr %length.addr
+  %capacity.addr = getelementptr inbounds %mecha.assembly, ptr %assembly, i32 0, i32 1
+  %capacity = load i64, ptr %capacity.addr
+  %size.addr = getelementptr inbounds %mecha.assembly, ptr %assembly, i32 0, i32 2
+  %size = load i64, ptr %size.addr
+  %elements.addr = getelementptr inbounds %mecha.assembly, ptr %assembly, i32 0, i32 3
+  %full = icmp eq i64 %length, %capacity
+  br i1 %full, label %grow, label %store
+grow:
+  %unused = icmp eq i64 %capacity, 0
+  %doubled = shl i64 %capacity, 1
+  %capacity.next = select i1 %unused, i64 4, i64 %doubled
+  store i64 %capacity.next, ptr %capacity.addr
+  %old = load ptr, ptr %elements.addr
+  %bytes = mul i64 %size, %capacity.next
+  %grown = call ptr @realloc(ptr %old, i64 %bytes)
+  %lost = icmp eq ptr %grown, null
+  br i1 %lost, label %memory, label %moved
+moved:
+  store ptr %grown, ptr %elements.addr
+  br label %store
+store:
+  %elements = load ptr, ptr %elements.addr
+  %offset = mul i64 %size, %length
+  %element = getelementptr i8, ptr %elements, i64 %offset
+  %length.next = add i64 %length, 1
+  store i64 %length.next, ptr %length.addr
+  ret ptr %element
+memory:
+  call void @mecha_fail(ptr @.mecha.memory)
+  unreachable
+}
+
+define internal i64 @mecha_assembly_length(ptr %assembly) {
+entry:
+  %length.addr = getelementptr inbounds %mecha.assembly, ptr %assembly, i32 0, i32 0
+  %length = load i64, ptr %length.addr
+  ret i64 %length
+}
+
+define internal void @mecha_send_gear(i64 %value) {
+entry:
+  %written = call i32 (ptr, ...) @printf(ptr @.mecha.gear, i64 %value)
+  ret void
+}
+
+define internal void @mecha_send_state(i64 %value) {
+entry:
+  call void @mecha_send_gear(i64 %value)
+  ret void
+}
+
+define internal void @mecha_send_tensor(double %value) {
+entry:
+  %written = call i32 (ptr, ...) @printf(ptr @.mecha.tensor, double %value)
+  ret void
+}
+
+define internal void @mecha_send_omnidrone(ptr %value) {
+entry:
+  %written = call i32 (ptr, ...) @printf(ptr @.mecha.omnidrone, ptr %value)
+  ret void
+}
+
+define internal void @mecha_send_nil(i8 %value) {
+entry:
+  %written = call i32 (ptr, ...) @printf(ptr @.mecha.nil)
+  ret void
+}
+
+define internal void @mecha_send_switch(i1 %value) {
+entry:
+  %text = select i1 %value, ptr @.mecha.true, ptr @.mecha.false
+  %written = call i32 (ptr, ...) @printf(ptr %text)
+  ret void
+}
+
+define internal void @mecha_send_monodrone(i32 %value) {
+entry:
+  %one = icmp ult i32 %value, 128
+  br i1 %one, label %ascii, label %two.check
+ascii:
+  %ascii.written = call i32 @putchar(i32 %value)
+  br label %done
+two.check:
+  %two = icmp ult i32 %value, 2048
+  br i1 %two, label %two.lead, label %three.check
+two.lead:
+  %two.shifted = lshr i32 %value, 6
+  %two.byte = or i32 %two.shifted, 192
+  %two.written = call i32 @putchar(i32 %two.byte)
+  br label %last
+three.check:
+  %three = icmp ult i32 %value, 65536
+  br i1 %three, label %three.lead, label %four.lead
+three.lead:
+  %three.shifted = lshr i32 %value, 12
+  %three.byte = or i32 %three.shifted, 224
+  %three.written = call i32 @putchar(i32 %three.byte)
+  br label %middle
+four.lead:
+  %four.shifted = lshr i32 %value, 18
+  %four.byte = or i32 %four.shifted, 240
+  %four.written = call i32 @putchar(i32 %four.byte)
+  %second.shifted = lshr i32 %value, 12
+  %second.bits = and i32 %second.shifted, 63
+  %second.byte = or i32 %second.bits, 128
+  %second.written = call i32 @putchar(i32 %second.byte)
+  br label %middle
+middle:
+  %middle.shifted = lshr i32 %value, 6
+  %middle.bits = and i32 %middle.shifted, 63
+  %middle.byte = or i32 %middle.bits, 128
+  %middle.written = call i32 @putchar(i32 %middle.byte)
+  br label %last
+last:
+  %last.bits = and i32 %value, 63
+  %last.byte = or i32 %last.bits, 128
+  %last.written = call i32 @putchar(i32 %last.byte)
+  br label %done
+done:
+  %newline = call i32 @putchar(i32 10)
+  ret void
+}
+
+; Reads a single line from stdin without its line ending.
+define internal ptr @mecha_read_line() {
+entry:
+  %first = call ptr @malloc(i64 64)
+  %missing = icmp eq ptr %first, null
+  br i1 %missing, label %memory, label %loop
+loop:
+  %line = phi ptr [ %first, %entry ], [ %line.next, %store ]
+  %length = phi i64 [ 0, %entry ], [ %length.next, %store ]
+  %capacity = phi i64 [ 64, %entry ], [ %capacity.next, %store ]
+  %c = call i32 @getchar()
+  %eof = icmp eq i32 %c, -1
+  %newline = icmp eq i32 %c, 10
+  %stop = or i1 %eof, %newline
+  br i1 %stop, label %end, label %room
+room:
+  %used = add i64 %length, 1
+  %full = icmp uge i64 %used, %capacity
+  br i1 %full, label %grow, label %store
+grow:
+  %doubled = shl i64 %capacity, 1
+  %grown = call ptr @realloc(ptr %line, i64 %doubled)
+  %lost = icmp eq ptr %grown, null
+  br i1 %lost, label %memory, label %store
+store:
+  %line.next = phi ptr [ %line, %room ], [ %grown, %grow ]
+  %capacity.next = phi i64 [ %capacity, %room ], [ %doubled, %grow ]
+  %slot = getelementptr i8, ptr %line.next, i64 %length
+  %byte = trunc i32 %c to i8
+  store i8 %byte, ptr %slot
+  %length.next = add i64 %length, 1
+  br label %loop
+end:
+  %empty = icmp eq i64 %length, 0
+  br i1 %empty, label %terminate, label %carriage
+carriage:
+  %last = sub i64 %length, 1
+  %last.slot = getelementptr i8, ptr %line, i64 %last
+  %last.byte = load i8, ptr %last.slot
+  %return = icmp eq i8 %last.byte, 13
+  %trimmed = select i1 %return, i64 %last, i64 %length
+  br label %terminate
+terminate:
+  %size = phi i64 [ 0, %end ], [ %trimmed, %carriage ]
+  %nul = getelementptr i8, ptr %line, i64 %size
+  store i8 0, ptr %nul
+  ret ptr %line
+memory:
+  call void @mecha_fail(ptr @.mecha.memory)
+  unreachable
+}
+
+define internal i64 @mecha_receive_gear() {
+entry:
+  %end = alloca ptr
+  %line = call ptr @mecha_read_line()
+  %errno = call ptr @__errno_location()
+  store i32 0, ptr %errno
+  %value = call i64 @strtoll(ptr %line, ptr %end, i32 10)
+  %stop = load ptr, ptr %end
+  %nothing = icmp eq ptr %stop, %line
+  %rest = load i8, ptr %stop
+  %trailing = icmp ne i8 %rest, 0
+  %code = load i32, ptr %errno
+  %range = icmp ne i32 %code, 0
+  %partial = or i1 %nothing, %trailing
+  %invalid = or i1 %partial, %range
+  br i1 %invalid, label %fail, label %valid
+fail:
+  call void @mecha_fail(ptr @.mecha.invalid.gear)
+  unreachable
+valid:
+  call void @free(ptr %line)
+  ret i64 %value
+}
+
+define internal i64 @mecha_receive_state() {
+entry:
+  %value = call i64 @mecha_receive_gear()
+  ret i64 %value
+}
+
+define internal double @mecha_receive_tensor() {
+entry:
+  %end = alloca ptr
+  %line = call ptr @mecha_read_line()
+  %errno = call ptr @__errno_location()
+  store i32 0, ptr %errno
+  %value = call double @strtod(ptr %line, ptr %end)
+  %stop = load ptr, ptr %end
+  %nothing = icmp eq ptr %stop, %line
+  %rest = load i8, ptr %stop
+  %trailing = icmp ne i8 %rest, 0
+  ; Only an overflow is rejected: a value too small for a normal double still reads as the closest one
+  %code = load i32, ptr %errno
+  %range = icmp ne i32 %code, 0
+  %magnitude = call double @llvm.fabs.f64(double %value)
+  %infinite = fcmp oeq double %magnitude, 0x7FF0000000000000
+  %overflow = and i1 %range, %infinite
+  %partial = or i1 %nothing, %trailing
+  %invalid = or i1 %partial, %overflow
+  br i1 %invalid, label %fail, label %valid
+fail:
+  call void @mecha_fail(ptr @.mecha.invalid.tensor)
+  unreachable
+valid:
+  call void @free(ptr %line)
+  ret double %value
+}
+
+define internal i32 @mecha_receive_monodrone() {
+entry:
+  %line = call ptr @mecha_read_line()
+  %lead.byte = load i8, ptr %line
+  %lead = zext i8 %lead.byte to i32
+  %empty = icmp eq i32 %lead, 0
+  br i1 %empty, label %fail, label %one.check
+one.check:
+  %one = icmp ult i32 %lead, 128
+  br i1 %one, label %decoded, label %two.check
+two.check:
+  %two.tag = and i32 %lead, 224
+  %two = icmp eq i32 %two.tag, 192
+  %two.bits = and i32 %lead, 31
+  br i1 %two, label %continuation, label %three.check
+three.check:
+  %three.tag = and i32 %lead, 240
+  %three = icmp eq i32 %three.tag, 224
+  %three.bits = and i32 %lead, 15
+  br i1 %three, label %continuation, label %four.check
+four.check:
+  %four.tag = and i32 %lead, 248
+  %four = icmp eq i32 %four.tag, 240
+  %four.bits = and i32 %lead, 7
+  br i1 %four, label %continuation, label %fail
+continuation:
+  %start = phi i32 [ %two.bits, %two.check ], [ %three.bits, %three.check ], [ %four.bits, %four.check ]
+  %size = phi i64 [ 2, %two.check ], [ 3, %three.check ], [ 4, %four.check ]
+  br label %loop
+loop:
+  %i = phi i64 [ 1, %continuation ], [ %i.next, %next ]
+  %value = phi i32 [ %start, %continuation ], [ %value.next, %next ]
+  %complete = icmp eq i64 %i, %size
+  br i1 %complete, label %decoded, label %next
+next:
+  %slot = getelementptr i8, ptr %line, i64 %i
+  %byte.raw = load i8, ptr %slot
+  %byte = zext i8 %byte.raw to i32
+  %tag = and i32 %byte, 192
+  %valid.byte = icmp eq i32 %tag, 128
+  %shifted = shl i32 %value, 6
+  %bits = and i32 %byte, 63
+  %value.next = or i32 %shifted, %bits
+  %i.next = add i64 %i, 1
+  br i1 %valid.byte, label %loop, label %fail
+decoded:
+  %result = phi i32 [ %lead, %one.check ], [ %value, %loop ]
+  %length = phi i64 [ 1, %one.check ], [ %size, %loop ]
+  %tail.slot = getelementptr i8, ptr %line, i64 %length
+  %tail = load i8, ptr %tail.slot
+  %extra = icmp ne i8 %tail, 0
+  br i1 %extra, label %fail, label %valid
+fail:
+  call void @mecha_fail(ptr @.mecha.invalid.monodrone)
+  unreachable
+valid:
+  call void @free(ptr %line)
+  ret i32 %result
+}
+
+define internal ptr @mecha_receive_omnidrone() {
+entry:
+  %line = call ptr @mecha_read_line()
+  ret ptr %line
+}
+`
+
+// runtimeItem :
+// A declaration of the runtime: a type, a global, a function of the C library or a function of the runtime with the
+// comments above it. section is the index of the group of declarations it belongs to, which are separated by blank
+// lines in the module.
+type runtimeItem struct {
+	name    string
+	text    string
+	section int
+}
+
+// runtimeName matches the names of types, globals and functions. It also matches local values, which are never the
+// name of a runtimeItem.
+var runtimeName = regexp.MustCompile(`[@%][A-Za-z_.$][A-Za-z0-9_.$]*`)
+
+// runtimeItems holds every declaration of runtime, in order.
+var runtimeItems = splitRuntime()
+
+// splitRuntime :
+// Splits runtime into its declarations. A group of one-line declarations gives one runtimeItem per line, and a
+// function gives a single runtimeItem, named after the first name on its first line that is not a comment.
+func splitRuntime() []runtimeItem {
+	var items []runtimeItem
+	for section, text := range strings.Split(strings.TrimSuffix(runtime, "\n"), "\n\n") {
+		declarations := []string{text}
+		if !strings.Contains(text, "define ") {
+			declarations = strings.Split(text, "\n")
+		}
+		for _, declaration := range declarations {
+			first := declaration
+			for strings.HasPrefix(first, ";") {
+				_, first, _ = strings.Cut(first, "\n")
+			}
+			first, _, _ = strings.Cut(first, "\n")
+			items = append(items, runtimeItem{name: runtimeName.FindString(first), text: declaration, section: section})
+		}
+	}
+	return items
+}
+
+// linkRuntime :
+// Returns the part of runtime that the given module needs: the declarations it names, and the ones those name in
+// turn. They keep the order they have in runtime, so unused functions are left out without moving the rest.
+func linkRuntime(module string) string {
+	byName := make(map[string]runtimeItem, len(runtimeItems))
+	for _, item := range runtimeItems {
+		byName[item.name] = item
+	}
+
+	used := make(map[string]bool)
+	pending := runtimeName.FindAllString(module, -1)
+	for len(pending) > 0 {
+		name := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		item, ok := byName[name]
+		if !ok || used[name] {
+			continue
+		}
+		used[name] = true
+		pending = append(pending, runtimeName.FindAllString(item.text, -1)...)
+	}
+
+	var sections []string
+	var section strings.Builder
+	last := -1
+	for _, item := range runtimeItems {
+		if !used[item.name] {
+			continue
+		}
+		if item.section != last && section.Len() > 0 {
+			sections = append(sections, section.String())
+			section.Reset()
+		}
+		last = item.section
+		if section.Len() > 0 {
+			section.WriteString("\n")
+		}
+		section.WriteString(item.text)
+	}
+	if section.Len() > 0 {
+		sections = append(sections, section.String())
+	}
+	if len(sections) == 0 {
+		return ""
+	}
+	return strings.Join(sections, "\n\n") + "\n"
+}
@@ -0,0 +1,32 @@
+; Generated from the main Construct.
+source_filename = "main"
+
+declare i32 @printf(ptr, ...)
+
+@.mecha.omnidrone = private unnamed_addr constant [4 x i8] c"%s\0A\00"
+
+define internal void @mecha_send_omnidrone(ptr %value) {
+entry:
+  %written = call i32 (ptr, ...) @printf(ptr @.mecha.omnidrone, ptr %value)
+  ret void
+}
+
+define i64 @mecha_architect_main() {
+entry:
+  %text.addr = alloca ptr
+  store ptr @.str.0, ptr %text.addr
+  %t1 = load ptr, ptr %text.addr
+  call void @mecha_send_omnidrone(ptr %t1)
+  ret i64 0
+L1:
+  ret i64 0
+}
+
+define i32 @main() {
+entry:
+  %code = call i64 @mecha_architect_main()
+  %exit = trunc i64 %code to i32
+  ret i32 %exit
+}
+
+@.str.0 = private unnamed_addr constant [14 x i8] c"Hello, world!\00"
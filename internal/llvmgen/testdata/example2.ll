@@ -0,0 +1,50 @@
+; Generated from the main Construct.
+source_filename = "main"
+
+declare i32 @printf(ptr, ...)
+
+@.mecha.omnidrone = private unnamed_addr constant [4 x i8] c"%s\0A\00"
+
+define internal void @mecha_send_omnidrone(ptr %value) {
+entry:
+  %written = call i32 (ptr, ...) @printf(ptr @.mecha.omnidrone, ptr %value)
+  ret void
+}
+
+define i64 @mecha_architect_test(i64 %arg.0) {
+entry:
+  %x.addr = alloca i64
+  store i64 %arg.0, ptr %x.addr
+  %t1 = load i64, ptr %x.addr
+  %t2 = icmp sle i64 %t1, 2
+  br i1 %t2, label %L3, label %L2
+L3:
+  %t3 = load i64, ptr %x.addr
+  %t4 = sub i64 %t3, 1
+  %t5 = call i64 @mecha_architect_test(i64 %t4)
+  ret i64 1
+L2:
+  br label %L1
+L1:
+  ret i64 0
+}
+
+define i64 @mecha_architect_main() {
+entry:
+  %text.addr = alloca ptr
+  store ptr @.str.0, ptr %text.addr
+  %t1 = load ptr, ptr %text.addr
+  call void @mecha_send_omnidrone(ptr %t1)
+  ret i64 0
+L1:
+  ret i64 0
+}
+
+define i32 @main() {
+entry:
+  %code = call i64 @mecha_architect_main()
+  %exit = trunc i64 %code to i32
+  ret i32 %exit
+}
+
+@.str.0 = private unnamed_addr constant [14 x i8] c"Hello, world!\00"
@@ -0,0 +1,62 @@
+; Generated from the main Construct.
+source_filename = "main"
+
+declare i32 @printf(ptr, ...)
+
+@.mecha.tensor = private unnamed_addr constant [4 x i8] c"%g\0A\00"
+@.mecha.omnidrone = private unnamed_addr constant [4 x i8] c"%s\0A\00"
+
+define internal void @mecha_send_tensor(double %value) {
+entry:
+  %written = call i32 (ptr, ...) @printf(ptr @.mecha.tensor, double %value)
+  ret void
+}
+
+define internal void @mecha_send_omnidrone(ptr %value) {
+entry:
+  %written = call i32 (ptr, ...) @printf(ptr @.mecha.omnidrone, ptr %value)
+  ret void
+}
+
+define i64 @mecha_architect_test(double %arg.0, i64 %arg.1) {
+entry:
+  %y.addr = alloca double
+  %x.addr = alloca i64
+  store double %arg.0, ptr %y.addr
+  store i64 %arg.1, ptr %x.addr
+  %t1 = load double, ptr %y.addr
+  call void @mecha_send_tensor(double %t1)
+  %t2 = load i64, ptr %x.addr
+  %t3 = icmp sle i64 %t2, 2
+  br i1 %t3, label %L3, label %L2
+L3:
+  %t4 = load double, ptr %y.addr
+  %t5 = load i64, ptr %x.addr
+  %t6 = sub i64 %t5, 1
+  %t7 = call i64 @mecha_architect_test(double %t4, i64 %t6)
+  ret i64 1
+L2:
+  br label %L1
+L1:
+  ret i64 0
+}
+
+define i64 @mecha_architect_main() {
+entry:
+  %text.addr = alloca ptr
+  store ptr @.str.0, ptr %text.addr
+  %t1 = load ptr, ptr %text.addr
+  call void @mecha_send_omnidrone(ptr %t1)
+  ret i64 0
+L1:
+  ret i64 0
+}
+
+define i32 @main() {
+entry:
+  %code = call i64 @mecha_architect_main()
+  %exit = trunc i64 %code to i32
+  ret i32 %exit
+}
+
+@.str.0 = private unnamed_addr constant [14 x i8] c"Hello, world!\00"
@@ -0,0 +1,89 @@
+; Generated from the main Construct.
+source_filename = "main"
+
+declare i32 @printf(ptr, ...)
+
+@.mecha.omnidrone = private unnamed_addr constant [4 x i8] c"%s\0A\00"
+
+define internal void @mecha_send_omnidrone(ptr %value) {
+entry:
+  %written = call i32 (ptr, ...) @printf(ptr @.mecha.omnidrone, ptr %value)
+  ret void
+}
+
+define i64 @mecha_architect_outside(i64 %arg.0) {
+entry:
+  %x.addr = alloca i64
+  store i64 %arg.0, ptr %x.addr
+  %t1 = load i64, ptr %x.addr
+  %t2 = icmp slt i64 %t1, 0
+  br i1 %t2, label %L3, label %L4
+L4:
+  %t3 = load i64, ptr %x.addr
+  %t4 = icmp sgt i64 %t3, 10
+  br i1 %t4, label %L3, label %L2
+L3:
+  ret i64 1
+L2:
+  br label %L1
+L1:
+  ret i64 0
+L5:
+  ret i64 0
+}
+
+define i64 @mecha_architect_main() {
+entry:
+  %text.addr = alloca ptr
+  %x.addr = alloca i64
+  %y.addr = alloca i64
+  store ptr @.str.0, ptr %text.addr
+  store i64 0, ptr %x.addr
+  store i64 1, ptr %y.addr
+  br label %L1
+L1:
+  %t1 = load i64, ptr %x.addr
+  %t2 = icmp slt i64 %t1, 2
+  br i1 %t2, label %L4, label %L2
+L4:
+  %t3 = load i64, ptr %y.addr
+  %t4 = icmp eq i64 %t3, 0
+  br i1 %t4, label %L2, label %L3
+L3:
+  %t5 = load i64, ptr %x.addr
+  %t6 = add i64 %t5, 1
+  store i64 %t6, ptr %x.addr
+  br label %L1
+L2:
+  %t7 = load i64, ptr %x.addr
+  %t8 = icmp sgt i64 %t7, 1
+  br i1 %t8, label %L9, label %L6
+L9:
+  %t9 = load i64, ptr %y.addr
+  %t10 = icmp slt i64 %t9, 2
+  br i1 %t10, label %L8, label %L6
+L8:
+  %t11 = load i64, ptr %x.addr
+  %t12 = call i64 @mecha_architect_outside(i64 %t11)
+  %t13 = icmp eq i64 %t12, 1
+  br i1 %t13, label %L6, label %L7
+L7:
+  %t14 = load ptr, ptr %text.addr
+  call void @mecha_send_omnidrone(ptr %t14)
+  br label %L5
+L6:
+  br label %L5
+L5:
+  ret i64 0
+L10:
+  ret i64 0
+}
+
+define i32 @main() {
+entry:
+  %code = call i64 @mecha_architect_main()
+  %exit = trunc i64 %code to i32
+  ret i32 %exit
+}
+
+@.str.0 = private unnamed_addr constant [14 x i8] c"Hello, world!\00"
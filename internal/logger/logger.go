@@ -2,6 +2,7 @@ package logger
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -40,6 +41,12 @@ func (l LogLevel) String() string {
 	}
 }
 
+// Reported is implemented by errors that the program shows to the user on its own, such as the diagnostics of the
+// compiler. Error logs them at LevelDebug, so they are not printed twice.
+type Reported interface {
+	Reported()
+}
+
 // Logger represents an active logging object that generates lines of JSON output to an io.Writer.
 type Logger struct {
 	out      io.Writer
@@ -118,7 +125,13 @@ func (l *Logger) Error(err error, properties map[string]any) {
 		properties = make(map[string]any)
 	}
 	properties["error"] = err.Error()
-	l.print(LevelError, "an error occurred", properties)
+
+	level := LevelError
+	var reported Reported
+	if errors.As(err, &reported) {
+		level = LevelDebug
+	}
+	l.print(level, "an error occurred", properties)
 }
 
 func (l *Logger) Fatal(err error, properties map[string]any) {
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"strings"
 	"sync"
 	"testing"
@@ -213,3 +214,31 @@ func TestLogger_JsonMarshalFailure(t *testing.T) {
 		t.Errorf("expected fallback log to contain '%s', but got: %s", expectedError, output)
 	}
 }
+
+// reportedError is an error shown to the user by other means than the logger.
+type reportedError struct{}
+
+func (reportedError) Error() string { return "reported" }
+func (reportedError) Reported()     {}
+
+// TestLogger_ReportedError ensures that errors implementing Reported are only logged in debug mode, even when wrapped.
+func TestLogger_ReportedError(t *testing.T) {
+	var buf bytes.Buffer
+	log := New(&buf, LevelInfo)
+
+	log.Error(fmt.Errorf("context -> %w", reportedError{}), nil)
+	if buf.Len() != 0 {
+		t.Errorf("expected a reported error to be suppressed at LevelInfo, but got: %s", buf.String())
+	}
+
+	log = New(&buf, LevelDebug)
+	log.Error(reportedError{}, nil)
+
+	var entry logEntry
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("failed to unmarshal log output: %v", err)
+	}
+	if entry.Level != LevelDebug.String() {
+		t.Errorf("expected level %s, got %s", LevelDebug, entry.Level)
+	}
+}
@@ -0,0 +1,252 @@
+package lsp
+
+import (
+	"fmt"
+	"mechanus-compiler/internal/ast"
+	"mechanus-compiler/internal/compiler_error"
+	"mechanus-compiler/internal/parser"
+	"mechanus-compiler/internal/semantic"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// document :
+// An open document and the result of its last analysis.
+type document struct {
+	uri         string
+	lines       []string
+	construct   *ast.Construct
+	info        *semantic.Info
+	diagnostics []*compiler_error.Diagnostic
+	references  []reference
+}
+
+// reference :
+// A name in the source: where it is, where it was declared and what to show when hovering it. Declarations refer to
+// themselves.
+type reference struct {
+	position ast.Pos
+	name     string
+	target   ast.Pos
+	hover    string
+}
+
+// analyze :
+// Runs the syntax and semantic analyses over the text of a document. The parser recovers from syntax errors, so the
+// Architects it could read still get their names resolved, but semantic errors are only reported for a document
+// without syntax errors, since the missing commands would make them wrong.
+//
+// Fails if the text cannot be handed to the parser.
+func analyze(uri, text string) (*document, error) {
+	doc := &document{uri: uri, lines: strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")}
+	if strings.TrimSpace(text) == "" {
+		return doc, nil
+	}
+
+	syntax, err := parser.NewParser(strings.NewReader(text), uri, false)
+	if err != nil {
+		return nil, err
+	}
+	construct, err := syntax.Run()
+	doc.diagnostics = compiler_error.Diagnostics(err)
+	if construct == nil {
+		return doc, nil
+	}
+	doc.construct = construct
+
+	analyzer := semantic.NewAnalyzer(false)
+	info, err := analyzer.Run(construct)
+	if len(doc.diagnostics) == 0 {
+		doc.diagnostics = compiler_error.Diagnostics(err)
+	}
+	doc.info = info
+	doc.index()
+
+	return doc, nil
+}
+
+// index :
+// Collects every name of the tree that the semantic analysis could resolve.
+func (doc *document) index() {
+	addSymbol := func(at ast.Pos, name string, symbol *semantic.Symbol) {
+		if symbol == nil {
+			return
+		}
+		doc.references = append(doc.references, reference{
+			position: at,
+			name:     name,
+			target:   symbol.Position,
+			hover:    doc.symbolHover(symbol),
+		})
+	}
+	addArchitect := func(at ast.Pos, name string, architect *ast.Architect) {
+		if architect == nil {
+			return
+		}
+		doc.references = append(doc.references, reference{
+			position: at,
+			name:     name,
+			target:   architect.NamePosition,
+			hover:    doc.architectHover(architect),
+		})
+	}
+
+	ast.Inspect(doc.construct, func(node ast.Node) bool {
+		switch n := node.(type) {
+		case *ast.Architect:
+			addArchitect(n.NamePosition, n.Name, n)
+		case *ast.StateMember:
+			addSymbol(n.Position, n.Name, doc.info.Defs[n])
+		case *ast.Parameter:
+			addSymbol(n.Position, n.Name, doc.info.Defs[n])
+		case *ast.CmdDeclaration:
+			addSymbol(n.Position, n.Name, doc.info.Defs[n])
+		case *ast.CmdFor:
+			addSymbol(n.NamePosition, n.Name, doc.info.Defs[n])
+		case *ast.Identifier:
+			addSymbol(n.Position, n.Name, doc.info.Uses[n])
+		case *ast.CmdAssignment:
+			addSymbol(n.Position, n.Name, doc.info.Uses[n])
+		case *ast.CmdReceive:
+			addSymbol(n.NamePosition, n.Name, doc.info.Uses[n])
+		case *ast.CallExpr:
+			addArchitect(n.Position, n.Name, doc.info.Calls[n])
+		}
+		return true
+	})
+}
+
+// referenceAt :
+// Returns the name found at a position, or nil if there is none.
+func (doc *document) referenceAt(at ast.Pos) *reference {
+	for i, ref := range doc.references {
+		if ref.position.Line == at.Line && at.Column >= ref.position.Column &&
+			at.Column < ref.position.Column+utf8.RuneCountInString(ref.name) {
+			return &doc.references[i]
+		}
+	}
+	return nil
+}
+
+// symbolHover :
+// Describes a variable, a parameter or a State member as it was declared.
+func (doc *document) symbolHover(symbol *semantic.Symbol) string {
+	return fmt.Sprintf("```mecha\n%s :%s\n```\n%s", doc.construct.TypeString(symbol.Type), symbol.Name, symbol.Kind)
+}
+
+// architectHover :
+// Describes an Architect with its header, as written in the source.
+func (doc *document) architectHover(architect *ast.Architect) string {
+	result := doc.construct.TypeString(semantic.ReturnType(architect))
+	return fmt.Sprintf("```mecha\n%s\n```\nintegrates %s", doc.header(architect), result)
+}
+
+// header :
+// Returns the header of an Architect, such as "Tensor (Gear :g)half Architect".
+func (doc *document) header(architect *ast.Architect) string {
+	parameters := make([]string, len(architect.Parameters))
+	for i, parameter := range architect.Parameters {
+		parameters[i] = fmt.Sprintf("%s :%s", doc.construct.TypeString(parameter.Type), parameter.Name)
+	}
+
+	text := fmt.Sprintf("(%s)%s Architect", strings.Join(parameters, ", "), architect.Name)
+	if architect.ReturnType != ast.TypeNone {
+		text = doc.construct.TypeString(architect.ReturnType) + " " + text
+	}
+	return text
+}
+
+// stateHeader :
+// Returns the declaration of a State set, such as "(Idle, Running)Machine State".
+func stateHeader(state *ast.StateSet) string {
+	members := make([]string, len(state.Members))
+	for i, member := range state.Members {
+		members[i] = member.Name
+	}
+	return fmt.Sprintf("(%s)%s State", strings.Join(members, ", "), state.Name)
+}
+
+//**********************************************************************************************************************
+// Conversions
+//**********************************************************************************************************************
+
+// toPosition :
+// Converts a position of the compiler, 1-based and counted in characters, into an LSP position, whose character is
+// counted in UTF-16 code units: the only encoding every client understands, and the one the server announces. A
+// column past the end of its line stays as far past it.
+func (doc *document) toPosition(at ast.Pos) position {
+	line, column := max(at.Line-1, 0), max(at.Column-1, 0)
+	character := 0
+	if line < len(doc.lines) {
+		for _, r := range doc.lines[line] {
+			if column == 0 {
+				break
+			}
+			character += utf16.RuneLen(r)
+			column--
+		}
+	}
+	return position{Line: line, Character: character + column}
+}
+
+// fromPosition :
+// Converts an LSP position into a position of the compiler. See toPosition. A character in the middle of a surrogate
+// pair is moved to the character after it.
+func (doc *document) fromPosition(at position) ast.Pos {
+	units, column := at.Character, 0
+	if at.Line >= 0 && at.Line < len(doc.lines) {
+		for _, r := range doc.lines[at.Line] {
+			if units <= 0 {
+				break
+			}
+			units -= utf16.RuneLen(r)
+			column++
+		}
+	}
+	return ast.Pos{Line: at.Line + 1, Column: column + max(units, 0) + 1}
+}
+
+// nameRange :
+// Returns the range of a name starting at the given position.
+func (doc *document) nameRange(at ast.Pos, name string) lspRange {
+	end := ast.Pos{Line: at.Line, Column: at.Column + utf8.RuneCountInString(name)}
+	return lspRange{Start: doc.toPosition(at), End: doc.toPosition(end)}
+}
+
+// lineRange :
+// Returns the range of a whole line of the document.
+func (doc *document) lineRange(line int) lspRange {
+	length := 0
+	if line >= 1 && line <= len(doc.lines) {
+		length = utf8.RuneCountInString(doc.lines[line-1])
+	}
+	return lspRange{Start: position{Line: line - 1}, End: doc.toPosition(ast.Pos{Line: line, Column: length + 1})}
+}
+
+// toDiagnostic :
+// Converts a Diagnostic of the compiler found in the document into an LSP diagnostic. Notes and the suggested fix are
+// added to the message. A Diagnostic without a position is shown at the top of the document.
+func (doc *document) toDiagnostic(d *compiler_error.Diagnostic) diagnostic {
+	severity := severityError
+	switch d.Severity {
+	case compiler_error.SeverityWarning:
+		severity = severityWarning
+	case compiler_error.SeverityNote:
+		severity = severityInformation
+	}
+
+	message := d.Message
+	for _, note := range d.Notes {
+		message += "\nnote: " + note
+	}
+	if d.Fix != nil {
+		message += "\nhelp: " + d.Fix.Message
+	}
+
+	result := diagnostic{Severity: severity, Code: d.Code, Source: "mecha", Message: message}
+	if d.Span.Start.Line > 0 {
+		result.Range = lspRange{Start: doc.toPosition(d.Span.Start), End: doc.toPosition(d.Span.Until())}
+	}
+	return result
+}
@@ -0,0 +1,385 @@
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mechanus-compiler/internal/compiler_error"
+	"mechanus-compiler/internal/lexer"
+	"mechanus-compiler/internal/logger"
+	"net/textproto"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Server :
+// This is the structure responsible for speaking the Language Server Protocol with an editor. It reads JSON-RPC
+// messages framed by Content-Length headers, analyzes every open document on each change and answers the requests
+// about them.
+type Server struct {
+	logger      *logger.Logger
+	reader      *bufio.Reader
+	writer      io.Writer
+	documents   map[string]*document
+	initialized bool
+	shutdown    bool
+}
+
+const (
+	errMissingContentLength = "message without a Content-Length header"
+	errExitBeforeShutdown   = "exit notification received before shutdown"
+	errUnknownDocument      = "unknown document '%s'"
+)
+
+// NewServer :
+// Initializes a new Server reading messages from in and writing them to out.
+func NewServer(in io.Reader, out io.Writer, debug bool) Server {
+	// Initialize the logger. Log to Stderr. Set level based on the debug flag.
+	logLevel := logger.LevelInfo
+	if debug {
+		logLevel = logger.LevelDebug
+	}
+
+	return Server{
+		logger:    logger.New(os.Stderr, logLevel),
+		reader:    bufio.NewReader(in),
+		writer:    out,
+		documents: make(map[string]*document),
+	}
+}
+
+// Run :
+// Serves messages until the client sends the exit notification.
+//
+// Fails if a message cannot be read or written, if the input ends before the exit notification, or if the client exits
+// without asking the server to shut down first.
+func (server *Server) Run() error {
+	for {
+		content, err := server.readMessage()
+		if err != nil {
+			err = compiler_error.FileErrorf("Server.Run", err)
+			server.logger.Error(err, nil)
+			return err
+		}
+
+		var message request
+		if err := json.Unmarshal(content, &message); err != nil {
+			if err := server.replyError(nil, codeParseError, err.Error()); err != nil {
+				return err
+			}
+			continue
+		}
+		server.logger.Debug("Message received", map[string]any{"method": message.Method})
+
+		if message.Method == "exit" {
+			if !server.shutdown {
+				err := compiler_error.FileErrorf("Server.Run", fmt.Errorf(errExitBeforeShutdown))
+				server.logger.Error(err, nil)
+				return err
+			}
+			return nil
+		}
+
+		if err := server.handle(message); err != nil {
+			err = compiler_error.FileErrorf("Server.Run", err)
+			server.logger.Error(err, nil)
+			return err
+		}
+	}
+}
+
+//**********************************************************************************************************************
+// Dispatch
+//**********************************************************************************************************************
+
+// handle :
+// Answers a request or applies a notification. Unknown notifications are ignored, as the protocol asks.
+//
+// Fails if the answer cannot be written.
+func (server *Server) handle(message request) error {
+	isRequest := len(message.ID) > 0
+
+	if !server.initialized && message.Method != "initialize" {
+		if isRequest {
+			return server.replyError(message.ID, codeServerNotInitialized, "the server is not initialized")
+		}
+		return nil
+	}
+	if server.shutdown && isRequest {
+		return server.replyError(message.ID, codeInvalidRequest, "the server is shutting down")
+	}
+
+	switch message.Method {
+	// Lifecycle
+	case "initialize":
+		server.initialized = true
+		return server.reply(message.ID, initializeResult{
+			Capabilities: serverCapabilities{
+				PositionEncoding:       "utf-16",
+				TextDocumentSync:       textDocumentSyncOptions{OpenClose: true, Change: syncFull},
+				DefinitionProvider:     true,
+				HoverProvider:          true,
+				DocumentSymbolProvider: true,
+			},
+			ServerInfo: serverInfo{Name: "mecha"},
+		})
+	case "shutdown":
+		server.shutdown = true
+		return server.reply(message.ID, nil)
+	// Synchronization
+	case "textDocument/didOpen":
+		var params didOpenParams
+		if err := json.Unmarshal(message.Params, &params); err != nil {
+			return nil
+		}
+		return server.update(params.TextDocument.URI, params.TextDocument.Text)
+	case "textDocument/didChange":
+		var params didChangeParams
+		if err := json.Unmarshal(message.Params, &params); err != nil || len(params.ContentChanges) == 0 {
+			return nil
+		}
+		// With full synchronization, the last change holds the whole document
+		text := params.ContentChanges[len(params.ContentChanges)-1].Text
+		return server.update(params.TextDocument.URI, text)
+	case "textDocument/didClose":
+		var params didCloseParams
+		if err := json.Unmarshal(message.Params, &params); err != nil {
+			return nil
+		}
+		delete(server.documents, params.TextDocument.URI)
+		return server.publish(params.TextDocument.URI, nil)
+	// Language features
+	case "textDocument/definition":
+		return server.answer(message, server.definition)
+	case "textDocument/hover":
+		return server.answer(message, server.hover)
+	case "textDocument/documentSymbol":
+		return server.answer(message, server.documentSymbols)
+	case "textDocument/completion":
+		return server.answer(message, server.completion)
+	}
+
+	if isRequest {
+		return server.replyError(message.ID, codeMethodNotFound, fmt.Sprintf("unknown method '%s'", message.Method))
+	}
+	return nil
+}
+
+// answer :
+// Replies to a request about a position in a document with the result of the given feature.
+//
+// Fails if the answer cannot be written.
+func (server *Server) answer(message request, feature func(*document, position) any) error {
+	var params textDocumentPositionParams
+	if err := json.Unmarshal(message.Params, &params); err != nil {
+		return server.replyError(message.ID, codeInvalidParams, err.Error())
+	}
+
+	doc, ok := server.documents[params.TextDocument.URI]
+	if !ok {
+		return server.replyError(message.ID, codeInvalidParams, fmt.Sprintf(errUnknownDocument, params.TextDocument.URI))
+	}
+	return server.reply(message.ID, feature(doc, params.Position))
+}
+
+// update :
+// Analyzes the new text of a document and publishes its diagnostics.
+//
+// Fails if the diagnostics cannot be written.
+func (server *Server) update(uri, text string) error {
+	doc, err := analyze(uri, text)
+	if err != nil {
+		// The previous analysis is kept, so the editor can still navigate the document
+		server.logger.Error(err, map[string]any{"uri": uri})
+		return nil
+	}
+	server.documents[uri] = doc
+	return server.publish(uri, doc)
+}
+
+// publish :
+// Sends the diagnostics of a document to the client, replacing the ones sent before. A closed document, which is
+// nil, has none left.
+//
+// Fails if the notification cannot be written.
+func (server *Server) publish(uri string, doc *document) error {
+	params := publishDiagnosticsParams{URI: uri, Diagnostics: []diagnostic{}}
+	if doc != nil {
+		for _, d := range doc.diagnostics {
+			params.Diagnostics = append(params.Diagnostics, doc.toDiagnostic(d))
+		}
+	}
+	return server.write(notification{JSONRPC: "2.0", Method: "textDocument/publishDiagnostics", Params: params})
+}
+
+//**********************************************************************************************************************
+// Language features
+//**********************************************************************************************************************
+
+// definition :
+// Returns where the name at the given position was declared, or nil.
+func (server *Server) definition(doc *document, at position) any {
+	ref := doc.referenceAt(doc.fromPosition(at))
+	if ref == nil {
+		return nil
+	}
+	return location{URI: doc.uri, Range: doc.nameRange(ref.target, ref.name)}
+}
+
+// hover :
+// Returns the declaration of the name at the given position, or nil.
+func (server *Server) hover(doc *document, at position) any {
+	ref := doc.referenceAt(doc.fromPosition(at))
+	if ref == nil {
+		return nil
+	}
+	return hover{
+		Contents: markupContent{Kind: "markdown", Value: ref.hover},
+		Range:    doc.nameRange(ref.position, ref.name),
+	}
+}
+
+// documentSymbols :
+// Returns the Construct of the document, with its Architects in the order they are written.
+func (server *Server) documentSymbols(doc *document, _ position) any {
+	symbols := make([]documentSymbol, 0, 1)
+	if doc.construct == nil {
+		return symbols
+	}
+
+	construct := documentSymbol{
+		Name:           doc.construct.Name,
+		Kind:           symbolKindModule,
+		Range:          lspRange{End: doc.lineRange(len(doc.lines)).End},
+		SelectionRange: doc.nameRange(doc.construct.Position, lexer.Construct),
+	}
+
+	// The parser reads the Architects from the bottom up
+	for i := len(doc.construct.Architects) - 1; i >= 0; i-- {
+		architect := doc.construct.Architects[i]
+		construct.Children = append(construct.Children, documentSymbol{
+			Name:           architect.Name,
+			Detail:         doc.header(architect),
+			Kind:           symbolKindFunction,
+			Range:          doc.lineRange(architect.Position.Line),
+			SelectionRange: doc.nameRange(architect.NamePosition, architect.Name),
+		})
+	}
+	for i := len(doc.construct.States) - 1; i >= 0; i-- {
+		state := doc.construct.States[i]
+		symbol := documentSymbol{
+			Name:           state.Name,
+			Detail:         stateHeader(state),
+			Kind:           symbolKindEnum,
+			Range:          doc.lineRange(state.Position.Line),
+			SelectionRange: doc.nameRange(state.NamePosition, state.Name),
+		}
+		for _, member := range state.Members {
+			symbol.Children = append(symbol.Children, documentSymbol{
+				Name:           member.Name,
+				Kind:           symbolKindEnumMember,
+				Range:          doc.nameRange(member.Position, member.Name),
+				SelectionRange: doc.nameRange(member.Position, member.Name),
+			})
+		}
+		construct.Children = append(construct.Children, symbol)
+	}
+	return append(symbols, construct)
+}
+
+// completion :
+// Returns every keyword of the language, and the Architects and State members of the document.
+func (server *Server) completion(doc *document, _ position) any {
+	items := make([]completionItem, 0, len(lexer.Keywords))
+	for _, keyword := range lexer.Keywords {
+		items = append(items, completionItem{Label: keyword, Kind: completionKindKeyword})
+	}
+	if doc.construct != nil {
+		for i := len(doc.construct.Architects) - 1; i >= 0; i-- {
+			architect := doc.construct.Architects[i]
+			items = append(items, completionItem{
+				Label:  architect.Name,
+				Kind:   completionKindFunction,
+				Detail: doc.header(architect),
+			})
+		}
+		for i := len(doc.construct.States) - 1; i >= 0; i-- {
+			state := doc.construct.States[i]
+			for _, member := range state.Members {
+				items = append(items, completionItem{
+					Label:  member.Name,
+					Kind:   completionKindEnumMember,
+					Detail: state.Name,
+				})
+			}
+		}
+	}
+	return items
+}
+
+//**********************************************************************************************************************
+// Transport
+//**********************************************************************************************************************
+
+// readMessage :
+// Reads the content of the next message, framed by its headers.
+//
+// Fails if the input ends or if the headers have no valid Content-Length.
+func (server *Server) readMessage() ([]byte, error) {
+	headers, err := textproto.NewReader(server.reader).ReadMIMEHeader()
+	if err != nil {
+		return nil, err
+	}
+
+	length, err := strconv.Atoi(strings.TrimSpace(headers.Get("Content-Length")))
+	if err != nil || length < 0 {
+		return nil, fmt.Errorf(errMissingContentLength)
+	}
+
+	content := make([]byte, length)
+	if _, err := io.ReadFull(server.reader, content); err != nil {
+		return nil, err
+	}
+	return content, nil
+}
+
+// reply :
+// Sends the result of a request.
+//
+// Fails if the message cannot be written.
+func (server *Server) reply(id json.RawMessage, result any) error {
+	content, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	return server.write(response{JSONRPC: "2.0", ID: id, Result: content})
+}
+
+// replyError :
+// Sends the error of a request. A message that could not be parsed is answered with a null ID.
+//
+// Fails if the message cannot be written.
+func (server *Server) replyError(id json.RawMessage, code int, message string) error {
+	if id == nil {
+		id = json.RawMessage("null")
+	}
+	return server.write(response{JSONRPC: "2.0", ID: id, Error: &responseError{Code: code, Message: message}})
+}
+
+// write :
+// Sends a message with its Content-Length header.
+//
+// Fails if the message cannot be written.
+func (server *Server) write(message any) error {
+	content, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(server.writer, "Content-Length: %d\r\n\r\n", len(content)); err != nil {
+		return err
+	}
+	_, err = server.writer.Write(content)
+	return err
+}
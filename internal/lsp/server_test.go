@@ -0,0 +1,244 @@
+package lsp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+)
+
+const testURI = "file:///example.mecha"
+
+// session holds the messages sent to the server and reads back what it answered.
+type session struct {
+	t     *testing.T
+	input bytes.Buffer
+	id    int
+}
+
+// request queues a request and returns its ID.
+func (s *session) request(method string, params any) int {
+	s.id++
+	s.send(map[string]any{"jsonrpc": "2.0", "id": s.id, "method": method, "params": params})
+	return s.id
+}
+
+// notify queues a notification.
+func (s *session) notify(method string, params any) {
+	s.send(map[string]any{"jsonrpc": "2.0", "method": method, "params": params})
+}
+
+func (s *session) send(message any) {
+	content, err := json.Marshal(message)
+	if err != nil {
+		s.t.Fatalf("failed to encode message: %v", err)
+	}
+	fmt.Fprintf(&s.input, "Content-Length: %d\r\n\r\n%s", len(content), content)
+}
+
+// run serves the queued messages and returns the answers by ID and the notifications by method.
+func (s *session) run() (map[int]json.RawMessage, map[string][]json.RawMessage) {
+	var output bytes.Buffer
+	server := NewServer(&s.input, &output, false)
+	if err := server.Run(); err != nil {
+		s.t.Fatalf("unexpected error: %v", err)
+	}
+
+	results := make(map[int]json.RawMessage)
+	notifications := make(map[string][]json.RawMessage)
+	reader := Server{reader: bufio.NewReader(&output)}
+	for {
+		content, err := reader.readMessage()
+		if err != nil {
+			break
+		}
+		var message struct {
+			ID     *int            `json:"id"`
+			Method string          `json:"method"`
+			Params json.RawMessage `json:"params"`
+			Result json.RawMessage `json:"result"`
+			Error  *responseError  `json:"error"`
+		}
+		if err := json.Unmarshal(content, &message); err != nil {
+			s.t.Fatalf("invalid message %s: %v", content, err)
+		}
+		switch {
+		case message.Error != nil:
+			s.t.Errorf("request %d failed: %s", *message.ID, message.Error.Message)
+		case message.ID != nil:
+			results[*message.ID] = message.Result
+		default:
+			notifications[message.Method] = append(notifications[message.Method], message.Params)
+		}
+	}
+	return results, notifications
+}
+
+// at builds the parameters of a request about a position of the test document.
+func at(line, character int) map[string]any {
+	return map[string]any{
+		"textDocument": map[string]any{"uri": testURI},
+		"position":     map[string]any{"line": line, "character": character},
+	}
+}
+
+// TestServer_Diagnostics ensures that opening a broken document publishes its syntax error, and that fixing it clears
+// the diagnostics.
+func TestServer_Diagnostics(t *testing.T) {
+	s := &session{t: t}
+	s.request("initialize", map[string]any{})
+	s.notify("textDocument/didOpen", map[string]any{"textDocument": map[string]any{
+		"uri":  testURI,
+		"text": "{\n  {\n    1 Integrate\n  } (Gear x)step Architect\n} main Construct\n",
+	}})
+	s.notify("textDocument/didChange", map[string]any{
+		"textDocument":   map[string]any{"uri": testURI},
+		"contentChanges": []any{map[string]any{"text": "{\n  {\n    1 Integrate\n  } (Gear :x)step Architect\n} main Construct\n"}},
+	})
+	s.request("shutdown", nil)
+	s.notify("exit", nil)
+
+	_, notifications := s.run()
+	published := notifications["textDocument/publishDiagnostics"]
+	if len(published) != 2 {
+		t.Fatalf("expected 2 publications, got %d", len(published))
+	}
+
+	var broken, fixed publishDiagnosticsParams
+	_ = json.Unmarshal(published[0], &broken)
+	_ = json.Unmarshal(published[1], &fixed)
+	if len(broken.Diagnostics) != 1 {
+		t.Fatalf("expected 1 diagnostic, got %+v", broken.Diagnostics)
+	}
+	d := broken.Diagnostics[0]
+	expected := lspRange{Start: position{Line: 3, Character: 5}, End: position{Line: 3, Character: 9}}
+	if d.Code != "E0101" || d.Range != expected {
+		t.Errorf("expected E0101 at %+v, got %s at %+v", expected, d.Code, d.Range)
+	}
+	if len(fixed.Diagnostics) != 0 {
+		t.Errorf("expected the diagnostics to be cleared, got %+v", fixed.Diagnostics)
+	}
+}
+
+// TestServer_Features checks definition, hover, document symbols and completion over the third example.
+func TestServer_Features(t *testing.T) {
+	source, err := os.ReadFile("../../docs/examples/example3_input.mecha")
+	if err != nil {
+		t.Fatalf("failed to read example: %v", err)
+	}
+
+	s := &session{t: t}
+	s.request("initialize", map[string]any{})
+	s.notify("textDocument/didOpen", map[string]any{"textDocument": map[string]any{"uri": testURI, "text": string(source)}})
+	// The 'text' sent on line 13 and the call to test on line 6
+	definition := s.request("textDocument/definition", at(12, 10))
+	call := s.request("textDocument/definition", at(5, 23))
+	hoverVariable := s.request("textDocument/hover", at(12, 10))
+	hoverParameter := s.request("textDocument/hover", at(6, 10))
+	symbols := s.request("textDocument/documentSymbol", map[string]any{"textDocument": map[string]any{"uri": testURI}})
+	completion := s.request("textDocument/completion", at(0, 0))
+	s.request("shutdown", nil)
+	s.notify("exit", nil)
+
+	results, _ := s.run()
+
+	var target location
+	_ = json.Unmarshal(results[definition], &target)
+	if target.Range.Start != (position{Line: 13, Character: 38}) {
+		t.Errorf("expected 'text' to be declared on 14:39, got %+v", target.Range.Start)
+	}
+	_ = json.Unmarshal(results[call], &target)
+	if target.Range.Start != (position{Line: 8, Character: 25}) {
+		t.Errorf("expected 'test' to be declared on 9:26, got %+v", target.Range.Start)
+	}
+
+	for id, expected := range map[int]string{hoverVariable: "Omnidrone :text", hoverParameter: "Gear :x"} {
+		var result hover
+		_ = json.Unmarshal(results[id], &result)
+		if !strings.Contains(result.Contents.Value, expected) {
+			t.Errorf("expected the hover to show %q, got %q", expected, result.Contents.Value)
+		}
+	}
+
+	var tree []documentSymbol
+	_ = json.Unmarshal(results[symbols], &tree)
+	if len(tree) != 1 || tree[0].Name != "main" || len(tree[0].Children) != 2 {
+		t.Fatalf("expected the Construct main with 2 Architects, got %+v", tree)
+	}
+	if first, second := tree[0].Children[0].Name, tree[0].Children[1].Name; first != "test" || second != "main" {
+		t.Errorf("expected the Architects in source order, got '%s' and '%s'", first, second)
+	}
+
+	var items []completionItem
+	_ = json.Unmarshal(results[completion], &items)
+	labels := make(map[string]bool)
+	for _, item := range items {
+		labels[item.Label] = true
+	}
+	for _, label := range []string{"Architect", "Integrate", "Gear", "test"} {
+		if !labels[label] {
+			t.Errorf("expected %q to be completed", label)
+		}
+	}
+}
+
+// TestServer_UTF16 ensures that characters are counted in UTF-16 code units, where an emoji takes two, both in the
+// positions sent to the client and in the ones it asks about.
+func TestServer_UTF16(t *testing.T) {
+	text := "{\n  {\n    (\"😀\" == nope)Send\n    (s)Send\n    \"😀\" =: Omnidrone :s\n  } ()main Architect\n" +
+		"} main Construct\n"
+
+	s := &session{t: t}
+	initialize := s.request("initialize", map[string]any{})
+	s.notify("textDocument/didOpen", map[string]any{"textDocument": map[string]any{"uri": testURI, "text": text}})
+	definition := s.request("textDocument/definition", at(3, 5))
+	hoverDeclaration := s.request("textDocument/hover", at(4, 23))
+	s.request("shutdown", nil)
+	s.notify("exit", nil)
+
+	results, notifications := s.run()
+
+	var result initializeResult
+	_ = json.Unmarshal(results[initialize], &result)
+	if result.Capabilities.PositionEncoding != "utf-16" {
+		t.Errorf("expected the server to announce utf-16, got %q", result.Capabilities.PositionEncoding)
+	}
+
+	var published publishDiagnosticsParams
+	_ = json.Unmarshal(notifications["textDocument/publishDiagnostics"][0], &published)
+	if len(published.Diagnostics) != 1 {
+		t.Fatalf("expected 1 diagnostic, got %+v", published.Diagnostics)
+	}
+	expected := lspRange{Start: position{Line: 2, Character: 13}, End: position{Line: 2, Character: 14}}
+	if published.Diagnostics[0].Range != expected {
+		t.Errorf("expected 'nope' to be reported at %+v, got %+v", expected, published.Diagnostics[0].Range)
+	}
+
+	var target location
+	_ = json.Unmarshal(results[definition], &target)
+	expected = lspRange{Start: position{Line: 4, Character: 23}, End: position{Line: 4, Character: 24}}
+	if target.Range != expected {
+		t.Errorf("expected 's' to be declared at %+v, got %+v", expected, target.Range)
+	}
+
+	var declaration hover
+	_ = json.Unmarshal(results[hoverDeclaration], &declaration)
+	if !strings.Contains(declaration.Contents.Value, "Omnidrone :s") {
+		t.Errorf("expected the hover to show the declaration of 's', got %q", declaration.Contents.Value)
+	}
+}
+
+// TestServer_ExitWithoutShutdown ensures that the server reports an exit that was not preceded by a shutdown.
+func TestServer_ExitWithoutShutdown(t *testing.T) {
+	s := &session{t: t}
+	s.request("initialize", map[string]any{})
+	s.notify("exit", nil)
+
+	server := NewServer(&s.input, &bytes.Buffer{}, false)
+	if err := server.Run(); err == nil {
+		t.Error("expected an error, got nil")
+	}
+}
@@ -0,0 +1,69 @@
+package mechatest
+
+import (
+	_ "embed"
+	"mechanus-compiler/internal/ast"
+	"mechanus-compiler/internal/parser"
+	"mechanus-compiler/internal/semantic"
+	"strings"
+	"testing"
+)
+
+// Program exercises every command and the runtime: it receives a Gear n, sends the sum of 1..n and a few other
+// values, and integrates sum - 10. Run with ProgramInput, it sends ProgramOutput and exits with ProgramExit.
+//
+//go:embed testdata/program.mecha
+var Program string
+
+const (
+	ProgramInput  = "5\n"
+	ProgramOutput = "15\n7.5\n2\nA\nequal\n2\n"
+	ProgramExit   = 5
+)
+
+// MissingMain is a Construct that passes the analysis but has no main Architect to start from.
+const MissingMain = `{
+   {
+        0 Integrate
+   } ()start Architect
+} main Construct`
+
+// Parse :
+// Runs the parser over the given source. Fails the test on a syntax error.
+func Parse(t *testing.T, source string) *ast.Construct {
+	t.Helper()
+
+	construct, err := TryParse(t, source)
+	if err != nil {
+		t.Fatalf("unexpected syntax error: %v", err)
+	}
+	return construct
+}
+
+// TryParse :
+// Runs the parser over the given source, returning what it could build along with its syntax errors, for the tests
+// that expect some.
+func TryParse(t *testing.T, source string) (*ast.Construct, error) {
+	t.Helper()
+
+	p, err := parser.NewParser(strings.NewReader(source), "input.mecha", false)
+	if err != nil {
+		t.Fatalf("failed to create parser: %v", err)
+	}
+	return p.Run()
+}
+
+// Analyze :
+// Parses and analyzes the given source, returning what the later phases need to run it. Fails the test on a syntax or
+// semantic error.
+func Analyze(t *testing.T, source string) (*ast.Construct, *semantic.Info) {
+	t.Helper()
+
+	construct := Parse(t, source)
+	analyzer := semantic.NewAnalyzer(false)
+	info, err := analyzer.Run(construct)
+	if err != nil {
+		t.Fatalf("unexpected semantic error: %v", err)
+	}
+	return construct, info
+}
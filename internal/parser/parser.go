@@ -1,26 +1,38 @@
 package parser
 
 import (
+	"errors"
 	"fmt"
+	"io"
+	"mechanus-compiler/internal/ast"
 	"mechanus-compiler/internal/compiler_error"
 	"mechanus-compiler/internal/lexer"
 	"mechanus-compiler/internal/logger"
 	"os"
+	"strconv"
 	"strings"
 )
 
 // Parser :
 // This is the structure responsible for making the syntactical analysis of the source file. It checks for unrecognized
-// syntaxes and, if it finds one, it returns an error code.
+// syntaxes and, if it finds one, records the error, skips the broken command or Architect and keeps going, so a
+// single run reports every syntax error. While doing so, it builds the abstract syntax tree of the program.
 type Parser struct {
 	logger          *logger.Logger
 	debug           bool // Restored for controlling debug-specific output
 	lexer           lexer.Lexer
-	outputFile      *os.File
-	token           int
-	lexeme          string
-	errorMessage    error
+	current         lexer.Token
+	position        ast.Pos
+	previous        ast.Pos
+	previousLexeme  string
+	next            *lexer.Token
+	errors          []error
+	maxErrors       int
+	quiet           bool // Logs the success of the analysis at LevelDebug
+	line            int  // The line of the command being parsed, or 0 outside of one
 	recognizedRules strings.Builder
+	typeNames       []string
+	types           map[string]ast.Type // The type given to each name in typeNames
 }
 
 const (
@@ -30,13 +42,19 @@ const (
 	errExpectedCloseParenthesis = "expected ')', got '%s'"
 	errExpectedIdentifier       = "expected an identifier, got '%s'"
 	errExpectedColon            = "expected ':', got '%s'"
+	errExpectedOpenBrackets     = "expected '[', got '%s'"
 )
 
+const noteLineEnded = "the line ends at '%s', and '%s' belongs to line %d"
+
+// DefaultMaxErrors is the number of syntax errors after which the parser stops, unless changed with SetMaxErrors.
+const DefaultMaxErrors = 10
+
 // NewParser :
-// Initializes a new Parser instance with the provided input and output files.
+// Initializes a new Parser instance reading the source from input. The name is the one given to diagnostics.
 //
 // Fails if it is not possible to initialize the lexer.
-func NewParser(inputFile, outputFile *os.File, debug bool) (Parser, error) {
+func NewParser(input io.Reader, name string, debug bool) (Parser, error) {
 	// Initialize the logger. Log to Stderr. Set level based on the debug flag.
 	logLevel := logger.LevelInfo
 	if debug {
@@ -45,7 +63,7 @@ func NewParser(inputFile, outputFile *os.File, debug bool) (Parser, error) {
 	lg := logger.New(os.Stderr, logLevel)
 
 	// Initialize the Lexer
-	lex, err := lexer.NewLexer(inputFile, outputFile, debug)
+	lex, err := lexer.NewLexer(input, name, debug)
 	if err != nil {
 		// The lexer's constructor will have already logged the error.
 		return Parser{}, err
@@ -53,86 +71,131 @@ func NewParser(inputFile, outputFile *os.File, debug bool) (Parser, error) {
 
 	// Initialize the structure
 	parser := Parser{
-		logger:       lg,
-		debug:        debug, // Set the debug flag
-		lexer:        lex,
-		outputFile:   outputFile,
-		token:        lexer.TNilValue,
-		errorMessage: nil,
+		logger:    lg,
+		debug:     debug, // Set the debug flag
+		lexer:     lex,
+		current:   lexer.Token{Kind: lexer.TNilValue},
+		maxErrors: DefaultMaxErrors,
 	}
 
 	return parser, nil
 }
 
+// SetMaxErrors :
+// Sets the number of syntax errors after which the parser gives up. Zero or less means no limit.
+func (parser *Parser) SetMaxErrors(maxErrors int) {
+	parser.maxErrors = maxErrors
+}
+
+// SetQuiet :
+// Logs the success of the syntax analysis at LevelDebug instead of LevelInfo, for commands such as "mecha run" whose
+// output belongs to the program.
+func (parser *Parser) SetQuiet(quiet bool) {
+	parser.quiet = quiet
+}
+
+// Comments :
+// Returns the comments of the source file, from the bottom to the top. Run must be called first, since comments are
+// found while reading tokens.
+func (parser *Parser) Comments() []lexer.Comment {
+	return parser.lexer.Comments()
+}
+
 // Run :
-// Starts the syntactical analysis.
+// Starts the syntactical analysis and returns the abstract syntax tree of the program.
 //
-// Fails if the lexer fails or if a syntactical error is found.
-func (parser *Parser) Run() error {
+// Fails if the lexer fails or if any syntactical error is found. Every syntax error is logged as it is found and the
+// returned error joins all of them. The tree is still returned, without the commands and Architects that could not
+// be parsed, unless the Construct itself is broken.
+func (parser *Parser) Run() (*ast.Construct, error) {
+	parser.errors = nil
+	parser.typeNames = nil
+	parser.types = make(map[string]ast.Type)
+
 	if err := parser.advanceToken(); err != nil {
 		// The lexer logs its own errors, so we just propagate the error up.
-		return err
+		return nil, err
 	}
 
-	if err := parser.g(); err != nil {
-		// Parsing functions log their own errors via handleSyntaxError.
-		return err
+	construct, err := parser.g()
+	if err != nil && !parser.recoverable(err) {
+		// Lexer errors and the error limit stop the analysis without being recorded as syntax errors
+		parser.errors = append(parser.errors, err)
+	}
+	if len(parser.errors) > 0 {
+		return construct, errors.Join(parser.errors...)
 	}
 
-	parser.logger.Info(compiler_error.SyntaxSuccess, nil)
-	return nil
+	if parser.quiet {
+		parser.logger.Debug(compiler_error.SyntaxSuccess, nil)
+	} else {
+		parser.logger.Info(compiler_error.SyntaxSuccess, nil)
+	}
+	return construct, nil
 }
 
 // g :
 // <G> ::= '{' <BODY> '}' <ID> 'Construct'
-func (parser *Parser) g() error {
+func (parser *Parser) g() (*ast.Construct, error) {
 	parser.accumulateRule("<G> ::= '{' <BODY> '}' <ID> 'Construct'")
+	construct := &ast.Construct{Position: parser.position}
 
 	// Expect 'Construct'
-	if parser.token != lexer.TConstruct {
-		return parser.handleSyntaxError(fmt.Errorf("expected 'Construct', got %s", parser.lexeme))
+	if parser.current.Kind != lexer.TConstruct {
+		return nil, parser.handleSyntaxError(fmt.Errorf("expected 'Construct', got %s", parser.current.Lexeme))
 	}
 	parser.displayToken()
 	if err := parser.advanceToken(); err != nil {
-		return err
+		return nil, err
 	}
 
 	// Expect <ID>
-	if parser.token != lexer.TId {
-		return parser.handleSyntaxError(fmt.Errorf(errExpectedIdentifier, parser.lexeme))
+	if parser.current.Kind != lexer.TId {
+		return nil, parser.handleSyntaxError(fmt.Errorf(errExpectedIdentifier, parser.current.Lexeme))
 	}
+	construct.Name = parser.current.Lexeme
 	parser.displayToken()
 	if err := parser.advanceToken(); err != nil {
-		return err
+		return nil, err
 	}
 
 	// Expect '}'
-	if parser.token != lexer.TCloseBraces {
-		return parser.handleSyntaxError(fmt.Errorf(errExpectedCloseBraces, parser.lexeme))
+	if parser.current.Kind != lexer.TCloseBraces {
+		return nil, parser.handleExpectedToken(errExpectedCloseBraces, "} ")
 	}
 	parser.displayToken()
 	if err := parser.advanceToken(); err != nil {
-		return err
+		return nil, err
 	}
 
 	// Expect <BODY>
-	if err := parser.body(); err != nil {
-		return err
+	if err := parser.body(construct); err != nil {
+		return nil, err
+	}
+	construct.TypeNames = parser.typeNames
+
+	// A Construct whose '{' was skipped while recovering from an earlier error has already been reported
+	if parser.current.Kind == lexer.TInputEnd && len(parser.errors) > 0 {
+		return construct, nil
 	}
 
 	// Expect '{'
-	if parser.token != lexer.TOpenBraces {
-		return parser.handleSyntaxError(fmt.Errorf(errExpectedOpenBraces, parser.lexeme))
+	if parser.current.Kind != lexer.TOpenBraces {
+		return nil, parser.handleExpectedToken(errExpectedOpenBraces, "{ ")
 	}
+	construct.Open = parser.position
 	parser.displayToken()
 	if err := parser.advanceToken(); err != nil {
-		if strings.Contains(err.Error(), compiler_error.EndOfFileReached) {
-			return nil
-		}
-		return err
+		return nil, err
 	}
 
-	return nil
+	// Nothing is allowed above the Construct
+	if parser.current.Kind != lexer.TInputEnd {
+		return nil, parser.handleSyntaxError(
+			fmt.Errorf("unexpected '%s' after the end of the Construct", parser.current.Lexeme))
+	}
+
+	return construct, nil
 }
 
 // <BODY> :
@@ -141,234 +204,391 @@ func (parser *Parser) g() error {
 // <BODY> ::= <BODY_REST> '{' <CMDS> '}' '(' ')' <ID> 'Architect'
 // <BODY> ::= <BODY_REST> '{' <CMDS> '}' <TYPE> '(' ')' <ID> 'Architect'
 // <BODY> ::= <BODY_REST> '{' <CMDS> '}' <TYPE> '(' <PARAMETERS_DECL> ')' <ID> 'Architect'
-func (parser *Parser) body() error {
+// <BODY> ::= <BODY_REST> '(' <MEMBERS> ')' <ID> 'State'
+func (parser *Parser) body(construct *ast.Construct) error {
 	parser.accumulateRule("<BODY> ::= <BODY_REST> '{' <CMDS> '}' '(' <PARAMETERS> ')' <ID> 'Architect' | ...")
 
-	// 1. Expect 'Architect'
-	if parser.token != lexer.TArchitect {
-		return parser.handleSyntaxError(fmt.Errorf("expected 'Architect', got %s", parser.lexeme))
-	}
-	parser.displayToken()
-	if err := parser.advanceToken(); err != nil {
+	// Parse the first Architect or State set
+	if err := parser.recoverItem(construct); err != nil {
 		return err
 	}
 
-	// 2. Expect <ID>
-	if parser.token != lexer.TId {
-		return parser.handleSyntaxError(fmt.Errorf("expected ID after Architect, got %s", parser.lexeme))
+	// Recursively parse any additional Architect bodies and State sets
+	return parser.bodyRest(construct)
+}
+
+// <BODY_REST> :
+//
+// <BODY_REST> ::= <BODY_REST> '{' <CMDS> '}' '(' <PARAMETERS_DECL> ')' <ID> 'Architect'
+// <BODY_REST> ::= <BODY_REST> '{' <CMDS> '}' <TYPE> '(' <PARAMETERS_DECL> ')' <ID> 'Architect'
+// <BODY_REST> ::= <BODY_REST> '(' <MEMBERS> ')' <ID> 'State'
+// <BODY_REST> ::= ε
+func (parser *Parser) bodyRest(construct *ast.Construct) error {
+	parser.accumulateRule("<BODY_REST> ::= <BODY_REST> '{' <CMDS> '}' '(' <PARAMETERS> ')' <ID> 'Architect' | ... | ε")
+
+	// Base case: ε. The '{' that opens the Construct ends the list of Architects.
+	if parser.current.Kind == lexer.TOpenBraces || parser.current.Kind == lexer.TInputEnd {
+		parser.accumulateRule("<BODY_REST> ::= ε")
+		return nil
 	}
-	parser.displayToken()
-	if err := parser.advanceToken(); err != nil {
+
+	if err := parser.recoverItem(construct); err != nil {
 		return err
 	}
 
-	// 3. Expect ')'
-	if parser.token != lexer.TCloseParentheses {
-		return parser.handleSyntaxError(fmt.Errorf("expected ')', got %s", parser.lexeme))
+	// Recurse to parse next body
+	return parser.bodyRest(construct)
+}
+
+// recoverItem :
+// Parses an Architect or a State set and adds it to the Construct. After a syntax error, the rest of it is skipped
+// and nothing is added, so the Architects and State sets around it are still parsed.
+//
+// Fails if the error cannot be recovered from.
+func (parser *Parser) recoverItem(construct *ast.Construct) error {
+	var err error
+	if parser.current.Kind == lexer.TState {
+		var state *ast.StateSet
+		if state, err = parser.stateSet(); err == nil {
+			construct.States = append(construct.States, state)
+		}
+	} else {
+		var architect *ast.Architect
+		if architect, err = parser.architect(); err == nil {
+			construct.Architects = append(construct.Architects, architect)
+		}
 	}
-	parser.displayToken()
-	if err := parser.advanceToken(); err != nil {
+
+	if err == nil {
+		return nil
+	}
+	if !parser.recoverable(err) {
 		return err
 	}
+	return parser.synchronizeArchitect()
+}
 
-	// 4. Optionally parse <PARAMETERS> (may be ε)
-	if parser.token != lexer.TOpenParentheses {
-		_ = parser.parametersDecl() // fail silently if no parametersDecl
-	}
+// stateSet :
+// Parses a State set:
+//
+// '(' <MEMBERS> ')' <ID> 'State'
+// <MEMBERS> ::= <ID> | <MEMBERS> ',' <ID>
+func (parser *Parser) stateSet() (*ast.StateSet, error) {
+	parser.accumulateRule("<BODY> ::= <BODY_REST> '(' <MEMBERS> ')' <ID> 'State'")
+	state := &ast.StateSet{Position: parser.position}
 
-	// 5. Expect ')'
-	if parser.token != lexer.TOpenParentheses {
-		return parser.handleSyntaxError(fmt.Errorf("expected '(', got %s", parser.lexeme))
-	}
+	// 1. Expect 'State'
 	parser.displayToken()
 	if err := parser.advanceToken(); err != nil {
-		return err
+		return nil, err
+	}
+
+	// 2. Expect <ID>
+	state.NamePosition = parser.position
+	name, err := parser.id()
+	if err != nil {
+		return nil, err
 	}
+	state.Name = name
+	state.Type = parser.namedType(name)
 
-	// 6. Expect '}'
-	if parser.token != lexer.TCloseBraces {
-		return parser.handleSyntaxError(fmt.Errorf("expected '}', got %s", parser.lexeme))
+	// 3. Expect ')'
+	if parser.current.Kind != lexer.TCloseParentheses {
+		return nil, parser.handleExpectedToken(errExpectedCloseParenthesis, ")")
 	}
 	parser.displayToken()
 	if err := parser.advanceToken(); err != nil {
-		return err
+		return nil, err
 	}
 
-	// 7. Parse <CMDS>
-	if err := parser.cmds(); err != nil {
-		return err
+	// 4. Expect <MEMBERS>, read from right to left
+	parser.accumulateRule("<MEMBERS> ::= <ID> | <MEMBERS> ',' <ID>")
+	for {
+		member := &ast.StateMember{Position: parser.position}
+		if member.Name, err = parser.id(); err != nil {
+			return nil, err
+		}
+		state.Members = append([]*ast.StateMember{member}, state.Members...)
+
+		if parser.current.Kind != lexer.TComma {
+			break
+		}
+		parser.displayToken()
+		if err := parser.advanceToken(); err != nil {
+			return nil, err
+		}
 	}
 
-	// 8. Expect '{'
-	if parser.token != lexer.TOpenBraces {
-		return parser.handleSyntaxError(fmt.Errorf("expected '{', got %s", parser.lexeme))
+	// 5. Expect '('
+	if parser.current.Kind != lexer.TOpenParentheses {
+		return nil, parser.handleExpectedToken(errExpectedOpenParenthesis, "(")
 	}
 	parser.displayToken()
 	if err := parser.advanceToken(); err != nil {
-		if strings.Contains(err.Error(), compiler_error.EndOfFileReached) {
-			return nil
-		}
-		return err
+		return nil, err
 	}
 
-	// 9. Recursively parse any additional Architect bodies
-	if err := parser.bodyRest(); err != nil {
-		if strings.Contains(err.Error(), compiler_error.EndOfFileReached) {
-			return nil
-		}
-		return err
-	}
+	return state, nil
+}
 
-	return nil
+// namedType :
+// Returns the type of a State set name, numbering the name the first time it is met. A name may be used as a type
+// before its State set is declared, since the file is read from the bottom up.
+func (parser *Parser) namedType(name string) ast.Type {
+	if t, ok := parser.types[name]; ok {
+		return t
+	}
+	t := ast.StateType(len(parser.typeNames))
+	parser.typeNames = append(parser.typeNames, name)
+	parser.types[name] = t
+	return t
 }
 
-// <BODY_REST> :
+// architect :
+// Parses a single Architect, shared by <BODY> and <BODY_REST>:
 //
-// <BODY_REST> ::= <BODY_REST> '{' <CMDS> '}' '(' <PARAMETERS_DECL> ')' <ID> 'Architect'
-// <BODY_REST> ::= <BODY_REST> '{' <CMDS> '}' <TYPE> '(' <PARAMETERS_DECL> ')' <ID> 'Architect'
-// <BODY_REST> ::= ε
-func (parser *Parser) bodyRest() error {
-	parser.accumulateRule("<BODY_REST> ::= <BODY_REST> '{' <CMDS> '}' '(' <PARAMETERS> ')' <ID> 'Architect' | ... | ε")
+// '{' <CMDS> '}' [<TYPE>] '(' [<PARAMETERS_DECL>] ')' <ID> 'Architect'
+func (parser *Parser) architect() (*ast.Architect, error) {
+	architect := &ast.Architect{Position: parser.position}
 
-	// 1. Base case: ε
-	if parser.token == lexer.TCloseBraces || parser.token == lexer.TInputEnd {
-		parser.accumulateRule("<BODY_REST> ::= ε")
-		return nil
+	// 1. Expect 'Architect'
+	if parser.current.Kind != lexer.TArchitect {
+		return nil, parser.handleSyntaxError(fmt.Errorf("expected 'Architect', got %s", parser.current.Lexeme))
+	}
+	parser.displayToken()
+	if err := parser.advanceToken(); err != nil {
+		return nil, err
 	}
 
-	// 2. Expect 'Architect'
-	if parser.token != lexer.TArchitect {
-		return parser.handleSyntaxError(fmt.Errorf("expected 'Architect', got %s", parser.lexeme))
+	// 2. Expect <ID>
+	if parser.current.Kind != lexer.TId {
+		return nil, parser.handleSyntaxError(fmt.Errorf("expected ID after Architect, got %s", parser.current.Lexeme))
 	}
+	architect.Name = parser.current.Lexeme
+	architect.NamePosition = parser.position
 	parser.displayToken()
 	if err := parser.advanceToken(); err != nil {
-		return err
+		return nil, err
 	}
 
-	// 3. Expect <ID>
-	if parser.token != lexer.TId {
-		return parser.handleSyntaxError(fmt.Errorf("expected ID after Architect, got %s", parser.lexeme))
+	// 3. Expect ')'
+	if parser.current.Kind != lexer.TCloseParentheses {
+		return nil, parser.handleExpectedToken(errExpectedCloseParenthesis, ")")
 	}
 	parser.displayToken()
 	if err := parser.advanceToken(); err != nil {
-		return err
+		return nil, err
+	}
+
+	// 4. Optionally parse <PARAMETERS_DECL>
+	if parser.current.Kind != lexer.TOpenParentheses {
+		parameters, err := parser.parametersDecl()
+		if err != nil {
+			return nil, err
+		}
+		architect.Parameters = parameters
 	}
 
-	// 4. Expect ')'
-	if parser.token != lexer.TCloseParentheses {
-		return parser.handleSyntaxError(fmt.Errorf("expected ')', got %s", parser.lexeme))
+	// 5. Expect '('
+	if parser.current.Kind != lexer.TOpenParentheses {
+		return nil, parser.handleExpectedToken(errExpectedOpenParenthesis, "(")
 	}
 	parser.displayToken()
 	if err := parser.advanceToken(); err != nil {
-		return err
+		return nil, err
+	}
+
+	// 6. Optionally parse the return <TYPE>
+	if parser.current.Kind != lexer.TCloseBraces {
+		returnType, err := parser.typeToken()
+		if err != nil {
+			return nil, err
+		}
+		architect.ReturnType = returnType
+	}
+
+	// 7. Parse '{' <CMDS> '}'
+	body, err := parser.block()
+	if err != nil {
+		return nil, err
 	}
+	architect.Body = body
 
-	// 5. Optionally parse <PARAMETERS>
-	if parser.token != lexer.TOpenParentheses {
-		_ = parser.parametersDecl() // fails silently if epsilon
+	return architect, nil
+}
+
+// <TYPE> :
+//
+// <TYPE> ::= 'Nil'
+// <TYPE> ::= <ELEMENT_TYPE>
+// <TYPE> ::= <ELEMENT_TYPE> 'Channel'
+// <TYPE> ::= <ELEMENT_TYPE> 'Assembly'
+func (parser *Parser) typeToken() (ast.Type, error) {
+	parser.accumulateRule("<TYPE> ::= 'Nil' | <ELEMENT_TYPE> | <ELEMENT_TYPE> 'Channel' | <ELEMENT_TYPE> 'Assembly'")
+
+	switch parser.current.Kind {
+	case lexer.TNil:
+		parser.displayToken()
+		return ast.TypeNil, parser.advanceToken()
+	case lexer.TChannel:
+		// 'Channel' follows the type it carries, so it is read first
+		parser.displayToken()
+		if err := parser.advanceToken(); err != nil {
+			return ast.TypeNone, err
+		}
+		element, err := parser.elementType()
+		if err != nil {
+			return ast.TypeNone, err
+		}
+		return element | ast.TypeChannel, nil
+	case lexer.TAssembly:
+		return parser.assemblyType()
 	}
+	return parser.elementType()
+}
 
-	// 6. Expect ')'
-	if parser.token != lexer.TOpenParentheses {
-		return parser.handleSyntaxError(fmt.Errorf("expected '(', got %s", parser.lexeme))
+// assemblyType :
+// Parses "<ELEMENT_TYPE> 'Assembly'", starting at the 'Assembly' keyword. Used both by <TYPE> and by the Assembly
+// literals of <X>.
+func (parser *Parser) assemblyType() (ast.Type, error) {
+	// Expect 'Assembly'
+	if parser.current.Kind != lexer.TAssembly {
+		return ast.TypeNone, parser.handleSyntaxError(fmt.Errorf("expected 'Assembly', got %s", parser.current.Lexeme))
 	}
 	parser.displayToken()
 	if err := parser.advanceToken(); err != nil {
-		return err
+		return ast.TypeNone, err
+	}
+
+	element, err := parser.elementType()
+	if err != nil {
+		return ast.TypeNone, err
 	}
+	return element | ast.TypeAssembly, nil
+}
 
-	// 7. Expect '}'
-	if parser.token != lexer.TCloseBraces {
-		return parser.handleSyntaxError(fmt.Errorf("expected '}', got %s", parser.lexeme))
+// <ELEMENT_TYPE> :
+//
+// <ELEMENT_TYPE> ::= 'Gear'
+// <ELEMENT_TYPE> ::= 'Tensor'
+// <ELEMENT_TYPE> ::= 'State'
+// <ELEMENT_TYPE> ::= 'Monodrone'
+// <ELEMENT_TYPE> ::= 'Omnidrone'
+// <ELEMENT_TYPE> ::= 'Switch'
+// <ELEMENT_TYPE> ::= <ID>
+//
+// An <ID> names a State set of the Construct.
+func (parser *Parser) elementType() (ast.Type, error) {
+	parser.accumulateRule("<ELEMENT_TYPE> ::= 'Gear' | 'Tensor' | 'State' | 'Monodrone' | 'Omnidrone' | 'Switch' | " +
+		"<ID>")
+
+	var typ ast.Type
+	switch parser.current.Kind {
+	case lexer.TGear:
+		typ = ast.TypeGear
+	case lexer.TTensor:
+		typ = ast.TypeTensor
+	case lexer.TState:
+		typ = ast.TypeState
+	case lexer.TMonodrone:
+		typ = ast.TypeMonodrone
+	case lexer.TOmnidrone:
+		typ = ast.TypeOmnidrone
+	case lexer.TSwitch:
+		typ = ast.TypeSwitch
+	case lexer.TId:
+		typ = parser.namedType(parser.current.Lexeme)
+	default:
+		return ast.TypeNone, parser.handleSyntaxError(fmt.Errorf("expected a Type keyword, got %s", parser.current.Lexeme))
 	}
 	parser.displayToken()
 	if err := parser.advanceToken(); err != nil {
-		return err
+		return ast.TypeNone, err // Propagation of error
 	}
+	return typ, nil
+}
 
-	// 8. Parse <CMDS>
-	if err := parser.cmds(); err != nil {
-		return err
-	}
+// block :
+// Parses '{' <CMDS> '}', which is shared by Architects and every command that owns a block.
+func (parser *Parser) block() (*ast.Block, error) {
+	block := &ast.Block{Position: parser.position}
 
-	// 9. Expect '{'
-	if parser.token != lexer.TOpenBraces {
-		return parser.handleSyntaxError(fmt.Errorf("expected '{', got %s", parser.lexeme))
+	// Expect '}'
+	if parser.current.Kind != lexer.TCloseBraces {
+		return nil, parser.handleExpectedToken(errExpectedCloseBraces, "} ")
 	}
 	parser.displayToken()
 	if err := parser.advanceToken(); err != nil {
-		return err
+		return nil, err
 	}
 
-	// 10. Recurse to parse next body
-	return parser.bodyRest()
-}
+	// Expect <CMDS>
+	commands, err := parser.cmds()
+	if err != nil {
+		return nil, err
+	}
+	block.Commands = commands
 
-// <TYPE> :
-//
-// <TYPE> ::= 'Nil'
-// <TYPE> ::= 'Gear'
-// <TYPE> ::= 'Tensor'
-// <TYPE> ::= 'State'
-// <TYPE> ::= 'Monodrone'
-// <TYPE> ::= 'Omnidrone'
-func (parser *Parser) typeToken() error {
-	parser.accumulateRule("<TYPE> ::= 'Nil' | 'Gear' | 'Tensor' | 'State' | 'Monodrone' | 'Omnidrone'")
-	if parser.token != lexer.TNil && parser.token != lexer.TGear && parser.token != lexer.TTensor &&
-		parser.token != lexer.TState && parser.token != lexer.TMonodrone && parser.token != lexer.TOmnidrone {
-		return parser.handleSyntaxError(fmt.Errorf("expected a Type keyword, got %s", parser.lexeme))
+	// Expect '{'
+	if parser.current.Kind != lexer.TOpenBraces {
+		return nil, parser.handleExpectedToken(errExpectedOpenBraces, "{ ")
 	}
+	block.Open = parser.position
 	parser.displayToken()
 	if err := parser.advanceToken(); err != nil {
-		return err // Propagation of error
+		return nil, err
 	}
-	return nil
+
+	return block, nil
 }
 
 // <CMDS> :
 // <CMDS> ::= <CMDS_REST> <CMD>
-func (parser *Parser) cmds() error {
+func (parser *Parser) cmds() ([]ast.Command, error) {
 	parser.accumulateRule("<CMDS> ::= <CMDS_REST> <CMD>")
+	commands := make([]ast.Command, 0)
 
 	for {
 		// Skip any newlines
-		for parser.token == lexer.TNewLine {
+		for parser.current.Kind == lexer.TNewLine {
 			parser.displayToken()
 			if err := parser.advanceToken(); err != nil {
-				return err
+				return nil, err
 			}
 		}
 
-		// At this level, hitting '{' means the parser is done with <CMDS>
-		if parser.token == lexer.TOpenBraces {
+		// At this level, hitting '{' means the parser is done with <CMDS>. At the end of the input, the missing '{'
+		// is reported by the caller.
+		if parser.current.Kind == lexer.TOpenBraces || parser.current.Kind == lexer.TInputEnd {
 			break
 		}
 
-		// Attempt to parse one command
-		if err := parser.cmd(); err != nil {
-			return err
+		// Attempt to parse one command. A broken command is skipped, and parsing resumes with the next one.
+		start := parser.position
+		parser.line = start.Line
+		command, err := parser.cmd()
+		if err != nil {
+			if !parser.recoverable(err) {
+				return nil, err
+			}
+			// A token that cannot start a command is skipped, or it would be reported again and again
+			if parser.position == start {
+				parser.displayToken()
+				if err := parser.advanceToken(); err != nil {
+					return nil, err
+				}
+			}
+			if err := parser.synchronizeCommand(); err != nil {
+				return nil, err
+			}
+			continue
 		}
+		commands = append(commands, command)
 	}
 
-	return nil
-}
-
-// <CMDS_REST> :
-//
-// <CMDS_REST> ::= '\n' <CMDS>
-// <CMDS_REST> ::= ε
-func (parser *Parser) cmdsRest() error {
-	parser.accumulateRule("<CMDS_REST> ::= '\\n' <CMDS> | ε")
-
-	if parser.token == lexer.TNewLine {
-		if err := parser.advanceToken(); err != nil {
-			return err
-		}
-		return parser.cmds()
-	}
-	// epsilon
-	parser.accumulateRule("<CMDS_REST> ::= ε")
-	return nil
+	// The block around the commands goes on above their lines
+	parser.line = 0
+	return commands, nil
 }
 
 // <CMD> :
@@ -379,45 +599,62 @@ func (parser *Parser) cmdsRest() error {
 // <CMD> ::= <CMD_ASSIGNMENT>
 // <CMD> ::= <CMD_RECEIVE>
 // <CMD> ::= <CMD_SEND>
+// <CMD> ::= <CMD_APPEND>
 // <CMD> ::= <CMD_INTEGRATE>
-func (parser *Parser) cmd() error {
-	parser.accumulateRule("<CMD> ::= <CMD_IF> | <CMD_FOR> | <CMD_DECLARATION> | <CMD_ASSIGNMENT> | <CMD_RECEIVE> | <CMD_SEND> | <CMD_INTEGRATE> | <CMD_CALL>")
-
-	if err := parser.cmdIf(); err == nil {
-		return nil
-	}
-	if err := parser.cmdFor(); err == nil {
-		return nil
-	}
-	if err := parser.cmdDeclaration(); err == nil {
-		return nil
-	}
-	if err := parser.cmdAssignment(); err == nil {
-		return nil
-	}
-	if err := parser.cmdReceive(); err == nil {
-		return nil
-	}
-	if err := parser.cmdSend(); err == nil {
-		return nil
-	}
-	if err := parser.cmdIntegrate(); err == nil {
-		return nil
-	}
-
-	if parser.token == lexer.TCloseParentheses {
-		parser.accumulateRule("<CMD_CALL> ::= '(' <PARAMETERS_CALL> ')' <ID>")
+// <CMD> ::= <CMD_CALL>
+// <CMD> ::= <CMD_DETACH>
+func (parser *Parser) cmd() (ast.Command, error) {
+	parser.accumulateRule("<CMD> ::= <CMD_IF> | <CMD_FOR> | <CMD_DECLARATION> | <CMD_ASSIGNMENT> | <CMD_RECEIVE> | <CMD_SEND> | <CMD_APPEND> | <CMD_INTEGRATE> | <CMD_CALL> | <CMD_DETACH>")
+
+	switch parser.current.Kind {
+	case lexer.TIf:
+		return parser.cmdIf()
+	case lexer.TFor:
+		return parser.cmdFor()
+	case lexer.TReceive:
+		return parser.cmdReceive()
+	case lexer.TSend:
+		return parser.cmdSend()
+	case lexer.TAppend:
+		return parser.cmdAppend()
+	case lexer.TIntegrate:
+		return parser.cmdIntegrate()
+	case lexer.TDetach:
+		parser.accumulateRule("<CMD_DETACH> ::= '(' <PARAMETERS_CALL> ')' <ID> 'Detach'")
+		call, err := parser.detach()
+		if err != nil {
+			return nil, err
+		}
+		return &ast.CmdCall{Call: call}, nil
+	case lexer.TId:
+		// Declarations, assignments and calls all start with an identifier when read from right to left, so the
+		// identifier is consumed here and the token after it decides which command is being parsed.
+		name, position := parser.current.Lexeme, parser.position
+		parser.displayToken()
+		if err := parser.advanceToken(); err != nil {
+			return nil, err
+		}
 
-		// Parse parameters
-		if err := parser.parametersCall(); err != nil {
-			return err
+		switch parser.current.Kind {
+		case lexer.TColon:
+			return parser.cmdDeclaration(name, position)
+		case lexer.TAttributionOperator, lexer.TCloseBrackets:
+			return parser.cmdAssignment(name, position)
+		case lexer.TCloseParentheses:
+			parser.accumulateRule("<CMD_CALL> ::= '(' <PARAMETERS_CALL> ')' <ID>")
+			call, err := parser.call(name, position)
+			if err != nil {
+				return nil, err
+			}
+			return &ast.CmdCall{Call: call}, nil
 		}
 
-		return nil
+		return nil, parser.handleSyntaxError(
+			fmt.Errorf("expected a declaration, assignment or call of '%s', got %s", name, parser.current.Lexeme))
 	}
 
 	// If no command matches, it's a syntax error
-	return parser.handleSyntaxError(fmt.Errorf("unrecognized command starting with token %s", parser.lexeme))
+	return nil, parser.handleSyntaxError(fmt.Errorf("unrecognized command starting with token %s", parser.current.Lexeme))
 }
 
 // <CMD_IF> :
@@ -425,738 +662,1120 @@ func (parser *Parser) cmd() error {
 // <CMD_IF> ::= '{' <CMDS> '}' <CONDITION> 'if'
 // <CMD_IF> ::= '{' <CMDS> '}' 'else' '{' <CMDS> '}' <CONDITION> 'if'
 // <CMD_IF> ::= <CMD_ELIF> '{' <CMDS> '}' <CONDITION> 'if'
-func (parser *Parser) cmdIf() error {
+func (parser *Parser) cmdIf() (*ast.CmdIf, error) {
 	parser.accumulateRule("<CMD_IF> ::= '{' <CMDS> '}' 'if' <CONDITION> | '{' <CMDS> '}' 'else' '{' <CMDS> '}' 'if' <CONDITION> | <CMD_ELIF> '{' <CMDS> '}' 'if' <CONDITION>")
+	command := &ast.CmdIf{Position: parser.position}
 
 	// Expect 'if'
-	if parser.token != lexer.TIf {
-		return parser.handleSyntaxError(fmt.Errorf("expected 'if', got %s", parser.lexeme))
+	if parser.current.Kind != lexer.TIf {
+		return nil, parser.handleSyntaxError(fmt.Errorf("expected 'if', got %s", parser.current.Lexeme))
 	}
 	parser.displayToken()
 	if err := parser.advanceToken(); err != nil {
-		return err
+		return nil, err
 	}
 
 	// Expect <CONDITION>
-	if err := parser.condition(); err != nil {
-		return err
-	}
-
-	// Expect '}'
-	if parser.token != lexer.TCloseBraces {
-		return parser.handleSyntaxError(fmt.Errorf(errExpectedCloseBraces, parser.lexeme))
-	}
-	parser.displayToken()
-	if err := parser.advanceToken(); err != nil {
-		return err
-	}
-
-	// Expect <CMDS>
-	if err := parser.cmds(); err != nil {
-		return err
+	condition, err := parser.condition()
+	if err != nil {
+		return nil, err
 	}
+	command.Condition = condition
 
-	// Expect '{'
-	if parser.token != lexer.TOpenBraces {
-		return parser.handleSyntaxError(fmt.Errorf(errExpectedOpenBraces, parser.lexeme))
-	}
-	parser.displayToken()
-	if err := parser.advanceToken(); err != nil {
-		return err
+	// Expect '{' <CMDS> '}'
+	then, err := parser.block()
+	if err != nil {
+		return nil, err
 	}
+	command.Then = then
 
 	// Check for 'elif'
-	for parser.token == lexer.TElif {
-		if err := parser.cmdElif(); err != nil {
-			return err
+	for parser.current.Kind == lexer.TElif {
+		elif, err := parser.cmdElif()
+		if err != nil {
+			return nil, err
 		}
+		command.Elifs = append(command.Elifs, elif)
 	}
 
 	// Check for 'else'
-	if parser.token == lexer.TElse {
-		parser.displayToken()
-		if err := parser.advanceToken(); err != nil {
-			return err
-		}
-		// Expect '}' after 'else' block
-		if parser.token != lexer.TCloseBraces {
-			return parser.handleSyntaxError(fmt.Errorf(errExpectedCloseBraces, parser.lexeme))
-		}
+	if parser.current.Kind == lexer.TElse {
 		parser.displayToken()
 		if err := parser.advanceToken(); err != nil {
-			return err
-		}
-		// Expect <CMDS> for 'else' block
-		if err := parser.cmds(); err != nil {
-			return err
-		}
-		// Expect '{' for 'else' block
-		if parser.token != lexer.TOpenBraces {
-			return parser.handleSyntaxError(fmt.Errorf(errExpectedOpenBraces, parser.lexeme))
+			return nil, err
 		}
-		parser.displayToken()
-		if err := parser.advanceToken(); err != nil {
-			return err
+
+		// Expect '{' <CMDS> '}' for 'else' block
+		otherwise, err := parser.block()
+		if err != nil {
+			return nil, err
 		}
+		command.Else = otherwise
 	}
 
-	return nil
+	return command, nil
 }
 
 // <CMD_ELIF> :
 //
 // <CMD_ELIF> ::= '{' <CMDS> '}' <CONDITION> 'elif'
-// <CMD_ELIF> ::= <CMD_ELIF_REST>
-func (parser *Parser) cmdElif() error {
-	parser.accumulateRule("<CMD_ELIF> ::= '{' <CMDS> '}' 'elif' <CONDITION> | <CMD_ELIF_REST>")
-
-	// If the current token is TElif, it's a direct elif. Otherwise, it must be CMD_ELIF_REST.
-	if parser.token != lexer.TElif {
-		return parser.cmdElifRest()
-	}
+func (parser *Parser) cmdElif() (*ast.CmdElif, error) {
+	parser.accumulateRule("<CMD_ELIF> ::= '{' <CMDS> '}' 'elif' <CONDITION>")
+	command := &ast.CmdElif{Position: parser.position}
 
 	// Expect 'elif'
+	if parser.current.Kind != lexer.TElif {
+		return nil, parser.handleSyntaxError(fmt.Errorf("expected 'elif', got %s", parser.current.Lexeme))
+	}
 	parser.displayToken()
 	if err := parser.advanceToken(); err != nil {
-		return err
+		return nil, err
 	}
 
 	// Expect <CONDITION>
-	if err := parser.condition(); err != nil {
-		return err
+	condition, err := parser.condition()
+	if err != nil {
+		return nil, err
 	}
+	command.Condition = condition
 
-	// Expect '}'
-	if parser.token != lexer.TCloseBraces {
-		return parser.handleSyntaxError(fmt.Errorf(errExpectedCloseBraces, parser.lexeme))
+	// Expect '{' <CMDS> '}'
+	body, err := parser.block()
+	if err != nil {
+		return nil, err
+	}
+	command.Body = body
+
+	return command, nil
+}
+
+// <CMD_FOR> :
+// <CMD_FOR> ::= '{' <CMDS> '}' <CONDITION> 'for'
+// <CMD_FOR> ::= '{' <CMDS> '}' <E> '=:' <TYPE> ':' <VAR> 'for'
+//
+// A <VAR> followed by ':' cannot start a <CONDITION>, so it marks the loop over the elements of an Assembly.
+func (parser *Parser) cmdFor() (*ast.CmdFor, error) {
+	parser.accumulateRule("<CMD_FOR> ::= '{' <CMDS> '}' <CONDITION> 'for' | '{' <CMDS> '}' <E> '=:' <TYPE> ':' <VAR> 'for'")
+	command := &ast.CmdFor{Position: parser.position}
+
+	// Expect 'for'
+	if parser.current.Kind != lexer.TFor {
+		return nil, parser.handleSyntaxError(fmt.Errorf("expected 'for', got %s", parser.current.Lexeme))
 	}
 	parser.displayToken()
 	if err := parser.advanceToken(); err != nil {
-		return err
+		return nil, err
 	}
 
-	// Expect <CMDS>
-	if err := parser.cmds(); err != nil {
-		return err
+	iteration := false
+	if parser.current.Kind == lexer.TId {
+		next, err := parser.peek()
+		if err != nil {
+			return nil, err
+		}
+		iteration = next == lexer.TColon
 	}
 
-	// Expect '{'
-	if parser.token != lexer.TOpenBraces {
-		return parser.handleSyntaxError(fmt.Errorf(errExpectedOpenBraces, parser.lexeme))
+	if iteration {
+		// Expect <VAR> ':' <TYPE> '=:' <E>
+		if err := parser.iteration(command); err != nil {
+			return nil, err
+		}
+	} else {
+		// Expect <CONDITION>
+		condition, err := parser.condition()
+		if err != nil {
+			return nil, err
+		}
+		command.Condition = condition
 	}
-	parser.displayToken()
-	if err := parser.advanceToken(); err != nil {
-		return err
+
+	// Expect '{' <CMDS> '}'
+	body, err := parser.block()
+	if err != nil {
+		return nil, err
 	}
+	command.Body = body
 
-	return nil
+	return command, nil
 }
 
-// <CMD_ELIF_REST> :
-//
-// <CMD_ELIF_REST> ::= <CMD_ELIF_REST> '{' <CMDS> '}' <CONDITION> 'elif'
-// <CMD_ELIF_REST> ::= '{' <CMDS> '}' 'else' <CMD_ELIF_REST> '{' <CMDS> '}' <CONDITION> 'elif'
-// <CMD_ELIF_REST> ::= ε
-func (parser *Parser) cmdElifRest() error {
-	parser.accumulateRule("<CMD_ELIF_REST> ::= '{' <CMDS> '}' 'elif' <CONDITION> <CMD_ELIF_REST> | '{' <CMDS> '}' 'else' '{' <CMDS> '}' 'elif' <CONDITION> <CMD_ELIF_REST> | ε")
-
-	// If the next token is not 'elif', it's epsilon.
-	if parser.token != lexer.TElif {
-		parser.accumulateRule("<CMD_ELIF_REST> ::= ε")
-		return nil
-	}
-
-	// Expect 'elif'
-	parser.displayToken()
-	if err := parser.advanceToken(); err != nil {
-		return err
-	}
-
-	// Expect <CONDITION>
-	if err := parser.condition(); err != nil {
-		return err
-	}
-
-	// Expect '}'
-	if parser.token != lexer.TCloseBraces {
-		return parser.handleSyntaxError(fmt.Errorf(errExpectedCloseBraces, parser.lexeme))
-	}
-	parser.displayToken()
-	if err := parser.advanceToken(); err != nil {
-		return err
-	}
-
-	// Expect <CMDS>
-	if err := parser.cmds(); err != nil {
-		return err
-	}
-
-	// Expect '{'
-	if parser.token != lexer.TOpenBraces {
-		return parser.handleSyntaxError(fmt.Errorf(errExpectedOpenBraces, parser.lexeme))
-	}
-	parser.displayToken()
-	if err := parser.advanceToken(); err != nil {
-		return err
-	}
-
-	// Check for 'else'
-	if parser.token == lexer.TElse {
-		parser.displayToken()
-		if err := parser.advanceToken(); err != nil {
-			return err
-		}
-		// Expect '}' after 'else' block
-		if parser.token != lexer.TCloseBraces {
-			return parser.handleSyntaxError(fmt.Errorf(errExpectedCloseBraces, parser.lexeme))
-		}
-		parser.displayToken()
-		if err := parser.advanceToken(); err != nil {
-			return err
-		}
-		// Expect <CMDS> for 'else' block
-		if err := parser.cmds(); err != nil {
-			return err
-		}
-		// Expect '{' for 'else' block
-		if parser.token != lexer.TOpenBraces {
-			return parser.handleSyntaxError(fmt.Errorf(errExpectedOpenBraces, parser.lexeme))
-		}
-		parser.displayToken()
-		if err := parser.advanceToken(); err != nil {
-			return err
-		}
-	}
-
-	// Recursive call for CMD_ELIF_REST
-	if err := parser.cmdElifRest(); err != nil {
+// iteration :
+// Parses "<E> '=:' <TYPE> ':' <VAR>" of a <CMD_FOR> that goes over the elements of an Assembly. It reads like the
+// declaration of the variable that holds each element.
+func (parser *Parser) iteration(command *ast.CmdFor) error {
+	// Expect <VAR>
+	command.NamePosition = parser.position
+	name, err := parser.varToken()
+	if err != nil {
 		return err
 	}
+	command.Name = name
 
-	return nil
-}
-
-// <CMD_FOR> :
-// <CMD_FOR> ::= '{' <CMDS> '}' <CONDITION> 'for'
-func (parser *Parser) cmdFor() error {
-	parser.accumulateRule("<CMD_FOR> ::= '{' <CMDS> '}' <CONDITION> 'for'")
-
-	// Expect 'for'
-	if parser.token != lexer.TFor {
-		return parser.handleSyntaxError(fmt.Errorf("expected 'for', got %s", parser.lexeme))
+	// Expect ':'
+	if parser.current.Kind != lexer.TColon {
+		return parser.handleExpectedToken(errExpectedColon, ":")
 	}
 	parser.displayToken()
 	if err := parser.advanceToken(); err != nil {
 		return err
 	}
 
-	// Expect <CONDITION>
-	if err := parser.condition(); err != nil {
+	// Expect <TYPE>
+	typ, err := parser.typeToken()
+	if err != nil {
 		return err
 	}
+	command.Type = typ
 
-	// Expect '}'
-	if parser.token != lexer.TCloseBraces {
-		return parser.handleSyntaxError(fmt.Errorf("expected '}', got %s", parser.lexeme))
+	// Expect '=:'
+	if parser.current.Kind != lexer.TDeclarationOperator {
+		return parser.handleSyntaxError(fmt.Errorf("expected '=:', got %s", parser.current.Lexeme))
 	}
 	parser.displayToken()
 	if err := parser.advanceToken(); err != nil {
 		return err
 	}
 
-	// Expect <CMDS>
-	if err := parser.cmds(); err != nil {
-		return err
-	}
-
-	// Expect '{'
-	if parser.token != lexer.TOpenBraces {
-		return parser.handleSyntaxError(fmt.Errorf(errExpectedOpenBraces, parser.lexeme))
-	}
-	parser.displayToken()
-	if err := parser.advanceToken(); err != nil {
+	// Expect <E>
+	elements, err := parser.e()
+	if err != nil {
 		return err
 	}
-
+	command.Elements = elements
 	return nil
 }
 
 // <CMD_INTEGRATE> :
 //
 // <CMD_INTEGRATE> ::= <E> 'Integrate'
-func (parser *Parser) cmdIntegrate() error {
+func (parser *Parser) cmdIntegrate() (*ast.CmdIntegrate, error) {
 	parser.accumulateRule("<CMD_INTEGRATE> ::= <E> 'Integrate'")
+	command := &ast.CmdIntegrate{Position: parser.position}
 
 	// Expect 'Integrate'
-	if parser.token != lexer.TIntegrate {
-		return parser.handleSyntaxError(fmt.Errorf("expected 'Integrate', got %s", parser.lexeme))
+	if parser.current.Kind != lexer.TIntegrate {
+		return nil, parser.handleSyntaxError(fmt.Errorf("expected 'Integrate', got %s", parser.current.Lexeme))
 	}
 	parser.displayToken()
 	if err := parser.advanceToken(); err != nil {
-		return err
+		return nil, err
 	}
 
 	// Expect <E>
-	if err := parser.e(); err != nil {
-		return err
+	value, err := parser.e()
+	if err != nil {
+		return nil, err
 	}
+	command.Value = value
 
-	return nil
+	return command, nil
 }
 
 // <CMD_DECLARATION> :
 //
 // <CMD_DECLARATION> ::= <E> '=:' <TYPE> ':' <VAR>
-func (parser *Parser) cmdDeclaration() error {
+//
+// The <VAR> has already been consumed by cmd.
+func (parser *Parser) cmdDeclaration(name string, position ast.Pos) (*ast.CmdDeclaration, error) {
 	parser.accumulateRule("<CMD_DECLARATION> ::= <E> '=:' <TYPE> ':' <VAR>")
-
-	// Expect <VAR>
-	if err := parser.varToken(); err != nil {
-		return err
-	}
+	command := &ast.CmdDeclaration{Position: position, Name: name}
 
 	// Expect ':'
-	if parser.token != lexer.TColon {
-		return parser.handleSyntaxError(fmt.Errorf(errExpectedColon, parser.lexeme))
+	if parser.current.Kind != lexer.TColon {
+		return nil, parser.handleExpectedToken(errExpectedColon, ":")
 	}
 	parser.displayToken()
 	if err := parser.advanceToken(); err != nil {
-		return err
+		return nil, err
 	}
 
 	// Expect <TYPE>
-	if err := parser.typeToken(); err != nil {
-		return err
+	typ, err := parser.typeToken()
+	if err != nil {
+		return nil, err
 	}
+	command.Type = typ
 
 	// Expect '=:'
-	if parser.token != lexer.TDeclarationOperator {
-		return parser.handleSyntaxError(fmt.Errorf("expected '=:', got %s", parser.lexeme))
+	if parser.current.Kind != lexer.TDeclarationOperator {
+		return nil, parser.handleSyntaxError(fmt.Errorf("expected '=:', got %s", parser.current.Lexeme))
 	}
 	parser.displayToken()
 	if err := parser.advanceToken(); err != nil {
-		return err
+		return nil, err
 	}
 
 	// Expect <E>
-	if err := parser.e(); err != nil {
-		return err
+	value, err := parser.e()
+	if err != nil {
+		return nil, err
 	}
+	command.Value = value
 
-	return nil
+	return command, nil
 }
 
 // <CMD_ASSIGNMENT> :
 //
 // <CMD_ASSIGNMENT> ::= <E> '=' <VAR>
-// <CMD_ASSIGNMENT> :
+// <CMD_ASSIGNMENT> ::= <E> '=' '[' <E> ']' <VAR>
 //
-// <CMD_ASSIGNMENT> ::= <E> '=' <VAR>
-func (parser *Parser) cmdAssignment() error {
-	parser.accumulateRule("<CMD_ASSIGNMENT> ::= <E> '=' <VAR>")
-
-	// Expect <VAR>
-	if err := parser.varToken(); err != nil {
-		return err
+// The <VAR> has already been consumed by cmd.
+func (parser *Parser) cmdAssignment(name string, position ast.Pos) (*ast.CmdAssignment, error) {
+	parser.accumulateRule("<CMD_ASSIGNMENT> ::= <E> '=' <VAR> | <E> '=' '[' <E> ']' <VAR>")
+	command := &ast.CmdAssignment{Position: position, Name: name}
+
+	// Optionally parse the '[' <E> ']' of an element
+	if parser.current.Kind == lexer.TCloseBrackets {
+		index, err := parser.index()
+		if err != nil {
+			return nil, err
+		}
+		command.Index = index
 	}
 
 	// Expect '='
-	if parser.token != lexer.TAttributionOperator {
-		return parser.handleSyntaxError(fmt.Errorf("expected '=', got %s", parser.lexeme))
+	if parser.current.Kind != lexer.TAttributionOperator {
+		return nil, parser.handleSyntaxError(fmt.Errorf("expected '=', got %s", parser.current.Lexeme))
 	}
 	parser.displayToken()
 	if err := parser.advanceToken(); err != nil {
-		return err
+		return nil, err
 	}
 
 	// Expect <E>
-	if err := parser.e(); err != nil {
-		return err
+	value, err := parser.e()
+	if err != nil {
+		return nil, err
 	}
+	command.Value = value
 
-	return nil
+	return command, nil
 }
 
 // <CMD_RECEIVE> :
 //
 // <CMD_RECEIVE> ::= '(' <VAR> ')' 'Receive'
-func (parser *Parser) cmdReceive() error {
-	parser.accumulateRule("<CMD_RECEIVE> ::= '(' <VAR> ')' 'Receive'")
+// <CMD_RECEIVE> ::= '(' <VAR> ')' <VAR> 'Receive'
+func (parser *Parser) cmdReceive() (*ast.CmdReceive, error) {
+	parser.accumulateRule("<CMD_RECEIVE> ::= '(' <VAR> ')' 'Receive' | '(' <VAR> ')' <VAR> 'Receive'")
+	command := &ast.CmdReceive{Position: parser.position}
 
 	// Expect 'Receive'
-	if parser.token != lexer.TReceive {
-		return parser.handleSyntaxError(fmt.Errorf("expected 'Receive', got %s", parser.lexeme))
+	if parser.current.Kind != lexer.TReceive {
+		return nil, parser.handleSyntaxError(fmt.Errorf("expected 'Receive', got %s", parser.current.Lexeme))
 	}
 	parser.displayToken()
 	if err := parser.advanceToken(); err != nil {
-		return err
+		return nil, err
+	}
+
+	// Optionally parse the Channel <VAR>
+	channel, err := parser.channel()
+	if err != nil {
+		return nil, err
 	}
+	command.Channel = channel
 
 	// Expect ')'
-	if parser.token != lexer.TCloseParentheses {
-		return parser.handleSyntaxError(fmt.Errorf(errExpectedCloseParenthesis, parser.lexeme))
+	if parser.current.Kind != lexer.TCloseParentheses {
+		return nil, parser.handleExpectedToken(errExpectedCloseParenthesis, ")")
 	}
 	parser.displayToken()
 	if err := parser.advanceToken(); err != nil {
-		return err
+		return nil, err
 	}
 
 	// Expect <VAR>
-	if err := parser.varToken(); err != nil {
-		return err
+	command.NamePosition = parser.position
+	name, err := parser.varToken()
+	if err != nil {
+		return nil, err
 	}
+	command.Name = name
 
-	// Expect ')'
-	if parser.token != lexer.TOpenParentheses {
-		return parser.handleSyntaxError(fmt.Errorf(errExpectedOpenParenthesis, parser.lexeme))
+	// Expect '('
+	if parser.current.Kind != lexer.TOpenParentheses {
+		return nil, parser.handleExpectedToken(errExpectedOpenParenthesis, "(")
 	}
 	parser.displayToken()
 	if err := parser.advanceToken(); err != nil {
-		return err
+		return nil, err
 	}
 
-	return nil
+	return command, nil
 }
 
 // <CMD_SEND> :
 //
 // <CMD_SEND> ::= '(' <E> ')' 'Send'
-func (parser *Parser) cmdSend() error {
-	parser.accumulateRule("<CMD_SEND> ::= '(' <E> ')' 'Send'")
+// <CMD_SEND> ::= '(' <E> ')' <VAR> 'Send'
+func (parser *Parser) cmdSend() (*ast.CmdSend, error) {
+	parser.accumulateRule("<CMD_SEND> ::= '(' <E> ')' 'Send' | '(' <E> ')' <VAR> 'Send'")
+	command := &ast.CmdSend{Position: parser.position}
 
 	// Expect TSend (first, since lexing is bottom-up, right-to-left)
-	if parser.token != lexer.TSend {
-		return parser.handleSyntaxError(fmt.Errorf("expected 'Send', got %s", parser.lexeme))
+	if parser.current.Kind != lexer.TSend {
+		return nil, parser.handleSyntaxError(fmt.Errorf("expected 'Send', got %s", parser.current.Lexeme))
 	}
 	parser.displayToken()
 	if err := parser.advanceToken(); err != nil {
-		return err
+		return nil, err
 	}
 
+	// Optionally parse the Channel <VAR>
+	channel, err := parser.channel()
+	if err != nil {
+		return nil, err
+	}
+	command.Channel = channel
+
 	// Expect TCloseParentheses
-	if parser.token != lexer.TCloseParentheses {
-		return parser.handleSyntaxError(fmt.Errorf("expected ')', got %s", parser.lexeme))
+	if parser.current.Kind != lexer.TCloseParentheses {
+		return nil, parser.handleExpectedToken(errExpectedCloseParenthesis, ")")
 	}
 	parser.displayToken()
 	if err := parser.advanceToken(); err != nil {
-		return err
+		return nil, err
 	}
 
 	// Parse <E>
-	if err := parser.e(); err != nil {
-		return err
+	value, err := parser.e()
+	if err != nil {
+		return nil, err
 	}
+	command.Value = value
 
 	// Expect TOpenParentheses
-	if parser.token != lexer.TOpenParentheses {
-		return parser.handleSyntaxError(fmt.Errorf("expected '(', got %s", parser.lexeme))
+	if parser.current.Kind != lexer.TOpenParentheses {
+		return nil, parser.handleExpectedToken(errExpectedOpenParenthesis, "(")
 	}
 	parser.displayToken()
 	if err := parser.advanceToken(); err != nil {
-		return err
+		return nil, err
 	}
 
-	return nil
+	return command, nil
 }
 
-// <CONDITION> :
+// <CMD_APPEND> :
 //
-// <CONDITION> ::= <E> '>' <E>
-// <CONDITION> ::= <E> '>=' <E>
-// <CONDITION> ::= <E> '<>' <E>
-// <CONDITION> ::= <E> '<=' <E>
-// <CONDITION> ::= <E> '<' <E>
-// <CONDITION> ::= <E> '==' <E>
-func (parser *Parser) condition() error {
-	parser.accumulateRule("<CONDITION> ::= <E> '>' <E> | <E> '>=' <E> | <E> '<>' <E> | <E> '<=' <E> | <E> '<' <E> | <E> '==' <E>")
-
-	// All conditions are of the form <E> OPERATOR <E>
-	// Parse the second <E> (rightmost) first
-	if err := parser.e(); err != nil {
-		return err
+// <CMD_APPEND> ::= '(' <E> ')' <VAR> 'Append'
+func (parser *Parser) cmdAppend() (*ast.CmdAppend, error) {
+	parser.accumulateRule("<CMD_APPEND> ::= '(' <E> ')' <VAR> 'Append'")
+	command := &ast.CmdAppend{Position: parser.position}
+
+	// Expect 'Append'
+	if parser.current.Kind != lexer.TAppend {
+		return nil, parser.handleSyntaxError(fmt.Errorf("expected 'Append', got %s", parser.current.Lexeme))
+	}
+	parser.displayToken()
+	if err := parser.advanceToken(); err != nil {
+		return nil, err
 	}
 
-	// Expect a comparison operator
-	if parser.token != lexer.TGreaterThanOperator &&
-		parser.token != lexer.TGreaterEqualOperator &&
-		parser.token != lexer.TLessThanOperator &&
-		parser.token != lexer.TLessEqualOperator &&
-		parser.token != lexer.TNotEqualOperator &&
-		parser.token != lexer.TEqualOperator {
-		return parser.handleSyntaxError(fmt.Errorf("expected a comparison operator, got %s", parser.lexeme))
+	// Expect the Assembly <VAR>
+	if parser.current.Kind != lexer.TId {
+		return nil, parser.handleSyntaxError(fmt.Errorf(errExpectedIdentifier, parser.current.Lexeme))
 	}
+	command.Assembly = &ast.Identifier{Position: parser.position, Name: parser.current.Lexeme}
 	parser.displayToken()
 	if err := parser.advanceToken(); err != nil {
-		return err
+		return nil, err
 	}
 
-	// Parse the first <E> (leftmost)
-	if err := parser.e(); err != nil {
-		return err
+	// Expect ')'
+	if parser.current.Kind != lexer.TCloseParentheses {
+		return nil, parser.handleExpectedToken(errExpectedCloseParenthesis, ")")
+	}
+	parser.displayToken()
+	if err := parser.advanceToken(); err != nil {
+		return nil, err
 	}
 
-	return nil
+	// Expect <E>
+	value, err := parser.e()
+	if err != nil {
+		return nil, err
+	}
+	command.Value = value
+
+	// Expect '('
+	if parser.current.Kind != lexer.TOpenParentheses {
+		return nil, parser.handleExpectedToken(errExpectedOpenParenthesis, "(")
+	}
+	parser.displayToken()
+	if err := parser.advanceToken(); err != nil {
+		return nil, err
+	}
+
+	return command, nil
+}
+
+// channel :
+// Parses the optional Channel <VAR> of <CMD_SEND> and <CMD_RECEIVE>, which comes right after the keyword when read
+// from right to left. Returns nil when the command uses the standard input or output instead. An identifier is only
+// the Channel when ')' follows it, so in "(y Send" it is left as the value missing its ')'.
+func (parser *Parser) channel() (*ast.Identifier, error) {
+	if parser.current.Kind != lexer.TId {
+		return nil, nil
+	}
+	next, err := parser.peek()
+	if err != nil {
+		return nil, err
+	}
+	if next != lexer.TCloseParentheses {
+		return nil, nil
+	}
+	channel := &ast.Identifier{Position: parser.position, Name: parser.current.Lexeme}
+	parser.displayToken()
+	return channel, parser.advanceToken()
+}
+
+// <CONDITION> :
+// <CONDITION> ::= <E>
+//
+// Any <E> is accepted here; the type checker makes sure it gives a Switch.
+func (parser *Parser) condition() (ast.Expr, error) {
+	parser.accumulateRule("<CONDITION> ::= <E>")
+	return parser.e()
 }
 
 // <E> :
-// <E> ::= <E_REST> <T>
-func (parser *Parser) e() error {
-	parser.accumulateRule("<E> ::= <T> <E_REST>")
+// <E> ::= <E> '||' <AND>
+// <E> ::= <AND>
+//
+// '||' binds looser than '&&', which binds looser than '!', so "a > 1 || !b < 2 && c == 3" groups as
+// "a > 1 || ((!(b < 2)) && c == 3)". Like sumRest, the <AND> to the right of the operator is parsed first and the rest
+// of the <E> is its left operand, which keeps '||' left-associative in the source.
+func (parser *Parser) e() (ast.Expr, error) {
+	parser.accumulateRule("<E> ::= <E> '||' <AND> | <AND>")
 
-	if err := parser.t(); err != nil {
-		return err
+	right, err := parser.and()
+	if err != nil {
+		return nil, err
+	}
+	if parser.current.Kind != lexer.TOrOperator {
+		return right, nil
+	}
+
+	position := parser.position
+	parser.displayToken()
+	if err := parser.advanceToken(); err != nil {
+		return nil, err
+	}
+
+	left, err := parser.e() // recursive continuation
+	if err != nil {
+		return nil, err
 	}
-	return parser.eRest()
+
+	return &ast.BinaryExpr{Position: position, Operator: ast.OpOr, Left: left, Right: right}, nil
+}
+
+// and :
+// <AND> ::= <AND> '&&' <NOT>
+// <AND> ::= <NOT>
+func (parser *Parser) and() (ast.Expr, error) {
+	parser.accumulateRule("<AND> ::= <AND> '&&' <NOT> | <NOT>")
+
+	right, err := parser.not()
+	if err != nil {
+		return nil, err
+	}
+	if parser.current.Kind != lexer.TAndOperator {
+		return right, nil
+	}
+
+	position := parser.position
+	parser.displayToken()
+	if err := parser.advanceToken(); err != nil {
+		return nil, err
+	}
+
+	left, err := parser.and() // recursive continuation
+	if err != nil {
+		return nil, err
+	}
+
+	return &ast.BinaryExpr{Position: position, Operator: ast.OpAnd, Left: left, Right: right}, nil
 }
 
-// eRest :
-// <E_REST> ::= <E_REST> '+' <T>
-// <E_REST> ::= <E_REST> '-' <T>
-// <E_REST> ::= ε
-func (parser *Parser) eRest() error {
-	switch parser.token {
-	case lexer.TAdditionOperator, lexer.TSubtractionOperator:
+// not :
+// <NOT> ::= '!' <NOT>
+// <NOT> ::= <COMPARISON>
+//
+// Like a unary '-', the operand of a '!' is found before the '!' itself.
+func (parser *Parser) not() (ast.Expr, error) {
+	parser.accumulateRule("<NOT> ::= '!' <NOT> | <COMPARISON>")
+
+	operand, err := parser.comparison()
+	if err != nil {
+		return nil, err
+	}
+
+	for parser.current.Kind == lexer.TNotOperator {
+		position := parser.position
 		parser.displayToken()
 		if err := parser.advanceToken(); err != nil {
-			return err
-		}
-		if err := parser.t(); err != nil {
-			return err
+			return nil, err
 		}
-		return parser.eRest() // recursive continuation
+		operand = &ast.UnaryExpr{Position: position, Operator: ast.OpNot, Operand: operand}
+	}
+
+	return operand, nil
+}
+
+// <COMPARISON> :
+// <COMPARISON> ::= <SUM> '>' <SUM>
+// <COMPARISON> ::= <SUM> '>=' <SUM>
+// <COMPARISON> ::= <SUM> '!=' <SUM>
+// <COMPARISON> ::= <SUM> '<=' <SUM>
+// <COMPARISON> ::= <SUM> '<' <SUM>
+// <COMPARISON> ::= <SUM> '==' <SUM>
+// <COMPARISON> ::= <SUM>
+//
+// Comparisons do not chain, so "a == b == c" must be written with parentheses around one of them.
+func (parser *Parser) comparison() (ast.Expr, error) {
+	parser.accumulateRule("<COMPARISON> ::= <SUM> '>' <SUM> | <SUM> '>=' <SUM> | <SUM> '!=' <SUM> | " +
+		"<SUM> '<=' <SUM> | <SUM> '<' <SUM> | <SUM> '==' <SUM> | <SUM>")
+
+	// Parse the second <SUM> (rightmost) first
+	right, err := parser.sum()
+	if err != nil {
+		return nil, err
+	}
+
+	// Check for a comparison operator
+	var operator ast.Operator
+	switch parser.current.Kind {
+	case lexer.TGreaterThanOperator:
+		operator = ast.OpGreater
+	case lexer.TGreaterEqualOperator:
+		operator = ast.OpGreaterEqual
+	case lexer.TLessThanOperator:
+		operator = ast.OpLess
+	case lexer.TLessEqualOperator:
+		operator = ast.OpLessEqual
+	case lexer.TNotEqualOperator:
+		operator = ast.OpNotEqual
+	case lexer.TEqualOperator:
+		operator = ast.OpEqual
+	default:
+		return right, nil
+	}
+	position := parser.position
+	parser.displayToken()
+	if err := parser.advanceToken(); err != nil {
+		return nil, err
+	}
+
+	// Parse the first <SUM> (leftmost)
+	left, err := parser.sum()
+	if err != nil {
+		return nil, err
+	}
+
+	return &ast.BinaryExpr{Position: position, Operator: operator, Left: left, Right: right}, nil
+}
+
+// <SUM> :
+// <SUM> ::= <SUM_REST> <T>
+func (parser *Parser) sum() (ast.Expr, error) {
+	parser.accumulateRule("<SUM> ::= <T> <SUM_REST>")
+
+	right, err := parser.t()
+	if err != nil {
+		return nil, err
+	}
+	return parser.sumRest(right)
+}
+
+// sumRest :
+// <SUM_REST> ::= <SUM_REST> '+' <T>
+// <SUM_REST> ::= <SUM_REST> '-' <T>
+// <SUM_REST> ::= ε
+//
+// The <T> to the right of the operator has already been parsed and is passed as right. Everything still to be read
+// belongs to the left operand, which keeps '+' and '-' left-associative in the source.
+func (parser *Parser) sumRest(right ast.Expr) (ast.Expr, error) {
+	var operator ast.Operator
+	switch parser.current.Kind {
+	case lexer.TAdditionOperator:
+		operator = ast.OpAdd
+	case lexer.TSubtractionOperator:
+		operator = ast.OpSub
 	default:
 		// ε-production matched — stop parsing this rule
-		parser.accumulateRule("<E_REST> ::= ε")
-		return nil
+		parser.accumulateRule("<SUM_REST> ::= ε")
+		return right, nil
+	}
+
+	position := parser.position
+	parser.displayToken()
+	if err := parser.advanceToken(); err != nil {
+		return nil, err
 	}
+
+	left, err := parser.sum() // recursive continuation
+	if err != nil {
+		return nil, err
+	}
+
+	return &ast.BinaryExpr{Position: position, Operator: operator, Left: left, Right: right}, nil
 }
 
 // <T> :
-func (parser *Parser) t() error {
+// <T> ::= <F> <T_REST>
+func (parser *Parser) t() (ast.Expr, error) {
 	parser.accumulateRule("<T> ::= <F> <T_REST>")
 
-	if err := parser.f(); err != nil {
-		return err
+	right, err := parser.f()
+	if err != nil {
+		return nil, err
 	}
 
-	return parser.tRest()
+	return parser.tRest(right)
 }
 
-// <T_REST>
-func (parser *Parser) tRest() error {
-	switch parser.token {
-	case lexer.TMultiplicationOperator, lexer.TDivisionOperator, lexer.TModuleOperator:
-		parser.displayToken()
-		if err := parser.advanceToken(); err != nil {
-			return err
-		}
-		if err := parser.f(); err != nil {
-			return err
-		}
-		return parser.tRest() // recursive continuation
+// <T_REST> :
+// <T_REST> ::= '*' <F> <T_REST>
+// <T_REST> ::= '/' <F> <T_REST>
+// <T_REST> ::= '%' <F> <T_REST>
+// <T_REST> ::= ε
+//
+// Works like sumRest: right is the <F> already parsed, and the rest of the <T> is the left operand.
+func (parser *Parser) tRest(right ast.Expr) (ast.Expr, error) {
+	var operator ast.Operator
+	switch parser.current.Kind {
+	case lexer.TMultiplicationOperator:
+		operator = ast.OpMul
+	case lexer.TDivisionOperator:
+		operator = ast.OpDiv
+	case lexer.TModuleOperator:
+		operator = ast.OpMod
 	default:
 		// ε-production matched — stop
 		parser.accumulateRule("<T_REST> ::= ε")
-		return nil
+		return right, nil
+	}
+
+	position := parser.position
+	parser.displayToken()
+	if err := parser.advanceToken(); err != nil {
+		return nil, err
 	}
+
+	left, err := parser.t() // recursive continuation
+	if err != nil {
+		return nil, err
+	}
+
+	return &ast.BinaryExpr{Position: position, Operator: operator, Left: left, Right: right}, nil
 }
 
-// <F>
-func (parser *Parser) f() error {
+// <F> :
+// <F> ::= -<F>
+// <F> ::= <X>
+//
+// Reading from right to left, the operand of a unary '-' is found before the sign itself. A '-' is only unary when
+// the token after it cannot end an operand or is on another line, since a command never continues on the line above;
+// otherwise it is a subtraction and is left for sumRest.
+func (parser *Parser) f() (ast.Expr, error) {
 	parser.accumulateRule("<F> ::= -<F> | <X>")
 
-	if parser.token == lexer.TSubtractionOperator {
-		parser.displayToken()
-		if err := parser.advanceToken(); err != nil {
-			return err
+	operand, err := parser.x()
+	if err != nil {
+		return nil, err
+	}
+
+	for parser.current.Kind == lexer.TSubtractionOperator {
+		next, err := parser.peek()
+		if err != nil {
+			return nil, err
 		}
-		if err := parser.f(); err != nil {
-			return err
+		if endsOperand(next) && parser.next.Span.End.Line == parser.current.Span.Start.Line {
+			break
 		}
-	} else {
-		if err := parser.x(); err != nil {
-			return err
+
+		position := parser.position
+		parser.displayToken()
+		if err := parser.advanceToken(); err != nil {
+			return nil, err
 		}
+		operand = &ast.UnaryExpr{Position: position, Operator: ast.OpNeg, Operand: operand}
 	}
-	return nil
+
+	return operand, nil
 }
 
 // <X> :
-func (parser *Parser) x() error {
-	parser.accumulateRule("<X> ::= '(' <E> ')' | [0-9]+('.'[0-9]+) | <STRING> | <NIL> | <VAR> | '(' <PARAMETERS_CALL> ')' <ID>")
-
-	switch parser.token {
+// <X> ::= '(' <E> ')'
+// <X> ::= [0-9]+('.'[0-9]+)
+// <X> ::= <STRING>
+// <X> ::= <NIL>
+// <X> ::= 'true'
+// <X> ::= 'false'
+// <X> ::= <VAR>
+// <X> ::= '(' <PARAMETERS_CALL> ')' <ID>
+// <X> ::= '(' <PARAMETERS_CALL> ')' <ID> 'Detach'
+// <X> ::= '(' [<PARAMETERS_CALL>] ')' <ELEMENT_TYPE> 'Assembly'
+// <X> ::= '[' <E> ']' <VAR>
+// <X> ::= '(' <E> ')' 'Length'
+func (parser *Parser) x() (ast.Expr, error) {
+	parser.accumulateRule("<X> ::= '(' <E> ')' | [0-9]+('.'[0-9]+) | <STRING> | <NIL> | 'true' | 'false' | <VAR> | " +
+		"'(' <PARAMETERS_CALL> ')' <ID> | '(' <PARAMETERS_CALL> ')' <ID> 'Detach' | " +
+		"'(' [<PARAMETERS_CALL>] ')' <ELEMENT_TYPE> 'Assembly' | '[' <E> ']' <VAR> | '(' <E> ')' 'Length'")
+	position := parser.position
+
+	switch parser.current.Kind {
 
 	// Case: STRING literal
 	case lexer.TDoubleQuote:
+		parser.accumulateRule("<STRING> ::= '\"' <TEXT> '\"'")
+		value := parser.current.Value
+		parser.displayToken()
+		return &ast.OmnidroneLiteral{Position: position, Value: value}, parser.advanceToken()
+
+	// Case: raw string literal
+	case lexer.TBacktick:
+		parser.accumulateRule("<STRING> ::= '`' <RAW_TEXT> '`'")
+		value := parser.current.Value
 		parser.displayToken()
-		return parser.advanceToken()
+		return &ast.OmnidroneLiteral{Position: position, Value: value, Raw: true}, parser.advanceToken()
+
+	// Case: single character literal
+	case lexer.TSingleQuote:
+		value := []rune(parser.current.Value)
+		if len(value) != 1 {
+			return nil, parser.handleSyntaxError(fmt.Errorf(compiler_error.InvalidMonodrone))
+		}
+		parser.displayToken()
+		return &ast.MonodroneLiteral{Position: position, Value: value[0]}, parser.advanceToken()
 
 	// Case: NIL
 	case lexer.TNil:
+		parser.accumulateRule("<NIL> ::= 'Nil'")
 		parser.displayToken()
-		return parser.advanceToken()
+		return &ast.NilLiteral{Position: position}, parser.advanceToken()
 
-	// Case: numeric literal (integer or float)
-	case lexer.TGear, lexer.TTensor:
+	// Case: Switch literal
+	case lexer.TTrue, lexer.TFalse:
+		value := parser.current.Kind == lexer.TTrue
 		parser.displayToken()
-		return parser.advanceToken()
+		return &ast.SwitchLiteral{Position: position, Value: value}, parser.advanceToken()
+
+	// Case: integer literal
+	case lexer.TGear:
+		value, err := strconv.ParseInt(parser.current.Lexeme, 10, 64)
+		if err != nil {
+			return nil, parser.handleSyntaxError(fmt.Errorf("invalid Gear literal %s", parser.current.Lexeme))
+		}
+		parser.displayToken()
+		return &ast.GearLiteral{Position: position, Value: value}, parser.advanceToken()
+
+	// Case: float literal
+	case lexer.TTensor:
+		value, err := strconv.ParseFloat(parser.current.Lexeme, 64)
+		if err != nil {
+			return nil, parser.handleSyntaxError(fmt.Errorf("invalid Tensor literal %s", parser.current.Lexeme))
+		}
+		parser.displayToken()
+		return &ast.TensorLiteral{Position: position, Value: value}, parser.advanceToken()
 
 	// Case: identifier (variable or function call)
 	case lexer.TId:
+		name := parser.current.Lexeme
+		parser.displayToken()
+		if err := parser.advanceToken(); err != nil {
+			return nil, err
+		}
+
+		// A ')' right after the identifier means it is the name of a called Architect, while a ']' means it is an
+		// Assembly whose element is read
+		switch parser.current.Kind {
+		case lexer.TCloseParentheses:
+			return parser.call(name, position)
+		case lexer.TCloseBrackets:
+			expr := &ast.IndexExpr{Position: parser.position, Assembly: &ast.Identifier{Position: position, Name: name}}
+			index, err := parser.index()
+			if err != nil {
+				return nil, err
+			}
+			expr.Index = index
+			return expr, nil
+		}
+		return &ast.Identifier{Position: position, Name: name}, nil
+
+	// Case: Assembly literal
+	case lexer.TAssembly:
+		typ, err := parser.assemblyType()
+		if err != nil {
+			return nil, err
+		}
+		literal := &ast.AssemblyLiteral{Position: position, Type: typ}
+
+		// Expect ')'
+		if parser.current.Kind != lexer.TCloseParentheses {
+			return nil, parser.handleExpectedToken(errExpectedCloseParenthesis, ")")
+		}
+		parser.displayToken()
+		if err := parser.advanceToken(); err != nil {
+			return nil, err
+		}
+
+		// Optionally parse <PARAMETERS_CALL>, which is omitted by an empty Assembly
+		if parser.current.Kind != lexer.TOpenParentheses {
+			elements, err := parser.parametersCall()
+			if err != nil {
+				return nil, err
+			}
+			literal.Elements = elements
+		}
+
+		// Expect '('
+		if parser.current.Kind != lexer.TOpenParentheses {
+			return nil, parser.handleExpectedToken(errExpectedOpenParenthesis, "(")
+		}
+		parser.displayToken()
+		return literal, parser.advanceToken()
+
+	// Case: length of an Assembly
+	case lexer.TLength:
+		parser.displayToken()
+		if err := parser.advanceToken(); err != nil {
+			return nil, err
+		}
+
+		// Expect ')'
+		if parser.current.Kind != lexer.TCloseParentheses {
+			return nil, parser.handleExpectedToken(errExpectedCloseParenthesis, ")")
+		}
+		parser.displayToken()
+		if err := parser.advanceToken(); err != nil {
+			return nil, err
+		}
+
+		assembly, err := parser.e()
+		if err != nil {
+			return nil, err
+		}
+
+		// Expect '('
+		if parser.current.Kind != lexer.TOpenParentheses {
+			return nil, parser.handleExpectedToken(errExpectedOpenParenthesis, "(")
+		}
 		parser.displayToken()
-		return parser.advanceToken()
+		return &ast.LengthExpr{Position: position, Assembly: assembly}, parser.advanceToken()
 
-	// Case: open parentheses — could be (E) or (PARAMS_CALL) ID
+	// Case: detached call, which the semantic analysis rejects since it has no result
+	case lexer.TDetach:
+		return parser.detach()
+
+	// Case: parenthesized expression
 	case lexer.TCloseParentheses:
 		parser.displayToken()
 		if err := parser.advanceToken(); err != nil {
-			return err
+			return nil, err
 		}
 
-		// Try to parse parametersCall (supports multiple expressions)
-		if err := parser.parametersCall(); err != nil {
-			return err
+		inner, err := parser.e()
+		if err != nil {
+			return nil, err
 		}
 
 		// Expect matching opening parenthesis
-		if parser.token != lexer.TOpenParentheses {
-			return parser.handleSyntaxError(fmt.Errorf("expected '(', got %s", parser.lexeme))
+		if parser.current.Kind != lexer.TOpenParentheses {
+			return nil, parser.handleExpectedToken(errExpectedOpenParenthesis, "(")
 		}
 		parser.displayToken()
 		if err := parser.advanceToken(); err != nil {
-			return err
+			return nil, err
 		}
 
-		return nil
+		return inner, nil
 	}
 
 	// If no valid rule matches, return error
-	return parser.handleSyntaxError(fmt.Errorf("unexpected token in <X>: %s", parser.lexeme))
+	return nil, parser.handleSyntaxError(fmt.Errorf("unexpected token in <X>: %s", parser.current.Lexeme))
 }
 
-func (parser *Parser) nilToken() error {
-	parser.accumulateRule("<NIL> :: 'Nil'")
+// call :
+// Parses "'(' <PARAMETERS_CALL> ')'" after the <ID> of a called Architect has been consumed. Used both by <CMD_CALL>
+// and by <X>.
+func (parser *Parser) call(name string, position ast.Pos) (*ast.CallExpr, error) {
+	call := &ast.CallExpr{Position: position, Name: name}
 
-	if parser.token != lexer.TNil {
-		return parser.handleSyntaxError(fmt.Errorf("expected 'Nil', got %s", parser.lexeme))
+	// Expect ')'
+	if parser.current.Kind != lexer.TCloseParentheses {
+		return nil, parser.handleExpectedToken(errExpectedCloseParenthesis, ")")
 	}
 	parser.displayToken()
 	if err := parser.advanceToken(); err != nil {
-		return err
+		return nil, err
 	}
-	return nil
-}
 
-// <STRING> :
-//
-// <STRING> ::= '"' <TEXT_WITH_NUMBERS> '"'
-func (parser *Parser) stringToken() error {
-	parser.accumulateRule("<STRING> ::= '\"' <TEXT_WITH_NUMBERS> '\"'")
+	// Optionally parse <PARAMETERS_CALL>
+	if parser.current.Kind != lexer.TOpenParentheses {
+		arguments, err := parser.parametersCall()
+		if err != nil {
+			return nil, err
+		}
+		call.Arguments = arguments
+	}
 
-	// The lexer identifies the entire string literal (including quotes) as TDoubleQuote.
-	// So, the parser just needs to consume the TDoubleQuote
-	if parser.token != lexer.TDoubleQuote {
-		return parser.handleSyntaxError(fmt.Errorf("expected a string literal, got %s", parser.lexeme))
+	// Expect '('
+	if parser.current.Kind != lexer.TOpenParentheses {
+		return nil, parser.handleExpectedToken(errExpectedOpenParenthesis, "(")
 	}
 	parser.displayToken()
 	if err := parser.advanceToken(); err != nil {
-		return err
+		return nil, err
 	}
-	return nil
+
+	return call, nil
 }
 
-// <VAR> :
-//
-// <VAR> ::= <ID>
-func (parser *Parser) varToken() error {
-	parser.accumulateRule("<VAR> ::= <ID>")
+// index :
+// Parses "'[' <E> ']'", starting at the ']' that follows the <VAR> of an Assembly when read from right to left. Used
+// both by <CMD_ASSIGNMENT> and by <X>.
+func (parser *Parser) index() (ast.Expr, error) {
+	// Expect ']'
+	if parser.current.Kind != lexer.TCloseBrackets {
+		return nil, parser.handleSyntaxError(fmt.Errorf("expected ']', got %s", parser.current.Lexeme))
+	}
+	parser.displayToken()
+	if err := parser.advanceToken(); err != nil {
+		return nil, err
+	}
 
-	if err := parser.id(); err != nil {
-		return err
+	index, err := parser.e()
+	if err != nil {
+		return nil, err
 	}
-	return nil
-}
 
-// <ID> :
-//
-// <ID> ::= (([A-Z]|[a-z])+(_|[0-9])*)+
-func (parser *Parser) id() error {
-	parser.accumulateRule("<ID> ::= (([A-Z]|[a-z])+(_|[0-9])*)+")
-	if parser.token != lexer.TId {
-		return parser.handleSyntaxError(fmt.Errorf(errExpectedIdentifier, parser.lexeme))
+	// Expect '['
+	if parser.current.Kind != lexer.TOpenBrackets {
+		return nil, parser.handleExpectedToken(errExpectedOpenBrackets, "[")
 	}
 	parser.displayToken()
 	if err := parser.advanceToken(); err != nil {
-		return err // Propagation of error
+		return nil, err
 	}
-	return nil
+	return index, nil
 }
 
-// <PARAMETERS_DECL> :
-//
-// <PARAMETERS_CALL> ::= <E>
-// <PARAMETERS_CALL> ::= <EXTRA_PARAMETERS_CALL> <E>
-// <EXTRA_PARAMETERS_CALL> ::= <E> ','
-// <EXTRA_PARAMETERS_CALL> ::= <EXTRA_PARAMETERS_CALL> <E> ','
-func (parser *Parser) parametersDecl() error {
-	parser.accumulateRule("<PARAMETERS> ::= <EXTRA_PARAMETERS> <TYPE> ':' <ID> | <TYPE> ':' <ID>")
-
-	// Expect ID (rightmost identifier in the parameter list)
-	if parser.token != lexer.TId {
-		return parser.handleSyntaxError(fmt.Errorf("expected parameter ID, got %s", parser.lexeme))
+// detach :
+// Parses "'(' <PARAMETERS_CALL> ')' <ID> 'Detach'", starting at the 'Detach' keyword. Used both by <CMD_DETACH> and
+// by <X>, so the semantic analysis can point out a detached call whose result is used.
+func (parser *Parser) detach() (*ast.CallExpr, error) {
+	// Expect 'Detach'
+	if parser.current.Kind != lexer.TDetach {
+		return nil, parser.handleSyntaxError(fmt.Errorf("expected 'Detach', got %s", parser.current.Lexeme))
 	}
 	parser.displayToken()
 	if err := parser.advanceToken(); err != nil {
-		return err
+		return nil, err
 	}
 
-	// Expect ':'
-	if parser.token != lexer.TColon {
-		return parser.handleSyntaxError(fmt.Errorf("expected ':', got %s", parser.lexeme))
+	// Expect <ID>
+	if parser.current.Kind != lexer.TId {
+		return nil, parser.handleSyntaxError(
+			fmt.Errorf("expected the ID of the detached Architect, got %s", parser.current.Lexeme))
 	}
+	name, position := parser.current.Lexeme, parser.position
 	parser.displayToken()
 	if err := parser.advanceToken(); err != nil {
-		return err
+		return nil, err
 	}
 
-	// Expect <TYPE>
-	if err := parser.typeToken(); err != nil {
-		return err
+	call, err := parser.call(name, position)
+	if err != nil {
+		return nil, err
 	}
+	call.Detached = true
+	return call, nil
+}
 
-	// Loop to check for extra parametersDecl (reverse order)
-	for parser.token == lexer.TComma {
-		parser.displayToken()
-		if err := parser.advanceToken(); err != nil {
-			return err
-		}
+// <VAR> :
+//
+// <VAR> ::= <ID>
+func (parser *Parser) varToken() (string, error) {
+	parser.accumulateRule("<VAR> ::= <ID>")
+	return parser.id()
+}
+
+// <ID> :
+//
+// <ID> ::= (([A-Z]|[a-z])+(_|[0-9])*)+
+func (parser *Parser) id() (string, error) {
+	parser.accumulateRule("<ID> ::= (([A-Z]|[a-z])+(_|[0-9])*)+")
+	if parser.current.Kind != lexer.TId {
+		return "", parser.handleSyntaxError(fmt.Errorf(errExpectedIdentifier, parser.current.Lexeme))
+	}
+	name := parser.current.Lexeme
+	parser.displayToken()
+	if err := parser.advanceToken(); err != nil {
+		return "", err // Propagation of error
+	}
+	return name, nil
+}
 
-		// Expect ID
-		if parser.token != lexer.TId {
-			return parser.handleSyntaxError(fmt.Errorf("expected parameter ID, got %s", parser.lexeme))
+// <PARAMETERS_DECL> :
+//
+// <PARAMETERS_DECL> ::= <EXTRA_PARAMETERS_DECL> <TYPE> ':' <ID> | <TYPE> ':' <ID>
+// <EXTRA_PARAMETERS_DECL> ::= <TYPE> ':' <ID> ','
+// <EXTRA_PARAMETERS_DECL> ::= <EXTRA_PARAMETERS_DECL> <TYPE> ':' <ID> ','
+//
+// The parameters are returned from left to right, as written in the source.
+func (parser *Parser) parametersDecl() ([]*ast.Parameter, error) {
+	parser.accumulateRule("<PARAMETERS> ::= <EXTRA_PARAMETERS> <TYPE> ':' <ID> | <TYPE> ':' <ID>")
+	parameters := make([]*ast.Parameter, 0)
+
+	for {
+		parameter := &ast.Parameter{Position: parser.position}
+
+		// Expect ID (rightmost identifier in the parameter list)
+		if parser.current.Kind != lexer.TId {
+			return nil, parser.handleSyntaxError(fmt.Errorf("expected parameter ID, got %s", parser.current.Lexeme))
 		}
+		parameter.Name = parser.current.Lexeme
 		parser.displayToken()
 		if err := parser.advanceToken(); err != nil {
-			return err
+			return nil, err
 		}
 
 		// Expect ':'
-		if parser.token != lexer.TColon {
-			return parser.handleSyntaxError(fmt.Errorf("expected ':', got %s", parser.lexeme))
+		if parser.current.Kind != lexer.TColon {
+			return nil, parser.handleExpectedToken(errExpectedColon, ":")
 		}
 		parser.displayToken()
 		if err := parser.advanceToken(); err != nil {
-			return err
+			return nil, err
 		}
 
 		// Expect <TYPE>
-		if err := parser.typeToken(); err != nil {
-			return err
+		typ, err := parser.typeToken()
+		if err != nil {
+			return nil, err
+		}
+		parameter.Type = typ
+
+		// Parameters are read from right to left, so each one goes in front of the previous
+		parameters = append([]*ast.Parameter{parameter}, parameters...)
+
+		// Loop to check for extra parametersDecl (reverse order)
+		if parser.current.Kind != lexer.TComma {
+			break
+		}
+		parser.displayToken()
+		if err := parser.advanceToken(); err != nil {
+			return nil, err
 		}
 	}
 
-	return nil
+	return parameters, nil
 }
 
 // <PARAMETERS_CALL>
@@ -1164,79 +1783,33 @@ func (parser *Parser) parametersDecl() error {
 // <PARAMETERS_CALL> ::= <E>
 // <PARAMETERS_CALL> ::= <EXTRA_PARAMETERS_CALL> <E>
 // <EXTRA_PARAMETERS_CALL> ::= <E> ',' | <EXTRA_PARAMETERS_CALL> <E> ','
-func (parser *Parser) parametersCall() error {
+//
+// The arguments are returned from left to right, as written in the source.
+func (parser *Parser) parametersCall() ([]ast.Expr, error) {
 	parser.accumulateRule("<PARAMETERS_CALL> ::= <EXTRA_PARAMETERS_CALL> <E> | <E>")
 
 	// Parse rightmost expression (last param)
-	if err := parser.e(); err != nil {
-		return err
+	argument, err := parser.e()
+	if err != nil {
+		return nil, err
 	}
+	arguments := []ast.Expr{argument}
 
 	// Repeatedly handle comma-separated expressions
-	for parser.token == lexer.TComma {
+	for parser.current.Kind == lexer.TComma {
 		parser.displayToken()
 		if err := parser.advanceToken(); err != nil {
-			return err
+			return nil, err
 		}
 
-		if err := parser.e(); err != nil {
-			return err
+		argument, err := parser.e()
+		if err != nil {
+			return nil, err
 		}
+		arguments = append([]ast.Expr{argument}, arguments...)
 	}
 
-	return nil
-}
-
-// <EXTRA_PARAMETERS> :
-//
-// <EXTRA_PARAMETERS> ::= ',' <ID> ':' <TYPE>
-// <EXTRA_PARAMETERS> ::= ',' <ID> ':' <TYPE> ',' <PARAMETERS>
-func (parser *Parser) extraParameters() error {
-	parser.accumulateRule("<EXTRA_PARAMETERS> ::= ',' <ID> ':' <TYPE> | ',' <ID> ':' <TYPE> ',' <PARAMETERS>")
-
-	// If there's a comma, it's a recursive call or a single extra parameter.
-	if parser.token == lexer.TComma {
-		// Consume the ','
-		parser.displayToken()
-		if err := parser.advanceToken(); err != nil {
-			return err
-		}
-
-		// Check for <TYPE>
-		if err := parser.typeToken(); err != nil {
-			return err
-		}
-
-		// Then ':'
-		if parser.token != lexer.TColon {
-			return parser.handleSyntaxError(fmt.Errorf(errExpectedColon, parser.lexeme))
-		}
-		parser.displayToken()
-		if err := parser.advanceToken(); err != nil {
-			return err
-		}
-
-		// Then <ID>
-		if err := parser.id(); err != nil {
-			return err
-		}
-
-		// After matching `ID : TYPE`, if the next token is also a `TComma`, then recursively call `extraParameters`.
-		if parser.token == lexer.TComma {
-			// Consume the comma for the recursive call
-			parser.displayToken()
-			if err := parser.advanceToken(); err != nil {
-				return err
-			}
-			if err := parser.parametersDecl(); err != nil {
-				return err
-			}
-		}
-
-	} else {
-		return parser.handleSyntaxError(fmt.Errorf("expected ',', got %s for extraParameters", parser.lexeme))
-	}
-	return nil
+	return arguments, nil
 }
 
 // advanceToken :
@@ -1245,44 +1818,222 @@ func (parser *Parser) extraParameters() error {
 // Fails if the lexer fails to get the next token.
 func (parser *Parser) advanceToken() error {
 	parser.logger.Debug("Advancing token...", nil)
+	parser.previous = parser.position
+	parser.previousLexeme = parser.current.Lexeme
+
+	// Use the token read by peek, if there is one
+	if parser.next != nil {
+		parser.current = *parser.next
+		parser.position = parser.current.Span.Start
+		parser.next = nil
+		return nil
+	}
 
-	token, err := parser.lexer.NextToken()
+	token, err := parser.lexer.Next()
 	if err != nil {
 		// The lexer logs its own errors. We just propagate it.
 		return err
 	}
 
-	parser.token = token
-	parser.lexeme = parser.lexer.GetLexeme()
+	parser.current = token
+	parser.position = parser.current.Span.Start
 
 	return nil
 }
 
+// peek :
+// Returns the token after the current one without consuming it.
+//
+// Fails if the lexer fails to get the next token.
+func (parser *Parser) peek() (int, error) {
+	if parser.next == nil {
+		token, err := parser.lexer.Next()
+		if err != nil {
+			return -1, err
+		}
+
+		parser.next = &token
+	}
+	return parser.next.Kind, nil
+}
+
+// endsOperand :
+// Checks if a token can be the last token of an operand in the source, which makes a '-' before it a subtraction.
+func endsOperand(token int) bool {
+	switch token {
+	case lexer.TId, lexer.TGear, lexer.TTensor, lexer.TDoubleQuote, lexer.TBacktick, lexer.TSingleQuote,
+		lexer.TNil, lexer.TTrue, lexer.TFalse, lexer.TDetach, lexer.TAssembly, lexer.TLength,
+		lexer.TCloseParentheses:
+		return true
+	default:
+		return false
+	}
+}
+
 // displayToken :
 // Displays the current token and lexeme if debug mode is enabled.
 func (parser *Parser) displayToken() {
 	if parser.debug {
-		parser.lexer.DisplayToken()
+		fmt.Println(lexer.DisplayTokenName(parser.current.Kind) + " ( " + parser.current.Lexeme + " )")
 	}
 }
 
 // handleSyntaxError :
-// Records and logs a syntax error, ensuring it is only logged once.
+// Records and logs a syntax error found at the current token. The productions return it until a command or an
+// Architect recovers from it.
 //
-// Returns a new error of type ErrSyntax.
+// Returns a new error of type ErrSyntax, or the error that stops the analysis once the error limit is reached.
 func (parser *Parser) handleSyntaxError(err error) error {
-	if parser.errorMessage == nil {
-		// Create the detailed error.
-		detailedErr := fmt.Errorf("%s at %s", err.Error(), parser.lexer.DisplayPos())
-		parser.errorMessage = compiler_error.SyntaxErrorf(compiler_error.SyntaxError, detailedErr)
-
-		// Log the structured error.
-		parser.logger.Error(parser.errorMessage, map[string]any{
-			"position": parser.lexer.DisplayPos(),
-			"lexeme":   parser.lexeme,
+	return parser.report(parser.diagnostic(compiler_error.CodeUnexpectedToken, err.Error()))
+}
+
+// handleExpectedToken :
+// Records and logs a syntax error for a missing symbol, formatting the message with the current lexeme. The lexer reads
+// each line from right to left, so the symbol is missing right before the token consumed last, not after the current
+// one: the suggested fix inserts replacement there.
+//
+// Returns a new error of type ErrSyntax, or the error that stops the analysis once the error limit is reached.
+func (parser *Parser) handleExpectedToken(format, replacement string) error {
+	diagnostic := parser.diagnostic(compiler_error.CodeExpectedToken, fmt.Sprintf(format, parser.current.Lexeme))
+
+	if diagnostic.Code == compiler_error.CodeExpectedToken && parser.previous.Line > 0 {
+		symbol := strings.TrimSpace(replacement)
+		diagnostic.Notes = append(diagnostic.Notes, fmt.Sprintf(
+			"Mechanus reads each line from right to left, so '%s' is expected right before '%s'", symbol,
+			parser.previousLexeme))
+		diagnostic.Fix = &compiler_error.Fix{
+			Message:     fmt.Sprintf("insert '%s'", symbol),
+			Span:        compiler_error.Span{Start: parser.previous, End: parser.previous},
+			Replacement: replacement,
+		}
+	}
+	return parser.report(diagnostic)
+}
+
+// diagnostic :
+// Builds the Diagnostic of a syntax error, underlining the current token. A character the lexer did not recognize is
+// reported with the lexer's own Diagnostic instead.
+//
+// When the current token is on a line above the command being parsed, the command ran out of tokens at the start of
+// its line, which is where the Diagnostic points: the current token belongs to the line above.
+func (parser *Parser) diagnostic(code, message string) *compiler_error.Diagnostic {
+	var lexical *compiler_error.Diagnostic
+	if parser.current.Kind == lexer.TLexError && errors.As(parser.lexer.Fail(), &lexical) {
+		return lexical
+	}
+
+	diagnostic := &compiler_error.Diagnostic{
+		Severity: compiler_error.SeverityError,
+		Kind:     compiler_error.ErrSyntax,
+		Code:     code,
+		File:     parser.lexer.FileName(),
+		Span:     parser.current.Span,
+		Message:  message,
+	}
+	if parser.lineEnded() {
+		diagnostic.Span = compiler_error.Span{Start: parser.previous, End: parser.previous}
+		diagnostic.Notes = append(diagnostic.Notes, fmt.Sprintf(noteLineEnded, parser.previousLexeme,
+			parser.current.Lexeme, parser.current.Span.Start.Line))
+	}
+	return diagnostic
+}
+
+// lineEnded :
+// Checks if the current token ends on a line above the command being parsed, so the command has no tokens left.
+func (parser *Parser) lineEnded() bool {
+	return parser.line > 0 && parser.current.Kind != lexer.TInputEnd && parser.current.Span.End.Line < parser.line
+}
+
+// report :
+// Records and logs a Diagnostic as a syntax error.
+//
+// Returns a new error of type ErrSyntax, or the error that stops the analysis once the error limit is reached.
+func (parser *Parser) report(diagnostic *compiler_error.Diagnostic) error {
+	syntaxErr := compiler_error.SyntaxErrorf(compiler_error.SyntaxError, diagnostic)
+	parser.errors = append(parser.errors, syntaxErr)
+
+	// Log the structured error.
+	parser.logger.Error(syntaxErr, map[string]any{
+		"position": parser.position.String(),
+		"lexeme":   parser.current.Lexeme,
+	})
+
+	if parser.maxErrors > 0 && len(parser.errors) >= parser.maxErrors {
+		limitErr := compiler_error.SyntaxErrorf(compiler_error.SyntaxError, &compiler_error.Diagnostic{
+			Severity: compiler_error.SeverityError,
+			Kind:     compiler_error.ErrSyntax,
+			Code:     compiler_error.CodeTooManyErrors,
+			File:     parser.lexer.FileName(),
+			Message:  fmt.Sprintf(compiler_error.TooManySyntaxErrors, len(parser.errors)),
 		})
+		parser.logger.Error(limitErr, nil)
+		return limitErr
+	}
+	return syntaxErr
+}
+
+// recoverable :
+// Checks if the parser can resume after an error: only the syntax error recorded last can be recovered from. Lexer
+// errors and the error limit stop the analysis.
+func (parser *Parser) recoverable(err error) bool {
+	return len(parser.errors) > 0 && err == parser.errors[len(parser.errors)-1]
+}
+
+// synchronizeCommand :
+// Skips the rest of a command after a syntax error. The lexer reads the file from the bottom up, so a command ends
+// where the next token is on a line above the token consumed last, or at the '{' that closes the enclosing block.
+// Braces are counted, so the blocks of the broken command are skipped as a whole.
+//
+// Fails if the lexer fails to get the next token.
+func (parser *Parser) synchronizeCommand() error {
+	depth := 0
+	for parser.current.Kind != lexer.TInputEnd {
+		if depth == 0 && (parser.current.Kind == lexer.TOpenBraces || parser.position.Line != parser.previous.Line) {
+			return nil
+		}
+		depth += braceDepth(parser.current.Kind)
+		parser.displayToken()
+		if err := parser.advanceToken(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// synchronizeArchitect :
+// Skips the rest of an Architect or State set after a syntax error, up to the 'Architect' keyword that starts the next
+// Architect, a 'State' keyword that ends its line and so starts a State set, or the '{' that opens the Construct.
+// Braces are counted like in synchronizeCommand.
+//
+// Fails if the lexer fails to get the next token.
+func (parser *Parser) synchronizeArchitect() error {
+	depth := 0
+	for parser.current.Kind != lexer.TInputEnd {
+		kind := parser.current.Kind
+		state := kind == lexer.TState && parser.position.Line != parser.previous.Line
+		if depth == 0 && (kind == lexer.TOpenBraces || kind == lexer.TArchitect || state) {
+			return nil
+		}
+		depth += braceDepth(kind)
+		parser.displayToken()
+		if err := parser.advanceToken(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// braceDepth :
+// Returns how a token changes the nesting of blocks, read from the bottom up: '}' opens a block and '{' closes it.
+func braceDepth(token int) int {
+	switch token {
+	case lexer.TCloseBraces:
+		return 1
+	case lexer.TOpenBraces:
+		return -1
+	default:
+		return 0
 	}
-	return parser.errorMessage
 }
 
 // accumulateRule :
@@ -1304,20 +2055,7 @@ func (parser *Parser) ShowRecognizedRules() {
 }
 
 // Fail :
-// Checks if the Parser failed during execution.
+// Checks if the Parser failed during execution, joining every error found.
 func (parser *Parser) Fail() error {
-	return parser.errorMessage
-}
-
-// Close :
-// Closes the input and output files used by the parser's lexer.
-func (parser *Parser) Close() {
-	parser.lexer.Close("input")
-	parser.lexer.Close("output")
-}
-
-// WriteOutput :
-// Writes the lexer's identified tokens to the output file.
-func (parser *Parser) WriteOutput() error {
-	return parser.lexer.WriteOutput()
+	return errors.Join(parser.errors...)
 }
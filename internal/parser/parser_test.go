@@ -0,0 +1,652 @@
+package parser_test
+
+import (
+	"mechanus-compiler/internal/ast"
+	"mechanus-compiler/internal/compiler_error"
+	"mechanus-compiler/internal/mechatest"
+	"mechanus-compiler/internal/parser"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestParser_Examples ensures that every example program is accepted and produces a Construct named main.
+func TestParser_Examples(t *testing.T) {
+	paths, err := filepath.Glob("../../docs/examples/example*_input.mecha")
+	if err != nil || len(paths) == 0 {
+		t.Fatalf("no examples found: %v", err)
+	}
+
+	for _, path := range paths {
+		source, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("failed to read %s: %v", path, err)
+		}
+
+		construct := mechatest.Parse(t, string(source))
+		if construct.Name != "main" {
+			t.Errorf("%s: expected Construct 'main', got '%s'", path, construct.Name)
+		}
+	}
+}
+
+// TestParser_Example3 checks the shape of the tree built for an Architect with parameters, a call and an if.
+func TestParser_Example3(t *testing.T) {
+	source, err := os.ReadFile("../../docs/examples/example3_input.mecha")
+	if err != nil {
+		t.Fatalf("failed to read example: %v", err)
+	}
+
+	construct := mechatest.Parse(t, string(source))
+
+	// Architects are found from the bottom of the file to the top
+	if len(construct.Architects) != 2 {
+		t.Fatalf("expected 2 Architects, got %d", len(construct.Architects))
+	}
+	main, test := construct.Architects[0], construct.Architects[1]
+	if main.Name != "main" || test.Name != "test" {
+		t.Fatalf("expected Architects 'main' and 'test', got '%s' and '%s'", main.Name, test.Name)
+	}
+
+	// Parameters are kept in source order
+	if len(test.Parameters) != 2 {
+		t.Fatalf("expected 2 parameters, got %d", len(test.Parameters))
+	}
+	if test.Parameters[0].Name != "y" || test.Parameters[0].Type != ast.TypeTensor {
+		t.Errorf("expected first parameter 'Tensor :y', got '%s :%s'", test.Parameters[0].Type, test.Parameters[0].Name)
+	}
+	if test.Parameters[1].Name != "x" || test.Parameters[1].Type != ast.TypeGear {
+		t.Errorf("expected second parameter 'Gear :x', got '%s :%s'", test.Parameters[1].Type, test.Parameters[1].Name)
+	}
+
+	// Commands are kept in execution order: the Send on the last line runs before the if written above it
+	commands := test.Body.Commands
+	if len(commands) != 2 {
+		t.Fatalf("expected 2 commands, got %d", len(commands))
+	}
+	if _, ok := commands[0].(*ast.CmdSend); !ok {
+		t.Errorf("expected the first command to be a Send, got %T", commands[0])
+	}
+	cmdIf, ok := commands[1].(*ast.CmdIf)
+	if !ok {
+		t.Fatalf("expected the second command to be an if, got %T", commands[1])
+	}
+
+	condition, ok := cmdIf.Condition.(*ast.BinaryExpr)
+	if !ok || condition.Operator != ast.OpLessEqual {
+		t.Fatalf("expected a '<=' condition, got %#v", cmdIf.Condition)
+	}
+	if left, ok := condition.Left.(*ast.Identifier); !ok || left.Name != "x" {
+		t.Errorf("expected 'x' on the left of the condition, got %#v", condition.Left)
+	}
+
+	if _, ok := cmdIf.Then.Commands[0].(*ast.CmdCall); !ok {
+		t.Errorf("expected the call to run first inside the if, got %T", cmdIf.Then.Commands[0])
+	}
+}
+
+// TestParser_Expressions checks precedence, associativity and unary minus.
+func TestParser_Expressions(t *testing.T) {
+	source := `{
+   {
+        a - b - c * -d =: Gear :x
+   } ()main Architect
+} main Construct`
+
+	construct := mechatest.Parse(t, source)
+
+	declaration, ok := construct.Architects[0].Body.Commands[0].(*ast.CmdDeclaration)
+	if !ok {
+		t.Fatalf("expected a declaration, got %T", construct.Architects[0].Body.Commands[0])
+	}
+
+	// Expect ((a - b) - (c * (-d)))
+	outer, ok := declaration.Value.(*ast.BinaryExpr)
+	if !ok || outer.Operator != ast.OpSub {
+		t.Fatalf("expected a subtraction at the root, got %#v", declaration.Value)
+	}
+	inner, ok := outer.Left.(*ast.BinaryExpr)
+	if !ok || inner.Operator != ast.OpSub {
+		t.Fatalf("expected 'a - b' on the left, got %#v", outer.Left)
+	}
+	product, ok := outer.Right.(*ast.BinaryExpr)
+	if !ok || product.Operator != ast.OpMul {
+		t.Fatalf("expected 'c * -d' on the right, got %#v", outer.Right)
+	}
+	if negation, ok := product.Right.(*ast.UnaryExpr); !ok || negation.Operator != ast.OpNeg {
+		t.Errorf("expected '-d' on the right of the product, got %#v", product.Right)
+	}
+}
+
+// TestParser_NegativeLineStart ensures that a '-' starting a line is unary, even below a line that ends with an
+// operand.
+func TestParser_NegativeLineStart(t *testing.T) {
+	source := `{
+   {
+        -5 - d =: Gear :m
+        -1 =: Gear :d
+        1 =: Gear :c
+   } ()main Architect
+} main Construct`
+
+	construct := mechatest.Parse(t, source)
+
+	commands := construct.Architects[0].Body.Commands
+	if len(commands) != 3 {
+		t.Fatalf("expected 3 commands, got %d", len(commands))
+	}
+	d, ok := commands[1].(*ast.CmdDeclaration)
+	if !ok || d.Name != "d" {
+		t.Fatalf("expected the declaration of d second, got %#v", commands[1])
+	}
+	if negation, ok := d.Value.(*ast.UnaryExpr); !ok || negation.Operator != ast.OpNeg {
+		t.Errorf("expected d to be declared with '-1', got %#v", d.Value)
+	}
+	m, ok := commands[2].(*ast.CmdDeclaration)
+	if !ok || m.Name != "m" {
+		t.Fatalf("expected the declaration of m last, got %#v", commands[2])
+	}
+	difference, ok := m.Value.(*ast.BinaryExpr)
+	if !ok || difference.Operator != ast.OpSub {
+		t.Fatalf("expected m to be declared with a subtraction, got %#v", m.Value)
+	}
+	if negation, ok := difference.Left.(*ast.UnaryExpr); !ok || negation.Operator != ast.OpNeg {
+		t.Errorf("expected '-5' on the left of the subtraction, got %#v", difference.Left)
+	}
+}
+
+// TestParser_Conditions checks the precedence of '||', '&&' and '!', and a parenthesized condition.
+func TestParser_Conditions(t *testing.T) {
+	source := `{
+   {
+        {
+        } a > 1 || !b < 2 && (c == 3 || d != 4) if
+   } ()main Architect
+} main Construct`
+
+	construct := mechatest.Parse(t, source)
+
+	cmdIf, ok := construct.Architects[0].Body.Commands[0].(*ast.CmdIf)
+	if !ok {
+		t.Fatalf("expected an if, got %T", construct.Architects[0].Body.Commands[0])
+	}
+
+	// Expect (a > 1) || ((!(b < 2)) && ((c == 3) || (d != 4)))
+	or, ok := cmdIf.Condition.(*ast.BinaryExpr)
+	if !ok || or.Operator != ast.OpOr {
+		t.Fatalf("expected '||' at the root, got %#v", cmdIf.Condition)
+	}
+	if left, ok := or.Left.(*ast.BinaryExpr); !ok || left.Operator != ast.OpGreater {
+		t.Errorf("expected 'a > 1' on the left of '||', got %#v", or.Left)
+	}
+	and, ok := or.Right.(*ast.BinaryExpr)
+	if !ok || and.Operator != ast.OpAnd {
+		t.Fatalf("expected '&&' on the right of '||', got %#v", or.Right)
+	}
+	not, ok := and.Left.(*ast.UnaryExpr)
+	if !ok || not.Operator != ast.OpNot {
+		t.Fatalf("expected '!' on the left of '&&', got %#v", and.Left)
+	}
+	if operand, ok := not.Operand.(*ast.BinaryExpr); !ok || operand.Operator != ast.OpLess {
+		t.Errorf("expected 'b < 2' as the operand of '!', got %#v", not.Operand)
+	}
+	if inner, ok := and.Right.(*ast.BinaryExpr); !ok || inner.Operator != ast.OpOr {
+		t.Errorf("expected the parenthesized '||' on the right of '&&', got %#v", and.Right)
+	}
+
+	// Any expression can be an operand, leaving its type to the type checker, but comparisons do not chain
+	mechatest.Parse(t, strings.Replace(source, "a > 1", "a", 1))
+	if _, err := mechatest.TryParse(t, strings.Replace(source, "a > 1", "a > 1 == true", 1)); err == nil {
+		t.Error("expected a syntax error for chained comparisons, got nil")
+	}
+}
+
+// TestParser_Switches checks Switch declarations, literals, and comparisons and logical operators outside of
+// conditions.
+func TestParser_Switches(t *testing.T) {
+	source := `{
+   {
+        (!done)Send
+        x > 1 && true =: Switch :done
+   } (Gear :x, Switch Channel :c)main Architect
+} main Construct`
+
+	construct := mechatest.Parse(t, source)
+
+	main := construct.Architects[0]
+	if main.Parameters[1].Type != ast.TypeSwitch|ast.TypeChannel {
+		t.Errorf("expected a Switch Channel parameter, got %s", main.Parameters[1].Type)
+	}
+	declaration, ok := main.Body.Commands[0].(*ast.CmdDeclaration)
+	if !ok || declaration.Type != ast.TypeSwitch {
+		t.Fatalf("expected a Switch declaration, got %#v", main.Body.Commands[0])
+	}
+	and, ok := declaration.Value.(*ast.BinaryExpr)
+	if !ok || and.Operator != ast.OpAnd {
+		t.Fatalf("expected '&&' as the declared value, got %#v", declaration.Value)
+	}
+	if literal, ok := and.Right.(*ast.SwitchLiteral); !ok || !literal.Value {
+		t.Errorf("expected 'true' on the right of '&&', got %#v", and.Right)
+	}
+	send, ok := main.Body.Commands[1].(*ast.CmdSend)
+	if !ok {
+		t.Fatalf("expected a Send, got %#v", main.Body.Commands[1])
+	}
+	if not, ok := send.Value.(*ast.UnaryExpr); !ok || not.Operator != ast.OpNot {
+		t.Errorf("expected '!done' as the sent value, got %#v", send.Value)
+	}
+}
+
+// TestParser_Concurrency checks Channel types, Send and Receive on a Channel, and a detached call.
+func TestParser_Concurrency(t *testing.T) {
+	source := `{
+   {
+        (v)out Send
+        (v)in Receive
+        0 =: Gear :v
+   } (Gear Channel :in, Tensor Channel :out)relay Architect
+   {
+        (a, b)relay Detach
+        1 =: Tensor Channel :b
+        0 =: Gear Channel :a
+   } ()main Architect
+} main Construct`
+
+	construct := mechatest.Parse(t, source)
+
+	relay := construct.Architects[1]
+	if len(relay.Parameters) != 2 || relay.Parameters[0].Type != ast.TypeGear|ast.TypeChannel ||
+		relay.Parameters[1].Type != ast.TypeTensor|ast.TypeChannel {
+		t.Fatalf("expected a Gear Channel and a Tensor Channel parameter, got %#v", relay.Parameters)
+	}
+	receive, ok := relay.Body.Commands[1].(*ast.CmdReceive)
+	if !ok || receive.Name != "v" || receive.Channel == nil || receive.Channel.Name != "in" {
+		t.Errorf("expected '(v)in Receive', got %#v", relay.Body.Commands[1])
+	}
+	send, ok := relay.Body.Commands[2].(*ast.CmdSend)
+	if !ok || send.Channel == nil || send.Channel.Name != "out" {
+		t.Errorf("expected '(v)out Send', got %#v", relay.Body.Commands[2])
+	}
+
+	main := construct.Architects[0]
+	declaration, ok := main.Body.Commands[0].(*ast.CmdDeclaration)
+	if !ok || declaration.Type.String() != "Gear Channel" {
+		t.Errorf("expected a Gear Channel declaration, got %#v", main.Body.Commands[0])
+	}
+	call, ok := main.Body.Commands[2].(*ast.CmdCall)
+	if !ok || !call.Call.Detached || call.Call.Name != "relay" || len(call.Call.Arguments) != 2 {
+		t.Errorf("expected '(a, b)relay Detach', got %#v", main.Body.Commands[2])
+	}
+
+	// A Channel cannot carry Nil
+	if _, err := mechatest.TryParse(t, strings.Replace(source, "Tensor Channel :b", "Nil Channel :b", 1)); err == nil {
+		t.Error("expected a syntax error for a Nil Channel, got nil")
+	}
+}
+
+// TestParser_States checks State sets and the State set names written as types, which are numbered in the order the
+// parser meets them, even before their declaration.
+func TestParser_States(t *testing.T) {
+	source := `{
+   (Red, Green)Light State
+   {
+        Idle =: Machine :m
+   } Light (Machine Channel :c)show Architect
+   (Idle, Running, Halted)Machine State
+} main Construct`
+
+	construct := mechatest.Parse(t, source)
+
+	if len(construct.States) != 2 || len(construct.Architects) != 1 {
+		t.Fatalf("expected 2 State sets and 1 Architect, got %d and %d", len(construct.States),
+			len(construct.Architects))
+	}
+	machine := construct.States[0]
+	members := make([]string, len(machine.Members))
+	for i, member := range machine.Members {
+		members[i] = member.Name
+	}
+	if machine.Name != "Machine" || strings.Join(members, ", ") != "Idle, Running, Halted" {
+		t.Errorf("expected '(Idle, Running, Halted)Machine State', got (%s)%s", strings.Join(members, ", "),
+			machine.Name)
+	}
+	if strings.Join(construct.TypeNames, ", ") != "Machine, Light" {
+		t.Errorf("expected the types Machine and Light, got %v", construct.TypeNames)
+	}
+
+	show := construct.Architects[0]
+	parameter := show.Parameters[0].Type
+	if parameter != machine.Type|ast.TypeChannel || construct.TypeString(parameter) != "Machine Channel" {
+		t.Errorf("expected a Machine Channel parameter, got %s", construct.TypeString(parameter))
+	}
+	if show.ReturnType != construct.States[1].Type || show.ReturnType.Underlying() != ast.TypeState {
+		t.Errorf("expected show to integrate a Light, got %s", construct.TypeString(show.ReturnType))
+	}
+	if declaration := show.Body.Commands[0].(*ast.CmdDeclaration); declaration.Type != machine.Type {
+		t.Errorf("expected a Machine declaration, got %s", construct.TypeString(declaration.Type))
+	}
+
+	// A State set needs at least one member
+	if _, err := mechatest.TryParse(t, strings.Replace(source, "(Red, Green)Light", "()Light", 1)); err == nil {
+		t.Error("expected a syntax error for an empty State set, got nil")
+	}
+}
+
+// TestParser_Assemblies checks Assembly types and literals, indexing, Length, Append, stores into an element and for
+// over the elements of an Assembly.
+func TestParser_Assemblies(t *testing.T) {
+	source := `{
+   {
+        {
+            (x)Send
+        } xs =: Tensor :x for
+        ([0]xs + (xs)Length)xs Append
+        1 = [i - 1]xs
+        (1, 2.5)Tensor Assembly =: Tensor Assembly :xs
+   } (Gear :i, Light Assembly :lights)main Architect
+   (Red, Green)Light State
+} main Construct`
+
+	construct := mechatest.Parse(t, source)
+
+	main := construct.Architects[0]
+	if lights := main.Parameters[1].Type; construct.TypeString(lights) != "Light Assembly" {
+		t.Errorf("expected a Light Assembly parameter, got %s", construct.TypeString(lights))
+	}
+	declaration := main.Body.Commands[0].(*ast.CmdDeclaration)
+	literal, ok := declaration.Value.(*ast.AssemblyLiteral)
+	if !ok || literal.Type != ast.TypeTensor|ast.TypeAssembly || len(literal.Elements) != 2 {
+		t.Fatalf("expected a Tensor Assembly literal of 2 elements, got %#v", declaration.Value)
+	}
+	if first, ok := literal.Elements[0].(*ast.GearLiteral); !ok || first.Value != 1 {
+		t.Errorf("expected 1 as the first element, got %#v", literal.Elements[0])
+	}
+
+	store, ok := main.Body.Commands[1].(*ast.CmdAssignment)
+	if !ok || store.Name != "xs" {
+		t.Fatalf("expected an assignment to xs, got %#v", main.Body.Commands[1])
+	}
+	if index, ok := store.Index.(*ast.BinaryExpr); !ok || index.Operator != ast.OpSub {
+		t.Errorf("expected 'i - 1' as the index, got %#v", store.Index)
+	}
+
+	appendCmd, ok := main.Body.Commands[2].(*ast.CmdAppend)
+	if !ok || appendCmd.Assembly.Name != "xs" {
+		t.Fatalf("expected an Append to xs, got %#v", main.Body.Commands[2])
+	}
+	sum := appendCmd.Value.(*ast.BinaryExpr)
+	if element, ok := sum.Left.(*ast.IndexExpr); !ok || element.Assembly.Name != "xs" {
+		t.Errorf("expected '[0]xs' on the left of '+', got %#v", sum.Left)
+	}
+	if _, ok := sum.Right.(*ast.LengthExpr); !ok {
+		t.Errorf("expected '(xs)Length' on the right of '+', got %#v", sum.Right)
+	}
+
+	loop, ok := main.Body.Commands[3].(*ast.CmdFor)
+	if !ok || loop.Condition != nil || loop.Name != "x" || loop.Type != ast.TypeTensor {
+		t.Fatalf("expected a for over the elements into the Tensor x, got %#v", main.Body.Commands[3])
+	}
+	if elements, ok := loop.Elements.(*ast.Identifier); !ok || elements.Name != "xs" {
+		t.Errorf("expected the for to walk over xs, got %#v", loop.Elements)
+	}
+
+	// An Assembly cannot hold another one, and an element needs both brackets
+	nested := strings.Replace(source, "Light Assembly", "Light Assembly Assembly", 1)
+	if _, err := mechatest.TryParse(t, nested); err == nil {
+		t.Error("expected a syntax error for an Assembly of Assemblies, got nil")
+	}
+	if _, err := mechatest.TryParse(t, strings.Replace(source, "[i - 1]xs", "i - 1]xs", 1)); err == nil {
+		t.Error("expected a syntax error for an index without '[', got nil")
+	}
+}
+
+// TestParser_SyntaxError ensures that an invalid program is rejected.
+func TestParser_SyntaxError(t *testing.T) {
+	source := `{
+   {
+        0 Integrate Integrate
+   } ()main Architect
+} main Construct`
+
+	if _, err := mechatest.TryParse(t, source); err == nil {
+		t.Error("expected a syntax error, got nil")
+	}
+}
+
+// brokenSource has three syntax errors: a repeated Integrate, a condition without its right operand and a parameter
+// without ':'. The if block is skipped with its broken condition, while the other Architect is still parsed.
+const brokenSource = `{
+   {
+        0 Integrate Integrate
+        {
+            (x)Send
+        } x < if
+        (x)Send
+        1 =: Gear :x
+   } ()main Architect
+
+   {
+        1 Integrate
+   } (Gear x)helper Architect
+
+   {
+        2 Integrate
+   } ()other Architect
+} main Construct`
+
+// TestParser_Recovery ensures that every syntax error is reported in a single run and that the commands and
+// Architects around them are kept.
+func TestParser_Recovery(t *testing.T) {
+	construct, err := mechatest.TryParse(t, brokenSource)
+	if err == nil {
+		t.Fatal("expected syntax errors, got nil")
+	}
+
+	errs := err.(interface{ Unwrap() []error }).Unwrap()
+	if len(errs) != 3 {
+		t.Fatalf("expected 3 errors, got %d: %v", len(errs), err)
+	}
+	for i, line := range []string{"Line: 13", "Line: 6", "Line: 3"} {
+		if !strings.Contains(errs[i].Error(), line) {
+			t.Errorf("expected error %d at %s, got %v", i, line, errs[i])
+		}
+	}
+
+	if construct == nil || len(construct.Architects) != 2 {
+		t.Fatalf("expected the 2 valid Architects to be kept, got %#v", construct)
+	}
+	if name := construct.Architects[0].Name; name != "other" {
+		t.Errorf("expected the first Architect read to be 'other', got '%s'", name)
+	}
+	if commands := construct.Architects[1].Body.Commands; len(commands) != 2 {
+		t.Errorf("expected the declaration and the Send of main to be kept, got %d commands", len(commands))
+	}
+}
+
+// TestParser_Diagnostics checks the Diagnostic of a missing ':': it underlines the token found instead and suggests
+// inserting the ':' on its right, before the token read last.
+func TestParser_Diagnostics(t *testing.T) {
+	_, err := mechatest.TryParse(t, brokenSource)
+	diagnostics := compiler_error.Diagnostics(err)
+	if len(diagnostics) != 3 {
+		t.Fatalf("expected 3 diagnostics, got %d: %v", len(diagnostics), err)
+	}
+
+	diagnostic := diagnostics[0]
+	span := compiler_error.Span{Start: ast.Pos{Line: 13, Column: 7}, End: ast.Pos{Line: 13, Column: 11}}
+	if diagnostic.Code != compiler_error.CodeExpectedToken || diagnostic.Span != span {
+		t.Errorf("expected %s at %v, got %s at %v", compiler_error.CodeExpectedToken, span, diagnostic.Code,
+			diagnostic.Span)
+	}
+	if !strings.HasSuffix(diagnostic.File, "input.mecha") {
+		t.Errorf("expected the source file name, got %q", diagnostic.File)
+	}
+
+	fix := diagnostic.Fix
+	if fix == nil || fix.Replacement != ":" || fix.Span.Start != (ast.Pos{Line: 13, Column: 12}) {
+		t.Errorf("expected a fix inserting ':' at Line: 13, Column: 12, got %+v", fix)
+	}
+}
+
+// TestParser_FirstColumn ensures that a token at the start of a line is reported on its own line, not on the line
+// above, where the lexer already is when it finishes reading it.
+func TestParser_FirstColumn(t *testing.T) {
+	source := `{
+  {
+    1 Integrate
+=
+  } ()main Architect
+} main Construct
+`
+	_, err := mechatest.TryParse(t, source)
+	diagnostics := compiler_error.Diagnostics(err)
+	if len(diagnostics) != 1 {
+		t.Fatalf("expected 1 diagnostic, got %d: %v", len(diagnostics), err)
+	}
+	if start := diagnostics[0].Span.Start; start != (ast.Pos{Line: 4, Column: 1}) {
+		t.Errorf("expected the error at Line: 4, Column: 1, got %s", start)
+	}
+}
+
+// TestParser_LineBoundary checks the Diagnostics of commands broken near the start of their line: an identifier is
+// only a Channel when ')' follows it, and a command that runs out of tokens is reported on its own line, not on the
+// line above where the next token is.
+func TestParser_LineBoundary(t *testing.T) {
+	tests := []struct {
+		line  string
+		start ast.Pos
+		fix   string
+		at    ast.Pos
+	}{
+		{line: "    (y Send", start: ast.Pos{Line: 4, Column: 6}, fix: ")", at: ast.Pos{Line: 4, Column: 8}},
+		{line: "    y)Send", start: ast.Pos{Line: 4, Column: 5}, fix: "(", at: ast.Pos{Line: 4, Column: 5}},
+		{line: "    ) Integrate", start: ast.Pos{Line: 4, Column: 5}},
+	}
+
+	for _, test := range tests {
+		source := "{\n  {\n    (1)Send\n" + test.line + "\n  } ()main Architect\n} main Construct\n"
+		_, err := mechatest.TryParse(t, source)
+		diagnostics := compiler_error.Diagnostics(err)
+		if len(diagnostics) != 1 {
+			t.Errorf("%s: expected 1 diagnostic, got %d: %v", test.line, len(diagnostics), err)
+			continue
+		}
+		if start := diagnostics[0].Span.Start; start != test.start {
+			t.Errorf("%s: expected the error at %s, got %s", test.line, test.start, start)
+		}
+		fix := diagnostics[0].Fix
+		if test.fix == "" {
+			if fix != nil {
+				t.Errorf("%s: expected no fix, got %+v", test.line, fix)
+			}
+			continue
+		}
+		if fix == nil || fix.Replacement != test.fix || fix.Span.Start != test.at {
+			t.Errorf("%s: expected a fix inserting %q at %s, got %+v", test.line, test.fix, test.at, fix)
+		}
+	}
+}
+
+// TestParser_LexicalDiagnostics checks that lexer errors point at the offending character: a string is opened by its
+// right quote, since lines are read from right to left.
+func TestParser_LexicalDiagnostics(t *testing.T) {
+	tests := []struct {
+		line  string
+		code  string
+		start ast.Pos
+	}{
+		{line: `    (text")Send`, code: compiler_error.CodeUnterminatedString, start: ast.Pos{Line: 3, Column: 10}},
+		{line: `    1 =: Gear :x $`, code: compiler_error.CodeUnknownCharacter, start: ast.Pos{Line: 3, Column: 18}},
+	}
+
+	for _, test := range tests {
+		source := "{\n  {\n" + test.line + "\n  } ()main Architect\n} main Construct\n"
+		_, err := mechatest.TryParse(t, source)
+		diagnostics := compiler_error.Diagnostics(err)
+		if len(diagnostics) == 0 {
+			t.Errorf("%s: expected a diagnostic, got %v", test.line, err)
+			continue
+		}
+		if diagnostics[0].Code != test.code || diagnostics[0].Span.Start != test.start {
+			t.Errorf("%s: expected %s at %s, got %s at %s", test.line, test.code, test.start, diagnostics[0].Code,
+				diagnostics[0].Span.Start)
+		}
+	}
+}
+
+// TestParser_MaxErrors ensures that the parser stops once the error limit is reached.
+func TestParser_MaxErrors(t *testing.T) {
+	p, err := parser.NewParser(strings.NewReader(brokenSource), "input.mecha", false)
+	if err != nil {
+		t.Fatalf("failed to create parser: %v", err)
+	}
+	p.SetMaxErrors(2)
+
+	_, err = p.Run()
+	if err == nil {
+		t.Fatal("expected syntax errors, got nil")
+	}
+	errs := err.(interface{ Unwrap() []error }).Unwrap()
+	if len(errs) != 3 || !strings.Contains(errs[2].Error(), "too many syntax errors") {
+		t.Errorf("expected 2 errors and the limit, got %v", err)
+	}
+}
+
+func TestParser_RecoverySkipsBadToken(t *testing.T) {
+	source := `{
+  {
+    1 Integrate
+    =
+  } ()main Architect
+} main Construct
+`
+	_, err := mechatest.TryParse(t, source)
+	if err == nil {
+		t.Fatal("expected a syntax error, got nil")
+	}
+	if errs := err.(interface{ Unwrap() []error }).Unwrap(); len(errs) != 1 {
+		t.Errorf("expected 1 error, got %d: %v", len(errs), err)
+	}
+}
+
+// TestParser_Comments ensures that comments are left out of the tree but kept aside, including a multiline comment
+// that spans two lines.
+func TestParser_Comments(t *testing.T) {
+	source := `{
+  {
+    */ spans
+    two lines /*
+    0 Integrate  */ inline /*
+  } ()main Architect
+  note //
+} main Construct
+`
+	p, err := parser.NewParser(strings.NewReader(source), "input.mecha", false)
+	if err != nil {
+		t.Fatalf("failed to create parser: %v", err)
+	}
+	if _, err := p.Run(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Comments are found from the bottom of the file to the top
+	expected := []struct {
+		text  string
+		start ast.Pos
+	}{
+		{text: "note //", start: ast.Pos{Line: 7, Column: 3}},
+		{text: "*/ inline /*", start: ast.Pos{Line: 5, Column: 18}},
+		{text: "*/ spans\n    two lines /*", start: ast.Pos{Line: 3, Column: 5}},
+	}
+	comments := p.Comments()
+	if len(comments) != len(expected) {
+		t.Fatalf("expected %d comments, got %+v", len(expected), comments)
+	}
+	for i, comment := range comments {
+		if comment.Text != expected[i].text || comment.Span.Start != expected[i].start {
+			t.Errorf("expected %q at %s, got %q at %s", expected[i].text, expected[i].start, comment.Text,
+				comment.Span.Start)
+		}
+	}
+}
@@ -0,0 +1,422 @@
+package semantic
+
+import (
+	"fmt"
+	"mechanus-compiler/internal/ast"
+	"mechanus-compiler/internal/compiler_error"
+)
+
+const (
+	errMismatchedDeclaration = "cannot declare %s '%s' with a value of type %s"
+	errMismatchedAssignment  = "cannot assign a value of type %s to %s '%s'"
+	errMismatchedIntegrate   = "Architect '%s' integrates %s, got %s"
+	errMismatchedArgument    = "argument %d of Architect '%s' expects %s, got %s"
+	errInvalidOperation      = "operator '%s' is not defined for %s and %s"
+	errInvalidUnary          = "operator '%s' is not defined for %s"
+	errInvalidComparison     = "cannot compare %s and %s with '%s'"
+	errInvalidReceive        = "cannot Receive into %s '%s'"
+	errInvalidSend           = "cannot Send %s to the output"
+	errMismatchedSend        = "cannot Send a value of type %s into %s '%s'"
+	errMismatchedReceive     = "cannot Receive from %s '%s' into %s '%s'"
+	errNotChannel            = "'%s' is not a Channel, it is %s"
+	errChannelCapacity       = "%s '%s' is made with a Gear capacity or shares another %s, got %s"
+	errDetachedValue         = "the result of detached Architect '%s' cannot be used"
+	errExpectedCondition     = "expected a Switch, got a value of type %s"
+	errNotAssembly           = "'%s' is not an Assembly, it is %s"
+	errExpectedAssembly      = "expected an Assembly, got a value of type %s"
+	errInvalidIndex          = "an Assembly is indexed with a Gear, got %s"
+	errMismatchedElement     = "element %d of %s expects %s, got %s"
+	errMismatchedStore       = "cannot assign a value of type %s to an element of %s '%s'"
+	errMismatchedAppend      = "cannot Append a value of type %s to %s '%s'"
+	errMismatchedIteration   = "cannot declare %s '%s' with the elements of %s"
+)
+
+//**********************************************************************************************************************
+// Type rules
+//**********************************************************************************************************************
+
+// ReturnType :
+// Returns the type integrated by an Architect. An Architect without a declared return type integrates a Gear, which
+// is what lets "0 Integrate" work in a plain "()main Architect".
+func ReturnType(architect *ast.Architect) ast.Type {
+	if architect.ReturnType == ast.TypeNone {
+		return ast.TypeGear
+	}
+	return architect.ReturnType
+}
+
+// Assignable :
+// Checks if a value of type from can be stored where a value of type to is expected. The only implicit conversion
+// in Mechanus is the widening of a Gear into a Tensor; every other combination must match exactly.
+func Assignable(from, to ast.Type) bool {
+	return from == to || (from == ast.TypeGear && to == ast.TypeTensor)
+}
+
+// IsNumeric :
+// Checks if the type takes part in arithmetic.
+func IsNumeric(t ast.Type) bool {
+	return t == ast.TypeGear || t == ast.TypeTensor
+}
+
+// arithmeticType :
+// Returns the type of "left op right" for an arithmetic operator, or TypeNone if the operation is not defined. Mixing
+// a Gear with a Tensor widens the Gear, so the result is a Tensor. '%' is only defined for Gears.
+func arithmeticType(operator ast.Operator, left, right ast.Type) ast.Type {
+	if !IsNumeric(left) || !IsNumeric(right) {
+		return ast.TypeNone
+	}
+	if operator == ast.OpMod {
+		if left != ast.TypeGear || right != ast.TypeGear {
+			return ast.TypeNone
+		}
+		return ast.TypeGear
+	}
+	if left == ast.TypeTensor || right == ast.TypeTensor {
+		return ast.TypeTensor
+	}
+	return ast.TypeGear
+}
+
+// logicalType :
+// Returns the type of "left op right" for '&&' and '||', or TypeNone if the operation is not defined. Both sides must
+// be Switches.
+func logicalType(left, right ast.Type) ast.Type {
+	if left != ast.TypeSwitch || right != ast.TypeSwitch {
+		return ast.TypeNone
+	}
+	return ast.TypeSwitch
+}
+
+// unaryType :
+// Returns the type of "op operand" for '-' and '!', or TypeNone if the operation is not defined. '-' negates a number
+// and '!' a Switch.
+func unaryType(operator ast.Operator, operand ast.Type) ast.Type {
+	if operator == ast.OpNot {
+		return logicalType(operand, operand)
+	}
+	if !IsNumeric(operand) {
+		return ast.TypeNone
+	}
+	return operand
+}
+
+// comparableTypes :
+// Checks if two values can be compared with the given operator. Numbers compare with each other after widening and
+// Monodrones are ordered by their code point. Channels and Assemblies cannot be compared, while every other type,
+// Switches included, only supports '==' and '!=' against the same type.
+func comparableTypes(operator ast.Operator, left, right ast.Type) bool {
+	if IsNumeric(left) && IsNumeric(right) {
+		return true
+	}
+	if left != right || left.IsChannel() || left.IsAssembly() {
+		return false
+	}
+	if left == ast.TypeMonodrone {
+		return true
+	}
+	return operator == ast.OpEqual || operator == ast.OpNotEqual
+}
+
+//**********************************************************************************************************************
+// Checker
+//**********************************************************************************************************************
+
+// checkTypes :
+// Infers the type of every expression and checks declarations, assignments, Integrates, conditions and call
+// arguments. Runs only after every name has been resolved, so it can rely on analyzer.info.
+func (analyzer *Analyzer) checkTypes(construct *ast.Construct) {
+	for _, architect := range construct.Architects {
+		analyzer.current = architect
+		analyzer.checkBlock(architect.Body)
+	}
+	analyzer.current = nil
+}
+
+// checkBlock :
+// Checks every command of a block.
+func (analyzer *Analyzer) checkBlock(block *ast.Block) {
+	for _, command := range block.Commands {
+		analyzer.checkCommand(command)
+	}
+}
+
+// checkCommand :
+// Checks a single command.
+func (analyzer *Analyzer) checkCommand(command ast.Command) {
+	switch cmd := command.(type) {
+	case *ast.CmdIf:
+		analyzer.checkCondition(cmd.Condition)
+		analyzer.checkBlock(cmd.Then)
+		for _, elif := range cmd.Elifs {
+			analyzer.checkCondition(elif.Condition)
+			analyzer.checkBlock(elif.Body)
+		}
+		if cmd.Else != nil {
+			analyzer.checkBlock(cmd.Else)
+		}
+	case *ast.CmdFor:
+		if cmd.Elements == nil {
+			analyzer.checkCondition(cmd.Condition)
+		} else if elements := analyzer.typeOf(cmd.Elements); elements != ast.TypeNone {
+			if !elements.IsAssembly() {
+				analyzer.reportType(cmd.Elements.Pos(), compiler_error.CodeExpectedAssembly, errExpectedAssembly,
+					elements)
+			} else if !Assignable(elements.Element(), cmd.Type) {
+				analyzer.reportType(cmd.NamePosition, compiler_error.CodeMismatchedIteration, errMismatchedIteration,
+					cmd.Type, cmd.Name, elements)
+			}
+		}
+		analyzer.checkBlock(cmd.Body)
+	case *ast.CmdDeclaration:
+		value := analyzer.typeOf(cmd.Value)
+		if cmd.Type.IsChannel() {
+			// A Gear makes a new Channel with that capacity, while another Channel is shared
+			if value != ast.TypeNone && value != ast.TypeGear && value != cmd.Type {
+				analyzer.reportType(cmd.Value.Pos(), compiler_error.CodeChannelCapacity, errChannelCapacity, cmd.Type,
+					cmd.Name, cmd.Type, value)
+			}
+			return
+		}
+		if value != ast.TypeNone && !Assignable(value, cmd.Type) {
+			analyzer.reportType(cmd.Value.Pos(), compiler_error.CodeMismatchedDeclaration, errMismatchedDeclaration,
+				cmd.Type, cmd.Name, value)
+		}
+	case *ast.CmdAssignment:
+		value := analyzer.typeOf(cmd.Value)
+		symbol := analyzer.info.Uses[cmd]
+		if cmd.Index != nil {
+			analyzer.checkIndex(cmd.Index)
+			if !symbol.Type.IsAssembly() {
+				analyzer.reportType(cmd.Position, compiler_error.CodeNotAssembly, errNotAssembly, cmd.Name, symbol.Type)
+			} else if value != ast.TypeNone && !Assignable(value, symbol.Type.Element()) {
+				analyzer.reportType(cmd.Value.Pos(), compiler_error.CodeMismatchedStore, errMismatchedStore, value,
+					symbol.Type, cmd.Name)
+			}
+			return
+		}
+		if value != ast.TypeNone && !Assignable(value, symbol.Type) {
+			analyzer.reportType(cmd.Value.Pos(), compiler_error.CodeMismatchedAssignment, errMismatchedAssignment,
+				value, symbol.Type, cmd.Name)
+		}
+	case *ast.CmdReceive:
+		symbol := analyzer.info.Uses[cmd]
+		if cmd.Channel != nil {
+			channel := analyzer.checkChannel(cmd.Channel)
+			if channel != ast.TypeNone && !Assignable(channel.Element(), symbol.Type) {
+				analyzer.reportType(cmd.Position, compiler_error.CodeMismatchedReceive, errMismatchedReceive, channel,
+					cmd.Channel.Name, symbol.Type,
+					cmd.Name)
+			}
+			return
+		}
+		// Only numbers and text are read from the input, so neither Switches, State sets nor Assemblies can be
+		// received
+		if symbol.Type == ast.TypeNil || symbol.Type.IsChannel() || symbol.Type.IsAssembly() ||
+			symbol.Type == ast.TypeSwitch || symbol.Type.StateIndex() >= 0 {
+			analyzer.reportType(cmd.Position, compiler_error.CodeInvalidReceive, errInvalidReceive, symbol.Type,
+				cmd.Name)
+		}
+	case *ast.CmdSend:
+		value := analyzer.typeOf(cmd.Value)
+		if cmd.Channel != nil {
+			channel := analyzer.checkChannel(cmd.Channel)
+			if value != ast.TypeNone && channel != ast.TypeNone && !Assignable(value, channel.Element()) {
+				analyzer.reportType(cmd.Value.Pos(), compiler_error.CodeMismatchedSend, errMismatchedSend, value,
+					channel, cmd.Channel.Name)
+			}
+			return
+		}
+		if value.IsChannel() || value.IsAssembly() {
+			analyzer.reportType(cmd.Value.Pos(), compiler_error.CodeInvalidSend, errInvalidSend, value)
+		}
+	case *ast.CmdAppend:
+		value := analyzer.typeOf(cmd.Value)
+		assembly := analyzer.checkAssembly(cmd.Assembly)
+		if value != ast.TypeNone && assembly != ast.TypeNone && !Assignable(value, assembly.Element()) {
+			analyzer.reportType(cmd.Value.Pos(), compiler_error.CodeMismatchedAppend, errMismatchedAppend, value,
+				assembly, cmd.Assembly.Name)
+		}
+	case *ast.CmdIntegrate:
+		value := analyzer.typeOf(cmd.Value)
+		expected := ReturnType(analyzer.current)
+		if value != ast.TypeNone && !Assignable(value, expected) {
+			analyzer.reportType(cmd.Value.Pos(), compiler_error.CodeMismatchedIntegrate, errMismatchedIntegrate,
+				analyzer.current.Name, expected, value)
+		}
+	case *ast.CmdCall:
+		if cmd.Call.Detached {
+			analyzer.checkArguments(cmd.Call)
+			return
+		}
+		analyzer.typeOf(cmd.Call)
+	}
+}
+
+// checkChannel :
+// Infers the type of the Channel used by a Send or Receive, reporting it if the variable is not a Channel. Returns
+// TypeNone in that case.
+func (analyzer *Analyzer) checkChannel(channel *ast.Identifier) ast.Type {
+	t := analyzer.typeOf(channel)
+	if !t.IsChannel() {
+		analyzer.reportType(channel.Position, compiler_error.CodeNotChannel, errNotChannel, channel.Name, t)
+		return ast.TypeNone
+	}
+	return t
+}
+
+// checkAssembly :
+// Infers the type of the Assembly used by an index or an Append, reporting it if the variable is not an Assembly.
+// Returns TypeNone in that case.
+func (analyzer *Analyzer) checkAssembly(assembly *ast.Identifier) ast.Type {
+	t := analyzer.typeOf(assembly)
+	if !t.IsAssembly() {
+		analyzer.reportType(assembly.Position, compiler_error.CodeNotAssembly, errNotAssembly, assembly.Name, t)
+		return ast.TypeNone
+	}
+	return t
+}
+
+// checkIndex :
+// Checks the index of an element of an Assembly, which must be a Gear.
+func (analyzer *Analyzer) checkIndex(index ast.Expr) {
+	if t := analyzer.typeOf(index); t != ast.TypeNone && t != ast.TypeGear {
+		analyzer.reportType(index.Pos(), compiler_error.CodeInvalidIndex, errInvalidIndex, t)
+	}
+}
+
+// checkArguments :
+// Checks that every argument of a call can be passed to the matching parameter.
+func (analyzer *Analyzer) checkArguments(call *ast.CallExpr) {
+	architect := analyzer.info.Calls[call]
+	for i, argument := range call.Arguments {
+		value := analyzer.typeOf(argument)
+		expected := architect.Parameters[i].Type
+		if value != ast.TypeNone && !Assignable(value, expected) {
+			analyzer.reportType(argument.Pos(), compiler_error.CodeMismatchedArgument, errMismatchedArgument, i+1,
+				call.Name, expected, value)
+		}
+	}
+}
+
+// checkCondition :
+// Checks the <CONDITION> of an if, elif or for, which must be a Switch.
+func (analyzer *Analyzer) checkCondition(condition ast.Expr) {
+	if t := analyzer.typeOf(condition); t != ast.TypeNone && t != ast.TypeSwitch {
+		analyzer.reportType(condition.Pos(), compiler_error.CodeExpectedCondition, errExpectedCondition, t)
+	}
+}
+
+// typeOf :
+// Infers the type of an expression and records it in analyzer.info.Types. Returns TypeNone when the expression is
+// invalid; the problem has already been reported by then, so callers skip their own checks to avoid cascades.
+func (analyzer *Analyzer) typeOf(expr ast.Expr) ast.Type {
+	t := analyzer.inferType(expr)
+	analyzer.info.Types[expr] = t
+	return t
+}
+
+// inferType :
+// Computes the type of an expression. See typeOf.
+func (analyzer *Analyzer) inferType(expr ast.Expr) ast.Type {
+	switch e := expr.(type) {
+	case *ast.GearLiteral:
+		return ast.TypeGear
+	case *ast.TensorLiteral:
+		return ast.TypeTensor
+	case *ast.MonodroneLiteral:
+		return ast.TypeMonodrone
+	case *ast.OmnidroneLiteral:
+		return ast.TypeOmnidrone
+	case *ast.SwitchLiteral:
+		return ast.TypeSwitch
+	case *ast.NilLiteral:
+		return ast.TypeNil
+	case *ast.Identifier:
+		return analyzer.info.Uses[e].Type
+	case *ast.UnaryExpr:
+		operand := analyzer.typeOf(e.Operand)
+		if operand == ast.TypeNone {
+			return ast.TypeNone
+		}
+		result := unaryType(e.Operator, operand)
+		if result == ast.TypeNone {
+			analyzer.reportType(e.Position, compiler_error.CodeInvalidUnary, errInvalidUnary, e.Operator, operand)
+		}
+		return result
+	case *ast.BinaryExpr:
+		left := analyzer.typeOf(e.Left)
+		right := analyzer.typeOf(e.Right)
+		if left == ast.TypeNone || right == ast.TypeNone {
+			return ast.TypeNone
+		}
+		if e.Operator.IsComparison() {
+			if !comparableTypes(e.Operator, left, right) {
+				analyzer.reportType(e.Position, compiler_error.CodeInvalidComparison, errInvalidComparison, left, right,
+					e.Operator)
+				return ast.TypeNone
+			}
+			return ast.TypeSwitch
+		}
+		var result ast.Type
+		if e.Operator.IsLogical() {
+			result = logicalType(left, right)
+		} else {
+			result = arithmeticType(e.Operator, left, right)
+		}
+		if result == ast.TypeNone {
+			analyzer.reportType(e.Position, compiler_error.CodeInvalidOperation, errInvalidOperation, e.Operator, left,
+				right)
+		}
+		return result
+	case *ast.CallExpr:
+		analyzer.checkArguments(e)
+		if e.Detached {
+			analyzer.reportType(e.Position, compiler_error.CodeDetachedValue, errDetachedValue, e.Name)
+			return ast.TypeNone
+		}
+		return ReturnType(analyzer.info.Calls[e])
+	case *ast.AssemblyLiteral:
+		for i, element := range e.Elements {
+			value := analyzer.typeOf(element)
+			if value != ast.TypeNone && !Assignable(value, e.Type.Element()) {
+				analyzer.reportType(element.Pos(), compiler_error.CodeMismatchedElement, errMismatchedElement, i+1,
+					e.Type, e.Type.Element(), value)
+			}
+		}
+		return e.Type
+	case *ast.IndexExpr:
+		analyzer.checkIndex(e.Index)
+		assembly := analyzer.checkAssembly(e.Assembly)
+		if assembly == ast.TypeNone {
+			return ast.TypeNone
+		}
+		return assembly.Element()
+	case *ast.LengthExpr:
+		assembly := analyzer.typeOf(e.Assembly)
+		if assembly == ast.TypeNone {
+			return ast.TypeNone
+		}
+		if !assembly.IsAssembly() {
+			analyzer.reportType(e.Assembly.Pos(), compiler_error.CodeExpectedAssembly, errExpectedAssembly, assembly)
+			return ast.TypeNone
+		}
+		return ast.TypeGear
+	}
+	return ast.TypeNone
+}
+
+// reportType :
+// Records and logs a type error found at the given position, under the diagnostic code of its kind. Types among the
+// arguments are shown as written in the source, so State sets appear by their name.
+func (analyzer *Analyzer) reportType(position ast.Pos, code string, format string, args ...any) {
+	for i, arg := range args {
+		if t, ok := arg.(ast.Type); ok {
+			args[i] = analyzer.construct.TypeString(t)
+		}
+	}
+	diagnostic := newDiagnostic(compiler_error.ErrType, code, position, fmt.Sprintf(format, args...))
+	err := compiler_error.TypeErrorf(compiler_error.TypeError, diagnostic)
+
+	analyzer.logger.Error(err, map[string]any{"position": position.String()})
+	analyzer.errors = append(analyzer.errors, err)
+}
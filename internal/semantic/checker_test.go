@@ -0,0 +1,354 @@
+package semantic_test
+
+import (
+	"mechanus-compiler/internal/ast"
+	"mechanus-compiler/internal/compiler_error"
+	"strings"
+	"testing"
+)
+
+// wrapMain places the given commands inside a main Architect.
+func wrapMain(commands string) string {
+	return "{\n   {\n" + commands + "\n   } ()main Architect\n} main Construct"
+}
+
+// wrapStates places the given commands inside a main Architect, below the Machine and Light State sets.
+func wrapStates(commands string) string {
+	states := "{\n   (Idle, Busy)Machine State\n   (Red, Green)Light State\n"
+	return states + strings.TrimPrefix(wrapMain(commands), "{\n")
+}
+
+// TestChecker_Errors checks that each kind of type error is reported with its own code.
+func TestChecker_Errors(t *testing.T) {
+	tests := []struct {
+		name     string
+		source   string
+		expected string
+		code     string
+	}{
+		{
+			name:     "declaration",
+			source:   wrapMain(`        "Hello" =: Gear :x`),
+			expected: "cannot declare Gear 'x' with a value of type Omnidrone",
+			code:     compiler_error.CodeMismatchedDeclaration,
+		},
+		{
+			name: "assignment",
+			source: wrapMain(`        1.5 = x
+        1 =: Gear :x`),
+			expected: "cannot assign a value of type Tensor to Gear 'x'",
+			code:     compiler_error.CodeMismatchedAssignment,
+		},
+		{
+			name:     "integrate",
+			source:   wrapMain(`        "done" Integrate`),
+			expected: "Architect 'main' integrates Gear, got Omnidrone",
+			code:     compiler_error.CodeMismatchedIntegrate,
+		},
+		{
+			name: "declared return type",
+			source: `{
+   {
+        1 Integrate
+   } Omnidrone ()name Architect
+   {
+        ()name =: Omnidrone :n
+   } ()main Architect
+} main Construct`,
+			expected: "Architect 'name' integrates Omnidrone, got Gear",
+			code:     compiler_error.CodeMismatchedIntegrate,
+		},
+		{
+			name: "argument",
+			source: `{
+   {
+        x Integrate
+   } (Gear :x)double Architect
+   {
+        (2.5)double
+   } ()main Architect
+} main Construct`,
+			expected: "argument 1 of Architect 'double' expects Gear, got Tensor",
+			code:     compiler_error.CodeMismatchedArgument,
+		},
+		{
+			name: "condition",
+			source: wrapMain(`        {
+        } "a" < 1 if`),
+			expected: "cannot compare Omnidrone and Gear with '<'",
+			code:     compiler_error.CodeInvalidComparison,
+		},
+		{
+			name: "logical condition",
+			source: wrapMain(`        {
+        } 1 > 0 && !("a" < 1) if`),
+			expected: "cannot compare Omnidrone and Gear with '<'",
+			code:     compiler_error.CodeInvalidComparison,
+		},
+		{
+			name: "operand of a logical operator",
+			source: wrapMain(`        {
+        } (1 > 0 || 1 + 2) if`),
+			expected: "operator '||' is not defined for Switch and Gear",
+			code:     compiler_error.CodeInvalidOperation,
+		},
+		{
+			name: "condition that is not a Switch",
+			source: wrapMain(`        {
+        } 1 + 2 for`),
+			expected: "expected a Switch, got a value of type Gear",
+			code:     compiler_error.CodeExpectedCondition,
+		},
+		{
+			name:     "arithmetic on a Switch",
+			source:   wrapMain(`        (1 > 0 && 2 > 1) + 1 =: Gear :x`),
+			expected: "operator '+' is not defined for Switch and Gear",
+			code:     compiler_error.CodeInvalidOperation,
+		},
+		{
+			name:     "comparison into a Gear",
+			source:   wrapMain(`        1 < 2 =: Gear :x`),
+			expected: "cannot declare Gear 'x' with a value of type Switch",
+			code:     compiler_error.CodeMismatchedDeclaration,
+		},
+		{
+			name:     "negated Switch",
+			source:   wrapMain(`        -true =: Switch :s`),
+			expected: "operator '-' is not defined for Switch",
+			code:     compiler_error.CodeInvalidUnary,
+		},
+		{
+			name:     "not on a Gear",
+			source:   wrapMain(`        !1 =: Switch :s`),
+			expected: "operator '!' is not defined for Gear",
+			code:     compiler_error.CodeInvalidUnary,
+		},
+		{
+			name: "order Switches",
+			source: wrapMain(`        {
+        } true < false if`),
+			expected: "cannot compare Switch and Switch with '<'",
+			code:     compiler_error.CodeInvalidComparison,
+		},
+		{
+			name: "receive into a Switch",
+			source: wrapMain(`        (s)Receive
+        false =: Switch :s`),
+			expected: "cannot Receive into Switch 's'",
+			code:     compiler_error.CodeInvalidReceive,
+		},
+		{
+			name:     "arithmetic",
+			source:   wrapMain(`        "a" + 1 =: Gear :x`),
+			expected: "operator '+' is not defined for Omnidrone and Gear",
+			code:     compiler_error.CodeInvalidOperation,
+		},
+		{
+			name:     "modulo on Tensor",
+			source:   wrapMain(`        5.0 % 2 =: Gear :x`),
+			expected: "operator '%' is not defined for Tensor and Gear",
+			code:     compiler_error.CodeInvalidOperation,
+		},
+		{
+			name: "receive into Nil",
+			source: wrapMain(`        (n)Receive
+        Nil =: Nil :n`),
+			expected: "cannot Receive into Nil 'n'",
+			code:     compiler_error.CodeInvalidReceive,
+		},
+		{
+			name:     "detached value",
+			source:   wrapMain(`        ()main Detach =: Gear :x`),
+			expected: "the result of detached Architect 'main' cannot be used",
+			code:     compiler_error.CodeDetachedValue,
+		},
+		{
+			name:     "channel capacity",
+			source:   wrapMain(`        1.5 =: Gear Channel :c`),
+			expected: "Gear Channel 'c' is made with a Gear capacity or shares another Gear Channel, got Tensor",
+			code:     compiler_error.CodeChannelCapacity,
+		},
+		{
+			name: "send into channel",
+			source: wrapMain(`        ("a")c Send
+        0 =: Gear Channel :c`),
+			expected: "cannot Send a value of type Omnidrone into Gear Channel 'c'",
+			code:     compiler_error.CodeMismatchedSend,
+		},
+		{
+			name: "receive from channel",
+			source: wrapMain(`        (g)c Receive
+        0 =: Gear :g
+        0 =: Tensor Channel :c`),
+			expected: "cannot Receive from Tensor Channel 'c' into Gear 'g'",
+			code:     compiler_error.CodeMismatchedReceive,
+		},
+		{
+			name: "not a channel",
+			source: wrapMain(`        (1)n Send
+        0 =: Gear :n`),
+			expected: "'n' is not a Channel, it is Gear",
+			code:     compiler_error.CodeNotChannel,
+		},
+		{
+			name: "send a channel",
+			source: wrapMain(`        (c)Send
+        0 =: Gear Channel :c`),
+			expected: "cannot Send Gear Channel to the output",
+			code:     compiler_error.CodeInvalidSend,
+		},
+		{
+			name: "compare channels",
+			source: wrapMain(`        {
+        } c == c if
+        0 =: Gear Channel :c`),
+			expected: "cannot compare Gear Channel and Gear Channel with '=='",
+			code:     compiler_error.CodeInvalidComparison,
+		},
+		{
+			name:     "member of another State set",
+			source:   wrapStates(`        Red =: Machine :m`),
+			expected: "cannot declare Machine 'm' with a value of type Light",
+			code:     compiler_error.CodeMismatchedDeclaration,
+		},
+		{
+			name:     "Gear into a State set",
+			source:   wrapStates(`        0 =: Machine :m`),
+			expected: "cannot declare Machine 'm' with a value of type Gear",
+			code:     compiler_error.CodeMismatchedDeclaration,
+		},
+		{
+			name: "compare State sets",
+			source: wrapStates(`        {
+        } Idle == Red if`),
+			expected: "cannot compare Machine and Light with '=='",
+			code:     compiler_error.CodeInvalidComparison,
+		},
+		{
+			name: "order State members",
+			source: wrapStates(`        {
+        } Idle < Busy if`),
+			expected: "cannot compare Machine and Machine with '<'",
+			code:     compiler_error.CodeInvalidComparison,
+		},
+		{
+			name: "receive into a State set",
+			source: wrapStates(`        (m)Receive
+        Idle =: Machine :m`),
+			expected: "cannot Receive into Machine 'm'",
+			code:     compiler_error.CodeInvalidReceive,
+		},
+		{
+			name:     "element of an Assembly literal",
+			source:   wrapStates(`        (Red, Idle)Light Assembly =: Light Assembly :ls`),
+			expected: "element 2 of Light Assembly expects Light, got Machine",
+			code:     compiler_error.CodeMismatchedElement,
+		},
+		{
+			name:     "Assembly of another type",
+			source:   wrapMain(`        (1, 2)Gear Assembly =: Tensor Assembly :ts`),
+			expected: "cannot declare Tensor Assembly 'ts' with a value of type Gear Assembly",
+			code:     compiler_error.CodeMismatchedDeclaration,
+		},
+		{
+			name: "index that is not a Gear",
+			source: wrapMain(`        ([1.5]xs)Send
+        (1, 2)Gear Assembly =: Gear Assembly :xs`),
+			expected: "an Assembly is indexed with a Gear, got Tensor",
+			code:     compiler_error.CodeInvalidIndex,
+		},
+		{
+			name: "index a Gear",
+			source: wrapMain(`        ([0]x)Send
+        1 =: Gear :x`),
+			expected: "'x' is not an Assembly, it is Gear",
+			code:     compiler_error.CodeNotAssembly,
+		},
+		{
+			name:     "Length of a Gear",
+			source:   wrapMain(`        ((1)Length)Send`),
+			expected: "expected an Assembly, got a value of type Gear",
+			code:     compiler_error.CodeExpectedAssembly,
+		},
+		{
+			name: "store into an element",
+			source: wrapMain(`        2.5 = [0]xs
+        (1, 2)Gear Assembly =: Gear Assembly :xs`),
+			expected: "cannot assign a value of type Tensor to an element of Gear Assembly 'xs'",
+			code:     compiler_error.CodeMismatchedStore,
+		},
+		{
+			name: "Append to an Assembly",
+			source: wrapMain(`        ("three")xs Append
+        (1, 2)Gear Assembly =: Gear Assembly :xs`),
+			expected: "cannot Append a value of type Omnidrone to Gear Assembly 'xs'",
+			code:     compiler_error.CodeMismatchedAppend,
+		},
+		{
+			name: "for over the elements",
+			source: wrapMain(`        {
+        } ts =: Gear :x for
+        (1.5)Tensor Assembly =: Tensor Assembly :ts`),
+			expected: "cannot declare Gear 'x' with the elements of Tensor Assembly",
+			code:     compiler_error.CodeMismatchedIteration,
+		},
+		{
+			name: "send an Assembly",
+			source: wrapMain(`        (xs)Send
+        ()Gear Assembly =: Gear Assembly :xs`),
+			expected: "cannot Send Gear Assembly to the output",
+			code:     compiler_error.CodeInvalidSend,
+		},
+		{
+			name: "compare Assemblies",
+			source: wrapMain(`        {
+        } xs == xs if
+        ()Gear Assembly =: Gear Assembly :xs`),
+			expected: "cannot compare Gear Assembly and Gear Assembly with '=='",
+			code:     compiler_error.CodeInvalidComparison,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := analyzeSource(t, test.source)
+			if err == nil {
+				t.Fatalf("expected an error containing %q, got nil", test.expected)
+			}
+			if !strings.Contains(err.Error(), test.expected) {
+				t.Errorf("expected an error containing %q, got %q", test.expected, err.Error())
+			}
+			diagnostics := compiler_error.Diagnostics(err)
+			if len(diagnostics) != 1 || diagnostics[0].Code != test.code {
+				t.Errorf("expected a single %s diagnostic, got %v", test.code, diagnostics)
+			}
+		})
+	}
+}
+
+// TestChecker_Widening ensures that Gears are widened into Tensors where a Tensor is expected.
+func TestChecker_Widening(t *testing.T) {
+	source := `{
+   {
+        x Integrate
+   } Tensor (Tensor :x)half Architect
+   {
+        (y)Send
+        (2)half + x * 2 =: Tensor :y
+        {
+        } 1.5 >= 1 if
+        1 =: Tensor :x
+   } ()main Architect
+} main Construct`
+
+	info, err := analyzeSource(t, source)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for expr, typ := range info.Types {
+		if call, ok := expr.(*ast.CallExpr); ok && typ != ast.TypeTensor {
+			t.Errorf("expected the call to '%s' to be a Tensor, got %s", call.Name, typ)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package semantic
+
+import "mechanus-compiler/internal/ast"
+
+// SymbolKind :
+// Tells what a Symbol was declared as.
+type SymbolKind int
+
+const (
+	SymbolVariable SymbolKind = iota
+	SymbolParameter
+	SymbolMember
+)
+
+// String :
+// Returns a human-readable name for the kind of symbol.
+func (k SymbolKind) String() string {
+	switch k {
+	case SymbolVariable:
+		return "variable"
+	case SymbolParameter:
+		return "parameter"
+	case SymbolMember:
+		return "State member"
+	default:
+		return "symbol"
+	}
+}
+
+// Symbol :
+// A name declared with '=:', in <PARAMETERS_DECL> or in the <MEMBERS> of a State set. Value is the place of a State
+// member in its set, which is the number it stands for at run time.
+type Symbol struct {
+	Name     string
+	Kind     SymbolKind
+	Type     ast.Type
+	Position ast.Pos
+	Node     ast.Node
+	Value    int64
+}
+
+// Scope :
+// A symbol table for a single block. Lookups fall back to the enclosing scopes, while declarations only ever check
+// the current one, so inner blocks may shadow outer names.
+type Scope struct {
+	parent  *Scope
+	symbols map[string]*Symbol
+}
+
+// NewScope :
+// Creates an empty scope nested inside parent. The outermost scope has a nil parent.
+func NewScope(parent *Scope) *Scope {
+	return &Scope{
+		parent:  parent,
+		symbols: make(map[string]*Symbol),
+	}
+}
+
+// Parent :
+// Returns the enclosing scope, or nil for the outermost one.
+func (scope *Scope) Parent() *Scope {
+	return scope.parent
+}
+
+// Declare :
+// Adds a symbol to the scope. If a symbol with the same name already exists in this scope, it is returned and the
+// scope is left untouched.
+func (scope *Scope) Declare(symbol *Symbol) *Symbol {
+	if existing, ok := scope.symbols[symbol.Name]; ok {
+		return existing
+	}
+	scope.symbols[symbol.Name] = symbol
+	return nil
+}
+
+// Lookup :
+// Finds a symbol in this scope or in any of the enclosing ones. Returns nil if the name is not declared.
+func (scope *Scope) Lookup(name string) *Symbol {
+	for current := scope; current != nil; current = current.parent {
+		if symbol, ok := current.symbols[name]; ok {
+			return symbol
+		}
+	}
+	return nil
+}
@@ -0,0 +1,429 @@
+package semantic
+
+import (
+	"errors"
+	"fmt"
+	"mechanus-compiler/internal/ast"
+	"mechanus-compiler/internal/compiler_error"
+	"mechanus-compiler/internal/logger"
+	"os"
+)
+
+// Analyzer :
+// This is the structure responsible for making the semantic analysis of the tree built by the parser. It resolves
+// every identifier against the scope it is used in and every call against the Architects of the Construct, then
+// checks the types of the program.
+type Analyzer struct {
+	logger    *logger.Logger
+	construct *ast.Construct
+	scope     *Scope
+	members   map[string]*Symbol
+	current   *ast.Architect
+	info      *Info
+	errors    []error
+	quiet     bool // Logs the success of each pass at LevelDebug
+}
+
+// Info :
+// The result of the semantic analysis, shared with the later phases of the compiler.
+type Info struct {
+	// Architects maps each Architect name to its declaration.
+	Architects map[string]*ast.Architect
+	// Main is the Architect that starts the program, or nil if the Construct has none.
+	Main *ast.Architect
+	// States maps the type of each State set to its declaration.
+	States map[ast.Type]*ast.StateSet
+	// Defs maps each *ast.Parameter, *ast.CmdDeclaration and *ast.StateMember to the symbol it declares, as well as
+	// each *ast.CmdFor that goes over an Assembly to the variable holding its elements.
+	Defs map[ast.Node]*Symbol
+	// Uses maps each *ast.Identifier, *ast.CmdAssignment and *ast.CmdReceive to the symbol it refers to. An
+	// *ast.Identifier may refer to a State member, which backends replace with its Value.
+	Uses map[ast.Node]*Symbol
+	// Calls maps each call to the Architect it invokes.
+	Calls map[*ast.CallExpr]*ast.Architect
+	// Types maps each expression to its inferred type.
+	Types map[ast.Expr]ast.Type
+	// Concurrent is set when an Architect is detached or a Channel is declared, which needs a runtime able to run
+	// Architects alongside each other.
+	Concurrent bool
+}
+
+// MainArchitect is the name of the Architect that starts the program.
+const MainArchitect = "main"
+
+const (
+	errUndeclaredVariable   = "use of undeclared variable '%s'"
+	errDuplicateDeclaration = "'%s' is already declared in this block at %s"
+	errDuplicateArchitect   = "Architect '%s' is already declared at %s"
+	errUndefinedArchitect   = "call to undefined Architect '%s'"
+	errWrongArgumentCount   = "Architect '%s' expects %d argument(s), got %d"
+	errDuplicateState       = "State '%s' is already declared at %s"
+	errDuplicateMember      = "State member '%s' is already declared at %s"
+	errUndeclaredState      = "use of undeclared State '%s'"
+	errChangedMember        = "cannot change State member '%s'"
+	errMainParameters       = "the main Architect cannot take parameters, got %d"
+)
+
+// NewAnalyzer :
+// Initializes a new Analyzer instance.
+func NewAnalyzer(debug bool) Analyzer {
+	// Initialize the logger. Log to Stderr. Set level based on the debug flag.
+	logLevel := logger.LevelInfo
+	if debug {
+		logLevel = logger.LevelDebug
+	}
+
+	return Analyzer{
+		logger: logger.New(os.Stderr, logLevel),
+	}
+}
+
+// SetQuiet :
+// Logs the success of the analysis at LevelDebug instead of LevelInfo, for commands whose output belongs to the
+// program they run.
+func (analyzer *Analyzer) SetQuiet(quiet bool) {
+	analyzer.quiet = quiet
+}
+
+// Run :
+// Starts the semantic analysis of the given Construct.
+//
+// Fails if any identifier cannot be resolved, if a name is declared twice in the same block, if a State set or one of
+// its members is declared twice in the Construct, if an Architect is called with the wrong number of arguments, if the
+// main Architect takes parameters, which nothing could pass to it, or if the program is not well typed. Every problem
+// found is reported, not only the first one. Types are only checked once every name has been resolved.
+func (analyzer *Analyzer) Run(construct *ast.Construct) (*Info, error) {
+	analyzer.errors = nil
+	analyzer.construct = construct
+	analyzer.members = make(map[string]*Symbol)
+	analyzer.info = &Info{
+		Architects: make(map[string]*ast.Architect),
+		States:     make(map[ast.Type]*ast.StateSet),
+		Defs:       make(map[ast.Node]*Symbol),
+		Uses:       make(map[ast.Node]*Symbol),
+		Calls:      make(map[*ast.CallExpr]*ast.Architect),
+		Types:      make(map[ast.Expr]ast.Type),
+	}
+
+	// State members are visible from every Architect, wherever their set is declared
+	for _, state := range construct.States {
+		analyzer.state(state)
+	}
+
+	// Architects may be called before they are declared, so they are all collected first
+	for _, architect := range construct.Architects {
+		if existing, ok := analyzer.info.Architects[architect.Name]; ok {
+			analyzer.report(architect.Position, compiler_error.CodeDuplicateArchitect, errDuplicateArchitect,
+				architect.Name, existing.Position)
+			continue
+		}
+		analyzer.info.Architects[architect.Name] = architect
+	}
+
+	// A Construct without a main Architect is still analyzed, and left for the phase that has to run it to reject
+	if entry, ok := analyzer.info.Architects[MainArchitect]; ok {
+		analyzer.info.Main = entry
+		if len(entry.Parameters) > 0 {
+			analyzer.report(entry.Parameters[0].Position, compiler_error.CodeMainParameters, errMainParameters,
+				len(entry.Parameters))
+		}
+	}
+
+	for _, architect := range construct.Architects {
+		analyzer.architect(architect)
+	}
+
+	if len(analyzer.errors) > 0 {
+		return analyzer.info, errors.Join(analyzer.errors...)
+	}
+	analyzer.success(compiler_error.SemanticSuccess)
+
+	analyzer.checkTypes(construct)
+	if len(analyzer.errors) > 0 {
+		return analyzer.info, errors.Join(analyzer.errors...)
+	}
+	analyzer.success(compiler_error.TypeSuccess)
+
+	return analyzer.info, nil
+}
+
+// state :
+// Declares a State set and its members. Members share a single namespace across every set, since they are used by
+// their name alone.
+func (analyzer *Analyzer) state(state *ast.StateSet) {
+	if existing, ok := analyzer.info.States[state.Type]; ok {
+		analyzer.report(state.Position, compiler_error.CodeDuplicateState, errDuplicateState, state.Name,
+			existing.Position)
+		return
+	}
+	analyzer.info.States[state.Type] = state
+
+	for i, member := range state.Members {
+		if existing, ok := analyzer.members[member.Name]; ok {
+			analyzer.report(member.Position, compiler_error.CodeDuplicateMember, errDuplicateMember, member.Name,
+				existing.Position)
+			continue
+		}
+		symbol := &Symbol{
+			Name:     member.Name,
+			Kind:     SymbolMember,
+			Type:     state.Type,
+			Position: member.Position,
+			Node:     member,
+			Value:    int64(i),
+		}
+		analyzer.members[member.Name] = symbol
+		analyzer.info.Defs[member] = symbol
+	}
+}
+
+// architect :
+// Checks a single Architect. Its parameters and the top level of its body share the same scope.
+func (analyzer *Analyzer) architect(architect *ast.Architect) {
+	analyzer.scope = NewScope(nil)
+	defer func() { analyzer.scope = nil }()
+
+	if architect.ReturnType.IsChannel() {
+		analyzer.info.Concurrent = true
+	}
+	analyzer.typeName(architect.Position, architect.ReturnType)
+
+	for _, parameter := range architect.Parameters {
+		analyzer.typeName(parameter.Position, parameter.Type)
+		analyzer.declare(&Symbol{
+			Name:     parameter.Name,
+			Kind:     SymbolParameter,
+			Type:     parameter.Type,
+			Position: parameter.Position,
+			Node:     parameter,
+		})
+	}
+
+	analyzer.commands(architect.Body.Commands)
+}
+
+// block :
+// Checks a nested block inside its own scope.
+func (analyzer *Analyzer) block(block *ast.Block) {
+	analyzer.scope = NewScope(analyzer.scope)
+	defer func() { analyzer.scope = analyzer.scope.Parent() }()
+
+	analyzer.commands(block.Commands)
+}
+
+// commands :
+// Checks a list of commands in execution order, so a variable is only visible to the commands that run after its
+// declaration.
+func (analyzer *Analyzer) commands(commands []ast.Command) {
+	for _, command := range commands {
+		analyzer.command(command)
+	}
+}
+
+// command :
+// Checks a single command.
+func (analyzer *Analyzer) command(command ast.Command) {
+	switch cmd := command.(type) {
+	case *ast.CmdIf:
+		analyzer.expr(cmd.Condition)
+		analyzer.block(cmd.Then)
+		for _, elif := range cmd.Elifs {
+			analyzer.expr(elif.Condition)
+			analyzer.block(elif.Body)
+		}
+		if cmd.Else != nil {
+			analyzer.block(cmd.Else)
+		}
+	case *ast.CmdFor:
+		if cmd.Elements == nil {
+			analyzer.expr(cmd.Condition)
+			analyzer.block(cmd.Body)
+			return
+		}
+		analyzer.iteration(cmd)
+	case *ast.CmdDeclaration:
+		// The value is checked first, so a variable cannot be used to initialize itself
+		analyzer.expr(cmd.Value)
+		analyzer.typeName(cmd.Position, cmd.Type)
+		analyzer.declare(&Symbol{
+			Name:     cmd.Name,
+			Kind:     SymbolVariable,
+			Type:     cmd.Type,
+			Position: cmd.Position,
+			Node:     cmd,
+		})
+	case *ast.CmdAssignment:
+		analyzer.expr(cmd.Value)
+		if cmd.Index != nil {
+			analyzer.expr(cmd.Index)
+		}
+		analyzer.use(cmd, cmd.Name, cmd.Position)
+	case *ast.CmdReceive:
+		if cmd.Channel != nil {
+			analyzer.expr(cmd.Channel)
+		}
+		analyzer.use(cmd, cmd.Name, cmd.Position)
+	case *ast.CmdSend:
+		analyzer.expr(cmd.Value)
+		if cmd.Channel != nil {
+			analyzer.expr(cmd.Channel)
+		}
+	case *ast.CmdAppend:
+		analyzer.expr(cmd.Value)
+		analyzer.expr(cmd.Assembly)
+	case *ast.CmdIntegrate:
+		analyzer.expr(cmd.Value)
+	case *ast.CmdCall:
+		analyzer.call(cmd.Call)
+	}
+}
+
+// iteration :
+// Checks a for that goes over the elements of an Assembly. The Assembly is resolved outside the loop, while the
+// variable holding each element gets a scope of its own around the body, so it can share the name of a variable of
+// the body's enclosing block.
+func (analyzer *Analyzer) iteration(cmd *ast.CmdFor) {
+	analyzer.expr(cmd.Elements)
+
+	analyzer.scope = NewScope(analyzer.scope)
+	defer func() { analyzer.scope = analyzer.scope.Parent() }()
+
+	analyzer.typeName(cmd.NamePosition, cmd.Type)
+	analyzer.declare(&Symbol{
+		Name:     cmd.Name,
+		Kind:     SymbolVariable,
+		Type:     cmd.Type,
+		Position: cmd.NamePosition,
+		Node:     cmd,
+	})
+	analyzer.block(cmd.Body)
+}
+
+// expr :
+// Resolves every identifier and call inside an expression.
+func (analyzer *Analyzer) expr(expr ast.Expr) {
+	switch e := expr.(type) {
+	case *ast.BinaryExpr:
+		analyzer.expr(e.Left)
+		analyzer.expr(e.Right)
+	case *ast.UnaryExpr:
+		analyzer.expr(e.Operand)
+	case *ast.Identifier:
+		analyzer.use(e, e.Name, e.Position)
+	case *ast.CallExpr:
+		analyzer.call(e)
+	case *ast.AssemblyLiteral:
+		analyzer.typeName(e.Position, e.Type)
+		for _, element := range e.Elements {
+			analyzer.expr(element)
+		}
+	case *ast.IndexExpr:
+		analyzer.expr(e.Index)
+		analyzer.expr(e.Assembly)
+	case *ast.LengthExpr:
+		analyzer.expr(e.Assembly)
+	}
+}
+
+// call :
+// Resolves the called Architect and checks the number of arguments.
+func (analyzer *Analyzer) call(call *ast.CallExpr) {
+	if call.Detached {
+		analyzer.info.Concurrent = true
+	}
+	for _, argument := range call.Arguments {
+		analyzer.expr(argument)
+	}
+
+	architect, ok := analyzer.info.Architects[call.Name]
+	if !ok {
+		analyzer.report(call.Position, compiler_error.CodeUndefinedArchitect, errUndefinedArchitect, call.Name)
+		return
+	}
+	analyzer.info.Calls[call] = architect
+
+	if len(call.Arguments) != len(architect.Parameters) {
+		analyzer.report(call.Position, compiler_error.CodeWrongArgumentCount, errWrongArgumentCount, call.Name,
+			len(architect.Parameters), len(call.Arguments))
+	}
+}
+
+// declare :
+// Adds a symbol to the current scope, reporting a duplicate declaration if the name is already taken in it.
+func (analyzer *Analyzer) declare(symbol *Symbol) {
+	if existing := analyzer.scope.Declare(symbol); existing != nil {
+		analyzer.report(symbol.Position, compiler_error.CodeDuplicateDeclaration, errDuplicateDeclaration, symbol.Name,
+			existing.Position)
+		return
+	}
+	analyzer.info.Defs[symbol.Node] = symbol
+	if symbol.Type.IsChannel() {
+		analyzer.info.Concurrent = true
+	}
+	analyzer.logger.Debug("Declared symbol", map[string]any{"name": symbol.Name, "kind": symbol.Kind.String()})
+}
+
+// use :
+// Resolves a name used by node, reporting it if it was not declared yet. A name that is not a variable may be a State
+// member, unless node stores a value into it.
+func (analyzer *Analyzer) use(node ast.Node, name string, position ast.Pos) {
+	symbol := analyzer.scope.Lookup(name)
+	if symbol == nil {
+		symbol = analyzer.members[name]
+	}
+	if symbol == nil {
+		analyzer.report(position, compiler_error.CodeUndeclaredVariable, errUndeclaredVariable, name)
+		return
+	}
+	if _, ok := node.(*ast.Identifier); !ok && symbol.Kind == SymbolMember {
+		analyzer.report(position, compiler_error.CodeChangedMember, errChangedMember, name)
+		return
+	}
+	analyzer.info.Uses[node] = symbol
+}
+
+// typeName :
+// Reports a type written at position that names a State set the Construct does not declare.
+func (analyzer *Analyzer) typeName(position ast.Pos, t ast.Type) {
+	if t.StateIndex() < 0 {
+		return
+	}
+	if _, ok := analyzer.info.States[t.Element()]; !ok {
+		analyzer.report(position, compiler_error.CodeUndeclaredState, errUndeclaredState,
+			analyzer.construct.TypeString(t.Element()))
+	}
+}
+
+// success :
+// Logs that a pass of the analysis found no errors.
+func (analyzer *Analyzer) success(message string) {
+	if analyzer.quiet {
+		analyzer.logger.Debug(message, nil)
+		return
+	}
+	analyzer.logger.Info(message, nil)
+}
+
+// report :
+// Records and logs a semantic error found at the given position, under the diagnostic code of its kind.
+func (analyzer *Analyzer) report(position ast.Pos, code string, format string, args ...any) {
+	diagnostic := newDiagnostic(compiler_error.ErrSemantic, code, position, fmt.Sprintf(format, args...))
+	err := compiler_error.SemanticErrorf(compiler_error.SemanticError, diagnostic)
+
+	analyzer.logger.Error(err, map[string]any{"position": position.String()})
+	analyzer.errors = append(analyzer.errors, err)
+}
+
+// newDiagnostic :
+// Builds the Diagnostic of an error found at the given position. Nodes only know where they start, so the Diagnostic
+// points at a single character. The tree does not know its file either, which is left for the caller to fill in.
+func newDiagnostic(kind compiler_error.AnalysisError, code string, position ast.Pos,
+	message string) *compiler_error.Diagnostic {
+	return &compiler_error.Diagnostic{
+		Severity: compiler_error.SeverityError,
+		Kind:     kind,
+		Code:     code,
+		Span:     compiler_error.Span{Start: position, End: position},
+		Message:  message,
+	}
+}
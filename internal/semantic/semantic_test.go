@@ -0,0 +1,271 @@
+package semantic_test
+
+import (
+	"mechanus-compiler/internal/ast"
+	"mechanus-compiler/internal/compiler_error"
+	"mechanus-compiler/internal/mechatest"
+	"mechanus-compiler/internal/semantic"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// analyzeSource parses and analyzes the given source.
+func analyzeSource(t *testing.T, source string) (*semantic.Info, error) {
+	t.Helper()
+
+	analyzer := semantic.NewAnalyzer(false)
+	return analyzer.Run(mechatest.Parse(t, source))
+}
+
+// TestAnalyzer_Examples ensures that every example program passes the semantic analysis.
+func TestAnalyzer_Examples(t *testing.T) {
+	paths, err := filepath.Glob("../../docs/examples/example*_input.mecha")
+	if err != nil || len(paths) == 0 {
+		t.Fatalf("no examples found: %v", err)
+	}
+
+	for _, path := range paths {
+		source, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("failed to read %s: %v", path, err)
+		}
+		if _, err := analyzeSource(t, string(source)); err != nil {
+			t.Errorf("%s: unexpected error: %v", path, err)
+		}
+	}
+}
+
+// TestAnalyzer_Errors checks that each kind of problem is reported with its position and its own code.
+func TestAnalyzer_Errors(t *testing.T) {
+	tests := []struct {
+		name     string
+		source   string
+		expected string
+		code     string
+	}{
+		{
+			name: "use before declaration",
+			source: `{
+   {
+        1 =: Gear :x
+        (x)Send
+   } ()main Architect
+} main Construct`,
+			expected: "use of undeclared variable 'x' at Line: 4",
+			code:     compiler_error.CodeUndeclaredVariable,
+		},
+		{
+			name: "main with parameters",
+			source: `{
+   {
+   } (Gear :a, Tensor :b)main Architect
+} main Construct`,
+			expected: "the main Architect cannot take parameters, got 2 at Line: 3",
+			code:     compiler_error.CodeMainParameters,
+		},
+		{
+			name: "for variable outside of its loop",
+			source: `{
+   {
+        (x)Send
+        {
+        } (1, 2)Gear Assembly =: Gear :x for
+   } ()main Architect
+} main Construct`,
+			expected: "use of undeclared variable 'x' at Line: 3",
+			code:     compiler_error.CodeUndeclaredVariable,
+		},
+		{
+			name: "duplicate declaration",
+			source: `{
+   {
+        2 =: Gear :x
+        1 =: Gear :x
+   } ()main Architect
+} main Construct`,
+			expected: "'x' is already declared in this block",
+			code:     compiler_error.CodeDuplicateDeclaration,
+		},
+		{
+			name: "undefined Architect",
+			source: `{
+   {
+        (1)missing
+   } ()main Architect
+} main Construct`,
+			expected: "call to undefined Architect 'missing'",
+			code:     compiler_error.CodeUndefinedArchitect,
+		},
+		{
+			name: "wrong argument count",
+			source: `{
+   {
+        x Integrate
+   } (Gear :x)double Architect
+   {
+        (1, 2)double
+   } ()main Architect
+} main Construct`,
+			expected: "Architect 'double' expects 1 argument(s), got 2",
+			code:     compiler_error.CodeWrongArgumentCount,
+		},
+		{
+			name: "variable out of scope",
+			source: `{
+   {
+        (y)Send
+        {
+            1 =: Gear :y
+        } 1 < 2 if
+   } ()main Architect
+} main Construct`,
+			expected: "use of undeclared variable 'y'",
+			code:     compiler_error.CodeUndeclaredVariable,
+		},
+		{
+			name: "duplicate State set",
+			source: `{
+   (On, Off)Power State
+   (Up, Down)Power State
+   {
+   } ()main Architect
+} main Construct`,
+			expected: "State 'Power' is already declared",
+			code:     compiler_error.CodeDuplicateState,
+		},
+		{
+			name: "duplicate State member",
+			source: `{
+   (Idle, Busy)Machine State
+   (Busy, Done)Job State
+   {
+   } ()main Architect
+} main Construct`,
+			expected: "State member 'Busy' is already declared",
+			code:     compiler_error.CodeDuplicateMember,
+		},
+		{
+			name: "undeclared State set",
+			source: `{
+   {
+        (m)Send
+   } (Machine :m)show Architect
+   {
+   } ()main Architect
+} main Construct`,
+			expected: "use of undeclared State 'Machine'",
+			code:     compiler_error.CodeUndeclaredState,
+		},
+		{
+			name: "assignment to a State member",
+			source: `{
+   (Idle, Busy)Machine State
+   {
+        Busy = Idle
+   } ()main Architect
+} main Construct`,
+			expected: "cannot change State member 'Idle'",
+			code:     compiler_error.CodeChangedMember,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := analyzeSource(t, test.source)
+			if err == nil {
+				t.Fatalf("expected an error containing %q, got nil", test.expected)
+			}
+			if !strings.Contains(err.Error(), test.expected) {
+				t.Errorf("expected an error containing %q, got %q", test.expected, err.Error())
+			}
+			diagnostics := compiler_error.Diagnostics(err)
+			if len(diagnostics) != 1 || diagnostics[0].Code != test.code {
+				t.Errorf("expected a single %s diagnostic, got %v", test.code, diagnostics)
+			}
+		})
+	}
+}
+
+// TestAnalyzer_States ensures that State members are numbered by their place in their set, wherever the set is
+// declared, and that a variable shadows a member of the same name.
+func TestAnalyzer_States(t *testing.T) {
+	source := `{
+   {
+        (Busy)Send
+        (Done)Send
+        0 =: Gear :Busy
+        {
+        } m != Idle if
+        Idle =: Machine :m
+   } ()main Architect
+   (Idle, Busy, Done)Machine State
+} main Construct`
+
+	info, err := analyzeSource(t, source)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for node, symbol := range info.Uses {
+		identifier, ok := node.(*ast.Identifier)
+		if !ok {
+			continue
+		}
+		switch identifier.Name {
+		case "Idle", "Done":
+			expected := map[string]int64{"Idle": 0, "Done": 2}[identifier.Name]
+			if symbol.Kind != semantic.SymbolMember || symbol.Value != expected {
+				t.Errorf("expected '%s' to be member %d, got a %s with %d", identifier.Name, expected, symbol.Kind,
+					symbol.Value)
+			}
+			if info.States[symbol.Type].Name != "Machine" {
+				t.Errorf("expected '%s' to belong to Machine, got %s", identifier.Name, symbol.Type)
+			}
+		case "Busy":
+			if symbol.Kind != semantic.SymbolVariable {
+				t.Errorf("expected the variable Busy to shadow the member, got a %s", symbol.Kind)
+			}
+		}
+	}
+}
+
+// TestAnalyzer_Shadowing ensures that an inner block may reuse a name declared in an outer one, and that uses are
+// resolved to the closest declaration.
+func TestAnalyzer_Shadowing(t *testing.T) {
+	source := `{
+   {
+        {
+            (x)Send
+            2 =: Gear :x
+        } x < 2 if
+        1 =: Gear :x
+   } ()main Architect
+} main Construct`
+
+	info, err := analyzeSource(t, source)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	checked := 0
+	for node, symbol := range info.Uses {
+		identifier, ok := node.(*ast.Identifier)
+		if !ok {
+			continue
+		}
+		checked++
+		// The condition uses the outer x (line 7), the Send uses the inner one (line 5)
+		if identifier.Position.Line == 4 && symbol.Position.Line != 5 {
+			t.Errorf("expected the Send to use the inner x, got the one at %s", symbol.Position)
+		}
+		if identifier.Position.Line == 6 && symbol.Position.Line != 7 {
+			t.Errorf("expected the condition to use the outer x, got the one at %s", symbol.Position)
+		}
+	}
+
+	if checked != 2 {
+		t.Errorf("expected 2 resolved identifiers, got %d", checked)
+	}
+}
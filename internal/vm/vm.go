@@ -0,0 +1,354 @@
+package vm
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"mechanus-compiler/internal/ast"
+	"mechanus-compiler/internal/bytecode"
+	"mechanus-compiler/internal/compiler_error"
+	"mechanus-compiler/internal/interpreter"
+	"mechanus-compiler/internal/logger"
+	"os"
+	"strings"
+)
+
+// VM :
+// This is the structure responsible for running a bytecode Program. The entry function and every detached function
+// run on a thread of their own, coordinated by the scheduler of the interpreter.
+type VM struct {
+	logger    *logger.Logger
+	program   *bytecode.Program
+	input     *bufio.Reader
+	output    *bufio.Writer
+	scheduler *interpreter.Scheduler
+}
+
+// thread :
+// The state of a running function and the functions it called. Every call gets a frame whose locals live on the
+// value stack, right below the operands of the function.
+type thread struct {
+	vm     *VM
+	stack  []interpreter.Value
+	frames []frame
+}
+
+// frame :
+// A running call: the function, the offset of its next instruction and the index of its first local on the stack.
+type frame struct {
+	function *bytecode.Function
+	ip       int
+	base     int
+}
+
+// maxFrames limits the depth of the call stack, so a runaway recursion stops with an error instead of exhausting the
+// memory of the machine.
+const maxFrames = 1 << 20
+
+const (
+	errStackOverflow     = "call stack overflow in '%s'"
+	errMalformedBytecode = "malformed bytecode in '%s' at offset %d: %v"
+)
+
+// NewVM :
+// Initializes a new VM instance. The program should come from bytecode.Load or from a bytecode.Compiler, so its
+// operands have been checked.
+func NewVM(program *bytecode.Program, input io.Reader, output io.Writer, debug bool) VM {
+	// Initialize the logger. Log to Stderr. Set level based on the debug flag.
+	logLevel := logger.LevelInfo
+	if debug {
+		logLevel = logger.LevelDebug
+	}
+
+	return VM{
+		logger:  logger.New(os.Stderr, logLevel),
+		program: program,
+		input:   bufio.NewReader(input),
+		output:  bufio.NewWriter(output),
+	}
+}
+
+// Run :
+// Runs the entry function of the program and returns the exit code of the program, which is the Gear it integrates.
+// Functions that integrate any other type exit with 0.
+//
+// Fails on a runtime error such as a division by zero, a Receive that cannot be parsed or a deadlock, including one
+// inside a detached function. The exit code is 1 in that case. Detached functions still running when the entry
+// function returns are stopped.
+func (vm *VM) Run() (int64, error) {
+	vm.scheduler = interpreter.NewScheduler()
+	defer func() {
+		vm.scheduler.Stop()
+		if flushErr := vm.output.Flush(); flushErr != nil {
+			vm.logger.Error(compiler_error.FileErrorf("VM.Run", flushErr), nil)
+		}
+	}()
+
+	main := &thread{vm: vm}
+	main.call(vm.program.Functions[vm.program.Entry])
+
+	value, err := main.run()
+	if errors.Is(err, interpreter.ErrHalted) {
+		// A detached function failed, and its error is the one that stopped the program
+		err = vm.scheduler.Failure()
+	}
+	if err != nil {
+		return 1, err
+	}
+	if gear, ok := value.(int64); ok {
+		return gear, nil
+	}
+	return 0, nil
+}
+
+// run :
+// Runs the thread until its first function returns, and returns the value it integrates.
+func (thread *thread) run() (value interpreter.Value, err error) {
+	// Verify does not follow the stack, so bytecode that was not produced by the compiler may still pop more values
+	// than it pushed. That is reported as an error instead of crashing the VM.
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			name, offset := "", 0
+			if len(thread.frames) > 0 {
+				current := thread.frames[len(thread.frames)-1]
+				name, offset = current.function.Name, current.ip
+			}
+			err = thread.vm.fail(fmt.Errorf(errMalformedBytecode, name, offset, recovered))
+		}
+	}()
+
+	return thread.loop()
+}
+
+// loop :
+// Executes instructions until the first function of the thread returns. Backward jumps and calls first check that
+// the program was not halted, which is enough to stop any loop or recursion.
+func (thread *thread) loop() (interpreter.Value, error) {
+	vm := thread.vm
+	current := &thread.frames[len(thread.frames)-1]
+	for {
+		code := current.function.Code
+		op := bytecode.Opcode(code[current.ip])
+		offset := current.ip
+
+		operand := 0
+		for i := 0; i < op.OperandWidth(); i++ {
+			operand |= int(code[current.ip+1+i]) << (8 * i)
+		}
+		current.ip += 1 + op.OperandWidth()
+
+		switch op {
+		case bytecode.OpConst:
+			thread.push(vm.program.Constants[operand])
+		case bytecode.OpNil:
+			thread.push(interpreter.Nil{})
+		case bytecode.OpLoad:
+			thread.push(thread.stack[current.base+operand])
+		case bytecode.OpStore:
+			thread.stack[current.base+operand] = thread.pop()
+		case bytecode.OpPop:
+			thread.pop()
+		case bytecode.OpWiden:
+			thread.push(interpreter.Convert(thread.pop(), ast.TypeTensor))
+		case bytecode.OpAdd, bytecode.OpSub, bytecode.OpMul, bytecode.OpDiv, bytecode.OpMod:
+			operator, _ := op.Operator()
+			right := thread.pop()
+			left := thread.pop()
+			value, err := interpreter.Arithmetic(operator, left, right)
+			if err != nil {
+				return nil, vm.fail(fmt.Errorf("%w in '%s' at offset %d", err, current.function.Name, offset))
+			}
+			thread.push(value)
+		case bytecode.OpNeg:
+			thread.push(interpreter.Negate(thread.pop()))
+		case bytecode.OpGreater, bytecode.OpGreaterEqual, bytecode.OpLess, bytecode.OpLessEqual, bytecode.OpEqual,
+			bytecode.OpNotEqual:
+			operator, _ := op.Operator()
+			right := thread.pop()
+			left := thread.pop()
+			thread.push(interpreter.Compare(operator, left, right))
+		case bytecode.OpJump:
+			if vm.scheduler.Halted() {
+				return nil, interpreter.ErrHalted
+			}
+			current.ip = operand
+		case bytecode.OpJumpIfFalse:
+			if !thread.pop().(bool) {
+				current.ip = operand
+			}
+		case bytecode.OpJumpIfTrue:
+			if thread.pop().(bool) {
+				current.ip = operand
+			}
+		case bytecode.OpCall:
+			if vm.scheduler.Halted() {
+				return nil, interpreter.ErrHalted
+			}
+			function := vm.program.Functions[operand]
+			if len(thread.frames) >= maxFrames {
+				return nil, vm.fail(fmt.Errorf(errStackOverflow, function.Name))
+			}
+			thread.call(function)
+			current = &thread.frames[len(thread.frames)-1]
+		case bytecode.OpReturn:
+			value := thread.pop()
+			thread.stack = thread.stack[:current.base]
+			thread.frames = thread.frames[:len(thread.frames)-1]
+			if len(thread.frames) == 0 {
+				return value, nil
+			}
+			thread.push(value)
+			current = &thread.frames[len(thread.frames)-1]
+		case bytecode.OpSend:
+			value := thread.pop()
+			err := vm.scheduler.Output(func() error {
+				_, err := vm.output.WriteString(interpreter.Format(value) + "\n")
+				return err
+			})
+			if err != nil {
+				return nil, vm.stop(err)
+			}
+		case bytecode.OpReceive:
+			value, err := vm.receive(ast.Type(operand))
+			if err != nil {
+				return nil, vm.stop(fmt.Errorf("%w in '%s' at offset %d", err, current.function.Name, offset))
+			}
+			thread.push(value)
+		case bytecode.OpDetach:
+			function := vm.program.Functions[operand]
+			base := len(thread.stack) - function.Parameters
+			vm.detach(function, thread.stack[base:])
+			thread.stack = thread.stack[:base]
+		case bytecode.OpChannel:
+			channel, err := interpreter.NewChannel(thread.pop().(int64))
+			if err != nil {
+				return nil, vm.fail(fmt.Errorf("%w in '%s' at offset %d", err, current.function.Name, offset))
+			}
+			thread.push(channel)
+		case bytecode.OpSendChannel:
+			channel, _ := thread.pop().(*interpreter.Channel)
+			if err := vm.scheduler.Send(channel, thread.pop()); err != nil {
+				return nil, vm.stop(fmt.Errorf("%w in '%s' at offset %d", err, current.function.Name, offset))
+			}
+		case bytecode.OpReceiveChannel:
+			channel, _ := thread.pop().(*interpreter.Channel)
+			value, err := vm.scheduler.Receive(channel)
+			if err != nil {
+				return nil, vm.stop(fmt.Errorf("%w in '%s' at offset %d", err, current.function.Name, offset))
+			}
+			thread.push(value)
+		case bytecode.OpSelect:
+			index := thread.pop().(int64)
+			base := len(thread.stack) - operand
+			value := thread.stack[base+int(index)]
+			thread.stack = thread.stack[:base]
+			thread.push(value)
+		case bytecode.OpAssembly:
+			base := len(thread.stack) - operand
+			elements := append([]interpreter.Value(nil), thread.stack[base:]...)
+			thread.stack = thread.stack[:base]
+			thread.push(interpreter.NewAssembly(elements))
+		case bytecode.OpIndex:
+			assembly := thread.pop().(*interpreter.Assembly)
+			value, err := assembly.Get(thread.pop().(int64))
+			if err != nil {
+				return nil, vm.fail(fmt.Errorf("%w in '%s' at offset %d", err, current.function.Name, offset))
+			}
+			thread.push(value)
+		case bytecode.OpStoreIndex:
+			assembly := thread.pop().(*interpreter.Assembly)
+			index := thread.pop().(int64)
+			if err := assembly.Set(index, thread.pop()); err != nil {
+				return nil, vm.fail(fmt.Errorf("%w in '%s' at offset %d", err, current.function.Name, offset))
+			}
+		case bytecode.OpAppend:
+			assembly := thread.pop().(*interpreter.Assembly)
+			assembly.Append(thread.pop())
+		case bytecode.OpLength:
+			thread.push(thread.pop().(*interpreter.Assembly).Len())
+		default:
+			return nil, vm.fail(fmt.Errorf(errMalformedBytecode, current.function.Name, offset, op))
+		}
+	}
+}
+
+// call :
+// Pushes a frame for the function. Its arguments are already on the stack and become its first locals; the rest of
+// its locals start as Nil until they are declared.
+func (thread *thread) call(function *bytecode.Function) {
+	base := len(thread.stack) - function.Parameters
+	for i := function.Parameters; i < function.Locals; i++ {
+		thread.push(interpreter.Nil{})
+	}
+	thread.frames = append(thread.frames, frame{function: function, base: base})
+}
+
+// detach :
+// Runs the function on a new thread. The arguments are copied to its stack, where they become its first locals.
+func (vm *VM) detach(function *bytecode.Function, arguments []interpreter.Value) {
+	detached := &thread{vm: vm, stack: append([]interpreter.Value(nil), arguments...)}
+	detached.call(function)
+	vm.scheduler.Detach(func() error {
+		_, err := detached.run()
+		return err
+	})
+}
+
+// push :
+// Pushes a value on the stack.
+func (thread *thread) push(value interpreter.Value) {
+	thread.stack = append(thread.stack, value)
+}
+
+// pop :
+// Pops the value on top of the stack.
+func (thread *thread) pop() interpreter.Value {
+	value := thread.stack[len(thread.stack)-1]
+	thread.stack = thread.stack[:len(thread.stack)-1]
+	return value
+}
+
+// receive :
+// Reads a line from the input and parses it as a value of the given type. Pending output is flushed first, so a
+// prompt sent right before the Receive is visible.
+func (vm *VM) receive(t ast.Type) (interpreter.Value, error) {
+	var line string
+	err := vm.scheduler.Input(func() error {
+		if err := vm.scheduler.Output(vm.output.Flush); err != nil {
+			return err
+		}
+
+		var err error
+		line, err = vm.input.ReadString('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\n")
+	line = strings.TrimSuffix(line, "\r")
+	return interpreter.Parse(line, t)
+}
+
+// fail :
+// Wraps and logs an error that stopped the program. Bytecode does not keep positions, so its Diagnostic points nowhere.
+func (vm *VM) fail(err error) error {
+	diagnostic := compiler_error.RuntimeDiagnostic(ast.Pos{}, err.Error())
+	err = compiler_error.RuntimeErrorf(compiler_error.RuntimeError, diagnostic)
+	vm.logger.Error(err, nil)
+	return err
+}
+
+// stop :
+// Like fail, but lets interpreter.ErrHalted through as-is, since the function that halted the program reported its
+// own error.
+func (vm *VM) stop(err error) error {
+	if errors.Is(err, interpreter.ErrHalted) {
+		return err
+	}
+	return vm.fail(err)
+}
@@ -0,0 +1,293 @@
+package vm
+
+import (
+	"bytes"
+	"mechanus-compiler/internal/bytecode"
+	"mechanus-compiler/internal/compiler_error"
+	"mechanus-compiler/internal/mechatest"
+	"strings"
+	"testing"
+)
+
+// runSource compiles the given source to bytecode and runs it with the given input. Returns what the program sent,
+// its exit code and the runtime error, if any.
+func runSource(t *testing.T, source, input string) (string, int64, error) {
+	t.Helper()
+
+	construct, info := mechatest.Analyze(t, source)
+	compiler := bytecode.NewCompiler(info, false)
+	program, err := compiler.Run(construct)
+	if err != nil {
+		t.Fatalf("unexpected compilation error: %v", err)
+	}
+
+	var output bytes.Buffer
+	machine := NewVM(program, strings.NewReader(input), &output, false)
+	exitCode, err := machine.Run()
+	return output.String(), exitCode, err
+}
+
+// TestVM_Program runs a program that uses every command.
+func TestVM_Program(t *testing.T) {
+	output, exitCode, err := runSource(t, mechatest.Program, mechatest.ProgramInput)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if exitCode != mechatest.ProgramExit {
+		t.Errorf("expected exit code %d, got %d", mechatest.ProgramExit, exitCode)
+	}
+	if output != mechatest.ProgramOutput {
+		t.Errorf("expected output %q, got %q", mechatest.ProgramOutput, output)
+	}
+}
+
+// TestVM_Branches checks every branch of an if with elifs and an else, inside a recursive Architect.
+func TestVM_Branches(t *testing.T) {
+	source := `{
+   {
+        {
+            ("many")Send
+        } else {
+            ("two")Send
+        } n == 2 elif {
+            ("one")Send
+        } n == 1 elif {
+            ("none")Send
+        } n == 0 if
+        {
+            (n - 1)count
+        } n > 0 if
+   } Nil (Gear :n)count Architect
+   {
+        (3)count
+   } ()main Architect
+} main Construct`
+
+	output, _, err := runSource(t, source, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := "none\none\ntwo\nmany\n"; output != expected {
+		t.Errorf("expected output %q, got %q", expected, output)
+	}
+}
+
+// TestVM_Logical checks that '&&' and '||' evaluate their left side first and skip their right side once the left
+// side decides the result.
+func TestVM_Logical(t *testing.T) {
+	source := `{
+   {
+        n Integrate
+        (n)Send
+   } Gear (Gear :n)trace Architect
+   {
+        {
+            ("or")Send
+        } (1)trace == 1 || (2)trace == 2 if
+        {
+            ("and")Send
+        } (3)trace == 0 && (4)trace == 4 if
+        {
+            ("not")Send
+        } !((5)trace == 0) && (6)trace == 6 if
+   } ()main Architect
+} main Construct`
+
+	output, _, err := runSource(t, source, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := "5\n6\nnot\n3\n1\nor\n"; output != expected {
+		t.Errorf("expected output %q, got %q", expected, output)
+	}
+}
+
+// TestVM_Detach runs detached functions that hand their results over on an unbuffered Channel, one at a time, and
+// checks that the Gears they send on a Tensor Channel are widened.
+func TestVM_Detach(t *testing.T) {
+	source := `{
+   {
+        (n * n)out Send
+        (n)turn Receive
+   } (Gear :n, Gear Channel :turn, Tensor Channel :out)square Architect
+   {
+        {
+            (value)Send
+            (value)squares Receive
+            (i)turn Send
+            i + 1 = i
+        } i < 4 for
+        0 =: Gear :i
+        0.0 =: Tensor :value
+        {
+            (0, turn, squares)square Detach
+            n + 1 = n
+        } n < 4 for
+        0 =: Gear :n
+        0 =: Tensor Channel :squares
+        0 =: Gear Channel :turn
+   } ()main Architect
+} main Construct`
+
+	output, _, err := runSource(t, source, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := "1\n4\n9\n16\n"; output != expected {
+		t.Errorf("expected output %q, got %q", expected, output)
+	}
+}
+
+// TestVM_States checks that a State member selects its name when sent, and that members compare by ordinal.
+func TestVM_States(t *testing.T) {
+	source := `{
+    (Low, Mid, High)Level State
+    {
+        {
+            (l)Send
+        } l != Mid if
+        {
+            High = l
+            (l)Send
+        } l == Low if
+        Low =: Level :l
+    } ()main Architect
+} main Construct`
+
+	output, _, err := runSource(t, source, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := "Low\nHigh\n"; output != expected {
+		t.Errorf("expected output %q, got %q", expected, output)
+	}
+}
+
+// TestVM_Switches checks a loop whose condition is a Switch variable rather than a comparison.
+func TestVM_Switches(t *testing.T) {
+	source := `{
+    {
+        {
+            (i)Send
+            i >= 2 = done
+            i + 1 = i
+        } !done for
+        false =: Switch :done
+        0 =: Gear :i
+    } ()main Architect
+} main Construct`
+
+	output, _, err := runSource(t, source, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := "1\n2\n"; output != expected {
+		t.Errorf("expected output %q, got %q", expected, output)
+	}
+}
+
+// TestVM_Assemblies checks nested for loops over the same Assembly, which read the elements stored while they run,
+// and a negative index.
+func TestVM_Assemblies(t *testing.T) {
+	source := `{
+    {
+        ([-1]xs)Send
+        {
+            (x)Send
+        } xs =: Gear :x for
+        {
+            i + 1 = i
+            {
+                [i]xs + y = [i]xs
+            } xs =: Gear :y for
+        } i < (xs)Length for
+        0 =: Gear :i
+        (1, 2, 3)Gear Assembly =: Gear Assembly :xs
+    } ()main Architect
+} main Construct`
+
+	output, _, err := runSource(t, source, "")
+	if err == nil || !strings.Contains(err.Error(), "Assembly index out of range in 'main'") {
+		t.Fatalf("expected an index out of range error, got %v", err)
+	}
+	if expected := "7\n21\n62\n"; output != expected {
+		t.Errorf("expected output %q, got %q", expected, output)
+	}
+}
+
+// TestVM_RuntimeErrors checks that the program stops on runtime errors, each reported as a Diagnostic.
+func TestVM_RuntimeErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		source   string
+		expected string
+	}{
+		{
+			name: "division by zero",
+			source: `{
+   {
+        (1 % n)Send
+        0 =: Gear :n
+   } ()main Architect
+} main Construct`,
+			expected: "division by zero in 'main'",
+		},
+		{
+			name: "stack overflow",
+			source: `{
+   {
+        ()loop Integrate
+   } ()loop Architect
+   {
+        ()loop Integrate
+   } ()main Architect
+} main Construct`,
+			expected: "call stack overflow in 'loop'",
+		},
+		{
+			name: "deadlock",
+			source: `{
+   {
+        (1)c Send
+   } (Gear Channel :c)put Architect
+   {
+        (n)c Receive
+        (n)c Receive
+        0 =: Gear :n
+        (c)put Detach
+        0 =: Gear Channel :c
+   } ()main Architect
+} main Construct`,
+			expected: "every Architect is waiting on a Channel in 'main'",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, exitCode, err := runSource(t, test.source, "")
+			if err == nil || !strings.Contains(err.Error(), test.expected) {
+				t.Errorf("expected an error containing %q, got %v", test.expected, err)
+			}
+			diagnostics := compiler_error.Diagnostics(err)
+			if len(diagnostics) != 1 || diagnostics[0].Code != compiler_error.CodeRuntime {
+				t.Errorf("expected a single runtime Diagnostic, got %v", diagnostics)
+			}
+			if exitCode != 1 {
+				t.Errorf("expected exit code 1, got %d", exitCode)
+			}
+		})
+	}
+}
+
+// TestVM_MalformedStack ensures that bytecode popping from an empty stack is reported instead of crashing.
+func TestVM_MalformedStack(t *testing.T) {
+	program := &bytecode.Program{Functions: []*bytecode.Function{{
+		Name: "main",
+		Code: []byte{byte(bytecode.OpPop), byte(bytecode.OpNil), byte(bytecode.OpReturn)},
+	}}}
+
+	machine := NewVM(program, strings.NewReader(""), &bytes.Buffer{}, false)
+	if _, err := machine.Run(); err == nil || !strings.Contains(err.Error(), "malformed bytecode") {
+		t.Errorf("expected a malformed bytecode error, got %v", err)
+	}
+}
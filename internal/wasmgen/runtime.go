@@ -0,0 +1,260 @@
+package wasmgen
+
+// imports :
+// The host functions every generated module imports from the "mecha" module. Omnidrones are addresses in the
+// exported memory, pointing to a little-endian u32 byte length followed by the UTF-8 bytes:
+//   - send_<type> prints a value followed by a newline; Tensors use six significant digits like the "%g" of C, and
+//     Switches, which are 0 or 1, are printed as false or true.
+//   - receive_<type> reads a line and returns its value, stopping the program when it is not valid. To return an
+//     Omnidrone, the host reserves its bytes with the exported _alloc function and writes them there.
+//   - fail stops the program with exit code 1 after printing the Omnidrone it is given.
+//
+// The exit code of the program is the Gear integrated by the exported main function, or 0 for any other type.
+const imports = `  (import "mecha" "send_gear" (func $mecha_send_gear (param i64)))
+  (import "mecha" "send_tensor" (func $mecha_send_tensor (param f64)))
+  (import "mecha" "send_monodrone" (func $mecha_send_monodrone (param i32)))
+  (import "mecha" "send_omnidrone" (func $mecha_send_omnidrone (param i32)))
+  (import "mecha" "send_state" (func $mecha_send_state (param i64)))
+  (import "mecha" "send_switch" (func $mecha_send_switch (param i32)))
+  (import "mecha" "send_nil" (func $mecha_send_nil (param i32)))
+  (import "mecha" "receive_gear" (func $mecha_receive_gear (result i64)))
+  (import "mecha" "receive_tensor" (func $mecha_receive_tensor (result f64)))
+  (import "mecha" "receive_monodrone" (func $mecha_receive_monodrone (result i32)))
+  (import "mecha" "receive_omnidrone" (func $mecha_receive_omnidrone (result i32)))
+  (import "mecha" "receive_state" (func $mecha_receive_state (result i64)))
+  (import "mecha" "fail" (func $mecha_fail (param i32)))
+`
+
+// runtime :
+// The functions placed after the imports of every generated module: a bump allocator for the Omnidrones received
+// from the host and for Assemblies, the Assembly operations, the comparison of Omnidrones and the checked Gear
+// operations. It is a format string that takes the addresses of the "division by zero", "out of memory" and
+// "Assembly index out of range" messages.
+//
+// An Assembly is the address of a header of four u32: its length, its capacity, the size of its elements and the
+// address of the elements. When an Append finds the elements full they are copied to a block twice as big; the
+// allocator never frees anything.
+const runtime = `  (func $mecha_alloc (export "_alloc") (param $size i32) (result i32)
+    (local $address i32)
+    global.get $mecha_heap
+    local.set $address
+    local.get $address
+    local.get $size
+    i32.add
+    i32.const 7
+    i32.add
+    i32.const -8
+    i32.and
+    global.set $mecha_heap
+    block $done
+      loop $grow
+        global.get $mecha_heap
+        memory.size
+        i32.const 16
+        i32.shl
+        i32.le_u
+        br_if $done
+        i32.const 1
+        memory.grow
+        i32.const -1
+        i32.eq
+        if
+          i32.const %[2]d
+          call $mecha_fail
+          unreachable
+        end
+        br $grow
+      end
+    end
+    local.get $address)
+
+  ;; Makes an Assembly of $length elements of $size bytes, which the generated code then stores.
+  (func $mecha_assembly_make (param $size i32) (param $length i32) (result i32)
+    (local $assembly i32)
+    i32.const 16
+    call $mecha_alloc
+    local.tee $assembly
+    local.get $length
+    i32.store
+    local.get $assembly
+    local.get $length
+    i32.store offset=4
+    local.get $assembly
+    local.get $size
+    i32.store offset=8
+    local.get $assembly
+    local.get $size
+    local.get $length
+    i32.mul
+    call $mecha_alloc
+    i32.store offset=12
+    local.get $assembly)
+
+  ;; Returns the address of an element, stopping the program when the index is outside of the Assembly.
+  (func $mecha_assembly_at (param $assembly i32) (param $index i64) (result i32)
+    local.get $index
+    local.get $assembly
+    i32.load
+    i64.extend_i32_u
+    i64.ge_u
+    if
+      i32.const %[3]d
+      call $mecha_fail
+      unreachable
+    end
+    local.get $assembly
+    i32.load offset=12
+    local.get $assembly
+    i32.load offset=8
+    local.get $index
+    i32.wrap_i64
+    i32.mul
+    i32.add)
+
+  ;; Adds an element to the end of an Assembly and returns its address, so the generated code can store it.
+  (func $mecha_assembly_push (param $assembly i32) (result i32)
+    (local $length i32)
+    (local $capacity i32)
+    (local $elements i32)
+    (local $i i32)
+    local.get $assembly
+    i32.load
+    local.tee $length
+    local.get $assembly
+    i32.load offset=4
+    i32.eq
+    if
+      local.get $length
+      i32.const 1
+      i32.shl
+      i32.const 4
+      local.get $length
+      select
+      local.set $capacity
+      local.get $assembly
+      local.get $capacity
+      i32.store offset=4
+      local.get $assembly
+      i32.load offset=8
+      local.get $capacity
+      i32.mul
+      call $mecha_alloc
+      local.set $elements
+      ;; Every element takes a multiple of 4 bytes, so they are copied as u32
+      block $copied
+        loop $copy
+          local.get $i
+          local.get $assembly
+          i32.load offset=8
+          local.get $length
+          i32.mul
+          i32.ge_u
+          br_if $copied
+          local.get $elements
+          local.get $i
+          i32.add
+          local.get $assembly
+          i32.load offset=12
+          local.get $i
+          i32.add
+          i32.load
+          i32.store
+          local.get $i
+          i32.const 4
+          i32.add
+          local.set $i
+          br $copy
+        end
+      end
+      local.get $assembly
+      local.get $elements
+      i32.store offset=12
+    end
+    local.get $assembly
+    local.get $length
+    i32.const 1
+    i32.add
+    i32.store
+    local.get $assembly
+    i32.load offset=12
+    local.get $assembly
+    i32.load offset=8
+    local.get $length
+    i32.mul
+    i32.add)
+
+  (func $mecha_omnidrone_equal (param $left i32) (param $right i32) (result i32)
+    (local $length i32)
+    (local $i i32)
+    local.get $left
+    i32.load
+    local.tee $length
+    local.get $right
+    i32.load
+    i32.ne
+    if
+      i32.const 0
+      return
+    end
+    block $done
+      loop $compare
+        local.get $i
+        local.get $length
+        i32.ge_u
+        br_if $done
+        local.get $left
+        local.get $i
+        i32.add
+        i32.load8_u offset=4
+        local.get $right
+        local.get $i
+        i32.add
+        i32.load8_u offset=4
+        i32.ne
+        if
+          i32.const 0
+          return
+        end
+        local.get $i
+        i32.const 1
+        i32.add
+        local.set $i
+        br $compare
+      end
+    end
+    i32.const 1)
+
+  (func $mecha_gear_div (param $left i64) (param $right i64) (result i64)
+    local.get $right
+    i64.eqz
+    if
+      i32.const %[1]d
+      call $mecha_fail
+      unreachable
+    end
+    ;; i64.div_s traps on INT64_MIN / -1, while the negation wraps back to INT64_MIN
+    local.get $right
+    i64.const -1
+    i64.eq
+    if
+      i64.const 0
+      local.get $left
+      i64.sub
+      return
+    end
+    local.get $left
+    local.get $right
+    i64.div_s)
+
+  (func $mecha_gear_mod (param $left i64) (param $right i64) (result i64)
+    local.get $right
+    i64.eqz
+    if
+      i32.const %[1]d
+      call $mecha_fail
+      unreachable
+    end
+    local.get $left
+    local.get $right
+    i64.rem_s)
+`
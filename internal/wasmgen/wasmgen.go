@@ -0,0 +1,723 @@
+package wasmgen
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"mechanus-compiler/internal/ast"
+	"mechanus-compiler/internal/compiler_error"
+	"mechanus-compiler/internal/logger"
+	"mechanus-compiler/internal/semantic"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Generator :
+// This is the structure responsible for turning a checked Construct into a WebAssembly text module. Every Architect
+// becomes a function exported under its own name, and Send and Receive call the host functions described by imports.
+// The runtime exports start with an underscore, which no Architect name can, so they never clash.
+//
+// Gears and States are i64, Tensors are f64, Monodrones are i32 code points, Omnidrones are i32 addresses in the
+// linear memory, Nil is an i32 that is always 0 and Assemblies are i32 addresses of a header kept by the runtime.
+// Variables and parameters are locals of their function.
+type Generator struct {
+	logger *logger.Logger
+	info   *semantic.Info
+	output strings.Builder
+	// Omnidrones and tables of State member names placed in the data segment, and the bytes of the segment
+	strings map[string]uint32
+	states  map[ast.Type]uint32
+	data    []byte
+	// State of the Architect being generated
+	code   strings.Builder
+	locals strings.Builder
+	names  map[*semantic.Symbol]string
+	taken  map[string]int
+	labels int
+	indent int
+	result ast.Type
+	// logical is set once the scratch local of '&&' and '||' has been declared
+	logical bool
+}
+
+const (
+	// dataStart is the address of the first Omnidrone. Address 0 is left unused.
+	dataStart = 8
+	// pageSize is the size of a page of linear memory.
+	pageSize = 65536
+	// indentation is the text used for each level of nesting in the generated code.
+	indentation = "  "
+	// logicalLocal holds the result of '&&' and '||'. Identifiers cannot start with a dot, so no variable takes it.
+	logicalLocal = "$.logical"
+)
+
+// NewGenerator :
+// Initializes a new Generator instance. info must be the result of a successful semantic analysis of the Construct
+// that will be generated.
+func NewGenerator(info *semantic.Info, debug bool) Generator {
+	// Initialize the logger. Log to Stderr. Set level based on the debug flag.
+	logLevel := logger.LevelInfo
+	if debug {
+		logLevel = logger.LevelDebug
+	}
+
+	return Generator{
+		logger: logger.New(os.Stderr, logLevel),
+		info:   info,
+	}
+}
+
+// Run :
+// Generates the WebAssembly text module for the given Construct.
+//
+// Fails if the Construct has no main Architect, or if it detaches an Architect or uses Channels. The module runs on
+// the single thread of its host, which docs/wasm gives no way to start another one.
+func (generator *Generator) Run(construct *ast.Construct) (string, error) {
+	generator.output.Reset()
+	generator.strings = make(map[string]uint32)
+	generator.states = make(map[ast.Type]uint32)
+	generator.data = nil
+
+	if generator.info.Main == nil {
+		err := compiler_error.CodegenErrorf(compiler_error.CodegenError, errors.New(compiler_error.MissingMain))
+		generator.logger.Error(err, nil)
+		return "", err
+	}
+
+	if generator.info.Concurrent {
+		unsupported := fmt.Errorf(compiler_error.Unsupported, "WebAssembly")
+		err := compiler_error.CodegenErrorf(compiler_error.CodegenError, unsupported)
+		generator.logger.Error(err, nil)
+		return "", err
+	}
+
+	division := generator.stringAddress(compiler_error.DivisionByZero)
+	memory := generator.stringAddress("out of memory")
+	outOfRange := generator.stringAddress(compiler_error.OutOfRange)
+
+	// The functions are generated first, since the size of the data segment is only known once every Omnidrone has
+	// been seen. The parser stores the Architects bottom-to-top, so they are emitted in reverse to follow the source
+	var functions strings.Builder
+	for i := len(construct.Architects) - 1; i >= 0; i-- {
+		functions.WriteString("\n")
+		functions.WriteString(generator.architect(construct.Architects[i]))
+	}
+
+	heap := dataStart + uint32(len(generator.data))
+	heap = (heap + 7) &^ 7
+	pages := (heap + pageSize - 1) / pageSize
+
+	generator.output.WriteString(fmt.Sprintf(";; Generated from the %s Construct.\n", construct.Name))
+	generator.output.WriteString("(module\n")
+	generator.output.WriteString(imports)
+	generator.output.WriteString("\n")
+	generator.output.WriteString(fmt.Sprintf("  (memory (export \"_memory\") %d)\n", max(pages, 1)))
+	generator.output.WriteString(fmt.Sprintf("  (global $mecha_heap (mut i32) (i32.const %d))\n", heap))
+	generator.output.WriteString(fmt.Sprintf("  (data (i32.const %d) %s)\n", dataStart, stringLiteral(generator.data)))
+	generator.output.WriteString("\n")
+	generator.output.WriteString(fmt.Sprintf(runtime, division, memory, outOfRange))
+	generator.output.WriteString(functions.String())
+	generator.output.WriteString(")\n")
+
+	generator.logger.Info(compiler_error.CodegenSuccess, nil)
+	return generator.output.String(), nil
+}
+
+//**********************************************************************************************************************
+// Architects and commands
+//**********************************************************************************************************************
+
+// architect :
+// Generates the function of a single Architect. The body is generated first, so the locals it declares can be listed
+// at the top of the function. An Architect that reaches the end of its body without an Integrate returns the zero
+// value of its type.
+func (generator *Generator) architect(architect *ast.Architect) string {
+	generator.logger.Debug("Generating Architect", map[string]any{"name": architect.Name})
+
+	generator.code.Reset()
+	generator.locals.Reset()
+	generator.names = make(map[*semantic.Symbol]string)
+	generator.taken = make(map[string]int)
+	generator.labels = 0
+	generator.logical = false
+	generator.indent = 2
+	generator.result = semantic.ReturnType(architect)
+
+	var header strings.Builder
+	header.WriteString(fmt.Sprintf("  (func $%s (export %q)", architectName(architect.Name), architect.Name))
+	for _, parameter := range architect.Parameters {
+		name := generator.newName(generator.info.Defs[parameter])
+		header.WriteString(fmt.Sprintf(" (param %s %s)", name, wasmType(parameter.Type)))
+	}
+	header.WriteString(fmt.Sprintf(" (result %s)\n", wasmType(generator.result)))
+
+	generator.commands(architect.Body.Commands)
+	generator.zeroValue(generator.result)
+
+	code := strings.TrimSuffix(generator.code.String(), "\n")
+	return header.String() + generator.locals.String() + code + ")\n"
+}
+
+// commands :
+// Generates a list of commands. They are already stored in execution order.
+func (generator *Generator) commands(commands []ast.Command) {
+	for _, command := range commands {
+		generator.command(command)
+	}
+}
+
+// block :
+// Generates the commands of a nested block one level deeper.
+func (generator *Generator) block(block *ast.Block) {
+	generator.indent++
+	generator.commands(block.Commands)
+	generator.indent--
+}
+
+// command :
+// Generates a single command.
+func (generator *Generator) command(command ast.Command) {
+	switch cmd := command.(type) {
+	case *ast.CmdIf:
+		generator.ifChain(cmd.Condition, cmd.Then, cmd.Elifs, cmd.Else)
+	case *ast.CmdFor:
+		if cmd.Elements != nil {
+			generator.iteration(cmd)
+			break
+		}
+		generator.labels++
+		done := fmt.Sprintf("$done%d", generator.labels)
+		loop := fmt.Sprintf("$loop%d", generator.labels)
+		generator.emit("block " + done)
+		generator.indent++
+		generator.emit("loop " + loop)
+		generator.indent++
+		generator.condition(cmd.Condition)
+		generator.emit("i32.eqz")
+		generator.emit("br_if " + done)
+		generator.indent--
+		generator.block(cmd.Body)
+		generator.indent++
+		generator.emit("br " + loop)
+		generator.indent--
+		generator.emit("end")
+		generator.indent--
+		generator.emit("end")
+	case *ast.CmdDeclaration:
+		generator.value(cmd.Value, cmd.Type)
+		generator.emit("local.set " + generator.symbolName(generator.info.Defs[cmd]))
+	case *ast.CmdAssignment:
+		symbol := generator.info.Uses[cmd]
+		if cmd.Index == nil {
+			generator.value(cmd.Value, symbol.Type)
+			generator.emit("local.set " + generator.symbolName(symbol))
+			break
+		}
+		// The value is kept in a local while the address of the element is found, since computing it may append to
+		// the Assembly and move its elements
+		element := symbol.Type.Element()
+		generator.labels++
+		value := generator.local("value", wasmType(element))
+		generator.value(cmd.Value, element)
+		generator.emit("local.set " + value)
+		generator.emit("local.get " + generator.symbolName(symbol))
+		generator.expr(cmd.Index)
+		generator.emit("call $mecha_assembly_at")
+		generator.emit("local.get " + value)
+		generator.emit(wasmType(element) + ".store")
+	case *ast.CmdReceive:
+		symbol := generator.info.Uses[cmd]
+		generator.emit("call $mecha_receive_" + runtimeSuffix(symbol.Type))
+		generator.emit("local.set " + generator.symbolName(symbol))
+	case *ast.CmdSend:
+		t := generator.info.Types[cmd.Value]
+		generator.expr(cmd.Value)
+		// A State is written as the name of its member, loaded from the table of the names of its set
+		if _, ok := generator.info.States[t]; ok {
+			generator.emit("i32.wrap_i64")
+			generator.emit("i32.const 4")
+			generator.emit("i32.mul")
+			generator.emit(fmt.Sprintf("i32.const %d", generator.stateAddress(t)))
+			generator.emit("i32.add")
+			generator.emit("i32.load")
+			t = ast.TypeOmnidrone
+		}
+		generator.emit("call $mecha_send_" + runtimeSuffix(t))
+	case *ast.CmdAppend:
+		element := generator.info.Types[cmd.Assembly].Element()
+		generator.labels++
+		value := generator.local("value", wasmType(element))
+		generator.value(cmd.Value, element)
+		generator.emit("local.set " + value)
+		generator.expr(cmd.Assembly)
+		generator.emit("call $mecha_assembly_push")
+		generator.emit("local.get " + value)
+		generator.emit(wasmType(element) + ".store")
+	case *ast.CmdIntegrate:
+		generator.value(cmd.Value, generator.result)
+		generator.emit("return")
+	case *ast.CmdCall:
+		generator.expr(cmd.Call)
+		generator.emit("drop")
+	}
+}
+
+// iteration :
+// Generates a for over the elements of an Assembly. The Assembly, its length and the index of the current element
+// are kept in locals of their own, so nested loops do not share them.
+func (generator *Generator) iteration(cmd *ast.CmdFor) {
+	element := generator.info.Types[cmd.Elements].Element()
+	generator.labels++
+	done := fmt.Sprintf("$done%d", generator.labels)
+	loop := fmt.Sprintf("$loop%d", generator.labels)
+	assembly := generator.local("elements", "i32")
+	length := generator.local("length", "i64")
+	index := generator.local("index", "i64")
+
+	generator.expr(cmd.Elements)
+	generator.emit("local.tee " + assembly)
+	generator.emit("i32.load")
+	generator.emit("i64.extend_i32_u")
+	generator.emit("local.set " + length)
+	generator.emit("i64.const 0")
+	generator.emit("local.set " + index)
+	generator.emit("block " + done)
+	generator.indent++
+	generator.emit("loop " + loop)
+	generator.indent++
+	generator.emit("local.get " + index)
+	generator.emit("local.get " + length)
+	generator.emit("i64.ge_s")
+	generator.emit("br_if " + done)
+	generator.emit("local.get " + assembly)
+	generator.emit("local.get " + index)
+	generator.emit("call $mecha_assembly_at")
+	generator.emit(wasmType(element) + ".load")
+	if element == ast.TypeGear && cmd.Type == ast.TypeTensor {
+		generator.emit("f64.convert_i64_s")
+	}
+	generator.emit("local.set " + generator.symbolName(generator.info.Defs[cmd]))
+	generator.indent--
+	generator.block(cmd.Body)
+	generator.indent++
+	generator.emit("local.get " + index)
+	generator.emit("i64.const 1")
+	generator.emit("i64.add")
+	generator.emit("local.set " + index)
+	generator.emit("br " + loop)
+	generator.indent--
+	generator.emit("end")
+	generator.indent--
+	generator.emit("end")
+}
+
+// ifChain :
+// Generates an if with its elifs and else. Each elif becomes an if nested in the else of the previous one.
+func (generator *Generator) ifChain(condition ast.Expr, then *ast.Block, elifs []*ast.CmdElif, otherwise *ast.Block) {
+	generator.condition(condition)
+	generator.emit("if")
+	generator.block(then)
+	if len(elifs) > 0 || otherwise != nil {
+		generator.emit("else")
+		if len(elifs) > 0 {
+			generator.indent++
+			generator.ifChain(elifs[0].Condition, elifs[0].Body, elifs[1:], otherwise)
+			generator.indent--
+		} else {
+			generator.block(otherwise)
+		}
+	}
+	generator.emit("end")
+}
+
+//**********************************************************************************************************************
+// Expressions
+//**********************************************************************************************************************
+
+// condition :
+// Pushes the i32 result of a <CONDITION>, which is 1 when it holds and 0 when it does not, like any other Switch.
+// Ifs have no results, so '&&' and '||' keep the result of their left side in a scratch local and only replace it
+// with the result of their right side when the left side does not decide it:
+//
+//	left; local.tee $.logical; if; right; local.set $.logical; end; local.get $.logical
+func (generator *Generator) condition(condition ast.Expr) {
+	if not, ok := condition.(*ast.UnaryExpr); ok {
+		generator.condition(not.Operand)
+		generator.emit("i32.eqz")
+		return
+	}
+
+	comparison, ok := condition.(*ast.BinaryExpr)
+	if !ok {
+		generator.expr(condition)
+		return
+	}
+	if !comparison.Operator.IsLogical() {
+		generator.comparison(comparison)
+		return
+	}
+
+	if !generator.logical {
+		generator.logical = true
+		generator.locals.WriteString(fmt.Sprintf("    (local %s i32)\n", logicalLocal))
+	}
+	generator.condition(comparison.Left)
+	generator.emit("local.tee " + logicalLocal)
+	if comparison.Operator == ast.OpOr {
+		generator.emit("i32.eqz")
+	}
+	generator.emit("if")
+	generator.indent++
+	generator.condition(comparison.Right)
+	generator.emit("local.set " + logicalLocal)
+	generator.indent--
+	generator.emit("end")
+	generator.emit("local.get " + logicalLocal)
+}
+
+// comparison :
+// Pushes the i32 result of a comparison. Numbers are widened to Tensors when one side is a Tensor; f64.ne is the
+// only Tensor comparison that holds against NaN. Omnidrones are compared by content.
+func (generator *Generator) comparison(comparison *ast.BinaryExpr) {
+	left := generator.info.Types[comparison.Left]
+	right := generator.info.Types[comparison.Right]
+
+	operandType := left
+	if left == ast.TypeTensor || right == ast.TypeTensor {
+		operandType = ast.TypeTensor
+	}
+	generator.value(comparison.Left, operandType)
+	generator.value(comparison.Right, operandType)
+
+	switch operandType {
+	case ast.TypeTensor:
+		generator.emit("f64." + comparisonSuffix(comparison.Operator, false))
+	case ast.TypeOmnidrone:
+		generator.emit("call $mecha_omnidrone_equal")
+		if comparison.Operator == ast.OpNotEqual {
+			generator.emit("i32.eqz")
+		}
+	default:
+		generator.emit(wasmType(operandType) + "." + comparisonSuffix(comparison.Operator, true))
+	}
+}
+
+// value :
+// Pushes an expression that is stored where a value of type to is expected, widening a Gear into a Tensor.
+func (generator *Generator) value(expr ast.Expr, to ast.Type) {
+	generator.expr(expr)
+	if generator.info.Types[expr] == ast.TypeGear && to == ast.TypeTensor {
+		generator.emit("f64.convert_i64_s")
+	}
+}
+
+// expr :
+// Pushes the value of an expression. Operands and arguments are evaluated from left to right.
+func (generator *Generator) expr(expr ast.Expr) {
+	switch e := expr.(type) {
+	case *ast.GearLiteral:
+		generator.emit(fmt.Sprintf("i64.const %d", e.Value))
+	case *ast.TensorLiteral:
+		generator.emit("f64.const " + tensorLiteral(e.Value))
+	case *ast.MonodroneLiteral:
+		generator.emit(fmt.Sprintf("i32.const %d", e.Value))
+	case *ast.OmnidroneLiteral:
+		generator.emit(fmt.Sprintf("i32.const %d", generator.stringAddress(e.Value)))
+	case *ast.SwitchLiteral:
+		if e.Value {
+			generator.emit("i32.const 1")
+		} else {
+			generator.emit("i32.const 0")
+		}
+	case *ast.NilLiteral:
+		generator.emit("i32.const 0")
+	case *ast.Identifier:
+		symbol := generator.info.Uses[e]
+		if symbol.Kind == semantic.SymbolMember {
+			generator.emit(fmt.Sprintf("i64.const %d", symbol.Value))
+		} else {
+			generator.emit("local.get " + generator.symbolName(symbol))
+		}
+	case *ast.UnaryExpr:
+		if e.Operator == ast.OpNot {
+			generator.condition(e)
+			return
+		}
+		generator.expr(e.Operand)
+		if generator.info.Types[e] == ast.TypeTensor {
+			generator.emit("f64.neg")
+		} else {
+			generator.emit("i64.const -1")
+			generator.emit("i64.mul")
+		}
+	case *ast.BinaryExpr:
+		if e.Operator.IsComparison() || e.Operator.IsLogical() {
+			generator.condition(e)
+			return
+		}
+		t := generator.info.Types[e]
+		generator.value(e.Left, t)
+		generator.value(e.Right, t)
+		generator.emit(arithmetic(e.Operator, t))
+	case *ast.CallExpr:
+		architect := generator.info.Calls[e]
+		for i, argument := range e.Arguments {
+			generator.value(argument, architect.Parameters[i].Type)
+		}
+		generator.emit("call $" + architectName(e.Name))
+	case *ast.AssemblyLiteral:
+		generator.assembly(e)
+	case *ast.IndexExpr:
+		generator.expr(e.Assembly)
+		generator.expr(e.Index)
+		generator.emit("call $mecha_assembly_at")
+		generator.emit(wasmType(generator.info.Types[e]) + ".load")
+	case *ast.LengthExpr:
+		generator.expr(e.Assembly)
+		generator.emit("i32.load")
+		generator.emit("i64.extend_i32_u")
+	}
+}
+
+// assembly :
+// Pushes a new Assembly holding the elements of a literal. Its address is kept in a local of its own while they are
+// stored, since an element may hold another literal.
+func (generator *Generator) assembly(e *ast.AssemblyLiteral) {
+	element := e.Type.Element()
+	generator.labels++
+	assembly := generator.local("assembly", "i32")
+
+	generator.emit(fmt.Sprintf("i32.const %d", elementSize(element)))
+	generator.emit(fmt.Sprintf("i32.const %d", len(e.Elements)))
+	generator.emit("call $mecha_assembly_make")
+	generator.emit("local.set " + assembly)
+	for i, value := range e.Elements {
+		generator.emit("local.get " + assembly)
+		generator.emit(fmt.Sprintf("i64.const %d", i))
+		generator.emit("call $mecha_assembly_at")
+		generator.value(value, element)
+		generator.emit(wasmType(element) + ".store")
+	}
+	generator.emit("local.get " + assembly)
+}
+
+//**********************************************************************************************************************
+// Helpers
+//**********************************************************************************************************************
+
+// symbolName :
+// Returns the name of the local of a variable or parameter, declaring a local the first time a variable is seen.
+func (generator *Generator) symbolName(symbol *semantic.Symbol) string {
+	if name, ok := generator.names[symbol]; ok {
+		return name
+	}
+
+	name := generator.newName(symbol)
+	generator.locals.WriteString(fmt.Sprintf("    (local %s %s)\n", name, wasmType(symbol.Type)))
+	return name
+}
+
+// newName :
+// Picks the name of a new variable or parameter. Every symbol gets its own name, so a shadowing declaration never
+// overwrites the variable it hides.
+func (generator *Generator) newName(symbol *semantic.Symbol) string {
+	name := "$" + symbol.Name
+	if count := generator.taken[symbol.Name]; count > 0 {
+		name = fmt.Sprintf("%s.%d", name, count)
+	}
+	generator.taken[symbol.Name]++
+	generator.names[symbol] = name
+	return name
+}
+
+// local :
+// Declares a local for a value the generated code keeps for itself, named after the current label number. Identifiers
+// cannot start with a dot, so no variable takes it.
+func (generator *Generator) local(name, t string) string {
+	local := fmt.Sprintf("$.%s%d", name, generator.labels)
+	generator.locals.WriteString(fmt.Sprintf("    (local %s %s)\n", local, t))
+	return local
+}
+
+// zeroValue :
+// Pushes the zero value of a type. It is a constant, except for the empty Assembly, which is made by the runtime.
+func (generator *Generator) zeroValue(t ast.Type) {
+	if t.IsAssembly() {
+		generator.emit(fmt.Sprintf("i32.const %d", elementSize(t.Element())))
+		generator.emit("i32.const 0")
+		generator.emit("call $mecha_assembly_make")
+		return
+	}
+	switch t {
+	case ast.TypeTensor:
+		generator.emit("f64.const 0")
+	case ast.TypeOmnidrone:
+		generator.emit(fmt.Sprintf("i32.const %d", generator.stringAddress("")))
+	default:
+		generator.emit(wasmType(t) + ".const 0")
+	}
+}
+
+// emit :
+// Writes a single instruction at the current indentation.
+func (generator *Generator) emit(instruction string) {
+	generator.code.WriteString(strings.Repeat(indentation, generator.indent))
+	generator.code.WriteString(instruction)
+	generator.code.WriteString("\n")
+}
+
+// stringAddress :
+// Returns the address of an Omnidrone in the data segment, adding it the first time. Each one is a u32 length
+// followed by its bytes, aligned to 4 bytes.
+func (generator *Generator) stringAddress(value string) uint32 {
+	if address, ok := generator.strings[value]; ok {
+		return address
+	}
+
+	for len(generator.data)%4 != 0 {
+		generator.data = append(generator.data, 0)
+	}
+	address := dataStart + uint32(len(generator.data))
+	generator.data = binary.LittleEndian.AppendUint32(generator.data, uint32(len(value)))
+	generator.data = append(generator.data, value...)
+	generator.strings[value] = address
+	return address
+}
+
+// stateAddress :
+// Returns the address of the table of the member names of a State set in the data segment, adding it the first time.
+// Each entry is the u32 address of an Omnidrone.
+func (generator *Generator) stateAddress(t ast.Type) uint32 {
+	if address, ok := generator.states[t]; ok {
+		return address
+	}
+
+	members := generator.info.States[t].Members
+	names := make([]uint32, 0, len(members))
+	for _, member := range members {
+		names = append(names, generator.stringAddress(member.Name))
+	}
+	for len(generator.data)%4 != 0 {
+		generator.data = append(generator.data, 0)
+	}
+	address := dataStart + uint32(len(generator.data))
+	for _, name := range names {
+		generator.data = binary.LittleEndian.AppendUint32(generator.data, name)
+	}
+	generator.states[t] = address
+	return address
+}
+
+// architectName :
+// Returns the name of the function generated for an Architect. The prefix keeps Architects from clashing with the
+// runtime.
+func architectName(name string) string {
+	return "mecha_architect_" + name
+}
+
+// runtimeSuffix :
+// Returns the lowercase type name used by the runtime functions, such as $mecha_send_gear.
+func runtimeSuffix(t ast.Type) string {
+	return strings.ToLower(t.String())
+}
+
+// wasmType :
+// Returns the value type used for a Mechanus type.
+func wasmType(t ast.Type) string {
+	switch t.Underlying() {
+	case ast.TypeGear, ast.TypeState:
+		return "i64"
+	case ast.TypeTensor:
+		return "f64"
+	default:
+		return "i32"
+	}
+}
+
+// elementSize :
+// Returns the number of bytes taken by an element of an Assembly of the given type.
+func elementSize(t ast.Type) int {
+	if wasmType(t) == "i32" {
+		return 4
+	}
+	return 8
+}
+
+// arithmetic :
+// Returns the instruction for an arithmetic operator. Gear division and modulo go through the runtime, which stops
+// the program on a division by zero.
+func arithmetic(operator ast.Operator, t ast.Type) string {
+	if t == ast.TypeTensor {
+		switch operator {
+		case ast.OpAdd:
+			return "f64.add"
+		case ast.OpSub:
+			return "f64.sub"
+		case ast.OpMul:
+			return "f64.mul"
+		default:
+			return "f64.div"
+		}
+	}
+
+	switch operator {
+	case ast.OpAdd:
+		return "i64.add"
+	case ast.OpSub:
+		return "i64.sub"
+	case ast.OpMul:
+		return "i64.mul"
+	case ast.OpDiv:
+		return "call $mecha_gear_div"
+	default:
+		return "call $mecha_gear_mod"
+	}
+}
+
+// comparisonSuffix :
+// Returns the name of a comparison instruction without its type, signed for integers.
+func comparisonSuffix(operator ast.Operator, integer bool) string {
+	var suffix string
+	switch operator {
+	case ast.OpGreater:
+		suffix = "gt"
+	case ast.OpGreaterEqual:
+		suffix = "ge"
+	case ast.OpLess:
+		suffix = "lt"
+	case ast.OpLessEqual:
+		suffix = "le"
+	case ast.OpEqual:
+		return "eq"
+	default:
+		return "ne"
+	}
+	if integer {
+		suffix += "_s"
+	}
+	return suffix
+}
+
+// tensorLiteral :
+// Formats a Tensor so it reads back as the exact same f64.
+func tensorLiteral(value float64) string {
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+// stringLiteral :
+// Quotes the bytes of the data segment. Anything outside printable ASCII, along with '"' and '\', is written as a
+// hexadecimal escape.
+func stringLiteral(value []byte) string {
+	var builder strings.Builder
+	builder.WriteByte('"')
+	for _, c := range value {
+		if c < 0x20 || c >= 0x7F || c == '"' || c == '\\' {
+			builder.WriteString(fmt.Sprintf("\\%02x", c))
+			continue
+		}
+		builder.WriteByte(c)
+	}
+	builder.WriteByte('"')
+	return builder.String()
+}
@@ -0,0 +1,133 @@
+package wasmgen
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"mechanus-compiler/internal/mechatest"
+	"mechanus-compiler/internal/wat"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// runner runs a module with the host of docs/wasm, reading the input from stdin. Its exit code is the one of the
+// program.
+const runner = `import { readFileSync } from "node:fs";
+import { run } from %q;
+
+const { output, error, code } = await run(readFileSync(process.argv[2]), readFileSync(0, "utf8"));
+process.stdout.write(output);
+if (error) {
+  process.stderr.write("mecha: " + error + "\n");
+}
+process.exit(code);
+`
+
+// generateSource parses, analyzes and generates a WebAssembly text module for the given source.
+func generateSource(t *testing.T, source string) (string, error) {
+	t.Helper()
+
+	construct, info := mechatest.Analyze(t, source)
+	generator := NewGenerator(info, false)
+	return generator.Run(construct)
+}
+
+// TestGenerator_MissingMain ensures that a Construct without a main Architect cannot be generated.
+func TestGenerator_MissingMain(t *testing.T) {
+	if _, err := generateSource(t, mechatest.MissingMain); err == nil {
+		t.Fatal("expected an error, got nil")
+	}
+}
+
+// TestGenerator_Assemble checks that the module generated for every example program is valid.
+func TestGenerator_Assemble(t *testing.T) {
+	paths, err := filepath.Glob("../../docs/examples/example*_input.mecha")
+	if err != nil || len(paths) == 0 {
+		t.Fatalf("no examples found: %v", err)
+	}
+
+	for _, path := range paths {
+		name := strings.TrimSuffix(filepath.Base(path), "_input.mecha")
+		t.Run(name, func(t *testing.T) {
+			source, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("failed to read %s: %v", path, err)
+			}
+			code, err := generateSource(t, string(source))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if _, err := wat.Assemble(code); err != nil {
+				t.Errorf("the module for %s is not valid: %v", path, err)
+			}
+		})
+	}
+}
+
+// TestStringLiteral checks the escaping of the data segment.
+func TestStringLiteral(t *testing.T) {
+	tests := map[string]string{
+		"plain":    `"plain"`,
+		`say "hi"`: `"say \22hi\22"`,
+		`back\`:    `"back\5c"`,
+		"\x05\x00": `"\05\00"`,
+		"olá":      `"ol\c3\a1"`,
+	}
+
+	for value, expected := range tests {
+		if got := stringLiteral([]byte(value)); got != expected {
+			t.Errorf("stringLiteral(%q) = %s, expected %s", value, got, expected)
+		}
+	}
+}
+
+// TestGenerator_Run assembles the generated module and runs it with Node and the host of docs/wasm, checking what
+// the program sends and integrates. Skipped when node is not installed.
+func TestGenerator_Run(t *testing.T) {
+	node, err := exec.LookPath("node")
+	if err != nil {
+		t.Skip("node not found")
+	}
+
+	code, err := generateSource(t, mechatest.Program)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	module, err := wat.Assemble(code)
+	if err != nil {
+		t.Fatalf("failed to assemble the module: %v", err)
+	}
+
+	host, err := filepath.Abs("../../docs/wasm/host.js")
+	if err != nil {
+		t.Fatalf("failed to find the host: %v", err)
+	}
+	dir := t.TempDir()
+	script := filepath.Join(dir, "run.mjs")
+	if err := os.WriteFile(script, []byte(fmt.Sprintf(runner, filepath.ToSlash(host))), 0o644); err != nil {
+		t.Fatalf("failed to write the runner: %v", err)
+	}
+	binary := filepath.Join(dir, "program.wasm")
+	if err := os.WriteFile(binary, module, 0o644); err != nil {
+		t.Fatalf("failed to write the module: %v", err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	run := exec.Command(node, script, binary)
+	run.Stdin = strings.NewReader(mechatest.ProgramInput)
+	run.Stdout = &stdout
+	run.Stderr = &stderr
+	err = run.Run()
+
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != mechatest.ProgramExit {
+		t.Errorf("expected exit code %d, got %v\n%s", mechatest.ProgramExit, err, stderr.String())
+	}
+
+	if stdout.String() != mechatest.ProgramOutput {
+		t.Errorf("expected output %q, got %q", mechatest.ProgramOutput, stdout.String())
+	}
+}
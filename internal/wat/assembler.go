@@ -0,0 +1,964 @@
+package wat
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// immediate :
+// The kind of immediate an instruction takes in the text format.
+type immediate int
+
+const (
+	immediateNone immediate = iota
+	immediateBlock
+	immediateLabel
+	immediateFunction
+	immediateLocal
+	immediateGlobal
+	immediateMemory
+	immediateI32
+	immediateI64
+	immediateF64
+)
+
+// operation :
+// An instruction of the supported subset: its opcode, its immediate and, for plain instructions, the types it pops
+// and pushes. Instructions with a nil pops are checked by hand.
+type operation struct {
+	opcode    byte
+	immediate immediate
+	pops      []ValueType
+	pushes    []ValueType
+	// alignment is the natural alignment of a memory access, as a power of two
+	alignment uint32
+}
+
+// operations :
+// The supported instructions, by name.
+var operations = map[string]operation{
+	"unreachable":         {opcode: 0x00},
+	"nop":                 {opcode: 0x01, pops: []ValueType{}},
+	"block":               {opcode: 0x02, immediate: immediateBlock},
+	"loop":                {opcode: 0x03, immediate: immediateBlock},
+	"if":                  {opcode: 0x04, immediate: immediateBlock},
+	"else":                {opcode: 0x05, immediate: immediateBlock},
+	"end":                 {opcode: 0x0B, immediate: immediateBlock},
+	"br":                  {opcode: 0x0C, immediate: immediateLabel},
+	"br_if":               {opcode: 0x0D, immediate: immediateLabel},
+	"return":              {opcode: 0x0F},
+	"call":                {opcode: 0x10, immediate: immediateFunction},
+	"drop":                {opcode: 0x1A},
+	"select":              {opcode: 0x1B},
+	"local.get":           {opcode: 0x20, immediate: immediateLocal},
+	"local.set":           {opcode: 0x21, immediate: immediateLocal},
+	"local.tee":           {opcode: 0x22, immediate: immediateLocal},
+	"global.get":          {opcode: 0x23, immediate: immediateGlobal},
+	"global.set":          {opcode: 0x24, immediate: immediateGlobal},
+	"i32.load":            loadOp(0x28, I32, 2),
+	"i64.load":            loadOp(0x29, I64, 3),
+	"f64.load":            loadOp(0x2B, F64, 3),
+	"i32.load8_u":         loadOp(0x2D, I32, 0),
+	"i32.store":           storeOp(0x36, I32, 2),
+	"i64.store":           storeOp(0x37, I64, 3),
+	"f64.store":           storeOp(0x39, F64, 3),
+	"i32.store8":          storeOp(0x3A, I32, 0),
+	"memory.size":         {opcode: 0x3F, pops: []ValueType{}, pushes: []ValueType{I32}},
+	"memory.grow":         {opcode: 0x40, pops: []ValueType{I32}, pushes: []ValueType{I32}},
+	"i32.const":           {opcode: 0x41, immediate: immediateI32, pops: []ValueType{}, pushes: []ValueType{I32}},
+	"i64.const":           {opcode: 0x42, immediate: immediateI64, pops: []ValueType{}, pushes: []ValueType{I64}},
+	"f64.const":           {opcode: 0x44, immediate: immediateF64, pops: []ValueType{}, pushes: []ValueType{F64}},
+	"i32.eqz":             unaryOp(0x45, I32, I32),
+	"i32.eq":              binaryOp(0x46, I32, I32),
+	"i32.ne":              binaryOp(0x47, I32, I32),
+	"i32.lt_s":            binaryOp(0x48, I32, I32),
+	"i32.lt_u":            binaryOp(0x49, I32, I32),
+	"i32.gt_s":            binaryOp(0x4A, I32, I32),
+	"i32.gt_u":            binaryOp(0x4B, I32, I32),
+	"i32.le_s":            binaryOp(0x4C, I32, I32),
+	"i32.le_u":            binaryOp(0x4D, I32, I32),
+	"i32.ge_s":            binaryOp(0x4E, I32, I32),
+	"i32.ge_u":            binaryOp(0x4F, I32, I32),
+	"i64.eqz":             unaryOp(0x50, I64, I32),
+	"i64.eq":              binaryOp(0x51, I64, I32),
+	"i64.ne":              binaryOp(0x52, I64, I32),
+	"i64.lt_s":            binaryOp(0x53, I64, I32),
+	"i64.lt_u":            binaryOp(0x54, I64, I32),
+	"i64.gt_s":            binaryOp(0x55, I64, I32),
+	"i64.gt_u":            binaryOp(0x56, I64, I32),
+	"i64.le_s":            binaryOp(0x57, I64, I32),
+	"i64.le_u":            binaryOp(0x58, I64, I32),
+	"i64.ge_s":            binaryOp(0x59, I64, I32),
+	"i64.ge_u":            binaryOp(0x5A, I64, I32),
+	"f64.eq":              binaryOp(0x61, F64, I32),
+	"f64.ne":              binaryOp(0x62, F64, I32),
+	"f64.lt":              binaryOp(0x63, F64, I32),
+	"f64.gt":              binaryOp(0x64, F64, I32),
+	"f64.le":              binaryOp(0x65, F64, I32),
+	"f64.ge":              binaryOp(0x66, F64, I32),
+	"i32.add":             binaryOp(0x6A, I32, I32),
+	"i32.sub":             binaryOp(0x6B, I32, I32),
+	"i32.mul":             binaryOp(0x6C, I32, I32),
+	"i32.div_s":           binaryOp(0x6D, I32, I32),
+	"i32.div_u":           binaryOp(0x6E, I32, I32),
+	"i32.rem_s":           binaryOp(0x6F, I32, I32),
+	"i32.rem_u":           binaryOp(0x70, I32, I32),
+	"i32.and":             binaryOp(0x71, I32, I32),
+	"i32.or":              binaryOp(0x72, I32, I32),
+	"i32.xor":             binaryOp(0x73, I32, I32),
+	"i32.shl":             binaryOp(0x74, I32, I32),
+	"i32.shr_s":           binaryOp(0x75, I32, I32),
+	"i32.shr_u":           binaryOp(0x76, I32, I32),
+	"i64.add":             binaryOp(0x7C, I64, I64),
+	"i64.sub":             binaryOp(0x7D, I64, I64),
+	"i64.mul":             binaryOp(0x7E, I64, I64),
+	"i64.div_s":           binaryOp(0x7F, I64, I64),
+	"i64.div_u":           binaryOp(0x80, I64, I64),
+	"i64.rem_s":           binaryOp(0x81, I64, I64),
+	"i64.rem_u":           binaryOp(0x82, I64, I64),
+	"i64.and":             binaryOp(0x83, I64, I64),
+	"i64.or":              binaryOp(0x84, I64, I64),
+	"i64.xor":             binaryOp(0x85, I64, I64),
+	"i64.shl":             binaryOp(0x86, I64, I64),
+	"i64.shr_s":           binaryOp(0x87, I64, I64),
+	"i64.shr_u":           binaryOp(0x88, I64, I64),
+	"f64.neg":             unaryOp(0x9A, F64, F64),
+	"f64.add":             binaryOp(0xA0, F64, F64),
+	"f64.sub":             binaryOp(0xA1, F64, F64),
+	"f64.mul":             binaryOp(0xA2, F64, F64),
+	"f64.div":             binaryOp(0xA3, F64, F64),
+	"i32.wrap_i64":        unaryOp(0xA7, I64, I32),
+	"i64.extend_i32_s":    unaryOp(0xAC, I32, I64),
+	"i64.extend_i32_u":    unaryOp(0xAD, I32, I64),
+	"f64.convert_i64_s":   unaryOp(0xB9, I64, F64),
+	"f64.convert_i32_s":   unaryOp(0xB7, I32, F64),
+	"i64.reinterpret_f64": unaryOp(0xBD, F64, I64),
+	"f64.reinterpret_i64": unaryOp(0xBF, I64, F64),
+}
+
+// unaryOp, binaryOp, loadOp and storeOp build the table entries of plain instructions.
+func unaryOp(opcode byte, operand, result ValueType) operation {
+	return operation{opcode: opcode, pops: []ValueType{operand}, pushes: []ValueType{result}}
+}
+
+func binaryOp(opcode byte, operand, result ValueType) operation {
+	return operation{opcode: opcode, pops: []ValueType{operand, operand}, pushes: []ValueType{result}}
+}
+
+func loadOp(opcode byte, t ValueType, alignment uint32) operation {
+	return operation{opcode: opcode, immediate: immediateMemory, pops: []ValueType{I32}, pushes: []ValueType{t},
+		alignment: alignment}
+}
+
+func storeOp(opcode byte, t ValueType, alignment uint32) operation {
+	return operation{opcode: opcode, immediate: immediateMemory, pops: []ValueType{I32, t}, pushes: []ValueType{},
+		alignment: alignment}
+}
+
+const (
+	errUnknownInstruction = "line %d: unknown instruction '%s'"
+	errMissingImmediate   = "line %d: '%s' expects an immediate"
+	errUnknownName        = "line %d: unknown %s '%s'"
+	errDuplicateName      = "line %d: %s '%s' is already defined"
+	errDuplicateExport    = "line %d: export '%s' is already defined"
+	errStackUnderflow     = "line %d: '%s' expects a value on the stack"
+	errTypeMismatch       = "line %d: '%s' expects %s, got %s"
+	errUnbalancedStack    = "line %d: %d value(s) left on the stack at the end of the block"
+	errUnbalancedBlocks   = "line %d: 'end' without a matching block"
+	errUnclosedBlock      = "line %d: block is never closed"
+	errElseWithoutIf      = "line %d: 'else' outside of an 'if'"
+	errImmutableGlobal    = "line %d: global '%s' is immutable"
+	errMissingMemory      = "line %d: '%s' needs a memory"
+	errBadAlignment       = "line %d: alignment %d is larger than the natural alignment of '%s'"
+	errDataOutOfBounds    = "line %d: data segment does not fit in the initial memory"
+	errBadInitializer     = "line %d: the initializer of a global must be a constant of its type"
+)
+
+// Assemble :
+// Reads a module from its text format, validates it and returns its binary encoding. Validation follows the
+// WebAssembly specification for the supported subset: every name must resolve, and every instruction must find
+// operands of the right types on the stack. Blocks, loops and ifs have no parameters or results.
+func Assemble(source string) ([]byte, error) {
+	module, err := Parse(source)
+	if err != nil {
+		return nil, err
+	}
+
+	assembler, err := newAssembler(module)
+	if err != nil {
+		return nil, err
+	}
+	return assembler.encode()
+}
+
+// assembler :
+// Resolves the names of a module and encodes its sections.
+type assembler struct {
+	module    *Module
+	functions map[string]uint32
+	globals   map[string]uint32
+	// signatures holds every function, imports first, in the function index space
+	signatures []Signature
+	types      []Signature
+	typeIndex  map[string]uint32
+}
+
+// newAssembler :
+// Builds the index spaces of the module.
+func newAssembler(module *Module) (*assembler, error) {
+	assembler := &assembler{
+		module:    module,
+		functions: make(map[string]uint32),
+		globals:   make(map[string]uint32),
+		typeIndex: make(map[string]uint32),
+	}
+
+	define := func(names map[string]uint32, kind, name string, index uint32, line int) error {
+		if name == "" {
+			return nil
+		}
+		if _, ok := names[name]; ok {
+			return fmt.Errorf(errDuplicateName, line, kind, name)
+		}
+		names[name] = index
+		return nil
+	}
+
+	for _, imported := range module.Imports {
+		index := uint32(len(assembler.signatures))
+		if err := define(assembler.functions, "function", imported.Name, index, imported.Line); err != nil {
+			return nil, err
+		}
+		assembler.signatures = append(assembler.signatures, imported.Signature)
+	}
+	for _, function := range module.Functions {
+		index := uint32(len(assembler.signatures))
+		if err := define(assembler.functions, "function", function.Name, index, function.Line); err != nil {
+			return nil, err
+		}
+		assembler.signatures = append(assembler.signatures, function.signature())
+	}
+	for i, global := range module.Globals {
+		if err := define(assembler.globals, "global", global.Name, uint32(i), global.Line); err != nil {
+			return nil, err
+		}
+	}
+	return assembler, nil
+}
+
+// signature :
+// Returns the type of a function.
+func (function *Function) signature() Signature {
+	signature := Signature{Results: function.Results}
+	for _, param := range function.Params {
+		signature.Params = append(signature.Params, param.Type)
+	}
+	return signature
+}
+
+// typeOf :
+// Returns the index of a signature in the type section, adding it the first time.
+func (assembler *assembler) typeOf(signature Signature) uint32 {
+	key := fmt.Sprint(signature.Params, signature.Results)
+	if index, ok := assembler.typeIndex[key]; ok {
+		return index
+	}
+	index := uint32(len(assembler.types))
+	assembler.types = append(assembler.types, signature)
+	assembler.typeIndex[key] = index
+	return index
+}
+
+// resolve :
+// Returns the index a name or a number refers to.
+func resolve(names map[string]uint32, kind, reference string, limit int, line int) (uint32, error) {
+	if index, ok := names[reference]; ok {
+		return index, nil
+	}
+	if index, err := strconv.ParseUint(reference, 10, 32); err == nil && int(index) < limit {
+		return uint32(index), nil
+	}
+	return 0, fmt.Errorf(errUnknownName, line, kind, reference)
+}
+
+//**********************************************************************************************************************
+// Sections
+//**********************************************************************************************************************
+
+// encode :
+// Writes the binary module: the header followed by the type, import, function, memory, global, export, code and data
+// sections.
+func (assembler *assembler) encode() ([]byte, error) {
+	module := assembler.module
+
+	// Code comes first, since it validates the functions and fills the type section as a side effect
+	var code bytes.Buffer
+	writeU32(&code, uint32(len(module.Functions)))
+	for _, function := range module.Functions {
+		body, err := assembler.function(function)
+		if err != nil {
+			return nil, err
+		}
+		writeU32(&code, uint32(len(body)))
+		code.Write(body)
+	}
+
+	var imports bytes.Buffer
+	writeU32(&imports, uint32(len(module.Imports)))
+	for _, imported := range module.Imports {
+		writeName(&imports, imported.Module)
+		writeName(&imports, imported.Field)
+		imports.WriteByte(0x00)
+		writeU32(&imports, assembler.typeOf(imported.Signature))
+	}
+
+	var functions bytes.Buffer
+	writeU32(&functions, uint32(len(module.Functions)))
+	for _, function := range module.Functions {
+		writeU32(&functions, assembler.typeOf(function.signature()))
+	}
+
+	var types bytes.Buffer
+	writeU32(&types, uint32(len(assembler.types)))
+	for _, signature := range assembler.types {
+		types.WriteByte(0x60)
+		writeValueTypes(&types, signature.Params)
+		writeValueTypes(&types, signature.Results)
+	}
+
+	var memory bytes.Buffer
+	if module.Memory != nil {
+		writeU32(&memory, 1)
+		if module.Memory.Max == nil {
+			memory.WriteByte(0x00)
+			writeU32(&memory, module.Memory.Min)
+		} else {
+			memory.WriteByte(0x01)
+			writeU32(&memory, module.Memory.Min)
+			writeU32(&memory, *module.Memory.Max)
+		}
+	}
+
+	globals, err := assembler.globalSection()
+	if err != nil {
+		return nil, err
+	}
+	exports, err := assembler.exportSection()
+	if err != nil {
+		return nil, err
+	}
+	data, err := assembler.dataSection()
+	if err != nil {
+		return nil, err
+	}
+
+	var output bytes.Buffer
+	output.WriteString("\x00asm")
+	output.Write([]byte{0x01, 0x00, 0x00, 0x00})
+	writeSection(&output, 1, types.Bytes())
+	writeSection(&output, 2, imports.Bytes())
+	writeSection(&output, 3, functions.Bytes())
+	writeSection(&output, 5, memory.Bytes())
+	writeSection(&output, 6, globals)
+	writeSection(&output, 7, exports)
+	writeSection(&output, 10, code.Bytes())
+	writeSection(&output, 11, data)
+	return output.Bytes(), nil
+}
+
+// globalSection :
+// Encodes the globals and checks that each one starts with a constant of its type.
+func (assembler *assembler) globalSection() ([]byte, error) {
+	var section bytes.Buffer
+	writeU32(&section, uint32(len(assembler.module.Globals)))
+	for _, global := range assembler.module.Globals {
+		section.WriteByte(byte(global.Type))
+		if global.Mutable {
+			section.WriteByte(0x01)
+		} else {
+			section.WriteByte(0x00)
+		}
+
+		op := operations[global.Init.Name]
+		if op.immediate < immediateI32 || op.pushes[0] != global.Type {
+			return nil, fmt.Errorf(errBadInitializer, global.Line)
+		}
+		if err := constant(&section, op, global.Init); err != nil {
+			return nil, err
+		}
+		section.WriteByte(0x0B)
+	}
+	return section.Bytes(), nil
+}
+
+// exportSection :
+// Encodes the exports written inline and as module fields, checking that every name is unique.
+func (assembler *assembler) exportSection() ([]byte, error) {
+	module := assembler.module
+	var entries bytes.Buffer
+	count := uint32(0)
+	seen := make(map[string]bool)
+	add := func(name string, kind byte, index uint32, line int) error {
+		if seen[name] {
+			return fmt.Errorf(errDuplicateExport, line, name)
+		}
+		seen[name] = true
+		writeName(&entries, name)
+		entries.WriteByte(kind)
+		writeU32(&entries, index)
+		count++
+		return nil
+	}
+
+	for i, function := range module.Functions {
+		for _, name := range function.Exports {
+			if err := add(name, 0x00, uint32(len(module.Imports)+i), function.Line); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if module.Memory != nil {
+		for _, name := range module.Memory.Exports {
+			if err := add(name, 0x02, 0, module.Memory.Line); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for i, global := range module.Globals {
+		for _, name := range global.Exports {
+			if err := add(name, 0x03, uint32(i), global.Line); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for _, export := range module.Exports {
+		var kind byte
+		var index uint32
+		var err error
+		switch export.Kind {
+		case "func":
+			index, err = resolve(assembler.functions, "function", export.Index, len(assembler.signatures), export.Line)
+		case "memory":
+			kind = 0x02
+			if module.Memory == nil {
+				err = fmt.Errorf(errMissingMemory, export.Line, "export")
+			}
+		case "global":
+			kind = 0x03
+			index, err = resolve(assembler.globals, "global", export.Index, len(module.Globals), export.Line)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err := add(export.Name, kind, index, export.Line); err != nil {
+			return nil, err
+		}
+	}
+
+	var section bytes.Buffer
+	writeU32(&section, count)
+	section.Write(entries.Bytes())
+	return section.Bytes(), nil
+}
+
+// dataSection :
+// Encodes the data segments and checks that they fit in the initial memory.
+func (assembler *assembler) dataSection() ([]byte, error) {
+	var section bytes.Buffer
+	writeU32(&section, uint32(len(assembler.module.Data)))
+	for _, data := range assembler.module.Data {
+		memory := assembler.module.Memory
+		if memory == nil {
+			return nil, fmt.Errorf(errMissingMemory, data.Line, "data")
+		}
+		if uint64(data.Offset)+uint64(len(data.Bytes)) > uint64(memory.Min)*65536 {
+			return nil, fmt.Errorf(errDataOutOfBounds, data.Line)
+		}
+
+		section.WriteByte(0x00)
+		section.WriteByte(0x41)
+		writeS64(&section, int64(int32(data.Offset)))
+		section.WriteByte(0x0B)
+		writeU32(&section, uint32(len(data.Bytes)))
+		section.Write(data.Bytes)
+	}
+	return section.Bytes(), nil
+}
+
+//**********************************************************************************************************************
+// Functions
+//**********************************************************************************************************************
+
+// unknown is the type of a value popped from the stack of unreachable code, which matches any type.
+const unknown ValueType = 0
+
+// frame :
+// A block being validated: a block, loop or if, or the function itself at the bottom of the stack.
+type frame struct {
+	opcode byte
+	label  string
+	// results are the types the block leaves on the stack, and the types a branch to it carries unless it is a loop
+	results     []ValueType
+	height      int
+	unreachable bool
+	line        int
+}
+
+// validator :
+// The state of the function being validated.
+type validator struct {
+	assembler *assembler
+	function  *Function
+	locals    []Local
+	names     map[string]uint32
+	stack     []ValueType
+	frames    []frame
+	code      bytes.Buffer
+}
+
+// function :
+// Validates a function and returns its encoded body: the locals followed by the instructions.
+func (assembler *assembler) function(function *Function) ([]byte, error) {
+	v := &validator{
+		assembler: assembler,
+		function:  function,
+		locals:    append(append([]Local{}, function.Params...), function.Locals...),
+		names:     make(map[string]uint32),
+	}
+	for i, local := range v.locals {
+		if local.Name == "" {
+			continue
+		}
+		if _, ok := v.names[local.Name]; ok {
+			return nil, fmt.Errorf(errDuplicateName, function.Line, "local", local.Name)
+		}
+		v.names[local.Name] = uint32(i)
+	}
+
+	// Locals are written as runs of the same type
+	var runs [][2]uint32
+	for _, local := range function.Locals {
+		if len(runs) > 0 && runs[len(runs)-1][1] == uint32(local.Type) {
+			runs[len(runs)-1][0]++
+			continue
+		}
+		runs = append(runs, [2]uint32{1, uint32(local.Type)})
+	}
+	writeU32(&v.code, uint32(len(runs)))
+	for _, run := range runs {
+		writeU32(&v.code, run[0])
+		v.code.WriteByte(byte(run[1]))
+	}
+
+	v.frames = []frame{{opcode: 0x00, results: function.Results, line: function.Line}}
+	for _, instruction := range function.Body {
+		if err := v.instruction(instruction); err != nil {
+			return nil, err
+		}
+	}
+	if len(v.frames) != 1 {
+		return nil, fmt.Errorf(errUnclosedBlock, v.frames[len(v.frames)-1].line)
+	}
+	// The implicit end of the function
+	if err := v.end(Instruction{Name: "end", Line: function.Line}); err != nil {
+		return nil, err
+	}
+	v.code.WriteByte(0x0B)
+	return v.code.Bytes(), nil
+}
+
+// instruction :
+// Validates and encodes a single instruction.
+func (v *validator) instruction(instruction Instruction) error {
+	op := operations[instruction.Name]
+	line := instruction.Line
+
+	switch instruction.Name {
+	case "block", "loop", "if":
+		if instruction.Name == "if" {
+			if err := v.pop(instruction, I32); err != nil {
+				return err
+			}
+		}
+		label := ""
+		if len(instruction.Immediates) > 0 {
+			label = instruction.Immediates[0]
+		}
+		v.frames = append(v.frames, frame{opcode: op.opcode, label: label, height: len(v.stack), line: line})
+		v.code.WriteByte(op.opcode)
+		v.code.WriteByte(0x40)
+		return nil
+	case "else":
+		top := &v.frames[len(v.frames)-1]
+		if top.opcode != operations["if"].opcode || len(v.frames) == 1 {
+			return fmt.Errorf(errElseWithoutIf, line)
+		}
+		if err := v.balanced(instruction); err != nil {
+			return err
+		}
+		top.opcode = op.opcode
+		top.unreachable = false
+		v.code.WriteByte(op.opcode)
+		return nil
+	case "end":
+		if len(v.frames) == 1 {
+			return fmt.Errorf(errUnbalancedBlocks, line)
+		}
+		if err := v.end(instruction); err != nil {
+			return err
+		}
+		v.code.WriteByte(op.opcode)
+		return nil
+	case "br", "br_if":
+		depth, target, err := v.label(instruction)
+		if err != nil {
+			return err
+		}
+		if instruction.Name == "br_if" {
+			if err := v.pop(instruction, I32); err != nil {
+				return err
+			}
+		}
+		carried := target.results
+		if target.opcode == operations["loop"].opcode {
+			carried = nil
+		}
+		if err := v.popAll(instruction, carried); err != nil {
+			return err
+		}
+		if instruction.Name == "br" {
+			v.setUnreachable()
+		} else {
+			v.stack = append(v.stack, carried...)
+		}
+		v.code.WriteByte(op.opcode)
+		writeU32(&v.code, depth)
+		return nil
+	case "return":
+		if err := v.popAll(instruction, v.function.Results); err != nil {
+			return err
+		}
+		v.setUnreachable()
+		v.code.WriteByte(op.opcode)
+		return nil
+	case "unreachable":
+		v.setUnreachable()
+		v.code.WriteByte(op.opcode)
+		return nil
+	case "call":
+		index, err := resolve(v.assembler.functions, "function", instruction.Immediates[0],
+			len(v.assembler.signatures), line)
+		if err != nil {
+			return err
+		}
+		signature := v.assembler.signatures[index]
+		if err := v.popAll(instruction, signature.Params); err != nil {
+			return err
+		}
+		v.stack = append(v.stack, signature.Results...)
+		v.code.WriteByte(op.opcode)
+		writeU32(&v.code, index)
+		return nil
+	case "drop":
+		if _, err := v.popAny(instruction); err != nil {
+			return err
+		}
+		v.code.WriteByte(op.opcode)
+		return nil
+	case "select":
+		if err := v.pop(instruction, I32); err != nil {
+			return err
+		}
+		second, err := v.popAny(instruction)
+		if err != nil {
+			return err
+		}
+		first, err := v.popAny(instruction)
+		if err != nil {
+			return err
+		}
+		if first != unknown && second != unknown && first != second {
+			return fmt.Errorf(errTypeMismatch, line, instruction.Name, first, second)
+		}
+		if first == unknown {
+			first = second
+		}
+		v.stack = append(v.stack, first)
+		v.code.WriteByte(op.opcode)
+		return nil
+	case "local.get", "local.set", "local.tee":
+		index, err := resolve(v.names, "local", instruction.Immediates[0], len(v.locals), line)
+		if err != nil {
+			return err
+		}
+		t := v.locals[index].Type
+		if instruction.Name != "local.get" {
+			if err := v.pop(instruction, t); err != nil {
+				return err
+			}
+		}
+		if instruction.Name != "local.set" {
+			v.stack = append(v.stack, t)
+		}
+		v.code.WriteByte(op.opcode)
+		writeU32(&v.code, index)
+		return nil
+	case "global.get", "global.set":
+		globals := v.assembler.module.Globals
+		index, err := resolve(v.assembler.globals, "global", instruction.Immediates[0], len(globals), line)
+		if err != nil {
+			return err
+		}
+		global := globals[index]
+		if instruction.Name == "global.set" {
+			if !global.Mutable {
+				return fmt.Errorf(errImmutableGlobal, line, instruction.Immediates[0])
+			}
+			if err := v.pop(instruction, global.Type); err != nil {
+				return err
+			}
+		} else {
+			v.stack = append(v.stack, global.Type)
+		}
+		v.code.WriteByte(op.opcode)
+		writeU32(&v.code, index)
+		return nil
+	}
+
+	// Plain instructions: pop the operands, push the results and write the immediates
+	if err := v.popAll(instruction, op.pops); err != nil {
+		return err
+	}
+	v.stack = append(v.stack, op.pushes...)
+
+	switch {
+	case op.immediate >= immediateI32:
+		return constant(&v.code, op, instruction)
+	case op.immediate == immediateMemory:
+		v.code.WriteByte(op.opcode)
+		return v.memarg(instruction, op)
+	case instruction.Name == "memory.size" || instruction.Name == "memory.grow":
+		if v.assembler.module.Memory == nil {
+			return fmt.Errorf(errMissingMemory, line, instruction.Name)
+		}
+		v.code.WriteByte(op.opcode)
+		v.code.WriteByte(0x00)
+	default:
+		v.code.WriteByte(op.opcode)
+	}
+	return nil
+}
+
+// memarg :
+// Writes the alignment and offset of a memory access.
+func (v *validator) memarg(instruction Instruction, op operation) error {
+	if v.assembler.module.Memory == nil {
+		return fmt.Errorf(errMissingMemory, instruction.Line, instruction.Name)
+	}
+
+	alignment, offset := op.alignment, uint64(0)
+	for _, immediate := range instruction.Immediates {
+		key, value, _ := strings.Cut(immediate, "=")
+		number, err := strconv.ParseUint(strings.ReplaceAll(value, "_", ""), 0, 32)
+		if err != nil {
+			return fmt.Errorf(errBadNumber, instruction.Line, key, value)
+		}
+		if key == "offset" {
+			offset = number
+			continue
+		}
+		// align is given in bytes and must be a power of two no larger than the natural alignment
+		if number == 0 || number&(number-1) != 0 || number > 1<<op.alignment {
+			return fmt.Errorf(errBadAlignment, instruction.Line, number, instruction.Name)
+		}
+		alignment = 0
+		for 1<<alignment < number {
+			alignment++
+		}
+	}
+
+	writeU32(&v.code, alignment)
+	writeU32(&v.code, uint32(offset))
+	return nil
+}
+
+// label :
+// Resolves the target of a branch, given as a name or a relative depth.
+func (v *validator) label(instruction Instruction) (uint32, frame, error) {
+	reference := instruction.Immediates[0]
+	for depth := 0; depth < len(v.frames); depth++ {
+		target := v.frames[len(v.frames)-1-depth]
+		if target.label != "" && target.label == reference {
+			return uint32(depth), target, nil
+		}
+	}
+	if depth, err := strconv.ParseUint(reference, 10, 32); err == nil && int(depth) < len(v.frames) {
+		return uint32(depth), v.frames[len(v.frames)-1-int(depth)], nil
+	}
+	return 0, frame{}, fmt.Errorf(errUnknownName, instruction.Line, "label", reference)
+}
+
+// end :
+// Closes the innermost block, checking that it leaves exactly its results on the stack.
+func (v *validator) end(instruction Instruction) error {
+	top := v.frames[len(v.frames)-1]
+	if err := v.popAll(instruction, top.results); err != nil {
+		return err
+	}
+	if err := v.balanced(instruction); err != nil {
+		return err
+	}
+	v.frames = v.frames[:len(v.frames)-1]
+	v.stack = append(v.stack, top.results...)
+	return nil
+}
+
+// balanced :
+// Checks that nothing is left on the stack of the innermost block, then resets it for the next branch of an if.
+func (v *validator) balanced(instruction Instruction) error {
+	top := v.frames[len(v.frames)-1]
+	if len(v.stack) != top.height {
+		return fmt.Errorf(errUnbalancedStack, instruction.Line, len(v.stack)-top.height)
+	}
+	return nil
+}
+
+// setUnreachable :
+// Marks the rest of the innermost block as unreachable. Its stack is dropped and becomes polymorphic.
+func (v *validator) setUnreachable() {
+	top := &v.frames[len(v.frames)-1]
+	v.stack = v.stack[:top.height]
+	top.unreachable = true
+}
+
+// pop :
+// Pops a value of the expected type.
+func (v *validator) pop(instruction Instruction, expected ValueType) error {
+	actual, err := v.popAny(instruction)
+	if err != nil {
+		return err
+	}
+	if actual != unknown && actual != expected {
+		return fmt.Errorf(errTypeMismatch, instruction.Line, instruction.Name, expected, actual)
+	}
+	return nil
+}
+
+// popAll :
+// Pops values of the expected types, the last one first.
+func (v *validator) popAll(instruction Instruction, expected []ValueType) error {
+	for i := len(expected) - 1; i >= 0; i-- {
+		if err := v.pop(instruction, expected[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// popAny :
+// Pops a value of any type. In unreachable code an empty stack yields unknown values.
+func (v *validator) popAny(instruction Instruction) (ValueType, error) {
+	top := v.frames[len(v.frames)-1]
+	if len(v.stack) == top.height {
+		if top.unreachable {
+			return unknown, nil
+		}
+		return unknown, fmt.Errorf(errStackUnderflow, instruction.Line, instruction.Name)
+	}
+	t := v.stack[len(v.stack)-1]
+	v.stack = v.stack[:len(v.stack)-1]
+	return t, nil
+}
+
+//**********************************************************************************************************************
+// Encoding helpers
+//**********************************************************************************************************************
+
+// constant :
+// Writes an i32.const, i64.const or f64.const instruction.
+func constant(w *bytes.Buffer, op operation, instruction Instruction) error {
+	text := instruction.Immediates[0]
+	w.WriteByte(op.opcode)
+	switch op.immediate {
+	case immediateI32:
+		value, err := parseInt(text, 32)
+		if err != nil {
+			return fmt.Errorf(errBadNumber, instruction.Line, "i32", text)
+		}
+		writeS64(w, value)
+	case immediateI64:
+		value, err := parseInt(text, 64)
+		if err != nil {
+			return fmt.Errorf(errBadNumber, instruction.Line, "i64", text)
+		}
+		writeS64(w, value)
+	case immediateF64:
+		value, err := parseFloat(text)
+		if err != nil {
+			return fmt.Errorf(errBadNumber, instruction.Line, "f64", text)
+		}
+		var bits [8]byte
+		binary.LittleEndian.PutUint64(bits[:], math.Float64bits(value))
+		w.Write(bits[:])
+	}
+	return nil
+}
+
+// writeSection :
+// Writes a section with its id and size. Sections whose vector is empty, or that have no content at all, are left out.
+func writeSection(w *bytes.Buffer, id byte, content []byte) {
+	if len(content) == 0 || content[0] == 0x00 {
+		return
+	}
+	w.WriteByte(id)
+	writeU32(w, uint32(len(content)))
+	w.Write(content)
+}
+
+// writeValueTypes :
+// Writes a vector of value types.
+func writeValueTypes(w *bytes.Buffer, types []ValueType) {
+	writeU32(w, uint32(len(types)))
+	for _, t := range types {
+		w.WriteByte(byte(t))
+	}
+}
+
+// writeName :
+// Writes a UTF-8 name with its length.
+func writeName(w *bytes.Buffer, name string) {
+	writeU32(w, uint32(len(name)))
+	w.WriteString(name)
+}
+
+// writeU32 :
+// Writes an unsigned LEB128 number.
+func writeU32(w *bytes.Buffer, value uint32) {
+	for {
+		b := byte(value & 0x7F)
+		value >>= 7
+		if value == 0 {
+			w.WriteByte(b)
+			return
+		}
+		w.WriteByte(b | 0x80)
+	}
+}
+
+// writeS64 :
+// Writes a signed LEB128 number.
+func writeS64(w *bytes.Buffer, value int64) {
+	for {
+		b := byte(value & 0x7F)
+		value >>= 7
+		if (value == 0 && b&0x40 == 0) || (value == -1 && b&0x40 != 0) {
+			w.WriteByte(b)
+			return
+		}
+		w.WriteByte(b | 0x80)
+	}
+}
@@ -0,0 +1,756 @@
+package wat
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// ValueType :
+// A WebAssembly value type, using its binary encoding.
+type ValueType byte
+
+const (
+	I32 ValueType = 0x7F
+	I64 ValueType = 0x7E
+	F32 ValueType = 0x7D
+	F64 ValueType = 0x7C
+)
+
+// String :
+// Returns the text name of the value type.
+func (t ValueType) String() string {
+	switch t {
+	case I32:
+		return "i32"
+	case I64:
+		return "i64"
+	case F32:
+		return "f32"
+	case F64:
+		return "f64"
+	default:
+		return "unknown"
+	}
+}
+
+// Module :
+// The fields of a module read from its text format. Names are kept as written and only resolved by Assemble.
+type Module struct {
+	Imports   []*Import
+	Functions []*Function
+	Globals   []*Global
+	Memory    *Memory
+	Data      []*Data
+	Exports   []*Export
+}
+
+// Signature :
+// The parameters and results of a function.
+type Signature struct {
+	Params  []ValueType
+	Results []ValueType
+}
+
+// Import :
+// A function provided by the host.
+type Import struct {
+	Module    string
+	Field     string
+	Name      string
+	Signature Signature
+	Line      int
+}
+
+// Function :
+// A function defined by the module. Params and Locals share the index space of locals, parameters first.
+type Function struct {
+	Name    string
+	Exports []string
+	Params  []Local
+	Results []ValueType
+	Locals  []Local
+	Body    []Instruction
+	Line    int
+}
+
+// Local :
+// A parameter or local of a function. Name is empty when it is only reachable by index.
+type Local struct {
+	Name string
+	Type ValueType
+}
+
+// Instruction :
+// A plain instruction with its immediates as written, such as "local.get $x" or "i32.load offset=4".
+type Instruction struct {
+	Name       string
+	Immediates []string
+	Line       int
+}
+
+// Global :
+// A global variable and the constant it starts with.
+type Global struct {
+	Name    string
+	Exports []string
+	Type    ValueType
+	Mutable bool
+	Init    Instruction
+	Line    int
+}
+
+// Memory :
+// The linear memory of the module, sized in 64 KiB pages.
+type Memory struct {
+	Name    string
+	Exports []string
+	Min     uint32
+	Max     *uint32
+	Line    int
+}
+
+// Data :
+// Bytes copied into the memory at the given offset when the module is instantiated.
+type Data struct {
+	Offset uint32
+	Bytes  []byte
+	Line   int
+}
+
+// Export :
+// An export given as a module field, such as (export "main" (func $main)).
+type Export struct {
+	Name  string
+	Kind  string
+	Index string
+	Line  int
+}
+
+const (
+	errUnexpectedEnd       = "line %d: unexpected end of input"
+	errUnexpectedToken     = "line %d: unexpected '%s'"
+	errUnterminatedString  = "line %d: unterminated string"
+	errUnterminatedComment = "line %d: unterminated block comment"
+	errBadEscape           = "line %d: invalid escape '\\%s' in string"
+	errExpectedModule      = "line %d: expected a single (module ...)"
+	errUnknownField        = "line %d: unknown module field '%s'"
+	errExpected            = "line %d: expected %s"
+	errUnknownType         = "line %d: unknown value type '%s'"
+	errFoldedInstruction   = "line %d: folded instructions are not supported, write them in plain order"
+	errDuplicateMemory     = "line %d: only one memory is supported"
+	errBadNumber           = "line %d: invalid %s '%s'"
+)
+
+//**********************************************************************************************************************
+// S-expressions
+//**********************************************************************************************************************
+
+// node :
+// An atom, a string or a parenthesized list of nodes.
+type node struct {
+	atom   string
+	str    bool
+	list   []*node
+	isList bool
+	line   int
+}
+
+// keyword :
+// Returns the atom a list starts with, or "" when it starts with anything else.
+func (n *node) keyword() string {
+	if !n.isList || len(n.list) == 0 || n.list[0].isList || n.list[0].str {
+		return ""
+	}
+	return n.list[0].atom
+}
+
+// describe :
+// Returns a short text for error messages.
+func (n *node) describe() string {
+	switch {
+	case n.isList:
+		return "(" + n.keyword()
+	case n.str:
+		return strconv.Quote(n.atom)
+	default:
+		return n.atom
+	}
+}
+
+// scanner :
+// Splits the text format into nodes. Line comments (;; ...) and block comments ((; ... ;)) are skipped.
+type scanner struct {
+	source string
+	offset int
+	line   int
+}
+
+// parseNodes :
+// Reads every top-level node of the source.
+func parseNodes(source string) ([]*node, error) {
+	s := scanner{source: source, line: 1}
+	var nodes []*node
+	for {
+		if err := s.skip(); err != nil {
+			return nil, err
+		}
+		if s.offset >= len(s.source) {
+			return nodes, nil
+		}
+		n, err := s.node()
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, n)
+	}
+}
+
+// skip :
+// Moves past whitespace and comments.
+func (s *scanner) skip() error {
+	for s.offset < len(s.source) {
+		switch {
+		case s.source[s.offset] == '\n':
+			s.line++
+			s.offset++
+		case s.source[s.offset] == ' ' || s.source[s.offset] == '\t' || s.source[s.offset] == '\r':
+			s.offset++
+		case strings.HasPrefix(s.source[s.offset:], ";;"):
+			for s.offset < len(s.source) && s.source[s.offset] != '\n' {
+				s.offset++
+			}
+		case strings.HasPrefix(s.source[s.offset:], "(;"):
+			start := s.line
+			end := strings.Index(s.source[s.offset:], ";)")
+			if end < 0 {
+				return fmt.Errorf(errUnterminatedComment, start)
+			}
+			s.line += strings.Count(s.source[s.offset:s.offset+end], "\n")
+			s.offset += end + 2
+		default:
+			return nil
+		}
+	}
+	return nil
+}
+
+// node :
+// Reads a single node starting at the current offset.
+func (s *scanner) node() (*node, error) {
+	line := s.line
+	switch s.source[s.offset] {
+	case '(':
+		s.offset++
+		list := &node{isList: true, line: line}
+		for {
+			if err := s.skip(); err != nil {
+				return nil, err
+			}
+			if s.offset >= len(s.source) {
+				return nil, fmt.Errorf(errUnexpectedEnd, s.line)
+			}
+			if s.source[s.offset] == ')' {
+				s.offset++
+				return list, nil
+			}
+			child, err := s.node()
+			if err != nil {
+				return nil, err
+			}
+			list.list = append(list.list, child)
+		}
+	case ')':
+		return nil, fmt.Errorf(errUnexpectedToken, line, ")")
+	case '"':
+		value, err := s.string()
+		if err != nil {
+			return nil, err
+		}
+		return &node{atom: value, str: true, line: line}, nil
+	default:
+		start := s.offset
+		for s.offset < len(s.source) && !strings.ContainsRune(" \t\r\n()\";", rune(s.source[s.offset])) {
+			s.offset++
+		}
+		if start == s.offset {
+			return nil, fmt.Errorf(errUnexpectedToken, line, s.source[s.offset:s.offset+1])
+		}
+		return &node{atom: s.source[start:s.offset], line: line}, nil
+	}
+}
+
+// string :
+// Reads a quoted string and decodes its escapes. Strings hold raw bytes, which is how data segments are written.
+func (s *scanner) string() (string, error) {
+	line := s.line
+	s.offset++
+	var builder strings.Builder
+	for {
+		if s.offset >= len(s.source) || s.source[s.offset] == '\n' {
+			return "", fmt.Errorf(errUnterminatedString, line)
+		}
+		c := s.source[s.offset]
+		s.offset++
+		switch c {
+		case '"':
+			return builder.String(), nil
+		case '\\':
+			if s.offset >= len(s.source) {
+				return "", fmt.Errorf(errUnterminatedString, line)
+			}
+			escape := s.source[s.offset]
+			s.offset++
+			switch escape {
+			case 'n':
+				builder.WriteByte('\n')
+			case 't':
+				builder.WriteByte('\t')
+			case 'r':
+				builder.WriteByte('\r')
+			case '"', '\'', '\\':
+				builder.WriteByte(escape)
+			case 'u':
+				end := strings.IndexByte(s.source[s.offset:], '}')
+				if !strings.HasPrefix(s.source[s.offset:], "{") || end < 0 {
+					return "", fmt.Errorf(errBadEscape, line, "u")
+				}
+				code, err := strconv.ParseUint(s.source[s.offset+1:s.offset+end], 16, 32)
+				if err != nil || !utf8.ValidRune(rune(code)) {
+					return "", fmt.Errorf(errBadEscape, line, "u"+s.source[s.offset:s.offset+end+1])
+				}
+				builder.WriteRune(rune(code))
+				s.offset += end + 1
+			default:
+				if s.offset >= len(s.source) {
+					return "", fmt.Errorf(errUnterminatedString, line)
+				}
+				value, err := strconv.ParseUint(s.source[s.offset-1:s.offset+1], 16, 8)
+				if err != nil {
+					return "", fmt.Errorf(errBadEscape, line, s.source[s.offset-1:s.offset+1])
+				}
+				builder.WriteByte(byte(value))
+				s.offset++
+			}
+		default:
+			builder.WriteByte(c)
+		}
+	}
+}
+
+//**********************************************************************************************************************
+// Module fields
+//**********************************************************************************************************************
+
+// Parse :
+// Reads a module from its text format. Only the subset needed by the compiler is supported: function imports,
+// functions written as plain instruction sequences, one memory, globals, active data segments and exports.
+func Parse(source string) (*Module, error) {
+	nodes, err := parseNodes(source)
+	if err != nil {
+		return nil, err
+	}
+	if len(nodes) != 1 || nodes[0].keyword() != "module" {
+		line := 1
+		if len(nodes) > 0 {
+			line = nodes[0].line
+		}
+		return nil, fmt.Errorf(errExpectedModule, line)
+	}
+
+	module := &Module{}
+	fields := nodes[0].list[1:]
+	if len(fields) > 0 && isName(fields[0]) {
+		fields = fields[1:]
+	}
+	for _, field := range fields {
+		if err := module.field(field); err != nil {
+			return nil, err
+		}
+	}
+	return module, nil
+}
+
+// field :
+// Reads a single module field.
+func (module *Module) field(field *node) error {
+	switch field.keyword() {
+	case "import":
+		return module.importField(field)
+	case "func":
+		return module.function(field)
+	case "memory":
+		return module.memory(field)
+	case "global":
+		return module.global(field)
+	case "data":
+		return module.data(field)
+	case "export":
+		return module.export(field)
+	default:
+		return fmt.Errorf(errUnknownField, field.line, field.describe())
+	}
+}
+
+// importField :
+// Reads (import "module" "field" (func $name (param ...) (result ...))).
+func (module *Module) importField(field *node) error {
+	if len(field.list) != 4 || !field.list[1].str || !field.list[2].str || field.list[3].keyword() != "func" {
+		return fmt.Errorf(errExpected, field.line, `(import "module" "field" (func ...))`)
+	}
+
+	imported := &Import{Module: field.list[1].atom, Field: field.list[2].atom, Line: field.line}
+	items := field.list[3].list[1:]
+	if len(items) > 0 && isName(items[0]) {
+		imported.Name = items[0].atom
+		items = items[1:]
+	}
+	for _, item := range items {
+		switch item.keyword() {
+		case "param":
+			params, err := locals(item)
+			if err != nil {
+				return err
+			}
+			for _, param := range params {
+				imported.Signature.Params = append(imported.Signature.Params, param.Type)
+			}
+		case "result":
+			results, err := valueTypes(item.list[1:])
+			if err != nil {
+				return err
+			}
+			imported.Signature.Results = append(imported.Signature.Results, results...)
+		default:
+			return fmt.Errorf(errUnexpectedToken, item.line, item.describe())
+		}
+	}
+
+	module.Imports = append(module.Imports, imported)
+	return nil
+}
+
+// function :
+// Reads (func $name (export "name")* (param ...)* (result ...)* (local ...)* instructions...).
+func (module *Module) function(field *node) error {
+	function := &Function{Line: field.line}
+	items := field.list[1:]
+	if len(items) > 0 && isName(items[0]) {
+		function.Name = items[0].atom
+		items = items[1:]
+	}
+
+	for len(items) > 0 && items[0].isList {
+		item := items[0]
+		switch item.keyword() {
+		case "export":
+			name, err := exportName(item)
+			if err != nil {
+				return err
+			}
+			function.Exports = append(function.Exports, name)
+		case "param":
+			params, err := locals(item)
+			if err != nil {
+				return err
+			}
+			function.Params = append(function.Params, params...)
+		case "result":
+			results, err := valueTypes(item.list[1:])
+			if err != nil {
+				return err
+			}
+			function.Results = append(function.Results, results...)
+		case "local":
+			variables, err := locals(item)
+			if err != nil {
+				return err
+			}
+			function.Locals = append(function.Locals, variables...)
+		default:
+			return fmt.Errorf(errFoldedInstruction, item.line)
+		}
+		items = items[1:]
+	}
+
+	body, err := instructions(items)
+	if err != nil {
+		return err
+	}
+	function.Body = body
+
+	module.Functions = append(module.Functions, function)
+	return nil
+}
+
+// memory :
+// Reads (memory $name (export "name")* min max?).
+func (module *Module) memory(field *node) error {
+	if module.Memory != nil {
+		return fmt.Errorf(errDuplicateMemory, field.line)
+	}
+
+	memory := &Memory{Line: field.line}
+	items := field.list[1:]
+	if len(items) > 0 && isName(items[0]) {
+		memory.Name = items[0].atom
+		items = items[1:]
+	}
+	for len(items) > 0 && items[0].keyword() == "export" {
+		name, err := exportName(items[0])
+		if err != nil {
+			return err
+		}
+		memory.Exports = append(memory.Exports, name)
+		items = items[1:]
+	}
+
+	if len(items) == 0 || len(items) > 2 {
+		return fmt.Errorf(errExpected, field.line, "the page limits of the memory")
+	}
+	for i, item := range items {
+		pages, err := strconv.ParseUint(item.atom, 10, 16)
+		if err != nil || item.isList || item.str || pages > 65536 {
+			return fmt.Errorf(errBadNumber, item.line, "page count", item.describe())
+		}
+		value := uint32(pages)
+		if i == 0 {
+			memory.Min = value
+		} else {
+			memory.Max = &value
+		}
+	}
+
+	module.Memory = memory
+	return nil
+}
+
+// global :
+// Reads (global $name (export "name")* type (const instruction)), where type is a value type or (mut type).
+func (module *Module) global(field *node) error {
+	global := &Global{Line: field.line}
+	items := field.list[1:]
+	if len(items) > 0 && isName(items[0]) {
+		global.Name = items[0].atom
+		items = items[1:]
+	}
+	for len(items) > 0 && items[0].keyword() == "export" {
+		name, err := exportName(items[0])
+		if err != nil {
+			return err
+		}
+		global.Exports = append(global.Exports, name)
+		items = items[1:]
+	}
+
+	if len(items) != 2 {
+		return fmt.Errorf(errExpected, field.line, "a type and an initializer for the global")
+	}
+	typeNode := items[0]
+	if typeNode.keyword() == "mut" && len(typeNode.list) == 2 {
+		global.Mutable = true
+		typeNode = typeNode.list[1]
+	}
+	t, err := valueType(typeNode)
+	if err != nil {
+		return err
+	}
+	global.Type = t
+
+	init, err := instructions(items[1].list)
+	if !items[1].isList || err != nil || len(init) != 1 {
+		return fmt.Errorf(errExpected, items[1].line, "a constant initializer such as (i32.const 0)")
+	}
+	global.Init = init[0]
+
+	module.Globals = append(module.Globals, global)
+	return nil
+}
+
+// data :
+// Reads (data (i32.const offset) "bytes"*).
+func (module *Module) data(field *node) error {
+	if len(field.list) < 2 || field.list[1].keyword() != "i32.const" || len(field.list[1].list) != 2 {
+		return fmt.Errorf(errExpected, field.line, "(data (i32.const offset) ...)")
+	}
+	offset, err := parseInt(field.list[1].list[1].atom, 32)
+	if err != nil || offset < 0 {
+		return fmt.Errorf(errBadNumber, field.line, "data offset", field.list[1].list[1].describe())
+	}
+
+	data := &Data{Offset: uint32(offset), Line: field.line}
+	for _, item := range field.list[2:] {
+		if !item.str {
+			return fmt.Errorf(errExpected, item.line, "a string")
+		}
+		data.Bytes = append(data.Bytes, item.atom...)
+	}
+
+	module.Data = append(module.Data, data)
+	return nil
+}
+
+// export :
+// Reads (export "name" (func|memory|global index)).
+func (module *Module) export(field *node) error {
+	if len(field.list) != 3 || !field.list[1].str || len(field.list[2].list) != 2 {
+		return fmt.Errorf(errExpected, field.line, `(export "name" (kind index))`)
+	}
+	kind := field.list[2].keyword()
+	if kind != "func" && kind != "memory" && kind != "global" {
+		return fmt.Errorf(errUnexpectedToken, field.line, kind)
+	}
+
+	module.Exports = append(module.Exports, &Export{
+		Name:  field.list[1].atom,
+		Kind:  kind,
+		Index: field.list[2].list[1].atom,
+		Line:  field.line,
+	})
+	return nil
+}
+
+//**********************************************************************************************************************
+// Helpers
+//**********************************************************************************************************************
+
+// instructions :
+// Reads a plain sequence of instructions. The immediates of each one are collected according to the operation
+// table, so "local.get $x" becomes a single instruction.
+func instructions(items []*node) ([]Instruction, error) {
+	var body []Instruction
+	for i := 0; i < len(items); i++ {
+		item := items[i]
+		if item.isList {
+			return nil, fmt.Errorf(errFoldedInstruction, item.line)
+		}
+		if item.str {
+			return nil, fmt.Errorf(errUnexpectedToken, item.line, item.describe())
+		}
+
+		instruction := Instruction{Name: item.atom, Line: item.line}
+		op, ok := operations[item.atom]
+		if !ok {
+			return nil, fmt.Errorf(errUnknownInstruction, item.line, item.atom)
+		}
+
+		next := func() bool { return i+1 < len(items) && !items[i+1].isList && !items[i+1].str }
+		switch op.immediate {
+		case immediateBlock:
+			// An optional label, such as "block $done"
+			if next() && strings.HasPrefix(items[i+1].atom, "$") {
+				instruction.Immediates = append(instruction.Immediates, items[i+1].atom)
+				i++
+			}
+		case immediateMemory:
+			for next() && (strings.HasPrefix(items[i+1].atom, "offset=") || strings.HasPrefix(items[i+1].atom, "align=")) {
+				instruction.Immediates = append(instruction.Immediates, items[i+1].atom)
+				i++
+			}
+		case immediateNone:
+		default:
+			if !next() {
+				return nil, fmt.Errorf(errMissingImmediate, item.line, item.atom)
+			}
+			instruction.Immediates = append(instruction.Immediates, items[i+1].atom)
+			i++
+		}
+		body = append(body, instruction)
+	}
+	return body, nil
+}
+
+// locals :
+// Reads (param $name type), (param type*) or the same forms of local.
+func locals(item *node) ([]Local, error) {
+	items := item.list[1:]
+	if len(items) == 2 && isName(items[0]) {
+		t, err := valueType(items[1])
+		if err != nil {
+			return nil, err
+		}
+		return []Local{{Name: items[0].atom, Type: t}}, nil
+	}
+
+	types, err := valueTypes(items)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]Local, 0, len(types))
+	for _, t := range types {
+		result = append(result, Local{Type: t})
+	}
+	return result, nil
+}
+
+// valueTypes :
+// Reads a list of value types.
+func valueTypes(items []*node) ([]ValueType, error) {
+	types := make([]ValueType, 0, len(items))
+	for _, item := range items {
+		t, err := valueType(item)
+		if err != nil {
+			return nil, err
+		}
+		types = append(types, t)
+	}
+	return types, nil
+}
+
+// valueType :
+// Reads a single value type.
+func valueType(item *node) (ValueType, error) {
+	if !item.isList && !item.str {
+		switch item.atom {
+		case "i32":
+			return I32, nil
+		case "i64":
+			return I64, nil
+		case "f32":
+			return F32, nil
+		case "f64":
+			return F64, nil
+		}
+	}
+	return 0, fmt.Errorf(errUnknownType, item.line, item.describe())
+}
+
+// exportName :
+// Reads the name of (export "name").
+func exportName(item *node) (string, error) {
+	if len(item.list) != 2 || !item.list[1].str {
+		return "", fmt.Errorf(errExpected, item.line, `(export "name")`)
+	}
+	return item.list[1].atom, nil
+}
+
+// isName :
+// Checks if a node is a symbolic name such as $main.
+func isName(n *node) bool {
+	return !n.isList && !n.str && strings.HasPrefix(n.atom, "$") && len(n.atom) > 1
+}
+
+// parseInt :
+// Reads an integer literal of the given width. Both signed and unsigned forms are accepted, so -1 and 0xFFFFFFFF
+// are the same i32; the result is sign-extended from the given width.
+func parseInt(text string, bits int) (int64, error) {
+	text = strings.ReplaceAll(text, "_", "")
+	if signed, err := strconv.ParseInt(text, 0, bits); err == nil {
+		return signed, nil
+	}
+	unsigned, err := strconv.ParseUint(strings.TrimPrefix(text, "+"), 0, bits)
+	if err != nil {
+		return 0, err
+	}
+	// Reinterpret the unsigned value in two's complement
+	shift := 64 - bits
+	return int64(unsigned<<shift) >> shift, nil
+}
+
+// parseFloat :
+// Reads a float literal, including inf, nan and hexadecimal floats.
+func parseFloat(text string) (float64, error) {
+	text = strings.ReplaceAll(text, "_", "")
+	return strconv.ParseFloat(text, 64)
+}
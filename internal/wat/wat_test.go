@@ -0,0 +1,170 @@
+package wat
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// TestAssemble_Add checks the exact encoding of a small module against the bytes written by the reference tools.
+func TestAssemble_Add(t *testing.T) {
+	source := `;; Adds its two parameters.
+(module
+  (func $add (export "add") (param $a i32) (param $b i32) (result i32)
+    local.get $a
+    local.get $b
+    i32.add))`
+
+	expected := []byte{
+		0x00, 0x61, 0x73, 0x6D, 0x01, 0x00, 0x00, 0x00,
+		// Type section: (i32, i32) -> i32
+		0x01, 0x07, 0x01, 0x60, 0x02, 0x7F, 0x7F, 0x01, 0x7F,
+		// Function section
+		0x03, 0x02, 0x01, 0x00,
+		// Export section: "add" is function 0
+		0x07, 0x07, 0x01, 0x03, 0x61, 0x64, 0x64, 0x00, 0x00,
+		// Code section
+		0x0A, 0x09, 0x01, 0x07, 0x00, 0x20, 0x00, 0x20, 0x01, 0x6A, 0x0B,
+	}
+
+	module, err := Assemble(source)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !bytes.Equal(module, expected) {
+		t.Errorf("expected\n% x\ngot\n% x", expected, module)
+	}
+}
+
+// TestAssemble_Module checks that a module using every kind of field and the structured instructions is accepted.
+func TestAssemble_Module(t *testing.T) {
+	source := `(module
+  (import "host" "print" (func $print (param i64)))
+  (memory (export "memory") 1)
+  (global $counter (mut i32) (i32.const 0))
+  (data (i32.const 8) "hi\00\n")
+  (func $loop (export "loop") (param $n i64) (result i64)
+    (local $sum i64)
+    block $done
+      loop $next
+        local.get $n
+        i64.eqz
+        br_if $done
+        local.get $sum
+        local.get $n
+        i64.add
+        local.set $sum
+        local.get $n
+        i64.const 1
+        i64.sub
+        local.set $n
+        br $next
+      end
+    end
+    global.get $counter
+    i32.const 1
+    i32.add
+    global.set $counter
+    i32.const 8
+    i32.load8_u offset=1
+    i32.eqz
+    if
+      local.get $sum
+      f64.convert_i64_s
+      f64.const 0.5
+      f64.mul
+      i64.reinterpret_f64
+      return
+    else
+      local.get $sum
+      call $print
+    end
+    local.get $sum))`
+
+	module, err := Assemble(source)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !bytes.HasPrefix(module, []byte("\x00asm\x01\x00\x00\x00")) {
+		t.Errorf("missing module header: % x", module[:8])
+	}
+}
+
+// TestAssemble_Errors checks the errors reported for modules that are not valid.
+func TestAssemble_Errors(t *testing.T) {
+	tests := map[string]struct {
+		source   string
+		expected string
+	}{
+		"type mismatch": {
+			source:   `(module (func (result i32) i64.const 1))`,
+			expected: "expects i32, got i64",
+		},
+		"values left": {
+			source:   `(module (func block i32.const 1 end))`,
+			expected: "left on the stack",
+		},
+		"unknown label": {
+			source:   `(module (func br $nowhere))`,
+			expected: "unknown label '$nowhere'",
+		},
+		"unknown local": {
+			source:   `(module (func local.get $x drop))`,
+			expected: "unknown local '$x'",
+		},
+		"unknown function": {
+			source:   `(module (func call $f))`,
+			expected: "unknown function '$f'",
+		},
+		"unknown instruction": {
+			source:   `(module (func nop frobnicate))`,
+			expected: "unknown instruction 'frobnicate'",
+		},
+		"folded instruction": {
+			source:   `(module (func (i32.add (i32.const 1) (i32.const 2)) drop))`,
+			expected: "folded instructions",
+		},
+		"missing memory": {
+			source:   `(module (func i32.const 0 i32.load drop))`,
+			expected: "needs a memory",
+		},
+		"data out of bounds": {
+			source:   `(module (memory 1) (data (i32.const 65535) "ab"))`,
+			expected: "does not fit",
+		},
+		"immutable global": {
+			source:   `(module (global $g i32 (i32.const 0)) (func i32.const 1 global.set $g))`,
+			expected: "is immutable",
+		},
+		"duplicate export": {
+			source:   `(module (func (export "a")) (func (export "a")))`,
+			expected: "already defined",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := Assemble(test.source)
+			if err == nil {
+				t.Fatal("expected an error, got nil")
+			}
+			if !strings.Contains(err.Error(), test.expected) {
+				t.Errorf("expected an error containing %q, got %q", test.expected, err.Error())
+			}
+		})
+	}
+}
+
+// TestAssemble_Unreachable checks that the stack is polymorphic after an unconditional branch.
+func TestAssemble_Unreachable(t *testing.T) {
+	source := `(module (func (result i64) i64.const 1 return i32.add))`
+
+	if _, err := Assemble(source); err == nil {
+		t.Fatal("expected an error, since i32.add leaves an i32 where an i64 is expected")
+	}
+
+	source = `(module (func (result i64) unreachable i64.add))`
+	if _, err := Assemble(source); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}